@@ -30,6 +30,7 @@ type MetricsReport struct {
 	System        *SystemMetrics         `protobuf:"bytes,4,opt,name=system,proto3" json:"system,omitempty"`
 	Interfaces    []*InterfaceMetrics    `protobuf:"bytes,5,rep,name=interfaces,proto3" json:"interfaces,omitempty"`
 	CustomMetrics map[string]float64     `protobuf:"bytes,6,rep,name=custom_metrics,json=customMetrics,proto3" json:"custom_metrics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	Events        []*Event               `protobuf:"bytes,7,rep,name=events,proto3" json:"events,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -106,6 +107,13 @@ func (x *MetricsReport) GetCustomMetrics() map[string]float64 {
 	return nil
 }
 
+func (x *MetricsReport) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
 type MetricsAck struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Received      bool                   `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
@@ -390,11 +398,87 @@ func (x *InterfaceMetrics) GetTxDrops() int64 {
 	return 0
 }
 
+type Event struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Severity      string                 `protobuf:"bytes,2,opt,name=severity,proto3" json:"severity,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Attributes    map[string]string      `protobuf:"bytes,5,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *Event) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
 var File_metrics_proto protoreflect.FileDescriptor
 
 const file_metrics_proto_rawDesc = "" +
 	"\n" +
-	"\rmetrics.proto\x12\x13ispmonitor.agent.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xa4\x03\n" +
+	"\rmetrics.proto\x12\x13ispmonitor.agent.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd8\x03\n" +
 	"\rMetricsReport\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1b\n" +
 	"\trouter_id\x18\x02 \x01(\tR\brouterId\x128\n" +
@@ -403,7 +487,8 @@ const file_metrics_proto_rawDesc = "" +
 	"\n" +
 	"interfaces\x18\x05 \x03(\v2%.ispmonitor.agent.v1.InterfaceMetricsR\n" +
 	"interfaces\x12\\\n" +
-	"\x0ecustom_metrics\x18\x06 \x03(\v25.ispmonitor.agent.v1.MetricsReport.CustomMetricsEntryR\rcustomMetrics\x1a@\n" +
+	"\x0ecustom_metrics\x18\x06 \x03(\v25.ispmonitor.agent.v1.MetricsReport.CustomMetricsEntryR\rcustomMetrics\x122\n" +
+	"\x06events\x18\a \x03(\v2\x1a.ispmonitor.agent.v1.EventR\x06events\x1a@\n" +
 	"\x12CustomMetricsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\"C\n" +
@@ -438,7 +523,18 @@ const file_metrics_proto_rawDesc = "" +
 	"\ttx_errors\x18\n" +
 	" \x01(\x03R\btxErrors\x12\x19\n" +
 	"\brx_drops\x18\v \x01(\x03R\arxDrops\x12\x19\n" +
-	"\btx_drops\x18\f \x01(\x03R\atxDropsBHZFgithub.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpbb\x06proto3"
+	"\btx_drops\x18\f \x01(\x03R\atxDrops\"\x96\x02\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x1a\n" +
+	"\bseverity\x18\x02 \x01(\tR\bseverity\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x128\n" +
+	"\ttimestamp\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12J\n" +
+	"\n" +
+	"attributes\x18\x05 \x03(\v2*.ispmonitor.agent.v1.Event.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01BHZFgithub.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpbb\x06proto3"
 
 var (
 	file_metrics_proto_rawDescOnce sync.Once
@@ -452,25 +548,30 @@ func file_metrics_proto_rawDescGZIP() []byte {
 	return file_metrics_proto_rawDescData
 }
 
-var file_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_metrics_proto_goTypes = []any{
 	(*MetricsReport)(nil),         // 0: ispmonitor.agent.v1.MetricsReport
 	(*MetricsAck)(nil),            // 1: ispmonitor.agent.v1.MetricsAck
 	(*SystemMetrics)(nil),         // 2: ispmonitor.agent.v1.SystemMetrics
 	(*InterfaceMetrics)(nil),      // 3: ispmonitor.agent.v1.InterfaceMetrics
-	nil,                           // 4: ispmonitor.agent.v1.MetricsReport.CustomMetricsEntry
-	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+	(*Event)(nil),                 // 4: ispmonitor.agent.v1.Event
+	nil,                           // 5: ispmonitor.agent.v1.MetricsReport.CustomMetricsEntry
+	nil,                           // 6: ispmonitor.agent.v1.Event.AttributesEntry
+	(*timestamppb.Timestamp)(nil), // 7: google.protobuf.Timestamp
 }
 var file_metrics_proto_depIdxs = []int32{
-	5, // 0: ispmonitor.agent.v1.MetricsReport.timestamp:type_name -> google.protobuf.Timestamp
+	7, // 0: ispmonitor.agent.v1.MetricsReport.timestamp:type_name -> google.protobuf.Timestamp
 	2, // 1: ispmonitor.agent.v1.MetricsReport.system:type_name -> ispmonitor.agent.v1.SystemMetrics
 	3, // 2: ispmonitor.agent.v1.MetricsReport.interfaces:type_name -> ispmonitor.agent.v1.InterfaceMetrics
-	4, // 3: ispmonitor.agent.v1.MetricsReport.custom_metrics:type_name -> ispmonitor.agent.v1.MetricsReport.CustomMetricsEntry
-	4, // [4:4] is the sub-list for method output_type
-	4, // [4:4] is the sub-list for method input_type
-	4, // [4:4] is the sub-list for extension type_name
-	4, // [4:4] is the sub-list for extension extendee
-	0, // [0:4] is the sub-list for field type_name
+	5, // 3: ispmonitor.agent.v1.MetricsReport.custom_metrics:type_name -> ispmonitor.agent.v1.MetricsReport.CustomMetricsEntry
+	4, // 4: ispmonitor.agent.v1.MetricsReport.events:type_name -> ispmonitor.agent.v1.Event
+	7, // 5: ispmonitor.agent.v1.Event.timestamp:type_name -> google.protobuf.Timestamp
+	6, // 6: ispmonitor.agent.v1.Event.attributes:type_name -> ispmonitor.agent.v1.Event.AttributesEntry
+	7, // [7:7] is the sub-list for method output_type
+	7, // [7:7] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_metrics_proto_init() }
@@ -484,7 +585,7 @@ func file_metrics_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_metrics_proto_rawDesc), len(file_metrics_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
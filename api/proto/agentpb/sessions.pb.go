@@ -30,6 +30,7 @@ type SessionReport struct {
 	PppoeSessions []*PPPoESession        `protobuf:"bytes,4,rep,name=pppoe_sessions,json=pppoeSessions,proto3" json:"pppoe_sessions,omitempty"`
 	NatSessions   []*NATSession          `protobuf:"bytes,5,rep,name=nat_sessions,json=natSessions,proto3" json:"nat_sessions,omitempty"`
 	DhcpLeases    []*DHCPLease           `protobuf:"bytes,6,rep,name=dhcp_leases,json=dhcpLeases,proto3" json:"dhcp_leases,omitempty"`
+	NatTopSources []*NATTopSource        `protobuf:"bytes,7,rep,name=nat_top_sources,json=natTopSources,proto3" json:"nat_top_sources,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -106,6 +107,13 @@ func (x *SessionReport) GetDhcpLeases() []*DHCPLease {
 	return nil
 }
 
+func (x *SessionReport) GetNatTopSources() []*NATTopSource {
+	if x != nil {
+		return x.NatTopSources
+	}
+	return nil
+}
+
 type SessionReportResponse struct {
 	state             protoimpl.MessageState `protogen:"open.v1"`
 	Success           bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -458,11 +466,71 @@ func (x *DHCPLease) GetStatus() string {
 	return ""
 }
 
+type NATTopSource struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Address       string                 `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Connections   int32                  `protobuf:"varint,3,opt,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NATTopSource) Reset() {
+	*x = NATTopSource{}
+	mi := &file_sessions_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NATTopSource) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NATTopSource) ProtoMessage() {}
+
+func (x *NATTopSource) ProtoReflect() protoreflect.Message {
+	mi := &file_sessions_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NATTopSource.ProtoReflect.Descriptor instead.
+func (*NATTopSource) Descriptor() ([]byte, []int) {
+	return file_sessions_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *NATTopSource) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *NATTopSource) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *NATTopSource) GetConnections() int32 {
+	if x != nil {
+		return x.Connections
+	}
+	return 0
+}
+
 var File_sessions_proto protoreflect.FileDescriptor
 
 const file_sessions_proto_rawDesc = "" +
 	"\n" +
-	"\x0esessions.proto\x12\x13ispmonitor.agent.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd0\x02\n" +
+	"\x0esessions.proto\x12\x13ispmonitor.agent.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x9b\x03\n" +
 	"\rSessionReport\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1b\n" +
 	"\trouter_id\x18\x02 \x01(\tR\brouterId\x128\n" +
@@ -470,7 +538,8 @@ const file_sessions_proto_rawDesc = "" +
 	"\x0epppoe_sessions\x18\x04 \x03(\v2!.ispmonitor.agent.v1.PPPoESessionR\rpppoeSessions\x12B\n" +
 	"\fnat_sessions\x18\x05 \x03(\v2\x1f.ispmonitor.agent.v1.NATSessionR\vnatSessions\x12?\n" +
 	"\vdhcp_leases\x18\x06 \x03(\v2\x1e.ispmonitor.agent.v1.DHCPLeaseR\n" +
-	"dhcpLeases\"`\n" +
+	"dhcpLeases\x12I\n" +
+	"\x0fnat_top_sources\x18\a \x03(\v2!.ispmonitor.agent.v1.NATTopSourceR\rnatTopSources\"`\n" +
 	"\x15SessionReportResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x12-\n" +
 	"\x12sessions_processed\x18\x02 \x01(\x05R\x11sessionsProcessed\"\xd5\x02\n" +
@@ -507,7 +576,11 @@ const file_sessions_proto_rawDesc = "" +
 	"\vlease_start\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
 	"leaseStart\x127\n" +
 	"\tlease_end\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\bleaseEnd\x12\x16\n" +
-	"\x06status\x18\x06 \x01(\tR\x06statusBHZFgithub.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpbb\x06proto3"
+	"\x06status\x18\x06 \x01(\tR\x06status\"`\n" +
+	"\fNATTopSource\x12\x18\n" +
+	"\aaddress\x18\x01 \x01(\tR\aaddress\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\x12 \n" +
+	"\vconnections\x18\x03 \x01(\x05R\vconnectionsBHZFgithub.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpbb\x06proto3"
 
 var (
 	file_sessions_proto_rawDescOnce sync.Once
@@ -521,28 +594,30 @@ func file_sessions_proto_rawDescGZIP() []byte {
 	return file_sessions_proto_rawDescData
 }
 
-var file_sessions_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_sessions_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_sessions_proto_goTypes = []any{
 	(*SessionReport)(nil),         // 0: ispmonitor.agent.v1.SessionReport
 	(*SessionReportResponse)(nil), // 1: ispmonitor.agent.v1.SessionReportResponse
 	(*PPPoESession)(nil),          // 2: ispmonitor.agent.v1.PPPoESession
 	(*NATSession)(nil),            // 3: ispmonitor.agent.v1.NATSession
 	(*DHCPLease)(nil),             // 4: ispmonitor.agent.v1.DHCPLease
-	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
+	(*NATTopSource)(nil),          // 5: ispmonitor.agent.v1.NATTopSource
+	(*timestamppb.Timestamp)(nil), // 6: google.protobuf.Timestamp
 }
 var file_sessions_proto_depIdxs = []int32{
-	5, // 0: ispmonitor.agent.v1.SessionReport.timestamp:type_name -> google.protobuf.Timestamp
+	6, // 0: ispmonitor.agent.v1.SessionReport.timestamp:type_name -> google.protobuf.Timestamp
 	2, // 1: ispmonitor.agent.v1.SessionReport.pppoe_sessions:type_name -> ispmonitor.agent.v1.PPPoESession
 	3, // 2: ispmonitor.agent.v1.SessionReport.nat_sessions:type_name -> ispmonitor.agent.v1.NATSession
 	4, // 3: ispmonitor.agent.v1.SessionReport.dhcp_leases:type_name -> ispmonitor.agent.v1.DHCPLease
-	5, // 4: ispmonitor.agent.v1.PPPoESession.connect_time:type_name -> google.protobuf.Timestamp
-	5, // 5: ispmonitor.agent.v1.DHCPLease.lease_start:type_name -> google.protobuf.Timestamp
-	5, // 6: ispmonitor.agent.v1.DHCPLease.lease_end:type_name -> google.protobuf.Timestamp
-	7, // [7:7] is the sub-list for method output_type
-	7, // [7:7] is the sub-list for method input_type
-	7, // [7:7] is the sub-list for extension type_name
-	7, // [7:7] is the sub-list for extension extendee
-	0, // [0:7] is the sub-list for field type_name
+	5, // 4: ispmonitor.agent.v1.SessionReport.nat_top_sources:type_name -> ispmonitor.agent.v1.NATTopSource
+	6, // 5: ispmonitor.agent.v1.PPPoESession.connect_time:type_name -> google.protobuf.Timestamp
+	6, // 6: ispmonitor.agent.v1.DHCPLease.lease_start:type_name -> google.protobuf.Timestamp
+	6, // 7: ispmonitor.agent.v1.DHCPLease.lease_end:type_name -> google.protobuf.Timestamp
+	8, // [8:8] is the sub-list for method output_type
+	8, // [8:8] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_sessions_proto_init() }
@@ -556,7 +631,7 @@ func file_sessions_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sessions_proto_rawDesc), len(file_sessions_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
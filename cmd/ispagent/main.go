@@ -5,21 +5,33 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/backup"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/linux"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/probe"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/snmp"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/config"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/license"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/natlog"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport/grpc"
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sink"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/telemetry"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/version"
 )
 
+// heartbeatInterval is how often heartbeats are sent to the server and
+// event buses
+const heartbeatInterval = 30 * time.Second
+
 func main() {
 	// Parse command-line flags
 	configPath := flag.String("config", "/etc/ispagent/agent.yaml", "Path to configuration file")
@@ -85,72 +97,239 @@ func main() {
 
 	// Initialize collector registry
 	registry := collector.NewRegistry()
-	if err := registry.Register(mikrotik.NewCollector()); err != nil {
+	mikrotikConfig, err := mikrotik.DefaultConfig().Apply(cfg.MikroTik, true)
+	if err != nil {
+		log.Fatalf("Invalid mikrotik configuration: %v", err)
+	}
+	mikrotikConfig.Backup.Interval = time.Duration(cfg.ConfigBackup.IntervalMinutes) * time.Minute
+	mikrotikConfig.Backup.ShowSensitive = cfg.ConfigBackup.ShowSensitive
+	mikrotikCollector := mikrotik.NewCollectorWithConfig(mikrotikConfig)
+	if err := registry.Register(mikrotikCollector); err != nil {
 		log.Fatalf("Failed to register MikroTik collector: %v", err)
 	}
+	for i := range cfg.Routers {
+		if cfg.Routers[i].Type != mikrotikCollector.Type() {
+			continue
+		}
+		if _, err := mikrotikCollector.RouterConfig(&cfg.Routers[i]); err != nil {
+			log.Fatalf("Router %s: %v", cfg.Routers[i].ID, err)
+		}
+	}
+	if err := registry.Register(probe.NewCollector()); err != nil {
+		log.Fatalf("Failed to register probe collector: %v", err)
+	}
+	snmpCollector := snmp.NewSNMPCollector()
+	if cfg.SNMP.ProfilesDir != "" {
+		profiles, err := snmp.LoadProfiles(cfg.SNMP.ProfilesDir)
+		if err != nil {
+			log.Fatalf("Failed to load SNMP profiles: %v", err)
+		}
+		snmpCollector.SetProfiles(profiles)
+		log.Printf("SNMP profiles: %v", profiles.Names())
+	}
+	if err := registry.Register(snmpCollector); err != nil {
+		log.Fatalf("Failed to register SNMP collector: %v", err)
+	}
+	linuxCollector := linux.NewLinuxCollector()
+	if err := registry.Register(linuxCollector); err != nil {
+		log.Fatalf("Failed to register Linux collector: %v", err)
+	}
 	log.Printf("Registered collectors: %v", registry.List())
 
-	// Initialize gRPC client
-	grpcClient, err := grpc.NewClient(&cfg.Server)
-	if err != nil {
-		log.Fatalf("Failed to create gRPC client: %v", err)
+	// Cleanups run on exit, and before exiting on a fatal error, so that
+	// the NAT translation log keeps its active mappings
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+		cleanups = nil
+	}
+	defer cleanup()
+	fatalf := func(format string, v ...interface{}) {
+		cleanup()
+		log.Fatalf(format, v...)
 	}
 
-	// Connect to server
-	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+	// Initialize NAT translation log if enabled
+	if cfg.NATLog.Enabled {
+		natLog, err := natlog.Open(natlog.Options{
+			Directory: cfg.NATLog.Directory,
+			Retention: time.Duration(cfg.NATLog.RetentionDays) * 24 * time.Hour,
+			Tolerance: 2 * time.Duration(cfg.Collection.IntervalSeconds) * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open NAT translation log: %v", err)
+		}
+		cleanups = append(cleanups, func() {
+			if err := natLog.Close(); err != nil {
+				log.Printf("Failed to close NAT translation log: %v", err)
+			}
+		})
+		mikrotikCollector.SetNATLog(natLog)
+
+		natLogServer := &http.Server{
+			Addr:              cfg.NATLog.ListenAddress,
+			Handler:           natlog.Handler(natLog, cfg.NATLog.Token, auditLogger),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := natLogServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("NAT log query API stopped: %v", err)
+			}
+		}()
+		cleanups = append(cleanups, func() { natLogServer.Close() })
 
-	if err := grpcClient.Connect(connectCtx); err != nil {
-		log.Fatalf("Failed to connect to server: %v", err)
+		log.Printf("NAT translation log enabled: %s (query API on %s)", cfg.NATLog.Directory, cfg.NATLog.ListenAddress)
 	}
-	defer grpcClient.Close()
 
-	log.Printf("Connected to server: %s", cfg.Server.Address)
+	// Initialize configuration backups if enabled
+	if cfg.ConfigBackup.Enabled {
+		backups, err := backup.Open(backup.Options{
+			Directory: cfg.ConfigBackup.Directory,
+			Retain:    cfg.ConfigBackup.Retain,
+		})
+		if err != nil {
+			fatalf("Failed to open configuration backup store: %v", err)
+		}
+		mikrotikCollector.SetBackupStore(backups)
+
+		log.Printf("Configuration backups enabled: %s (every %d minutes)", cfg.ConfigBackup.Directory, cfg.ConfigBackup.IntervalMinutes)
+	}
+
+	// Observers are fed with every collection result and, for MikroTik
+	// routers, with the full collected data
+	var observers []func(scheduler.Result)
+	var dataHandlers []func(*mikrotik.CollectedData)
+
+	// Outputs delivering from a queue run until shutdown
+	runCtx, stop := context.WithCancel(ctx)
+
+	// Initialize OpenTelemetry export if enabled
+	if cfg.OpenTelemetry.Enabled {
+		tel, err := telemetry.Setup(ctx, telemetry.Options{
+			Endpoint:       cfg.OpenTelemetry.Endpoint,
+			Insecure:       cfg.OpenTelemetry.Insecure,
+			Headers:        cfg.OpenTelemetry.Headers,
+			Metrics:        cfg.OpenTelemetry.Metrics,
+			Traces:         cfg.OpenTelemetry.Traces,
+			ExportInterval: time.Duration(cfg.OpenTelemetry.ExportIntervalSeconds) * time.Second,
+			SampleRatio:    cfg.OpenTelemetry.SampleRatio,
+			AgentID:        cfg.Agent.ID,
+		})
+		if err != nil {
+			fatalf("Failed to set up OpenTelemetry: %v", err)
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			if err := tel.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to flush OpenTelemetry data: %v", err)
+			}
+		}()
+		observers = append(observers, tel.Observe)
+		dataHandlers = append(dataHandlers, tel.Update)
+
+		log.Printf("OpenTelemetry export enabled: %s (metrics: %t, traces: %t)",
+			cfg.OpenTelemetry.Endpoint, cfg.OpenTelemetry.Metrics, cfg.OpenTelemetry.Traces)
+	}
 
 	// Set up signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	// The output pipeline feeds every output from its own buffer, so a slow
+	// output holds up neither collection nor the other outputs
+	pipeline := sink.NewPipeline(func(output string, err error) {
+		log.Printf("Warning: Output %s: %v", output, err)
+	})
+	observers = append(observers, pipeline.Observe)
+	dataHandlers = append(dataHandlers, pipeline.Update)
+
 	// Start collection loop
-	ticker := time.NewTicker(time.Duration(cfg.Collection.IntervalSeconds) * time.Second)
-	defer ticker.Stop()
+	sched := scheduler.New(registry, cfg.Routers, scheduler.Options{
+		Interval:      time.Duration(cfg.Collection.IntervalSeconds) * time.Second,
+		MaxConcurrent: cfg.Collection.MaxConcurrent,
+		OnResult: func(result scheduler.Result) {
+			for _, observe := range observers {
+				observe(result)
+			}
+			handleResult(result, auditLogger)
+		},
+	})
+	handleData := func(data *mikrotik.CollectedData) {
+		for _, handle := range dataHandlers {
+			handle(data)
+		}
+	}
+	mikrotikCollector.SetDataHandler(handleData)
+	linuxCollector.SetDataHandler(handleData)
+
+	outputs := &outputSet{
+		ctx: runCtx,
+		cfg: cfg,
+		redactor: privacy.NewRedactor(cfg.Privacy.RedactUsernames, cfg.Privacy.RedactIPAddresses).
+			WithIPv6PrefixLength(*cfg.Privacy.RedactIPv6PrefixLength),
+		stats:    sched.Stats,
+		pipeline: pipeline,
+	}
+	for _, out := range cfg.OutputList() {
+		if err := outputs.add(out); err != nil {
+			fatalf("Failed to create output %s: %v", out.Name, err)
+		}
+	}
+	defer outputs.close()
+	if len(outputs.transports) > 0 {
+		outputs.run(func(ctx context.Context) {
+			sendHeartbeats(ctx, outputs.transports)
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sched.Run(runCtx)
+		close(done)
+	}()
 
 	log.Printf("Starting collection loop (interval: %ds)", cfg.Collection.IntervalSeconds)
 
+	sig := <-sigChan
+	log.Printf("Received signal %v, shutting down gracefully...", sig)
+	stop()
+	<-done
+}
+
+// sendHeartbeats sends a heartbeat through every transport until ctx is
+// done
+func sendHeartbeats(ctx context.Context, transports []transport.Transport) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
 	for {
-		select {
-		case <-ticker.C:
-			// Collect from all configured routers
-			for _, router := range cfg.Routers {
-				go collectFromRouter(ctx, registry, &router, auditLogger)
+		for _, t := range transports {
+			heartbeatCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := t.SendHeartbeat(heartbeatCtx); err != nil && ctx.Err() == nil {
+				log.Printf("Warning: Failed to send heartbeat: %v", err)
 			}
-
-		case sig := <-sigChan:
-			log.Printf("Received signal %v, shutting down gracefully...", sig)
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
 		}
 	}
 }
 
-func collectFromRouter(ctx context.Context, registry *collector.Registry, router *models.RouterConfig, auditLogger *privacy.AuditLogger) {
-	log.Printf("Collecting from router: %s (%s)", router.Name, router.ID)
-
-	// Get the appropriate collector
-	coll, err := registry.Get(router.Type)
-	if err != nil {
-		log.Printf("Error: %v", err)
+func handleResult(result scheduler.Result, auditLogger *privacy.AuditLogger) {
+	router := result.Router
+	if result.Err != nil {
+		log.Printf("Error collecting from %s: %v", router.Name, result.Err)
 		return
 	}
+	metrics := result.Metrics
 
-	// Collect metrics
-	metrics, err := coll.Collect(ctx, router)
-	if err != nil {
-		log.Printf("Error collecting from %s: %v", router.Name, err)
-		return
-	}
-
-	log.Printf("Collected metrics from %s: CPU=%.1f%%, Memory=%.1f%%, Interfaces=%d",
-		router.Name, metrics.System.CPUPercent, metrics.System.MemoryPercent, len(metrics.Interfaces))
+	log.Printf("Collected metrics from %s in %v: CPU=%.1f%%, Memory=%.1f%%, Interfaces=%d",
+		router.Name, result.Duration.Round(time.Millisecond), metrics.System.CPUPercent, metrics.System.MemoryPercent, len(metrics.Interfaces))
 
 	// Log to audit if enabled
 	if auditLogger != nil {
@@ -163,6 +342,4 @@ func collectFromRouter(ctx context.Context, registry *collector.Registry, router
 			log.Printf("Warning: Failed to log audit entry: %v", err)
 		}
 	}
-
-	// TODO: Send metrics to server via transport
 }
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/config"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/promexport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sink"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sink/file"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sink/influx"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sink/mqtt"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport/grpc"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport/kafka"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport/nats"
+)
+
+// outputSet creates the outputs fed by the output pipeline and holds what
+// they keep open
+type outputSet struct {
+	ctx      context.Context // Ends delivery from the outbound queues
+	cfg      *config.Config
+	redactor *privacy.Redactor
+	stats    func() scheduler.Stats
+	pipeline *sink.Pipeline
+
+	// transports receive heartbeats
+	transports []transport.Transport
+	runners    sync.WaitGroup
+	closers    []func() error
+}
+
+// add creates an output and feeds it from the pipeline
+func (s *outputSet) add(out config.OutputConfig) error {
+	var output sink.Sink
+	var err error
+	switch out.Type {
+	case config.OutputGRPC:
+		output, err = s.addGRPC(out)
+	case config.OutputPrometheus:
+		output, err = s.addPrometheus(out)
+	case config.OutputInfluxDB:
+		output, err = s.addInfluxDB(out)
+	case config.OutputMQTT:
+		output, err = s.addMQTT(out)
+	case config.OutputKafka:
+		output, err = s.addKafka(out)
+	case config.OutputNATS:
+		output, err = s.addNATS(out)
+	case config.OutputFile:
+		output, err = s.addFile(out)
+	default:
+		err = fmt.Errorf("unknown output type %q", out.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	filter := sink.Filter{Routers: out.Routers}
+	for _, data := range out.Data {
+		filter.Data = append(filter.Data, sink.DataType(data))
+	}
+	s.pipeline.Add(out.Name, output, sink.OutputOptions{Filter: filter, Buffer: out.Buffer})
+	return nil
+}
+
+// close waits until the outputs have taken the collections handed to
+// them, then closes them in reverse order
+func (s *outputSet) close() {
+	s.pipeline.Close()
+	s.runners.Wait()
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		if err := s.closers[i](); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// run runs fn until the outputs are closed
+func (s *outputSet) run(fn func(ctx context.Context)) {
+	s.runners.Add(1)
+	go func() {
+		defer s.runners.Done()
+		fn(s.ctx)
+	}()
+}
+
+func (s *outputSet) onError(name string) func(err error) {
+	return func(err error) {
+		log.Printf("Output %s: %v", name, err)
+	}
+}
+
+func (s *outputSet) openQueue(cfg config.QueueConfig) (*queue.Queue, error) {
+	q, err := queue.Open(queue.Options{
+		Directory: cfg.Directory,
+		MaxBytes:  int64(cfg.MaxSizeMB) << 20,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+	s.closers = append(s.closers, q.Close)
+	return q, nil
+}
+
+// addTransport connects t and returns a sink feeding it. A transport that
+// cannot connect yet keeps retrying in the background, unless connecting
+// is required.
+func (s *outputSet) addTransport(name string, t transport.Transport, required bool) (sink.Sink, error) {
+	connectCtx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+	if err := t.Connect(connectCtx); err != nil {
+		if required {
+			t.Close()
+			return nil, err
+		}
+		log.Printf("Warning: Output %s: %v; retrying in the background", name, err)
+	}
+	s.closers = append(s.closers, t.Close)
+	s.transports = append(s.transports, t)
+	return sink.NewTransportSink(t, s.cfg.Agent.ID, s.redactor, s.onError(name)), nil
+}
+
+func (s *outputSet) outboxOptions(name string) transport.OutboxOptions {
+	return transport.OutboxOptions{
+		AgentID: s.cfg.Agent.ID,
+		OnError: s.onError(name),
+	}
+}
+
+func (s *outputSet) addGRPC(out config.OutputConfig) (sink.Sink, error) {
+	q, err := s.openQueue(out.Server.Queue)
+	if err != nil {
+		return nil, err
+	}
+	client, err := grpc.NewClient(&out.Server, q, s.outboxOptions(out.Name))
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.addTransport(out.Name, client, true)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Output %s: connected to server %s (queue: %s)", out.Name, out.Server.Address, out.Server.Queue.Directory)
+	return output, nil
+}
+
+func (s *outputSet) addPrometheus(out config.OutputConfig) (sink.Sink, error) {
+	exporter := promexport.New(promexport.Options{
+		Subscribers:         out.Prometheus.SubscriberMetrics,
+		MaxSubscriberSeries: out.Prometheus.MaxSubscriberSeries,
+		Redactor:            s.redactor,
+		Stats:               s.stats,
+	})
+
+	metricsServer := &http.Server{
+		Addr:              out.Prometheus.ListenAddress,
+		Handler:           exporter.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Output %s: Prometheus exporter stopped: %v", out.Name, err)
+		}
+	}()
+	s.closers = append(s.closers, metricsServer.Close)
+
+	log.Printf("Output %s: Prometheus exporter on http://%s%s", out.Name, out.Prometheus.ListenAddress, promexport.MetricsPath)
+	return exporter, nil
+}
+
+func (s *outputSet) addInfluxDB(out config.OutputConfig) (sink.Sink, error) {
+	cfg := out.InfluxDB
+	q, err := s.openQueue(cfg.Queue)
+	if err != nil {
+		return nil, err
+	}
+	influxSink, err := influx.New(q, influx.Options{
+		URL:           cfg.URL,
+		Organization:  cfg.Organization,
+		Bucket:        cfg.Bucket,
+		Token:         cfg.Token,
+		Database:      cfg.Database,
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Gzip:          cfg.Gzip,
+		Timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		AgentID:       s.cfg.Agent.ID,
+		Redactor:      s.redactor,
+		OnError:       s.onError(out.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.run(influxSink.Run)
+
+	log.Printf("Output %s: InfluxDB %s (queue: %s)", out.Name, cfg.URL, cfg.Queue.Directory)
+	return influxSink, nil
+}
+
+func (s *outputSet) addMQTT(out config.OutputConfig) (sink.Sink, error) {
+	cfg := out.MQTT
+	tlsConfig, err := loadTLS(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	mqttSink, err := mqtt.New(mqtt.Options{
+		Broker:      cfg.Broker,
+		ClientID:    cfg.ClientID,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		TLS:         tlsConfig,
+		QoS:         byte(cfg.QoS),
+		Retain:      cfg.Retain,
+		TopicPrefix: cfg.TopicPrefix,
+		// Session events are derived from the sessions, which the output
+		// may leave out
+		SessionEvents: cfg.SessionEvents && (len(out.Data) == 0 || slices.Contains(out.Data, string(sink.DataSessions))),
+		Redactor:      s.redactor,
+		AgentID:       s.cfg.Agent.ID,
+		OnError:       s.onError(out.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	connectCtx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+	if err := mqttSink.Connect(connectCtx); err != nil {
+		log.Printf("Warning: Output %s: %v; retrying in the background", out.Name, err)
+	}
+	s.closers = append(s.closers, mqttSink.Close)
+
+	log.Printf("Output %s: MQTT %s", out.Name, cfg.Broker)
+	return mqttSink, nil
+}
+
+func (s *outputSet) addKafka(out config.OutputConfig) (sink.Sink, error) {
+	cfg := out.Kafka
+	tlsConfig, err := loadTLS(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.openQueue(cfg.Queue)
+	if err != nil {
+		return nil, err
+	}
+	kafkaTransport, err := kafka.New(q, kafka.Options{
+		Brokers: cfg.Brokers,
+		Topics: kafka.Topics{
+			Metrics:    cfg.Topics.Metrics,
+			Sessions:   cfg.Topics.Sessions,
+			Heartbeats: cfg.Topics.Heartbeats,
+		},
+		ClientID:      cfg.ClientID,
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		TLS:           tlsConfig,
+		Timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		AgentID:       s.cfg.Agent.ID,
+		OnError:       s.onError(out.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.addTransport(out.Name, kafkaTransport, false)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Output %s: Kafka %v (queue: %s)", out.Name, cfg.Brokers, cfg.Queue.Directory)
+	return output, nil
+}
+
+func (s *outputSet) addNATS(out config.OutputConfig) (sink.Sink, error) {
+	cfg := out.NATS
+	tlsConfig, err := loadTLS(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.openQueue(cfg.Queue)
+	if err != nil {
+		return nil, err
+	}
+	natsTransport, err := nats.New(q, nats.Options{
+		URL:             cfg.URL,
+		SubjectPrefix:   cfg.SubjectPrefix,
+		Username:        cfg.Username,
+		Password:        cfg.Password,
+		Token:           cfg.Token,
+		CredentialsFile: cfg.CredentialsFile,
+		TLS:             tlsConfig,
+		Timeout:         time.Duration(cfg.TimeoutSeconds) * time.Second,
+		BatchSize:       cfg.BatchSize,
+		FlushInterval:   time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		AgentID:         s.cfg.Agent.ID,
+		OnError:         s.onError(out.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	output, err := s.addTransport(out.Name, natsTransport, false)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Output %s: NATS %s (queue: %s)", out.Name, cfg.URL, cfg.Queue.Directory)
+	return output, nil
+}
+
+func (s *outputSet) addFile(out config.OutputConfig) (sink.Sink, error) {
+	cfg := out.File
+	fileSink, err := file.New(file.Options{
+		Directory:      cfg.Directory,
+		Prefix:         cfg.Prefix,
+		MaxSize:        int64(cfg.MaxSizeMB) << 20,
+		RotateInterval: time.Duration(cfg.RotateIntervalMinutes) * time.Minute,
+		Compress:       cfg.Compress,
+		MaxFiles:       cfg.MaxFiles,
+		MaxTotalSize:   int64(cfg.MaxTotalSizeMB) << 20,
+		MaxAge:         time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		AgentID:        s.cfg.Agent.ID,
+		Redactor:       s.redactor,
+		OnError:        s.onError(out.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.closers = append(s.closers, fileSink.Close)
+
+	log.Printf("Output %s: NDJSON files in %s", out.Name, cfg.Directory)
+	return fileSink, nil
+}
+
+// loadTLS returns the client TLS configuration, or nil if TLS is disabled
+func loadTLS(cfg config.TLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig, err := cfg.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS config: %w", err)
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,253 @@
+// Command loadtest runs the agent's scheduler and MikroTik collector
+// against simulated routers and reports collection latency, memory,
+// goroutines and missed intervals, to size an agent before onboarding a
+// large network.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/apisim"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// Report is the outcome of a load test.
+type Report struct {
+	Routers       int            `json:"routers"`
+	Profile       apisim.Profile `json:"profile"`
+	Interval      time.Duration  `json:"interval_ns"`
+	Duration      time.Duration  `json:"duration_ns"`
+	Collections   int64          `json:"collections"`
+	Failures      int64          `json:"failures"`
+	Missed        int64          `json:"missed_intervals"`
+	LatencyP50    time.Duration  `json:"latency_p50_ns"`
+	LatencyP90    time.Duration  `json:"latency_p90_ns"`
+	LatencyP99    time.Duration  `json:"latency_p99_ns"`
+	LatencyMax    time.Duration  `json:"latency_max_ns"`
+	HeapBaseline  uint64         `json:"heap_baseline_bytes"`
+	HeapPeak      uint64         `json:"heap_peak_bytes"`
+	SysPeak       uint64         `json:"sys_peak_bytes"`
+	GoroutineBase int            `json:"goroutines_baseline"`
+	GoroutinePeak int            `json:"goroutines_peak"`
+	Errors        []string       `json:"errors,omitempty"`
+}
+
+func main() {
+	routers := flag.Int("routers", 100, "Number of simulated routers")
+	interfaces := flag.Int("interfaces", 8, "Ethernet interfaces per router")
+	sessions := flag.Int("sessions", 2000, "Active PPPoE sessions per router")
+	leases := flag.Int("leases", 500, "DHCP leases per router")
+	connections := flag.Int("connections", 20000, "Connection tracking entries per router")
+	collectNAT := flag.Bool("nat", true, "Collect the connection tracking table")
+	latency := flag.Duration("latency", 0, "Delay added by the simulated routers to every command")
+	interval := flag.Duration("interval", 60*time.Second, "Collection interval")
+	duration := flag.Duration("duration", 5*time.Minute, "Test duration")
+	maxConcurrent := flag.Int("max-concurrent", 0, "Maximum routers collected at once; 0 is unlimited")
+	jsonOutput := flag.Bool("json", false, "Print the report as JSON")
+	cpuProfile := flag.String("cpuprofile", "", "Write a CPU profile of the collection phase to this file")
+	flag.Parse()
+
+	profile := apisim.Profile{
+		Interfaces:  *interfaces,
+		Sessions:    *sessions,
+		Leases:      *leases,
+		Connections: *connections,
+	}
+
+	// Start the simulated routers; they share one set of tables
+	log.Printf("Starting %d simulated routers", *routers)
+	template := apisim.NewRouter("sim", "loadtest", "loadtest")
+	template.Populate(profile)
+	if *latency > 0 {
+		template.Inject("", apisim.Fault{Delay: *latency})
+	}
+
+	var configs []models.RouterConfig
+	for i := 1; i <= *routers; i++ {
+		id := fmt.Sprintf("sim-%04d", i)
+		srv, err := apisim.Listen("127.0.0.1:0", template.Clone(id))
+		if err != nil {
+			log.Fatalf("Failed to start simulated router: %v", err)
+		}
+		defer srv.Close()
+
+		configs = append(configs, models.RouterConfig{
+			ID:      id,
+			Name:    id,
+			Type:    "mikrotik",
+			Address: "127.0.0.1",
+			Credentials: models.RouterCredentials{
+				Username: "loadtest",
+				Password: "loadtest",
+			},
+			Metadata: map[string]interface{}{"api_port": srv.Port()},
+		})
+	}
+
+	mikrotikConfig := mikrotik.DefaultConfig()
+	mikrotikConfig.Collect.NAT = *collectNAT
+	mikrotikConfig.NAT.MaxConnections = *connections
+	registry := collector.NewRegistry()
+	if err := registry.Register(mikrotik.NewCollectorWithConfig(mikrotikConfig)); err != nil {
+		log.Fatalf("Failed to register MikroTik collector: %v", err)
+	}
+
+	var mu sync.Mutex
+	var latencies []time.Duration
+	errorCounts := make(map[string]int)
+	sched := scheduler.New(registry, configs, scheduler.Options{
+		Interval:      *interval,
+		MaxConcurrent: *maxConcurrent,
+		OnResult: func(result scheduler.Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			if result.Err != nil {
+				errorCounts[result.Err.Error()]++
+				return
+			}
+			latencies = append(latencies, result.Duration)
+		},
+	})
+
+	report := &Report{
+		Routers:  *routers,
+		Profile:  profile,
+		Interval: *interval,
+		Duration: *duration,
+	}
+	runtime.GC()
+	report.HeapBaseline, _ = readMemory()
+	report.GoroutineBase = runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			log.Fatalf("Failed to create CPU profile: %v", err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatalf("Failed to start CPU profile: %v", err)
+		}
+	}
+
+	log.Printf("Collecting every %v for %v", *interval, *duration)
+	done := make(chan struct{})
+	go func() {
+		sched.Run(ctx)
+		close(done)
+	}()
+
+	sample := time.NewTicker(500 * time.Millisecond)
+	progress := time.NewTicker(*interval)
+	started := time.Now()
+loop:
+	for {
+		select {
+		case <-done:
+			break loop
+		case <-sample.C:
+			heap, sys := readMemory()
+			report.HeapPeak = max(report.HeapPeak, heap)
+			report.SysPeak = max(report.SysPeak, sys)
+			report.GoroutinePeak = max(report.GoroutinePeak, runtime.NumGoroutine())
+		case <-progress.C:
+			stats := sched.Stats()
+			heap, _ := readMemory()
+			log.Printf("%v: %d collections, %d failed, %d missed, %d in flight, heap %s",
+				time.Since(started).Round(time.Second), stats.Collections, stats.Failures, stats.Missed, stats.InFlight, formatBytes(heap))
+		}
+	}
+	sample.Stop()
+	progress.Stop()
+	if *cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	report.Duration = time.Since(started).Round(time.Second)
+
+	stats := sched.Stats()
+	report.Collections = stats.Collections
+	report.Failures = stats.Failures
+	report.Missed = stats.Missed
+	report.LatencyP50 = percentile(latencies, 50)
+	report.LatencyP90 = percentile(latencies, 90)
+	report.LatencyP99 = percentile(latencies, 99)
+	report.LatencyMax = percentile(latencies, 100)
+	for msg, n := range errorCounts {
+		report.Errors = append(report.Errors, fmt.Sprintf("%dx %s", n, msg))
+	}
+	sort.Strings(report.Errors)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printReport(report)
+	}
+
+	if report.Missed > 0 || report.Failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// readMemory returns the heap in use and the memory obtained from the OS.
+func readMemory() (heap, sys uint64) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse, m.Sys
+}
+
+// percentile returns the p-th percentile of durations by nearest rank.
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func printReport(r *Report) {
+	fmt.Printf("Routers:          %d (%d interfaces, %d PPPoE sessions, %d leases, %d connections each)\n",
+		r.Routers, r.Profile.Interfaces, r.Profile.Sessions, r.Profile.Leases, r.Profile.Connections)
+	fmt.Printf("Interval:         %v for %v\n", r.Interval, r.Duration)
+	fmt.Printf("Collections:      %d (%d failed)\n", r.Collections, r.Failures)
+	fmt.Printf("Missed intervals: %d\n", r.Missed)
+	fmt.Printf("Latency:          p50 %v, p90 %v, p99 %v, max %v\n",
+		r.LatencyP50.Round(time.Millisecond), r.LatencyP90.Round(time.Millisecond),
+		r.LatencyP99.Round(time.Millisecond), r.LatencyMax.Round(time.Millisecond))
+	fmt.Printf("Heap in use:      %s idle, %s peak\n", formatBytes(r.HeapBaseline), formatBytes(r.HeapPeak))
+	fmt.Printf("Memory from OS:   %s peak\n", formatBytes(r.SysPeak))
+	fmt.Printf("Goroutines:       %d idle, %d peak\n", r.GoroutineBase, r.GoroutinePeak)
+	for _, e := range r.Errors {
+		fmt.Printf("Error:            %s\n", e)
+	}
+}
+
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreSaveAndLatest(t *testing.T) {
+	s, err := Open(Options{Directory: t.TempDir(), Retain: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _, err := s.Latest("r1"); err != nil || v != nil {
+		t.Fatalf("expected no versions, got %v, %v", v, err)
+	}
+
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, content := range []string{"v1", "v2", "v3"} {
+		if _, err := s.Save("r1", []byte(content), t0.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := s.Versions("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected retention to keep 2 versions, got %d", len(versions))
+	}
+	if versions[0].ID != "20240301T130000Z" {
+		t.Errorf("expected oldest kept version 20240301T130000Z, got %s", versions[0].ID)
+	}
+
+	v, content, err := s.Latest("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "v3" || !v.Time.Equal(t0.Add(2*time.Hour)) {
+		t.Errorf("unexpected latest version %+v %q", v, content)
+	}
+}
+
+func TestStoreRouterDirIsSanitized(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(Options{Directory: dir})
+
+	v, err := s.Save("../core/router 1", []byte("x"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(filepath.Dir(v.Path)) != dir {
+		t.Errorf("backup escaped the store directory: %s", v.Path)
+	}
+	if _, err := os.Stat(v.Path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenRequiresDirectory(t *testing.T) {
+	if _, err := Open(Options{}); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := strings.Join([]string{
+		"/interface bridge",
+		"add name=bridge1",
+		"/ip address",
+		"add address=192.168.88.1/24 interface=bridge1",
+		"/ip dns",
+		"set servers=1.1.1.1",
+		"/system identity",
+		"set name=core",
+	}, "\n")
+	new := strings.Join([]string{
+		"/interface bridge",
+		"add name=bridge1",
+		"/ip address",
+		"add address=192.168.88.1/24 interface=bridge1",
+		"add address=10.0.0.1/30 interface=ether1",
+		"/ip dns",
+		"set servers=8.8.8.8",
+		"/system identity",
+		"set name=core",
+	}, "\n")
+
+	d := Compare(old, new)
+	if d.Added != 2 || d.Removed != 1 {
+		t.Fatalf("expected +2 -1, got +%d -%d", d.Added, d.Removed)
+	}
+
+	want := `@@ -2,7 +2,8 @@
+ add name=bridge1
+ /ip address
+ add address=192.168.88.1/24 interface=bridge1
++add address=10.0.0.1/30 interface=ether1
+ /ip dns
+-set servers=1.1.1.1
++set servers=8.8.8.8
+ /system identity
+ set name=core
+`
+	if d.Unified != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", d.Unified, want)
+	}
+}
+
+func TestCompareSeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 30; i++ {
+		line := "line " + string(rune('a'+i%26))
+		a = append(a, line)
+		b = append(b, line)
+	}
+	b[2] = "changed start"
+	b[27] = "changed end"
+
+	d := Compare(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if n := strings.Count(d.Unified, "@@ -"); n != 2 {
+		t.Errorf("expected 2 hunks, got %d:\n%s", n, d.Unified)
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	d := Compare("a\nb\n", "a\r\nb")
+	if !d.Empty() || d.Unified != "" {
+		t.Errorf("expected no difference, got %+v", d)
+	}
+}
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the memory used to diff the changed region of two
+// configurations. Larger regions are shown as replaced wholesale.
+const maxDiffCells = 4 << 20
+
+// Diff is the line difference between two configurations.
+type Diff struct {
+	Added   int
+	Removed int
+	Unified string // Unified diff without file headers
+}
+
+// Empty reports whether the configurations are identical.
+func (d *Diff) Empty() bool {
+	return d.Added == 0 && d.Removed == 0
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Compare returns the line difference from old to new.
+func Compare(old, new string) *Diff {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// Configurations change little between versions, so only the region
+	// between the common prefix and suffix needs a real diff.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, l := range a[:prefix] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	ops = append(ops, diffLines(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+
+	d := &Diff{}
+	for _, op := range ops {
+		switch op.kind {
+		case '-':
+			d.Removed++
+		case '+':
+			d.Added++
+		}
+	}
+	if !d.Empty() {
+		d.Unified = unified(ops)
+	}
+	return d
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines computes an edit script using the longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+
+	if len(a)*len(b) > maxDiffCells {
+		for _, l := range a {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+
+	return ops
+}
+
+// unified renders an edit script as unified diff hunks.
+func unified(ops []diffOp) string {
+	var sb strings.Builder
+
+	// Line numbers (1-based) in old and new at each op
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	oldLine[0], newLine[0] = 1, 1
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are within 2*context lines
+		start := max(i-diffContext, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = run
+		}
+
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldLine[start], oldCount, newLine[start], newCount)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+
+		i = end
+	}
+
+	return sb.String()
+}
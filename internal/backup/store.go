@@ -0,0 +1,173 @@
+// Package backup keeps versioned copies of router configurations on disk
+// and computes differences between them.
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	versionLayout = "20060102T150405Z"
+	fileSuffix    = ".rsc"
+)
+
+// Options configures a backup store.
+type Options struct {
+	// Directory holds one subdirectory of versions per router.
+	Directory string
+	// Retain is the number of versions kept per router; 0 keeps all.
+	Retain int
+}
+
+// Version identifies a stored configuration.
+type Version struct {
+	ID   string    // File name without extension, e.g. 20240101T120000Z
+	Time time.Time // When the configuration was exported
+	Path string
+}
+
+// Store saves configuration versions as plain files, one directory per
+// router, so they can also be inspected and restored by hand.
+type Store struct {
+	opts Options
+	mu   sync.Mutex
+}
+
+// Open opens (or creates) a backup store in opts.Directory.
+func Open(opts Options) (*Store, error) {
+	if opts.Directory == "" {
+		return nil, fmt.Errorf("backup directory is required")
+	}
+	if err := os.MkdirAll(opts.Directory, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &Store{opts: opts}, nil
+}
+
+// Save stores content as a new version for routerID and removes versions
+// beyond the retention count.
+func (s *Store) Save(routerID string, content []byte, at time.Time) (*Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.routerDir(routerID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	at = at.UTC().Truncate(time.Second)
+	v := &Version{
+		ID:   at.Format(versionLayout),
+		Time: at,
+	}
+	v.Path = filepath.Join(dir, v.ID+fileSuffix)
+
+	// Write atomically so a crash never leaves a partial latest version
+	tmp := v.Path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0640); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp, v.Path); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if err := s.prune(routerID); err != nil {
+		return v, err
+	}
+
+	return v, nil
+}
+
+// Versions lists the stored versions of routerID, oldest first.
+func (s *Store) Versions(routerID string) ([]Version, error) {
+	entries, err := os.ReadDir(s.routerDir(routerID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var versions []Version
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		id := strings.TrimSuffix(name, fileSuffix)
+		t, err := time.Parse(versionLayout, id)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{
+			ID:   id,
+			Time: t,
+			Path: filepath.Join(s.routerDir(routerID), name),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Time.Before(versions[j].Time)
+	})
+
+	return versions, nil
+}
+
+// Latest returns the newest version of routerID and its content, or nil
+// when none is stored.
+func (s *Store) Latest(routerID string) (*Version, []byte, error) {
+	versions, err := s.Versions(routerID)
+	if err != nil || len(versions) == 0 {
+		return nil, nil, err
+	}
+
+	v := versions[len(versions)-1]
+	content, err := os.ReadFile(v.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return &v, content, nil
+}
+
+func (s *Store) prune(routerID string) error {
+	if s.opts.Retain <= 0 {
+		return nil
+	}
+
+	versions, err := s.Versions(routerID)
+	if err != nil {
+		return err
+	}
+
+	for len(versions) > s.opts.Retain {
+		if err := os.Remove(versions[0].Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		versions = versions[1:]
+	}
+
+	return nil
+}
+
+// routerDir returns the directory of routerID, with path separators and
+// other unsafe characters replaced.
+func (s *Store) routerDir(routerID string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, routerID)
+	if safe == "" || safe == "." || safe == ".." {
+		safe = "_" + safe
+	}
+	return filepath.Join(s.opts.Directory, safe)
+}
@@ -0,0 +1,91 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+)
+
+// sessionColumns are requested from "accel-cmd show sessions" so the output
+// does not depend on the configured defaults.
+var sessionColumns = []string{
+	"sid", "ifname", "username", "calling-sid", "ip", "type", "state",
+	"rate-limit", "uptime-raw", "rx-bytes-raw", "tx-bytes-raw", "rx-pkts", "tx-pkts",
+}
+
+// collectSessions lists accel-ppp sessions. Active PPPoE sessions are
+// returned as PPPoE sessions, and active sessions of all types are counted by
+// type (pppoe, ipoe, l2tp, ...).
+func collectSessions(ctx context.Context, r runner, accelCmd string) ([]mikrotik.PPPoESession, map[string]int, error) {
+	out, err := r.Run(ctx, fmt.Sprintf("%s show sessions %s", accelCmd, strings.Join(sessionColumns, ",")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sessions []mikrotik.PPPoESession
+	counts := make(map[string]int)
+	for _, row := range parseTable(string(out)) {
+		if row["state"] != "active" {
+			continue
+		}
+		counts[row["type"]]++
+		if row["type"] != "pppoe" {
+			continue
+		}
+
+		sessions = append(sessions, mikrotik.PPPoESession{
+			ID:        row["sid"],
+			SessionID: row["sid"],
+			Name:      row["ifname"],
+			Username:  row["username"],
+			CallerID:  strings.ToUpper(row["calling-sid"]),
+			Address:   row["ip"],
+			RateLimit: row["rate-limit"],
+			Uptime:    mikrotik.ParseInt64(row["uptime-raw"]),
+			RxBytes:   mikrotik.ParseInt64(row["rx-bytes-raw"]),
+			TxBytes:   mikrotik.ParseInt64(row["tx-bytes-raw"]),
+			RxPackets: mikrotik.ParseInt64(row["rx-pkts"]),
+			TxPackets: mikrotik.ParseInt64(row["tx-pkts"]),
+		})
+	}
+
+	return sessions, counts, nil
+}
+
+// parseTable parses accel-cmd's table output:
+//
+//	 sid | ifname | username
+//	-----+--------+---------
+//	 1a2 | ppp0   | alice
+func parseTable(out string) []map[string]string {
+	var header []string
+	var rows []map[string]string
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, "|") {
+			continue
+		}
+		cells := strings.Split(line, "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+
+		if header == nil {
+			header = cells
+			continue
+		}
+		if strings.Trim(line, "-+ ") == "" {
+			continue
+		}
+
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(cells) {
+				row[name] = cells[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
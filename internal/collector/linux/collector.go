@@ -0,0 +1,271 @@
+// Package linux implements a collector for Linux software routers, such as
+// accel-ppp BNGs, reading kernel statistics and accel-ppp sessions over SSH.
+package linux
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sshclient"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// AccelCmdNone disables accel-ppp session collection.
+const AccelCmdNone = "none"
+
+// Target contains the SSH and collection settings of a host, read from the
+// metadata of a router entry of type "linux".
+type Target struct {
+	Port                  int           `yaml:"port"`
+	Timeout               time.Duration `yaml:"timeout"`
+	KnownHosts            string        `yaml:"known_hosts"`
+	InsecureIgnoreHostKey bool          `yaml:"insecure_ignore_host_key"`
+
+	// AccelCmd is the accel-cmd invocation, e.g. "accel-cmd -p 2001";
+	// "none" skips PPPoE sessions
+	AccelCmd string `yaml:"accel_cmd"`
+
+	// Interface filtering by name glob; without filters, per-subscriber ppp
+	// interfaces are excluded
+	InterfaceInclude []string `yaml:"interface_include,omitempty"`
+	InterfaceExclude []string `yaml:"interface_exclude,omitempty"`
+}
+
+// CollectedData contains all data collected from a host, using the
+// MikroTik collector's models for interfaces, sessions and conntrack.
+type CollectedData struct {
+	*models.MetricsData
+	Interfaces  []mikrotik.InterfaceMetrics `json:"interfaces,omitempty"`
+	PPPoE       []mikrotik.PPPoESession     `json:"pppoe_sessions,omitempty"`
+	Conntrack   *mikrotik.NATStats          `json:"conntrack,omitempty"`
+	CollectedAt time.Time                   `json:"collected_at"`
+	Errors      []string                    `json:"errors,omitempty"`
+}
+
+// MikroTikData returns the data in the form of the MikroTik collector's,
+// sharing its base model, for outputs that take that form.
+func (d *CollectedData) MikroTikData() *mikrotik.CollectedData {
+	return &mikrotik.CollectedData{
+		MetricsData: d.MetricsData,
+		Interfaces:  d.Interfaces,
+		PPPoE:       d.PPPoE,
+		NATStats:    d.Conntrack,
+		CollectedAt: d.CollectedAt,
+		Errors:      d.Errors,
+	}
+}
+
+// runner runs shell commands on the host; *sshclient.Client implements it.
+type runner interface {
+	Run(ctx context.Context, command string) ([]byte, error)
+}
+
+// Collector collects metrics from Linux hosts over SSH.
+type Collector struct {
+	name string
+
+	mu       sync.Mutex
+	cpu      map[string]cpuSample // By router ID
+	counters map[string]counters  // By router ID + interface
+	onData   func(*mikrotik.CollectedData)
+}
+
+// NewCollector creates a new Linux collector.
+func NewCollector() collector.Collector {
+	return NewLinuxCollector()
+}
+
+// NewLinuxCollector creates a new Linux collector.
+func NewLinuxCollector() *Collector {
+	return &Collector{
+		name:     "linux",
+		cpu:      make(map[string]cpuSample),
+		counters: make(map[string]counters),
+	}
+}
+
+// Name returns the collector name.
+func (c *Collector) Name() string {
+	return c.name
+}
+
+// Type returns the router type.
+func (c *Collector) Type() string {
+	return "linux"
+}
+
+// SetDataHandler registers a function that is given the full data of every
+// successful Collect, in the MikroTik collector's form, so that outputs
+// receive accel-ppp sessions as they receive MikroTik ones. It is called
+// before Collect returns and must not change the data.
+func (c *Collector) SetDataHandler(handler func(*mikrotik.CollectedData)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onData = handler
+}
+
+// Collect collects metrics from a Linux host.
+func (c *Collector) Collect(ctx context.Context, router *models.RouterConfig) (*models.MetricsData, error) {
+	data, err := c.CollectAll(ctx, router)
+	if err != nil {
+		return nil, err
+	}
+	c.handle(data)
+	return data.MetricsData, nil
+}
+
+func (c *Collector) handle(data *CollectedData) {
+	c.mu.Lock()
+	onData := c.onData
+	c.mu.Unlock()
+	if onData != nil {
+		onData(data.MikroTikData())
+	}
+}
+
+// CollectAll collects all data from a Linux host. Only connection and
+// system statistics failures are errors; other failures are recorded in
+// Errors.
+func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig) (*CollectedData, error) {
+	target, err := ParseTarget(router)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dial(ctx, router, target)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return c.collect(ctx, client, router.ID, target, time.Now())
+}
+
+func (c *Collector) collect(ctx context.Context, r runner, routerID string, target *Target, now time.Time) (*CollectedData, error) {
+	data := &CollectedData{
+		MetricsData: &models.MetricsData{
+			RouterID:      routerID,
+			Timestamp:     now,
+			CustomMetrics: make(map[string]float64),
+		},
+		CollectedAt: now,
+	}
+
+	if err := c.collectSystem(ctx, r, routerID, data); err != nil {
+		return nil, fmt.Errorf("system: %w", err)
+	}
+
+	interfaces, err := c.collectInterfaces(ctx, r, routerID, target, now)
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("interfaces: %v", err))
+	}
+	data.Interfaces = interfaces
+	for _, iface := range interfaces {
+		data.MetricsData.Interfaces = append(data.MetricsData.Interfaces, iface.InterfaceMetrics)
+	}
+
+	// Conntrack counters exist only with the nf_conntrack module loaded
+	if stats, err := collectConntrack(ctx, r); err == nil {
+		data.Conntrack = stats
+		data.CustomMetrics["conntrack_entries"] = float64(stats.TotalConnections)
+		data.CustomMetrics["conntrack_max"] = float64(stats.MaxEntries)
+	}
+
+	if target.AccelCmd != AccelCmdNone {
+		sessions, counts, err := collectSessions(ctx, r, target.AccelCmd)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("pppoe: %v", err))
+		} else {
+			data.PPPoE = sessions
+			for sessionType, n := range counts {
+				data.CustomMetrics[fmt.Sprintf("accel_sessions{type=%q}", sessionType)] = float64(n)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// HealthCheck verifies that the host accepts the SSH credentials.
+func (c *Collector) HealthCheck(ctx context.Context, router *models.RouterConfig) error {
+	target, err := ParseTarget(router)
+	if err != nil {
+		return err
+	}
+	client, err := dial(ctx, router, target)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if _, err := client.Run(ctx, "cat /proc/uptime"); err != nil {
+		return fmt.Errorf("health check command failed: %w", err)
+	}
+	return nil
+}
+
+func dial(ctx context.Context, router *models.RouterConfig, target *Target) (*sshclient.Client, error) {
+	client, err := sshclient.Dial(ctx, sshclient.Options{
+		Address:               net.JoinHostPort(router.Address, strconv.Itoa(target.Port)),
+		Username:              router.Credentials.Username,
+		Password:              router.Credentials.Password,
+		Key:                   router.Credentials.SSHKey,
+		KnownHosts:            target.KnownHosts,
+		InsecureIgnoreHostKey: target.InsecureIgnoreHostKey,
+		Timeout:               target.Timeout,
+	})
+	if err != nil {
+		if sshclient.IsAuthError(err) {
+			return nil, fmt.Errorf("%s rejected the credentials: %w", router.Address, err)
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %w", router.Address, err)
+	}
+	return client, nil
+}
+
+// ParseTarget reads the host settings from the router metadata and applies
+// defaults.
+func ParseTarget(router *models.RouterConfig) (*Target, error) {
+	if router.Address == "" {
+		return nil, fmt.Errorf("router address is required")
+	}
+	if router.Credentials.Username == "" {
+		return nil, fmt.Errorf("ssh username is required")
+	}
+	if router.Credentials.SSHKey == "" && router.Credentials.Password == "" {
+		return nil, fmt.Errorf("ssh_key or password is required")
+	}
+
+	target := &Target{}
+	if len(router.Metadata) > 0 {
+		raw, err := yaml.Marshal(router.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid linux metadata: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, target); err != nil {
+			return nil, fmt.Errorf("invalid linux metadata: %w", err)
+		}
+	}
+
+	if target.Port == 0 {
+		target.Port = 22
+	}
+	if target.Timeout == 0 {
+		target.Timeout = 10 * time.Second
+	}
+	if target.AccelCmd == "" {
+		target.AccelCmd = "accel-cmd"
+	}
+	if len(target.InterfaceInclude) == 0 && len(target.InterfaceExclude) == 0 {
+		target.InterfaceExclude = []string{"ppp*"}
+	}
+
+	return target, nil
+}
@@ -0,0 +1,254 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// fakeHost answers readFiles commands from files and other commands from
+// outputs.
+type fakeHost struct {
+	files   map[string]string
+	outputs map[string]string
+}
+
+func (h *fakeHost) Run(_ context.Context, command string) ([]byte, error) {
+	if list, ok := strings.CutPrefix(command, "for f in "); ok {
+		list, _, _ = strings.Cut(list, ";")
+		var out strings.Builder
+		for _, pattern := range strings.Fields(list) {
+			for name, content := range h.files {
+				if matched, _ := path.Match(pattern, name); matched {
+					fmt.Fprintf(&out, "==> %s\n%s", name, content)
+				}
+			}
+		}
+		return []byte(out.String()), nil
+	}
+	for prefix, out := range h.outputs {
+		if strings.HasPrefix(command, prefix) {
+			return []byte(out), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: command not found", command)
+}
+
+const netDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0: %d  2000    1    2    0     0          0         0 %d  1500    3    4    0     0       0          0
+  ppp0:    5000      50    0    0    0     0          0         0     6000      60    0    0    0     0       0          0
+`
+
+const accelSessions = ` sid              | ifname | username | calling-sid       | ip         | type  | state    | rate-limit | uptime-raw | rx-bytes-raw | tx-bytes-raw | rx-pkts | tx-pkts
+------------------+--------+----------+-------------------+------------+-------+----------+------------+------------+--------------+--------------+---------+---------
+ a1b2c3d4e5f60001 | ppp0   | alice    | aa:bb:cc:dd:ee:01 | 100.64.0.2 | pppoe | active   | 50M/50M    | 3600       | 1048576      | 2097152      | 1000    | 2000
+ a1b2c3d4e5f60002 | ppp1   | bob      | aa:bb:cc:dd:ee:02 |            | pppoe | starting |            | 1          | 0            | 0            | 0       | 0
+ a1b2c3d4e5f60003 | ipoe0  | carol    | aa:bb:cc:dd:ee:03 | 100.64.0.3 | ipoe  | active   |            | 60         | 10           | 20           | 1       | 2
+`
+
+func newFakeHost(cpuBusy, cpuIdle, rx, tx uint64) *fakeHost {
+	return &fakeHost{
+		files: map[string]string{
+			"/proc/stat":                                 fmt.Sprintf("cpu  %d 0 0 %d 0 0 0 0 0 0\ncpu0 1 0 0 1 0 0 0 0 0 0\n", cpuBusy, cpuIdle),
+			"/proc/meminfo":                              "MemTotal:        8000000 kB\nMemFree:         1000000 kB\nMemAvailable:    6000000 kB\n",
+			"/proc/uptime":                               "86400.52 170000.00\n",
+			"/proc/loadavg":                              "0.50 0.40 0.30 1/200 4242\n",
+			"/proc/sys/kernel/osrelease":                 "6.1.0-18-amd64\n",
+			"/sys/class/thermal/thermal_zone0/temp":      "41000\n",
+			"/sys/class/thermal/thermal_zone1/temp":      "55500\n",
+			"/proc/sys/net/netfilter/nf_conntrack_count": "12345\n",
+			"/proc/sys/net/netfilter/nf_conntrack_max":   "262144\n",
+		},
+		outputs: map[string]string{
+			"cat /proc/net/dev": fmt.Sprintf(netDev, rx, tx),
+			"grep -H . /sys/class/net/": "/sys/class/net/eth0/operstate:up\n/sys/class/net/eth0/speed:10000\n" +
+				"/sys/class/net/eth0/mtu:1500\n/sys/class/net/eth0/address:52:54:00:12:34:56\n" +
+				"/sys/class/net/eth0/duplex:full\n/sys/class/net/eth0/flags:0x1003\n" +
+				"/sys/class/net/lo/operstate:unknown\n/sys/class/net/lo/flags:0x9\n",
+			"accel-cmd show sessions": accelSessions,
+		},
+	}
+}
+
+func TestCollect(t *testing.T) {
+	c := NewLinuxCollector()
+	target, err := ParseTarget(&models.RouterConfig{
+		Address:     "10.0.0.3",
+		Credentials: models.RouterCredentials{Username: "monitor", SSHKey: "/etc/ispagent/id_ed25519"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now()
+
+	data, err := c.collect(ctx, newFakeHost(100, 900, 1_000_000, 2_000_000), "bng1", target, now)
+	if err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if len(data.Errors) > 0 {
+		t.Errorf("Errors = %v", data.Errors)
+	}
+
+	sys := data.System
+	if sys.CPUPercent != 0 {
+		t.Errorf("first poll CPUPercent = %v, want 0", sys.CPUPercent)
+	}
+	if sys.MemoryTotalBytes != 8000000*1024 || sys.MemoryPercent != 25 {
+		t.Errorf("memory = %d bytes, %v%%", sys.MemoryTotalBytes, sys.MemoryPercent)
+	}
+	if sys.UptimeSeconds != 86400 || sys.TemperatureCelsius != 55.5 || sys.FirmwareVersion != "6.1.0-18-amd64" {
+		t.Errorf("system = %+v", sys)
+	}
+	if data.CustomMetrics["system_load1"] != 0.5 || data.CustomMetrics["conntrack_entries"] != 12345 || data.CustomMetrics["conntrack_max"] != 262144 {
+		t.Errorf("CustomMetrics = %v", data.CustomMetrics)
+	}
+
+	// ppp interfaces are excluded by default
+	if len(data.Interfaces) != 2 {
+		t.Fatalf("got %d interfaces, want lo and eth0", len(data.Interfaces))
+	}
+	eth0 := data.Interfaces[1]
+	if eth0.Name != "eth0" || !eth0.IsUp || !eth0.Enabled || eth0.SpeedMbps != 10000 || eth0.MTU != 1500 || !eth0.FullDuplex {
+		t.Errorf("eth0 = %+v", eth0)
+	}
+	if eth0.RxErrors != 1 || eth0.RxDrops != 2 || eth0.TxErrors != 3 || eth0.TxDrops != 4 {
+		t.Errorf("eth0 errors/drops = %+v", eth0.InterfaceMetrics)
+	}
+	if !data.Interfaces[0].IsUp {
+		t.Error("lo with unknown operstate should be up")
+	}
+
+	if len(data.PPPoE) != 1 {
+		t.Fatalf("got %d PPPoE sessions, want 1 active", len(data.PPPoE))
+	}
+	s := data.PPPoE[0]
+	if s.Username != "alice" || s.Name != "ppp0" || s.Address != "100.64.0.2" || s.CallerID != "AA:BB:CC:DD:EE:01" || s.Uptime != 3600 || s.TxBytes != 2097152 {
+		t.Errorf("session = %+v", s)
+	}
+	if data.CustomMetrics[`accel_sessions{type="pppoe"}`] != 1 || data.CustomMetrics[`accel_sessions{type="ipoe"}`] != 1 {
+		t.Errorf("session counts = %v", data.CustomMetrics)
+	}
+
+	// 10 seconds later: 50% busy, 1 MB/s received
+	data, err = c.collect(ctx, newFakeHost(200, 1000, 11_000_000, 2_000_000), "bng1", target, now.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.System.CPUPercent != 50 {
+		t.Errorf("CPUPercent = %v, want 50", data.System.CPUPercent)
+	}
+	if eth0 := data.Interfaces[1]; eth0.RxBytesPerSec != 1_000_000 || eth0.TxBytesPerSec != 0 {
+		t.Errorf("eth0 rates = %v/%v", eth0.RxBytesPerSec, eth0.TxBytesPerSec)
+	}
+
+	// Counters reset, e.g. after a reboot
+	data, _ = c.collect(ctx, newFakeHost(10, 10, 100, 100), "bng1", target, now.Add(20*time.Second))
+	if eth0 := data.Interfaces[1]; eth0.RxBytesPerSec != 0 || data.System.CPUPercent != 0 {
+		t.Errorf("after reset: rx rate = %v, cpu = %v", eth0.RxBytesPerSec, data.System.CPUPercent)
+	}
+}
+
+func TestDataHandler_SessionReport(t *testing.T) {
+	c := NewLinuxCollector()
+	var got []*mikrotik.CollectedData
+	c.SetDataHandler(func(data *mikrotik.CollectedData) { got = append(got, data) })
+	target, err := ParseTarget(&models.RouterConfig{
+		Address:     "10.0.0.3",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.collect(context.Background(), newFakeHost(100, 900, 0, 0), "bng1", target, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.handle(data)
+	if len(got) != 1 || got[0].MetricsData != data.MetricsData || got[0].NATStats != data.Conntrack {
+		t.Fatalf("handler got %+v", got)
+	}
+
+	// Outputs build the session report from the handed data, as from MikroTik
+	report := transport.NewSessionReport("agent-1", got[0], privacy.NewRedactor(false, true))
+	if report == nil || report.RouterId != "bng1" || len(report.PppoeSessions) != 1 {
+		t.Fatalf("session report = %v", report)
+	}
+	if s := report.PppoeSessions[0]; s.Username != "alice" || s.FramedIp != "100.64.xxx.xxx" || s.BytesOut != 2097152 {
+		t.Errorf("session = %v", s)
+	}
+}
+
+func TestCollect_OptionalSources(t *testing.T) {
+	host := newFakeHost(1, 1, 0, 0)
+	delete(host.files, "/proc/sys/net/netfilter/nf_conntrack_count")
+	delete(host.outputs, "accel-cmd show sessions")
+
+	target, _ := ParseTarget(&models.RouterConfig{
+		Address:     "10.0.0.3",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "x"},
+		Metadata:    map[string]interface{}{"interface_include": []interface{}{"eth*"}},
+	})
+	data, err := NewLinuxCollector().collect(context.Background(), host, "r1", target, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Conntrack != nil {
+		t.Error("conntrack reported without nf_conntrack")
+	}
+	if len(data.Errors) != 1 || !strings.HasPrefix(data.Errors[0], "pppoe:") {
+		t.Errorf("Errors = %v, want the accel-cmd failure", data.Errors)
+	}
+	if len(data.Interfaces) != 1 || data.Interfaces[0].Name != "eth0" {
+		t.Errorf("interfaces = %+v", data.Interfaces)
+	}
+
+	target.AccelCmd = AccelCmdNone
+	if data, _ := NewLinuxCollector().collect(context.Background(), host, "r1", target, time.Now()); len(data.Errors) != 0 {
+		t.Errorf("accel_cmd none: Errors = %v", data.Errors)
+	}
+
+	delete(host.files, "/proc/stat")
+	if _, err := NewLinuxCollector().collect(context.Background(), host, "r1", target, time.Now()); err == nil {
+		t.Error("collect() without /proc/stat expected error")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget(&models.RouterConfig{
+		Address:     "10.0.0.3",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "x"},
+		Metadata: map[string]interface{}{
+			"port":      2222,
+			"accel_cmd": "accel-cmd -p 2002",
+		},
+	})
+	if err != nil {
+		t.Fatalf("ParseTarget() error = %v", err)
+	}
+	if target.Port != 2222 || target.AccelCmd != "accel-cmd -p 2002" || target.Timeout != 10*time.Second {
+		t.Errorf("target = %+v", target)
+	}
+
+	errorCases := map[string]models.RouterConfig{
+		"no address":     {Credentials: models.RouterCredentials{Username: "u", Password: "x"}},
+		"no username":    {Address: "10.0.0.3", Credentials: models.RouterCredentials{Password: "x"}},
+		"no credentials": {Address: "10.0.0.3", Credentials: models.RouterCredentials{Username: "u"}},
+	}
+	for name, router := range errorCases {
+		if _, err := ParseTarget(&router); err == nil {
+			t.Errorf("%s: ParseTarget() expected error", name)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package linux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// systemFiles are read in one command; the globs may match nothing.
+var systemFiles = []string{
+	"/proc/stat",
+	"/proc/meminfo",
+	"/proc/uptime",
+	"/proc/loadavg",
+	"/proc/sys/kernel/osrelease",
+	"/sys/devices/virtual/dmi/id/product_name",
+	"/sys/class/thermal/thermal_zone*/temp",
+}
+
+// cpuSample holds the cumulative CPU times of /proc/stat, in clock ticks.
+type cpuSample struct {
+	total uint64
+	idle  uint64
+}
+
+// counters holds the previous interface counters for rate calculation.
+type counters struct {
+	rxBytes, txBytes, rxPackets, txPackets uint64
+	timestamp                              time.Time
+}
+
+// readFiles returns the contents of the files, which may contain shell
+// globs, by path. Unreadable files are left out.
+func readFiles(ctx context.Context, r runner, paths ...string) (map[string]string, error) {
+	command := "for f in " + strings.Join(paths, " ") + `; do [ -r "$f" ] && echo "==> $f" && cat "$f"; done; true`
+	out, err := r.Run(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	var current string
+	var content strings.Builder
+	flush := func() {
+		if current != "" {
+			files[current] = content.String()
+		}
+		content.Reset()
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "==> /"); ok {
+			flush()
+			current = "/" + name
+			continue
+		}
+		content.WriteString(line)
+		content.WriteByte('\n')
+	}
+	flush()
+	return files, scanner.Err()
+}
+
+// collectSystem reads CPU, memory, uptime, load and temperature. CPU usage
+// is computed between polls, so it is reported from the second poll on.
+func (c *Collector) collectSystem(ctx context.Context, r runner, routerID string, data *CollectedData) error {
+	files, err := readFiles(ctx, r, systemFiles...)
+	if err != nil {
+		return err
+	}
+
+	sample, ok := parseCPU(files["/proc/stat"])
+	if !ok {
+		return fmt.Errorf("no cpu line in /proc/stat")
+	}
+	c.mu.Lock()
+	prev, seen := c.cpu[routerID]
+	c.cpu[routerID] = sample
+	c.mu.Unlock()
+	if seen && sample.total > prev.total && sample.idle >= prev.idle {
+		busy := float64((sample.total - prev.total) - (sample.idle - prev.idle))
+		data.System.CPUPercent = busy / float64(sample.total-prev.total) * 100
+	}
+
+	meminfo := parseMeminfo(files["/proc/meminfo"])
+	total, available := meminfo["MemTotal"], meminfo["MemAvailable"]
+	if _, ok := meminfo["MemAvailable"]; !ok {
+		// Kernels before 3.14
+		available = meminfo["MemFree"] + meminfo["Buffers"] + meminfo["Cached"]
+	}
+	if total > 0 {
+		data.System.MemoryTotalBytes = total
+		data.System.MemoryUsedBytes = total - available
+		data.System.MemoryPercent = float64(total-available) / float64(total) * 100
+	}
+
+	if fields := strings.Fields(files["/proc/uptime"]); len(fields) > 0 {
+		uptime, _ := strconv.ParseFloat(fields[0], 64)
+		data.System.UptimeSeconds = int64(uptime)
+	}
+	if fields := strings.Fields(files["/proc/loadavg"]); len(fields) >= 3 {
+		for i, name := range []string{"system_load1", "system_load5", "system_load15"} {
+			load, _ := strconv.ParseFloat(fields[i], 64)
+			data.CustomMetrics[name] = load
+		}
+	}
+
+	data.System.FirmwareVersion = strings.TrimSpace(files["/proc/sys/kernel/osrelease"])
+	data.System.BoardName = strings.TrimSpace(files["/sys/devices/virtual/dmi/id/product_name"])
+
+	// The hottest thermal zone, in millidegrees
+	for name, content := range files {
+		if matched, _ := path.Match("/sys/class/thermal/thermal_zone*/temp", name); !matched {
+			continue
+		}
+		milli, err := strconv.ParseInt(strings.TrimSpace(content), 10, 64)
+		if err == nil && float64(milli)/1000 > data.System.TemperatureCelsius {
+			data.System.TemperatureCelsius = float64(milli) / 1000
+		}
+	}
+
+	return nil
+}
+
+// parseCPU reads the aggregate cpu line of /proc/stat.
+func parseCPU(stat string) (cpuSample, bool) {
+	for _, line := range strings.Split(stat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal; guest time is
+		// already included in user
+		var sample cpuSample
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			v, _ := strconv.ParseUint(field, 10, 64)
+			sample.total += v
+			if i == 3 || i == 4 {
+				sample.idle += v
+			}
+		}
+		return sample, true
+	}
+	return cpuSample{}, false
+}
+
+// parseMeminfo returns /proc/meminfo values in bytes.
+func parseMeminfo(meminfo string) map[string]int64 {
+	values := make(map[string]int64)
+	for _, line := range strings.Split(meminfo, "\n") {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		values[name] = v
+	}
+	return values
+}
+
+// collectInterfaces reads /proc/net/dev counters and link state from sysfs.
+func (c *Collector) collectInterfaces(ctx context.Context, r runner, routerID string, target *Target, now time.Time) ([]mikrotik.InterfaceMetrics, error) {
+	out, err := r.Run(ctx, "cat /proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	interfaces := parseNetDev(string(out))
+
+	// Link attributes are optional; speed cannot be read on virtual links
+	attrs := make(map[string]map[string]string)
+	if out, err := r.Run(ctx, "grep -H . /sys/class/net/*/operstate /sys/class/net/*/speed /sys/class/net/*/mtu /sys/class/net/*/address /sys/class/net/*/duplex /sys/class/net/*/flags 2>/dev/null; true"); err == nil {
+		attrs = parseSysfs(string(out))
+	}
+
+	var result []mikrotik.InterfaceMetrics
+	seen := make(map[string]bool)
+	for _, iface := range interfaces {
+		if !mikrotik.MatchFilter(iface.Name, target.InterfaceInclude, target.InterfaceExclude) {
+			continue
+		}
+
+		a := attrs[iface.Name]
+		// Tunnels and loopback report an unknown state while passing traffic
+		iface.IsUp = a["operstate"] == "up" || a["operstate"] == "unknown"
+		if speed, err := strconv.ParseInt(a["speed"], 10, 64); err == nil && speed > 0 {
+			iface.SpeedMbps = speed
+		}
+		metrics := mikrotik.InterfaceMetrics{
+			InterfaceMetrics: iface,
+			MAC:              strings.ToUpper(a["address"]),
+			MTU:              mikrotik.ParseInt64(a["mtu"]),
+			Enabled:          interfaceFlags(a["flags"])&iffUp != 0,
+			FullDuplex:       a["duplex"] == "full",
+		}
+
+		key := routerID + "|" + iface.Name
+		seen[key] = true
+		c.updateRates(key, &metrics, now)
+
+		result = append(result, metrics)
+	}
+
+	// Forget interfaces that disappeared, such as ended ppp sessions
+	c.mu.Lock()
+	for key := range c.counters {
+		if strings.HasPrefix(key, routerID+"|") && !seen[key] {
+			delete(c.counters, key)
+		}
+	}
+	c.mu.Unlock()
+
+	return result, nil
+}
+
+// updateRates sets per-second rates from the previous counters. Decreasing
+// counters mean the interface was recreated, so no rate is reported.
+func (c *Collector) updateRates(key string, m *mikrotik.InterfaceMetrics, now time.Time) {
+	current := counters{
+		rxBytes:   uint64(m.RxBytes),
+		txBytes:   uint64(m.TxBytes),
+		rxPackets: uint64(m.RxPackets),
+		txPackets: uint64(m.TxPackets),
+		timestamp: now,
+	}
+
+	c.mu.Lock()
+	prev, ok := c.counters[key]
+	c.counters[key] = current
+	c.mu.Unlock()
+
+	elapsed := now.Sub(prev.timestamp).Seconds()
+	if !ok || elapsed <= 0 ||
+		current.rxBytes < prev.rxBytes || current.txBytes < prev.txBytes ||
+		current.rxPackets < prev.rxPackets || current.txPackets < prev.txPackets {
+		return
+	}
+	m.RxBytesPerSec = float64(current.rxBytes-prev.rxBytes) / elapsed
+	m.TxBytesPerSec = float64(current.txBytes-prev.txBytes) / elapsed
+	m.RxPktsPerSec = float64(current.rxPackets-prev.rxPackets) / elapsed
+	m.TxPktsPerSec = float64(current.txPackets-prev.txPackets) / elapsed
+}
+
+// parseNetDev parses /proc/net/dev.
+func parseNetDev(netdev string) []models.InterfaceMetrics {
+	var result []models.InterfaceMetrics
+	for _, line := range strings.Split(netdev, "\n") {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			continue
+		}
+		v := func(i int) int64 {
+			n, _ := strconv.ParseInt(fields[i], 10, 64)
+			return n
+		}
+		result = append(result, models.InterfaceMetrics{
+			Name:      strings.TrimSpace(name),
+			RxBytes:   v(0),
+			RxPackets: v(1),
+			RxErrors:  v(2),
+			RxDrops:   v(3),
+			TxBytes:   v(8),
+			TxPackets: v(9),
+			TxErrors:  v(10),
+			TxDrops:   v(11),
+		})
+	}
+	return result
+}
+
+// parseSysfs parses "grep -H" output of /sys/class/net/<name>/<attribute>
+// files into attributes by interface.
+func parseSysfs(out string) map[string]map[string]string {
+	attrs := make(map[string]map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		file, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(file, "/sys/class/net/"), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		if attrs[parts[0]] == nil {
+			attrs[parts[0]] = make(map[string]string)
+		}
+		attrs[parts[0]][parts[1]] = strings.TrimSpace(value)
+	}
+	return attrs
+}
+
+// iffUp is the IFF_UP interface flag, set when the link is administratively
+// up.
+const iffUp = 0x1
+
+// interfaceFlags parses a sysfs flags value such as "0x1003".
+func interfaceFlags(s string) uint64 {
+	flags, _ := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+	return flags
+}
+
+// collectConntrack reads the netfilter connection tracking table size.
+func collectConntrack(ctx context.Context, r runner) (*mikrotik.NATStats, error) {
+	files, err := readFiles(ctx, r, "/proc/sys/net/netfilter/nf_conntrack_count", "/proc/sys/net/netfilter/nf_conntrack_max")
+	if err != nil {
+		return nil, err
+	}
+	count, ok := files["/proc/sys/net/netfilter/nf_conntrack_count"]
+	if !ok {
+		return nil, fmt.Errorf("nf_conntrack is not loaded")
+	}
+	return &mikrotik.NATStats{
+		TotalConnections: int(mikrotik.ParseInt64(strings.TrimSpace(count))),
+		MaxEntries:       mikrotik.ParseInt64(strings.TrimSpace(files["/proc/sys/net/netfilter/nf_conntrack_max"])),
+	}, nil
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseMetricKey splits a MetricsData.CustomMetrics key such as
+// `probe_rtt_avg_ms{target="1.1.1.1"}` into its name and label pairs. Keys
+// with invalid names or malformed labels are rejected
+func ParseMetricKey(key string) (name string, labels [][2]string, ok bool) {
+	name, rest, hasLabels := strings.Cut(key, "{")
+	if !validName(name) {
+		return "", nil, false
+	}
+	if !hasLabels {
+		return name, nil, true
+	}
+
+	rest, found := strings.CutSuffix(rest, "}")
+	if !found {
+		return "", nil, false
+	}
+	for rest != "" {
+		label, value, found := strings.Cut(rest, "=")
+		if !found || !validName(label) {
+			return "", nil, false
+		}
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return "", nil, false
+		}
+		unquoted, _ := strconv.Unquote(quoted)
+		labels = append(labels, [2]string{label, unquoted})
+
+		rest = value[len(quoted):]
+		if rest != "" {
+			if rest, found = strings.CutPrefix(rest, ","); !found {
+				return "", nil, false
+			}
+		}
+	}
+	return name, labels, true
+}
+
+// validName reports whether s is a valid metric or label name
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetricKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		name   string
+		labels [][2]string
+		ok     bool
+	}{
+		{"system_load1", "system_load1", nil, true},
+		{`probe_rtt_avg_ms{target="1.1.1.1"}`, "probe_rtt_avg_ms", [][2]string{{"target", "1.1.1.1"}}, true},
+		{`a{x="1",y="q\"}"}`, "a", [][2]string{{"x", "1"}, {"y", `q"}`}}, true},
+		{`1abc`, "", nil, false},
+		{`bad-name`, "", nil, false},
+		{`a{x=1}`, "", nil, false},
+		{`a{x="1"`, "", nil, false},
+		{`a{x="1";y="2"}`, "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			name, labels, ok := ParseMetricKey(tt.key)
+			if name != tt.name || !reflect.DeepEqual(labels, tt.labels) || ok != tt.ok {
+				t.Errorf("ParseMetricKey() = %q, %v, %v, want %q, %v, %v", name, labels, ok, tt.name, tt.labels, tt.ok)
+			}
+		})
+	}
+}
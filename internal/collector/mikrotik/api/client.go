@@ -7,6 +7,7 @@ import (
 	"crypto/md5"
 	"crypto/tls"
 	"encoding/hex"
+	"errors"
 	"io"
 	"net"
 	"sync"
@@ -24,6 +25,7 @@ type ClientConfig struct {
 	Timeout            time.Duration // Connection and read/write timeout
 	RetryAttempts      int           // Number of retry attempts
 	RetryDelay         time.Duration // Delay between retries
+	RecordFile         string        // Append all commands and replies to this file, with credentials scrubbed
 }
 
 // DefaultConfig returns a ClientConfig with default values.
@@ -44,6 +46,7 @@ type Client struct {
 	mu         sync.Mutex
 	connected  bool
 	apiVersion string // Detected API version for login method selection
+	recorder   *Recorder
 
 	// Circuit breaker
 	circuitBreaker *circuitBreaker
@@ -153,6 +156,14 @@ func (c *Client) Connect(ctx context.Context) error {
 		return ErrCircuitOpen
 	}
 
+	if c.config.RecordFile != "" && c.recorder == nil {
+		recorder, err := CreateRecorder(c.config.RecordFile)
+		if err != nil {
+			return err
+		}
+		c.recorder = recorder
+	}
+
 	var lastErr error
 	for attempt := 0; attempt <= c.config.RetryAttempts; attempt++ {
 		if attempt > 0 {
@@ -224,10 +235,16 @@ func (c *Client) connect(ctx context.Context) error {
 
 func (c *Client) authenticate(ctx context.Context) error {
 	// Try new login method first (RouterOS 6.43+)
-	if err := c.tryNewLogin(); err == nil {
+	err := c.tryNewLogin()
+	if err == nil {
 		return nil
 	}
 
+	// Nothing to fall back on if the router dropped the connection
+	if c.conn == nil {
+		return err
+	}
+
 	// Fall back to legacy challenge-response login
 	return c.tryLegacyLogin()
 }
@@ -241,7 +258,7 @@ func (c *Client) tryNewLogin() error {
 		return err
 	}
 
-	reply, err := c.readReply()
+	reply, err := c.readLoginReply()
 	if err != nil {
 		return err
 	}
@@ -251,13 +268,15 @@ func (c *Client) tryNewLogin() error {
 	}
 
 	if !reply.IsDone() {
-		// Check if we got a challenge (old method)
-		if ret, ok := reply.Data["ret"]; ok {
-			return c.handleLegacyChallenge(ret)
-		}
 		return NewProtocolError("unexpected login response", nil)
 	}
 
+	// Routers before 6.43 ignore the credentials and answer with a
+	// challenge for the old method
+	if ret, ok := reply.Data["ret"]; ok {
+		return c.handleLegacyChallenge(ret)
+	}
+
 	return nil
 }
 
@@ -268,7 +287,7 @@ func (c *Client) tryLegacyLogin() error {
 		return err
 	}
 
-	reply, err := c.readReply()
+	reply, err := c.readLoginReply()
 	if err != nil {
 		return err
 	}
@@ -313,7 +332,7 @@ func (c *Client) handleLegacyChallenge(challenge string) error {
 		return err
 	}
 
-	reply, err := c.readReply()
+	reply, err := c.readLoginReply()
 	if err != nil {
 		return err
 	}
@@ -329,11 +348,30 @@ func (c *Client) handleLegacyChallenge(challenge string) error {
 	return nil
 }
 
+// readLoginReply reads the replies to /login. A failed login is answered
+// with a !trap followed by !done, which must be read too.
+func (c *Client) readLoginReply() (*Reply, error) {
+	replies, err := c.readAllReplies()
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if reply.IsTrap() {
+			return reply, nil
+		}
+	}
+	return replies[len(replies)-1], nil
+}
+
 // Close closes the connection to the router.
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.recorder != nil {
+		c.recorder.Close()
+		c.recorder = nil
+	}
 	return c.closeConn()
 }
 
@@ -364,19 +402,94 @@ func (c *Client) Execute(ctx context.Context, sentence *Sentence) ([]*Reply, err
 		return nil, ErrNotConnected
 	}
 
-	// Set deadline
-	if c.config.Timeout > 0 {
-		deadline := time.Now().Add(c.config.Timeout)
-		if err := c.conn.SetDeadline(deadline); err != nil {
-			return nil, NewConnectionError("failed to set deadline", err)
-		}
+	if err := c.setDeadline(); err != nil {
+		c.closeConn()
+		return nil, err
 	}
 
 	if err := c.writeSentence(sentence); err != nil {
+		c.closeConn()
 		return nil, err
 	}
 
-	return c.readAllReplies()
+	replies, err := c.readAllReplies()
+	if err != nil {
+		// The rest of the replies would be read as the answer to the
+		// next command
+		c.closeConn()
+		return nil, err
+	}
+	return replies, nil
+}
+
+// RunStream executes a command and calls fn for every data reply as it is
+// read, without buffering the whole result set. The deadline is extended
+// after each reply, so long listings are bounded by idle time rather than
+// total transfer time.
+//
+// If fn returns an error, the remaining replies are drained and discarded
+// to keep the connection in sync, and that error is returned. A trap is
+// returned once the command completes.
+func (c *Client) RunStream(ctx context.Context, command string, args map[string]string, fn func(map[string]string) error) error {
+	sentence := NewSentence(command)
+	for k, v := range args {
+		sentence.AddAttribute(k, v)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return ErrNotConnected
+	}
+
+	if err := c.setDeadline(); err != nil {
+		c.closeConn()
+		return err
+	}
+
+	if err := c.writeSentence(sentence); err != nil {
+		c.closeConn()
+		return err
+	}
+
+	var fnErr, trapErr error
+	for {
+		// Abandoning a half-read reply stream would desynchronize the
+		// connection, so cancellation and read errors close it instead.
+		if err := ctx.Err(); err != nil {
+			c.closeConn()
+			return err
+		}
+
+		if err := c.setDeadline(); err != nil {
+			c.closeConn()
+			return err
+		}
+
+		reply, err := c.readReply()
+		if err != nil {
+			c.closeConn()
+			return err
+		}
+
+		switch {
+		case reply.IsFatal():
+			c.closeConn()
+			return NewFatalError(reply)
+		case reply.IsTrap():
+			trapErr = NewTrapError(reply)
+		case reply.IsData():
+			if fnErr == nil && trapErr == nil {
+				fnErr = fn(reply.Data)
+			}
+		case reply.IsDone():
+			if trapErr != nil {
+				return trapErr
+			}
+			return fnErr
+		}
+	}
 }
 
 // Run executes a command and returns the data replies (filtering out !done).
@@ -420,7 +533,21 @@ func (c *Client) RunOne(ctx context.Context, command string, args map[string]str
 	return results[0], nil
 }
 
+// setDeadline applies the configured timeout to the next read or write.
+func (c *Client) setDeadline() error {
+	if c.config.Timeout <= 0 {
+		return nil
+	}
+	if err := c.conn.SetDeadline(time.Now().Add(c.config.Timeout)); err != nil {
+		return NewConnectionError("failed to set deadline", err)
+	}
+	return nil
+}
+
 func (c *Client) writeSentence(sentence *Sentence) error {
+	if c.recorder != nil {
+		c.recorder.command(sentence)
+	}
 	data := EncodeSentence(sentence)
 	_, err := c.conn.Write(data)
 	if err != nil {
@@ -431,8 +558,15 @@ func (c *Client) writeSentence(sentence *Sentence) error {
 
 func (c *Client) readReply() (*Reply, error) {
 	reply, err := DecodeSentence(c.reader)
+	if c.recorder != nil {
+		if err != nil {
+			c.recorder.fail(err)
+		} else {
+			c.recorder.reply(reply)
+		}
+	}
 	if err != nil {
-		if err == io.EOF {
+		if errors.Is(err, io.EOF) {
 			c.closeConn()
 			return nil, ErrConnectionClosed
 		}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"net"
 	"testing"
 	"time"
 )
@@ -173,3 +176,147 @@ func TestClientResetCircuitBreaker(t *testing.T) {
 		t.Error("circuit should be closed after reset")
 	}
 }
+
+// newPipeClient returns a client already connected to one end of an
+// in-memory pipe, and the other end for the test to act as the router.
+func newPipeClient(t *testing.T) (*Client, net.Conn) {
+	t.Helper()
+
+	clientConn, routerConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		routerConn.Close()
+	})
+
+	client := NewClient(&ClientConfig{Timeout: time.Second})
+	client.conn = clientConn
+	client.reader = bufio.NewReader(clientConn)
+	client.connected = true
+
+	return client, routerConn
+}
+
+// serveReplies reads one command from conn and answers with the given replies.
+func serveReplies(t *testing.T, conn net.Conn, replies ...*Sentence) {
+	t.Helper()
+
+	go func() {
+		reader := bufio.NewReader(conn)
+		if _, err := DecodeSentence(reader); err != nil {
+			return
+		}
+		for _, r := range replies {
+			if _, err := conn.Write(EncodeSentence(r)); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func TestClientRunStream(t *testing.T) {
+	client, router := newPipeClient(t)
+
+	serveReplies(t, router,
+		NewSentence("!re").AddAttribute("name", "ether1"),
+		NewSentence("!re").AddAttribute("name", "ether2"),
+		NewSentence("!re").AddAttribute("name", "ether3"),
+		NewSentence("!done"),
+	)
+
+	var names []string
+	err := client.RunStream(context.Background(), "/interface/print", nil, func(row map[string]string) error {
+		names = append(names, row["name"])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+
+	if len(names) != 3 || names[0] != "ether1" || names[2] != "ether3" {
+		t.Errorf("unexpected rows: %v", names)
+	}
+}
+
+func TestClientRunStreamCallbackError(t *testing.T) {
+	client, router := newPipeClient(t)
+
+	serveReplies(t, router,
+		NewSentence("!re").AddAttribute("name", "ether1"),
+		NewSentence("!re").AddAttribute("name", "ether2"),
+		NewSentence("!done"),
+	)
+
+	stop := errors.New("stop")
+	calls := 0
+	err := client.RunStream(context.Background(), "/interface/print", nil, func(row map[string]string) error {
+		calls++
+		return stop
+	})
+
+	if err != stop {
+		t.Errorf("expected callback error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected callback to stop after first row, got %d calls", calls)
+	}
+	if !client.IsConnected() {
+		t.Error("client should stay connected after draining the stream")
+	}
+}
+
+func TestClientRunStreamTrap(t *testing.T) {
+	client, router := newPipeClient(t)
+
+	serveReplies(t, router,
+		NewSentence("!trap").AddAttribute("message", "no such command"),
+		NewSentence("!done"),
+	)
+
+	err := client.RunStream(context.Background(), "/bogus/print", nil, func(row map[string]string) error {
+		return nil
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != ErrTypeTrap {
+		t.Fatalf("expected trap error, got %v", err)
+	}
+	if apiErr.Message != "no such command" {
+		t.Errorf("unexpected trap message %q", apiErr.Message)
+	}
+}
+
+func TestClientRunStreamTimeout(t *testing.T) {
+	client, router := newPipeClient(t)
+	client.config.Timeout = 50 * time.Millisecond
+
+	// The router stalls after the first row, leaving the stream half read
+	serveReplies(t, router,
+		NewSentence("!re").AddAttribute("name", "ether1"),
+	)
+
+	rows := 0
+	err := client.RunStream(context.Background(), "/ip/firewall/connection/print", nil, func(row map[string]string) error {
+		rows++
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if rows != 1 {
+		t.Errorf("expected 1 row before the timeout, got %d", rows)
+	}
+	if client.IsConnected() {
+		t.Error("client should close a connection left out of sync")
+	}
+}
+
+func TestClientRunStreamNotConnected(t *testing.T) {
+	client := NewClient(nil)
+
+	err := client.RunStream(context.Background(), "/interface/print", nil, func(row map[string]string) error {
+		return nil
+	})
+	if err != ErrNotConnected {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
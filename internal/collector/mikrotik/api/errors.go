@@ -207,3 +207,12 @@ func IsCircuitOpenError(err error) bool {
 	}
 	return false
 }
+
+// IsTrapError checks if the error is a RouterOS trap error.
+func IsTrapError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Type == ErrTypeTrap
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exchange is a recorded command and the replies to it.
+type Exchange struct {
+	Time    time.Time         `json:"time"`
+	Command string            `json:"command"`
+	Args    map[string]string `json:"args,omitempty"`
+	Replies []RecordedReply   `json:"replies"`
+	Error   string            `json:"error,omitempty"` // Read error that ended the exchange
+}
+
+// RecordedReply is one reply sentence of an exchange.
+type RecordedReply struct {
+	Type string            `json:"type"`
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// scrubbed replaces credentials in recorded /login commands.
+const scrubbed = "<scrubbed>"
+
+// loginSecrets are the /login attributes replaced in recordings.
+var loginSecrets = []string{"name", "password", "response"}
+
+// Recorder writes exchanges as JSON lines. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	closer  io.Closer
+	current *Exchange
+}
+
+// NewRecorder creates a recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// CreateRecorder creates a recorder appending to the file at path, so that
+// several polls of a router can be captured in one file.
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	return &Recorder{w: f, closer: f}, nil
+}
+
+// Close writes an unfinished exchange and closes the file opened by
+// CreateRecorder.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.flush()
+	if r.closer != nil {
+		if closeErr := r.closer.Close(); err == nil {
+			err = closeErr
+		}
+		r.closer = nil
+	}
+	return err
+}
+
+// command starts a new exchange for a sentence sent to the router.
+func (r *Recorder) command(s *Sentence) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.flush()
+	ex := &Exchange{
+		Time:    time.Now().UTC(),
+		Command: s.Word,
+		Replies: []RecordedReply{},
+	}
+	for _, word := range s.Words {
+		key, value, ok := ParseAttributeWord(word)
+		if !ok {
+			continue
+		}
+		if ex.Args == nil {
+			ex.Args = make(map[string]string)
+		}
+		ex.Args[key] = value
+	}
+	if ex.Command == "/login" {
+		for _, key := range loginSecrets {
+			if _, ok := ex.Args[key]; ok {
+				ex.Args[key] = scrubbed
+			}
+		}
+	}
+	r.current = ex
+}
+
+// reply adds a reply to the current exchange and writes the exchange when
+// the reply completes it.
+func (r *Recorder) reply(reply *Reply) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return
+	}
+	rec := RecordedReply{Type: reply.Type}
+	if len(reply.Data) > 0 {
+		rec.Data = make(map[string]string, len(reply.Data))
+		for k, v := range reply.Data {
+			rec.Data[k] = v
+		}
+	}
+	r.current.Replies = append(r.current.Replies, rec)
+	if reply.IsDone() || reply.IsFatal() {
+		r.flush()
+	}
+}
+
+// fail ends the current exchange with a read error.
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return
+	}
+	r.current.Error = err.Error()
+	r.flush()
+}
+
+// flush writes the current exchange. Callers must hold r.mu.
+func (r *Recorder) flush() error {
+	if r.current == nil {
+		return nil
+	}
+	data, err := json.Marshal(r.current)
+	r.current = nil
+	if err != nil {
+		return err
+	}
+	_, err = r.w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadRecording reads the exchanges written by a Recorder.
+func ReadRecording(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal([]byte(text), &ex); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return exchanges, nil
+}
+
+// LoadRecording reads a recording file.
+func LoadRecording(path string) ([]Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRecording(f)
+}
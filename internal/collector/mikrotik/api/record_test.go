@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	client, router := newPipeClient(t)
+	client.recorder = NewRecorder(&buf)
+
+	// Logins are recorded with the credentials scrubbed
+	client.recorder.command(NewSentence("/login").AddAttribute("name", "admin").AddAttribute("password", "secret"))
+	client.recorder.reply(&Reply{Type: "!done"})
+
+	serveReplies(t, router,
+		NewSentence("!re").AddAttribute("name", "ether1").AddAttribute("rx-byte", "100"),
+		NewSentence("!re").AddAttribute("name", "ether2"),
+		NewSentence("!done"),
+	)
+	if _, err := client.Run(context.Background(), "/interface/print", map[string]string{".proplist": "name,rx-byte"}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	serveReplies(t, router,
+		NewSentence("!trap").AddAttribute("message", "no such command prefix"),
+		NewSentence("!done"),
+	)
+	if _, err := client.Run(context.Background(), "/ip/hotspot/print", nil); !IsTrapError(err) {
+		t.Fatalf("Run() error = %v, want trap", err)
+	}
+
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "admin") {
+		t.Errorf("recording contains credentials:\n%s", buf.String())
+	}
+
+	exchanges, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatalf("ReadRecording() error = %v", err)
+	}
+	if len(exchanges) != 3 {
+		t.Fatalf("got %d exchanges, want 3", len(exchanges))
+	}
+	if exchanges[0].Args["password"] != scrubbed {
+		t.Errorf("login args = %v", exchanges[0].Args)
+	}
+	ex := exchanges[1]
+	if ex.Command != "/interface/print" || ex.Args[".proplist"] != "name,rx-byte" || len(ex.Replies) != 3 || ex.Replies[0].Data["rx-byte"] != "100" {
+		t.Errorf("exchange = %+v", ex)
+	}
+	if exchanges[2].Replies[0].Type != "!trap" || exchanges[2].Replies[1].Type != "!done" {
+		t.Errorf("trap exchange = %+v", exchanges[2])
+	}
+}
+
+func TestRecorder_ReadError(t *testing.T) {
+	var buf bytes.Buffer
+	client, router := newPipeClient(t)
+	client.recorder = NewRecorder(&buf)
+
+	go func() {
+		DecodeSentence(router)
+		router.Write(EncodeSentence(NewSentence("!re").AddAttribute("name", "ether1")))
+		router.Close()
+	}()
+	if _, err := client.Run(context.Background(), "/interface/print", nil); err == nil {
+		t.Fatal("Run() succeeded on a closed connection")
+	}
+
+	exchanges, err := ReadRecording(&buf)
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("ReadRecording() = %v, %v", exchanges, err)
+	}
+	if len(exchanges[0].Replies) != 1 || exchanges[0].Error == "" {
+		t.Errorf("exchange = %+v, want one reply and the read error", exchanges[0])
+	}
+}
@@ -0,0 +1,178 @@
+package apisim
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Profile sizes the tables generated by Populate.
+type Profile struct {
+	Interfaces  int // Ethernet interfaces
+	Sessions    int // Active PPPoE sessions, each with a pppoe-in interface
+	Leases      int // DHCP leases
+	Connections int // Connection tracking entries
+}
+
+// Populate fills the router with generated interfaces, PPPoE sessions, DHCP
+// leases and connection tracking entries shaped like those of an access
+// router. The data is deterministic, so tests can assert on it.
+func (r *Router) Populate(p Profile) {
+	var interfaces, ethernet []map[string]string
+	for i := 1; i <= p.Interfaces; i++ {
+		name := fmt.Sprintf("ether%d", i)
+		interfaces = append(interfaces, map[string]string{
+			"name":        name,
+			"type":        "ether",
+			"mtu":         "1500",
+			"mac-address": mac(0x10, i),
+			"running":     "true",
+			"disabled":    "false",
+			"rx-byte":     strconv.Itoa(i * 1_000_000_000),
+			"tx-byte":     strconv.Itoa(i * 250_000_000),
+			"rx-packet":   strconv.Itoa(i * 1_000_000),
+			"tx-packet":   strconv.Itoa(i * 400_000),
+			"rx-error":    "0",
+			"tx-error":    "0",
+			"rx-drop":     "0",
+			"tx-drop":     "0",
+		})
+		ethernet = append(ethernet, map[string]string{
+			"name":        name,
+			"speed":       "1Gbps",
+			"full-duplex": "true",
+		})
+	}
+
+	var sessions []map[string]string
+	for i := 1; i <= p.Sessions; i++ {
+		user := fmt.Sprintf("user%d", i)
+		sessions = append(sessions, map[string]string{
+			"name":       user,
+			"service":    "pppoe",
+			"caller-id":  mac(0x20, i),
+			"address":    ipv4(100, 64, i),
+			"uptime":     fmt.Sprintf("%dh%dm", i%24, i%60),
+			"encoding":   "",
+			"session-id": fmt.Sprintf("0x81%06X", i),
+			"radius":     "true",
+		})
+		interfaces = append(interfaces, map[string]string{
+			"name":      "<pppoe-" + user + ">",
+			"type":      "pppoe-in",
+			"mtu":       "1480",
+			"running":   "true",
+			"disabled":  "false",
+			"dynamic":   "true",
+			"rx-byte":   strconv.Itoa(i * 10_000_000),
+			"tx-byte":   strconv.Itoa(i * 80_000_000),
+			"rx-packet": strconv.Itoa(i * 10_000),
+			"tx-packet": strconv.Itoa(i * 60_000),
+		})
+	}
+
+	var leases, used []map[string]string
+	for i := 1; i <= p.Leases; i++ {
+		address := ipv4(10, 0, i)
+		leases = append(leases, map[string]string{
+			"address":       address,
+			"mac-address":   mac(0x30, i),
+			"host-name":     fmt.Sprintf("host-%d", i),
+			"server":        "dhcp1",
+			"active-server": "dhcp1",
+			"status":        "bound",
+			"expires-after": "9m30s",
+			"last-seen":     "30s",
+			"dynamic":       "true",
+			"blocked":       "false",
+			"disabled":      "false",
+		})
+		used = append(used, map[string]string{
+			"pool":    "dhcp_pool1",
+			"address": address,
+			"owner":   "dhcp1",
+			"info":    mac(0x30, i),
+		})
+	}
+
+	protocols := []string{"tcp", "udp", "icmp"}
+	var connections []map[string]string
+	counts := make(map[string]int)
+	for i := 1; i <= p.Connections; i++ {
+		proto := protocols[i%len(protocols)]
+		counts[proto]++
+		src := ipv4(100, 64, 1+i%max(p.Sessions, 1))
+		dst := fmt.Sprintf("203.0.113.%d", 1+i%254)
+		conn := map[string]string{
+			"protocol":     proto,
+			"timeout":      "23h59m",
+			"assured":      "true",
+			"confirmed":    "true",
+			"orig-bytes":   strconv.Itoa(i * 1200),
+			"repl-bytes":   strconv.Itoa(i * 9600),
+			"orig-packets": strconv.Itoa(i * 10),
+			"repl-packets": strconv.Itoa(i * 12),
+		}
+		if proto == "icmp" {
+			conn["src-address"] = src
+			conn["dst-address"] = dst
+			conn["reply-src-address"] = dst
+			conn["reply-dst-address"] = "198.51.100.1"
+			conn["icmp-type"] = "8"
+			conn["icmp-code"] = "0"
+			conn["icmp-id"] = strconv.Itoa(i)
+		} else {
+			port := 1024 + i%64000
+			conn["src-address"] = fmt.Sprintf("%s:%d", src, port)
+			conn["dst-address"] = dst + ":443"
+			conn["reply-src-address"] = dst + ":443"
+			conn["reply-dst-address"] = fmt.Sprintf("198.51.100.1:%d", port)
+		}
+		if proto == "tcp" {
+			conn["tcp-state"] = "established"
+		}
+		connections = append(connections, conn)
+	}
+
+	r.SetTable("/interface", interfaces)
+	r.SetTable("/interface/ethernet", ethernet)
+	r.SetTable("/ppp/active", sessions)
+	r.SetTable("/interface/pppoe-server/server", []map[string]string{{
+		"service-name": "pppoe",
+		"interface":    "ether2",
+		"disabled":     "false",
+	}})
+	r.SetTable("/ip/dhcp-server/lease", leases)
+	r.SetTable("/ip/dhcp-server", []map[string]string{{
+		"name":          "dhcp1",
+		"interface":     "ether3",
+		"address-pool":  "dhcp_pool1",
+		"lease-time":    "10m",
+		"authoritative": "yes",
+		"disabled":      "false",
+	}})
+	r.SetTable("/ip/pool", []map[string]string{{
+		"name":   "dhcp_pool1",
+		"ranges": "10.0.0.1-10.0.255.254",
+	}})
+	r.SetTable("/ip/pool/used", used)
+	r.SetTable("/ip/firewall/connection", connections)
+	r.SetTable("/ip/firewall/connection/tracking", []map[string]string{{
+		"enabled":            "auto",
+		"max-entries":        "1048576",
+		"total-entries":      strconv.Itoa(p.Connections),
+		"total-tcp-entries":  strconv.Itoa(counts["tcp"]),
+		"total-udp-entries":  strconv.Itoa(counts["udp"]),
+		"total-icmp-entries": strconv.Itoa(counts["icmp"]),
+	}})
+}
+
+// mac returns a locally administered MAC address for item i of a kind.
+func mac(kind byte, i int) string {
+	return fmt.Sprintf("02:00:%02X:%02X:%02X:%02X", kind, byte(i>>16), byte(i>>8), byte(i))
+}
+
+// ipv4 returns address i of the /16 a.b.0.0, skipping .0 and .255.
+func ipv4(a, b, i int) string {
+	i--
+	return fmt.Sprintf("%d.%d.%d.%d", a, b, i/254%256, 1+i%254)
+}
@@ -0,0 +1,244 @@
+// Package apisim implements an in-process RouterOS API server for tests and
+// demos. It speaks the binary API protocol of package api, serves tables set
+// up by the caller and can inject delays, traps, fatal errors and
+// disconnects, so the agent can be run against simulated routers.
+package apisim
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginMode selects the login method a simulated router accepts.
+type LoginMode int
+
+// Login methods.
+const (
+	LoginNew    LoginMode = iota // Name and password in /login (RouterOS 6.43+)
+	LoginLegacy                  // MD5 challenge-response (before 6.43)
+)
+
+// Fault is an error injected into the replies to a command.
+type Fault struct {
+	Delay      time.Duration // Wait before replying
+	Trap       string        // Reply with a !trap with this message
+	Fatal      string        // Reply with a !fatal with this message and close the connection
+	Disconnect bool          // Close the connection without replying
+	Count      int           // Number of commands affected; 0 affects all of them
+}
+
+// Router is the state of a simulated router: its credentials, menus and
+// injected faults. It is safe for concurrent use and may be changed while
+// it is being served.
+type Router struct {
+	mu       sync.Mutex
+	username string
+	password string
+	login    LoginMode
+	tables   map[string][]map[string]string
+	faults   map[string]*Fault
+	nextID   int
+	commands []string
+}
+
+// NewRouter creates a router that accepts the given credentials with the
+// new login method. It has an identity and system resources; other menus
+// are added with SetTable or Populate.
+func NewRouter(identity, username, password string) *Router {
+	r := &Router{
+		username: username,
+		password: password,
+		tables:   make(map[string][]map[string]string),
+		faults:   make(map[string]*Fault),
+	}
+	r.SetTable("/system/identity", []map[string]string{{"name": identity}})
+	r.SetTable("/system/resource", []map[string]string{{
+		"uptime":            "3d4h5m6s",
+		"version":           "7.14.3 (stable)",
+		"cpu-load":          "12",
+		"free-memory":       "805306368",
+		"total-memory":      "1073741824",
+		"free-hdd-space":    "100663296",
+		"total-hdd-space":   "134217728",
+		"architecture-name": "arm64",
+		"board-name":        "CCR2004-1G-12S+2XS",
+	}})
+	return r
+}
+
+// Clone creates a router with another identity that shares the tables of
+// r, so that many simulated routers can serve large tables without copying
+// them. Later changes to either router do not affect the other.
+func (r *Router) Clone(identity string) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := &Router{
+		username: r.username,
+		password: r.password,
+		login:    r.login,
+		tables:   make(map[string][]map[string]string, len(r.tables)),
+		faults:   make(map[string]*Fault),
+		nextID:   r.nextID,
+	}
+	for menu, table := range r.tables {
+		// Items are never changed in place, and the capacity is capped so
+		// that AddItem on either router reallocates
+		c.tables[menu] = table[:len(table):len(table)]
+	}
+	c.tables["/system/identity"] = []map[string]string{{".id": "*0", "name": identity}}
+	return c
+}
+
+// SetLoginMode selects the login method the router accepts.
+func (r *Router) SetLoginMode(mode LoginMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.login = mode
+}
+
+// SetTable replaces the items of a menu, such as "/interface". Items
+// without an ".id" are given one. Menus without items, such as
+// "/system/resource", are tables with a single item.
+func (r *Router) SetTable(menu string, items []map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	table := make([]map[string]string, len(items))
+	for i, item := range items {
+		table[i] = r.copyItem(item)
+	}
+	r.tables[menu] = table
+}
+
+// AddItem appends an item to a menu.
+func (r *Router) AddItem(menu string, item map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables[menu] = append(r.tables[menu], r.copyItem(item))
+}
+
+// Table returns a copy of the items of a menu.
+func (r *Router) Table(menu string) []map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	items := make([]map[string]string, len(r.tables[menu]))
+	for i, item := range r.tables[menu] {
+		items[i] = cloneItem(item)
+	}
+	return items
+}
+
+// Inject makes the router fail a command, such as "/ppp/active/print", or
+// every command when command is empty. It replaces an earlier fault for the
+// same command.
+func (r *Router) Inject(command string, f Fault) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults[command] = &f
+}
+
+// ClearFaults removes all injected faults.
+func (r *Router) ClearFaults() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faults = make(map[string]*Fault)
+}
+
+// maxCommands bounds the commands kept for Commands.
+const maxCommands = 1000
+
+// Commands returns the last commands received after login, in order.
+func (r *Router) Commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.commands...)
+}
+
+// fault returns the fault to apply to command and consumes one use of it.
+func (r *Router) fault(command string) *Fault {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := command
+	f, ok := r.faults[key]
+	if !ok {
+		key = ""
+		if f, ok = r.faults[key]; !ok {
+			return nil
+		}
+	}
+	applied := *f
+	if f.Count > 0 {
+		f.Count--
+		if f.Count == 0 {
+			delete(r.faults, key)
+		}
+	}
+	return &applied
+}
+
+// print returns the items of a menu reduced to the properties in proplist,
+// or false if the menu does not exist. The items must not be changed.
+func (r *Router) print(menu, proplist string) ([]map[string]string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	table, ok := r.tables[menu]
+	if !ok {
+		return nil, false
+	}
+
+	if proplist == "" {
+		return table, true
+	}
+
+	props := strings.Split(proplist, ",")
+	items := make([]map[string]string, len(table))
+	for i, item := range table {
+		items[i] = make(map[string]string, len(props))
+		for _, p := range props {
+			if v, ok := item[p]; ok {
+				items[i][p] = v
+			}
+		}
+	}
+	return items, true
+}
+
+func (r *Router) credentials() (username, password string, mode LoginMode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.username, r.password, r.login
+}
+
+func (r *Router) record(command string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.commands) == maxCommands {
+		r.commands = r.commands[1:]
+	}
+	r.commands = append(r.commands, command)
+}
+
+// copyItem copies an item and assigns an ID if it has none. Callers must
+// hold r.mu.
+func (r *Router) copyItem(item map[string]string) map[string]string {
+	c := cloneItem(item)
+	if _, ok := c[".id"]; !ok {
+		r.nextID++
+		c[".id"] = fmt.Sprintf("*%X", r.nextID)
+	}
+	return c
+}
+
+func cloneItem(item map[string]string) map[string]string {
+	c := make(map[string]string, len(item))
+	for k, v := range item {
+		c[k] = v
+	}
+	return c
+}
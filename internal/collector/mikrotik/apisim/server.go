@@ -0,0 +1,263 @@
+package apisim
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+// Server serves a simulated router over TCP.
+type Server struct {
+	router   *Router
+	listener net.Listener
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// session is the login state of one connection.
+type session struct {
+	loggedIn  bool
+	challenge []byte
+}
+
+// Listen starts serving router on addr, such as "127.0.0.1:0" for a free
+// port.
+func Listen(addr string, router *Router) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		router:   router,
+		listener: ln,
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Router returns the served router.
+func (s *Server) Router() *Router {
+	return s.router
+}
+
+// Close stops the server, closes all connections and waits for them to
+// finish.
+func (s *Server) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// errClose ends a connection after a fatal reply or an injected disconnect.
+var errClose = errors.New("close connection")
+
+// serve answers the commands of one connection until it is closed.
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	sess := &session{}
+	for {
+		req, err := api.DecodeSentence(reader)
+		if err != nil {
+			return
+		}
+		err = s.handle(w, sess, req)
+		if flushErr := w.Flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle answers one command. Faults are applied before login checks, so
+// logins can be failed too.
+func (s *Server) handle(w *bufio.Writer, sess *session, req *api.Reply) error {
+	command := req.Type
+	if f := s.router.fault(command); f != nil {
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-s.done:
+				return errClose
+			}
+		}
+		switch {
+		case f.Disconnect:
+			return errClose
+		case f.Fatal != "":
+			write(w, api.NewSentence("!fatal").AddAttribute("message", f.Fatal))
+			w.Flush()
+			return errClose
+		case f.Trap != "":
+			write(w, trap(f.Trap))
+			return write(w, api.NewSentence("!done"))
+		}
+	}
+
+	switch {
+	case command == "/login":
+		return s.login(w, sess, req)
+	case !sess.loggedIn:
+		write(w, trap("not logged in"))
+		return write(w, api.NewSentence("!done"))
+	case command == "/quit":
+		write(w, api.NewSentence("!fatal").AddAttribute("message", "session terminated on request"))
+		w.Flush()
+		return errClose
+	}
+
+	s.router.record(command)
+
+	menu, verb := splitCommand(command)
+	if verb == "print" || verb == "getall" {
+		if items, ok := s.router.print(menu, req.Data[".proplist"]); ok {
+			for _, item := range items {
+				if err := writeItem(w, item); err != nil {
+					return err
+				}
+			}
+			return write(w, api.NewSentence("!done"))
+		}
+	}
+
+	write(w, trap("no such command prefix"))
+	return write(w, api.NewSentence("!done"))
+}
+
+// login accepts the name and password of the new method, or issues and
+// checks an MD5 challenge for the legacy one.
+func (s *Server) login(w *bufio.Writer, sess *session, req *api.Reply) error {
+	username, password, mode := s.router.credentials()
+
+	if response, ok := req.Data["response"]; ok {
+		if sess.challenge == nil || req.Data["name"] != username || response != challengeResponse(password, sess.challenge) {
+			write(w, trap("cannot log in"))
+			return write(w, api.NewSentence("!done"))
+		}
+		sess.loggedIn = true
+		return write(w, api.NewSentence("!done"))
+	}
+
+	if _, ok := req.Data["password"]; ok && mode == LoginNew {
+		if req.Data["name"] != username || req.Data["password"] != password {
+			write(w, trap("invalid user name or password (6)"))
+			return write(w, api.NewSentence("!done"))
+		}
+		sess.loggedIn = true
+		return write(w, api.NewSentence("!done"))
+	}
+
+	// Legacy routers ignore the credentials and send a challenge
+	sess.challenge = make([]byte, 16)
+	rand.Read(sess.challenge)
+	return write(w, api.NewSentence("!done").AddAttribute("ret", hex.EncodeToString(sess.challenge)))
+}
+
+// challengeResponse computes the legacy login response: "00" followed by
+// the hex MD5 of a zero byte, the password and the challenge.
+func challengeResponse(password string, challenge []byte) string {
+	hash := md5.New()
+	hash.Write([]byte{0})
+	hash.Write([]byte(password))
+	hash.Write(challenge)
+	return "00" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// splitCommand splits "/interface/print" into "/interface" and "print".
+func splitCommand(command string) (menu, verb string) {
+	i := strings.LastIndex(command, "/")
+	if i < 0 {
+		return "", command
+	}
+	return command[:i], command[i+1:]
+}
+
+func trap(message string) *api.Sentence {
+	return api.NewSentence("!trap").AddAttribute("message", message)
+}
+
+// writeItem writes a !re sentence for item, with its ID first as RouterOS
+// sends it. Words are encoded directly, as tables can be large.
+func writeItem(w *bufio.Writer, item map[string]string) error {
+	w.Write(api.EncodeWord("!re"))
+	if id, ok := item[".id"]; ok {
+		w.Write(api.EncodeWord("=.id=" + id))
+	}
+	for k, v := range item {
+		if k != ".id" {
+			w.Write(api.EncodeWord("=" + k + "=" + v))
+		}
+	}
+	return w.WriteByte(0)
+}
+
+func write(w *bufio.Writer, s *api.Sentence) error {
+	_, err := w.Write(api.EncodeSentence(s))
+	return err
+}
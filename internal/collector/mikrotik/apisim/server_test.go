@@ -0,0 +1,208 @@
+package apisim
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+func newTestServer(t *testing.T, router *Router) *Server {
+	t.Helper()
+	srv, err := Listen("127.0.0.1:0", router)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func newTestClient(srv *Server, password string) *api.Client {
+	return api.NewClient(&api.ClientConfig{
+		Address:  srv.Addr(),
+		Username: "admin",
+		Password: password,
+		Timeout:  time.Second,
+	})
+}
+
+func TestServer_Login(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     LoginMode
+		password string
+		wantErr  bool
+	}{
+		{name: "new", mode: LoginNew, password: "secret"},
+		{name: "legacy", mode: LoginLegacy, password: "secret"},
+		{name: "new wrong password", mode: LoginNew, password: "wrong", wantErr: true},
+		{name: "legacy wrong password", mode: LoginLegacy, password: "wrong", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter("core-01", "admin", "secret")
+			router.SetLoginMode(tt.mode)
+			client := newTestClient(newTestServer(t, router), tt.password)
+			defer client.Close()
+
+			err := client.Connect(context.Background())
+			if tt.wantErr {
+				if !api.IsAuthError(err) {
+					t.Fatalf("Connect() error = %v, want auth error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+
+			identity, err := client.GetRouterIdentity(context.Background())
+			if err != nil || identity != "core-01" {
+				t.Errorf("GetRouterIdentity() = %q, %v", identity, err)
+			}
+		})
+	}
+}
+
+func TestServer_Print(t *testing.T) {
+	router := NewRouter("core-01", "admin", "secret")
+	router.Populate(Profile{Interfaces: 2, Sessions: 3, Leases: 4, Connections: 6})
+	client := newTestClient(newTestServer(t, router), "secret")
+	ctx := context.Background()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	interfaces, err := client.Run(ctx, "/interface/print", map[string]string{".proplist": "name,type"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(interfaces) != 5 || interfaces[0]["name"] != "ether1" || interfaces[4]["name"] != "<pppoe-user3>" {
+		t.Errorf("interfaces = %v", interfaces)
+	}
+	if len(interfaces[0]) != 2 {
+		t.Errorf(".proplist not applied: %v", interfaces[0])
+	}
+
+	var conns int
+	err = client.RunStream(ctx, "/ip/firewall/connection/print", nil, func(map[string]string) error {
+		conns++
+		return nil
+	})
+	if err != nil || conns != 6 {
+		t.Errorf("RunStream() = %d connections, %v", conns, err)
+	}
+
+	tracking, err := client.RunOne(ctx, "/ip/firewall/connection/tracking/print", nil)
+	if err != nil || tracking["total-tcp-entries"] != "2" {
+		t.Errorf("tracking = %v, %v", tracking, err)
+	}
+
+	leases, err := client.Run(ctx, "/ip/dhcp-server/lease/print", nil)
+	if err != nil || len(leases) != 4 || leases[0][".id"] == "" {
+		t.Errorf("leases = %v, %v", leases, err)
+	}
+
+	_, err = client.Run(ctx, "/ip/hotspot/active/print", nil)
+	if !api.IsTrapError(err) {
+		t.Errorf("Run(unknown menu) error = %v, want trap", err)
+	}
+
+	commands := router.Commands()
+	if len(commands) != 5 || commands[0] != "/interface/print" {
+		t.Errorf("Commands() = %v", commands)
+	}
+}
+
+func TestRouter_Clone(t *testing.T) {
+	router := NewRouter("core-01", "admin", "secret")
+	router.Populate(Profile{Interfaces: 2, Sessions: 2})
+	clone := router.Clone("core-02")
+	clone.AddItem("/ppp/active", map[string]string{"name": "user3"})
+	router.Inject("", Fault{Disconnect: true})
+
+	client := newTestClient(newTestServer(t, clone), "secret")
+	ctx := context.Background()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if identity, err := client.GetRouterIdentity(ctx); err != nil || identity != "core-02" {
+		t.Errorf("GetRouterIdentity() = %q, %v", identity, err)
+	}
+	if sessions, err := client.Run(ctx, "/ppp/active/print", nil); err != nil || len(sessions) != 3 {
+		t.Errorf("clone sessions = %v, %v", sessions, err)
+	}
+	if n := len(router.Table("/ppp/active")); n != 2 {
+		t.Errorf("original has %d sessions, want 2", n)
+	}
+}
+
+func TestServer_Faults(t *testing.T) {
+	router := NewRouter("core-01", "admin", "secret")
+	router.Populate(Profile{Interfaces: 1, Sessions: 1})
+	srv := newTestServer(t, router)
+	ctx := context.Background()
+
+	connect := func(t *testing.T) *api.Client {
+		t.Helper()
+		client := newTestClient(srv, "secret")
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+
+	t.Run("trap once", func(t *testing.T) {
+		client := connect(t)
+		router.Inject("/ppp/active/print", Fault{Trap: "interrupted", Count: 1})
+
+		_, err := client.Run(ctx, "/ppp/active/print", nil)
+		var apiErr *api.APIError
+		if !api.IsTrapError(err) || !errors.As(err, &apiErr) || apiErr.Message != "interrupted" {
+			t.Errorf("first Run() error = %v, want trap", err)
+		}
+		if sessions, err := client.Run(ctx, "/ppp/active/print", nil); err != nil || len(sessions) != 1 {
+			t.Errorf("second Run() = %v, %v", sessions, err)
+		}
+	})
+
+	t.Run("fatal", func(t *testing.T) {
+		client := connect(t)
+		router.Inject("/interface/print", Fault{Fatal: "out of memory", Count: 1})
+
+		_, err := client.Run(ctx, "/interface/print", nil)
+		if err == nil || client.IsConnected() {
+			t.Errorf("Run() error = %v, connected = %v; want fatal and closed", err, client.IsConnected())
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		client := connect(t)
+		router.Inject("", Fault{Disconnect: true})
+		defer router.ClearFaults()
+
+		if err := client.Ping(ctx); !errors.Is(err, api.ErrConnectionClosed) {
+			t.Errorf("Ping() error = %v, want connection closed", err)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		client := connect(t)
+		router.Inject("/system/resource/print", Fault{Delay: 1500 * time.Millisecond, Count: 1})
+
+		start := time.Now()
+		if err := client.Ping(ctx); err == nil {
+			t.Error("Ping() succeeded, want a timeout")
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("Ping() returned after %v, want the client timeout", elapsed)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package mikrotik
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ipv4LenOffset keeps IPv4 prefix lengths apart from IPv6 ones (0-128) in
+// asnTable.byLen.
+const ipv4LenOffset = 129
+
+// asnTable maps IP prefixes to origin AS numbers using longest-prefix match.
+type asnTable struct {
+	byLen   map[int]map[netip.Prefix]uint32
+	lengths []int // Prefix lengths present, longest first
+}
+
+// loadASNTable reads a prefix-to-ASN file. Each non-empty line holds a
+// prefix and an AS number separated by whitespace, e.g. "8.8.8.0/24 15169"
+// or "2001:4860::/32 AS15169"; lines starting with '#' are ignored.
+func loadASNTable(path string) (*asnTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ASN file: %w", err)
+	}
+	defer file.Close()
+
+	t := &asnTable{byLen: make(map[int]map[netip.Prefix]uint32)}
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("ASN file line %d: expected prefix and ASN", lineNum)
+		}
+
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("ASN file line %d: %w", lineNum, err)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[1]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("ASN file line %d: invalid ASN %q", lineNum, fields[1])
+		}
+
+		t.add(prefix, uint32(asn))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ASN file: %w", err)
+	}
+
+	return t, nil
+}
+
+func (t *asnTable) add(prefix netip.Prefix, asn uint32) {
+	prefix = prefix.Masked()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += ipv4LenOffset
+	}
+
+	m, ok := t.byLen[bits]
+	if !ok {
+		m = make(map[netip.Prefix]uint32)
+		t.byLen[bits] = m
+		t.lengths = append(t.lengths, bits)
+		sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	}
+	m[prefix] = asn
+}
+
+// lookup returns the origin AS of addr, or 0 when no prefix covers it.
+func (t *asnTable) lookup(addr netip.Addr) uint32 {
+	if t == nil {
+		return 0
+	}
+	addr = addr.Unmap()
+
+	for _, bits := range t.lengths {
+		plen := bits
+		if addr.Is4() {
+			if bits < ipv4LenOffset {
+				continue
+			}
+			plen -= ipv4LenOffset
+		} else if bits >= ipv4LenOffset {
+			continue
+		}
+
+		prefix, err := addr.Prefix(plen)
+		if err != nil {
+			continue
+		}
+		if asn, ok := t.byLen[bits][prefix]; ok {
+			return asn
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,178 @@
+package mikrotik
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/cli"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/replay"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/rest"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Access methods, selected per router with the "backend" metadata key.
+const (
+	BackendAPI  = "api"  // Binary API on port 8728/8729
+	BackendSSH  = "ssh"  // Console commands over SSH
+	BackendREST = "rest" // REST API of RouterOS 7 over HTTPS
+
+	// BackendReplay answers from a recording instead of a router
+	BackendReplay = "replay"
+)
+
+// Backend runs RouterOS commands and returns records as the binary API
+// does. *api.Client, *cli.Client, *rest.Client and *replay.Client
+// implement it.
+type Backend interface {
+	Connect(ctx context.Context) error
+	Close() error
+	Run(ctx context.Context, command string, args map[string]string) ([]map[string]string, error)
+	RunOne(ctx context.Context, command string, args map[string]string) (map[string]string, error)
+	RunStream(ctx context.Context, command string, args map[string]string, fn func(map[string]string) error) error
+	Ping(ctx context.Context) error
+}
+
+// exporter is implemented by backends that return /export output directly
+// instead of writing a file on the router.
+type exporter interface {
+	Export(ctx context.Context, args map[string]string) (string, error)
+}
+
+// runOptional runs a print command of a menu that may be missing, as when
+// its package is disabled. The trap RouterOS answers an unknown command with
+// yields no records; other errors, such as timeouts, are returned, so that
+// an unreadable table is not taken for an empty one.
+func runOptional(ctx context.Context, client Backend, command string) ([]map[string]string, error) {
+	records, err := client.Run(ctx, command, nil)
+	if err != nil {
+		if api.IsTrapError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+	return records, nil
+}
+
+// RouterOptions contains per-router access settings read from the router
+// metadata.
+type RouterOptions struct {
+	Backend string `yaml:"backend"`
+
+	// API settings, used with BackendAPI; APIPort overrides api.port and
+	// RecordFile captures the session for replay
+	APIPort    int    `yaml:"api_port"`
+	RecordFile string `yaml:"record_file"`
+
+	// SSH settings, used with BackendSSH
+	SSHPort               int    `yaml:"ssh_port"`
+	KnownHosts            string `yaml:"known_hosts"`
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key"`
+
+	// REST settings, used with BackendREST; TLS verification follows
+	// api.insecure_skip_verify
+	RESTPort      int  `yaml:"rest_port"`
+	RESTPlainHTTP bool `yaml:"rest_plain_http"` // www instead of www-ssl
+
+	// ReplayFile is the recording answered from, used with BackendReplay
+	ReplayFile string `yaml:"replay_file"`
+}
+
+// ParseRouterOptions reads the access settings from the router metadata and
+// applies defaults.
+func ParseRouterOptions(router *models.RouterConfig) (*RouterOptions, error) {
+	opts := &RouterOptions{}
+	if len(router.Metadata) > 0 {
+		raw, err := yaml.Marshal(router.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid router metadata: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, opts); err != nil {
+			return nil, fmt.Errorf("invalid router metadata: %w", err)
+		}
+	}
+
+	switch opts.Backend {
+	case "":
+		opts.Backend = BackendAPI
+	case BackendAPI, BackendSSH, BackendREST:
+	case BackendReplay:
+		if opts.ReplayFile == "" {
+			return nil, fmt.Errorf("backend %q requires replay_file", opts.Backend)
+		}
+	default:
+		return nil, fmt.Errorf("unknown backend %q", opts.Backend)
+	}
+	if opts.SSHPort == 0 {
+		opts.SSHPort = 22
+	}
+	if opts.RESTPort == 0 {
+		opts.RESTPort = 443
+		if opts.RESTPlainHTTP {
+			opts.RESTPort = 80
+		}
+	}
+	return opts, nil
+}
+
+// createBackend creates the client for the router's access method, traced
+// when tracing is set up.
+func (c *Collector) createBackend(router *models.RouterConfig, cfg *Config) (Backend, error) {
+	opts, err := ParseRouterOptions(router)
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.newBackend(router, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	return traceBackend(client, router.ID, opts.Backend), nil
+}
+
+func (c *Collector) newBackend(router *models.RouterConfig, cfg *Config, opts *RouterOptions) (Backend, error) {
+	timeout := cfg.API.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	switch opts.Backend {
+	case BackendReplay:
+		client, err := replay.Load(opts.ReplayFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load recording: %w", err)
+		}
+		return client, nil
+	case BackendREST:
+		return rest.NewClient(&rest.ClientConfig{
+			Address:            net.JoinHostPort(router.Address, strconv.Itoa(opts.RESTPort)),
+			Username:           router.Credentials.Username,
+			Password:           router.Credentials.Password,
+			UseTLS:             !opts.RESTPlainHTTP,
+			InsecureSkipVerify: cfg.API.InsecureSkipVerify,
+			Timeout:            timeout,
+		}), nil
+	case BackendSSH:
+		return cli.NewClient(&cli.Config{
+			Address:               net.JoinHostPort(router.Address, strconv.Itoa(opts.SSHPort)),
+			Username:              router.Credentials.Username,
+			Password:              router.Credentials.Password,
+			Key:                   router.Credentials.SSHKey,
+			KnownHosts:            opts.KnownHosts,
+			InsecureIgnoreHostKey: opts.InsecureIgnoreHostKey,
+			Timeout:               timeout,
+		}), nil
+	default:
+		return c.createClient(router, cfg, opts), nil
+	}
+}
+
+var (
+	_ Backend = (*api.Client)(nil)
+	_ Backend = (*cli.Client)(nil)
+	_ Backend = (*rest.Client)(nil)
+	_ Backend = (*replay.Client)(nil)
+)
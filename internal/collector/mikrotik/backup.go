@@ -0,0 +1,301 @@
+package mikrotik
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/backup"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// EventConfigChange is raised when a router's exported configuration differs
+// from the previous backup.
+const EventConfigChange = "config_change"
+
+// exportFile is the file the configuration is exported to on the router.
+const exportFile = "ispagent-export"
+
+// maxDiffAttribute bounds the diff carried in a config_change event; the
+// full versions remain in the backup store.
+const maxDiffAttribute = 64 << 10
+
+// exportHeader matches the first line of an export, which carries the export
+// time and would otherwise make every version differ.
+var exportHeader = regexp.MustCompile(`^# .* by RouterOS `)
+
+// changeByPattern matches "... changed by admin" as well as the RouterOS 7
+// form "... changed by winbox-3.40/tcp-msg(winbox):admin@10.0.0.5/action:12".
+var changeByPattern = regexp.MustCompile(`\b(?:added|changed|removed|moved|enabled|disabled) by (?:[^\s:]*:)?([^\s@/():]+)`)
+
+// loginPattern matches account topic entries such as
+// "user admin logged in from 10.0.0.5 via winbox".
+var loginPattern = regexp.MustCompile(`^user (\S+) logged in`)
+
+// backupTracker remembers when each router was last backed up.
+type backupTracker struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newBackupTracker() *backupTracker {
+	return &backupTracker{
+		last: make(map[string]time.Time),
+	}
+}
+
+// due reports whether routerID should be backed up now and, if so, records
+// the attempt.
+func (t *backupTracker) due(routerID string, interval time.Duration, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.last[routerID]; ok && now.Sub(last) < interval {
+		return false
+	}
+	t.last[routerID] = now
+	return true
+}
+
+// backupConfig exports the router configuration and stores it when it
+// changed. It returns a config_change event describing the difference, or
+// nil for the first backup of a router and for unchanged configurations.
+func (c *Collector) backupConfig(ctx context.Context, client Backend, routerID string, cfg BackupConfig, store *backup.Store, now time.Time) (*models.Event, error) {
+	export, err := exportConfig(ctx, client, cfg.ShowSensitive)
+	if err != nil {
+		return nil, err
+	}
+	content := normalizeExport(export)
+
+	prev, prevContent, err := store.Latest(routerID)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && string(prevContent) == content {
+		return nil, nil
+	}
+
+	version, err := store.Save(routerID, []byte(content), now)
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil {
+		return nil, nil
+	}
+
+	diff := backup.Compare(string(prevContent), content)
+
+	// Attribution is best effort: the change may have scrolled out of the
+	// log buffer, or logging may be disabled
+	var users []string
+	if entries, err := readLog(ctx, client, now); err == nil {
+		users = changeUsers(entries, prev.Time)
+	}
+
+	return configChangeEvent(diff, users, prev, version, cfg.ShowSensitive, now), nil
+}
+
+// configChangeEvent describes a change between two versions. Exports made
+// with showSensitive carry passwords, keys and PSKs, so their diff is left
+// out of the event and only kept in the backup store.
+func configChangeEvent(diff *backup.Diff, users []string, prev, version *backup.Version, showSensitive bool, now time.Time) *models.Event {
+	by := "unknown user"
+	if len(users) > 0 {
+		by = strings.Join(users, ", ")
+	}
+
+	unified := diff.Unified
+	truncated := false
+	if len(unified) > maxDiffAttribute {
+		unified = unified[:maxDiffAttribute]
+		truncated = true
+	}
+
+	event := &models.Event{
+		Type:      EventConfigChange,
+		Severity:  models.SeverityWarning,
+		Message:   fmt.Sprintf("Configuration changed by %s (+%d -%d lines)", by, diff.Added, diff.Removed),
+		Timestamp: now,
+		Attributes: map[string]string{
+			"diff":             unified,
+			"users":            strings.Join(users, ","),
+			"added_lines":      strconv.Itoa(diff.Added),
+			"removed_lines":    strconv.Itoa(diff.Removed),
+			"version":          version.ID,
+			"previous_version": prev.ID,
+		},
+	}
+	switch {
+	case showSensitive:
+		delete(event.Attributes, "diff")
+		event.Attributes["diff_omitted"] = "true"
+	case truncated:
+		event.Attributes["diff_truncated"] = "true"
+	}
+	return event
+}
+
+// exportConfig exports the configuration to a file on the router, reads it
+// back and removes it; backends that return the export directly skip the
+// file. Sensitive values are hidden unless showSensitive is set; RouterOS 6
+// shows them by default and RouterOS 7 hides them, so the flag that is not
+// understood is retried without.
+func exportConfig(ctx context.Context, client Backend, showSensitive bool) (string, error) {
+	args := map[string]string{"terse": ""}
+	if showSensitive {
+		args["show-sensitive"] = ""
+	} else {
+		args["hide-sensitive"] = ""
+	}
+
+	if e, ok := client.(exporter); ok {
+		export, err := e.Export(ctx, args)
+		if err != nil && api.IsTrapError(err) {
+			export, err = e.Export(ctx, nil)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to export configuration: %w", err)
+		}
+		return export, nil
+	}
+
+	args["file"] = exportFile
+
+	if _, err := client.Run(ctx, "/export", args); err != nil {
+		if !api.IsTrapError(err) {
+			return "", fmt.Errorf("failed to export configuration: %w", err)
+		}
+		if _, err := client.Run(ctx, "/export", map[string]string{"file": exportFile}); err != nil {
+			return "", fmt.Errorf("failed to export configuration: %w", err)
+		}
+	}
+
+	name := exportFile + ".rsc"
+	defer client.Run(context.WithoutCancel(ctx), "/file/remove", map[string]string{"numbers": name})
+
+	return readRouterFile(ctx, client, name)
+}
+
+// readRouterFile returns the content of a file on the router. RouterOS
+// 7.13+ reads it in chunks with /file/read; older versions only expose the
+// first 4 KiB through the contents property of /file/print.
+func readRouterFile(ctx context.Context, client Backend, name string) (string, error) {
+	file, err := waitForFile(ctx, client, name)
+	if err != nil {
+		return "", err
+	}
+	size := ParseInt64(file["size"])
+
+	var sb strings.Builder
+	const chunkSize = 32768
+	for offset := int64(0); ; {
+		chunk, err := client.RunOne(ctx, "/file/read", map[string]string{
+			"file":       name,
+			"offset":     strconv.FormatInt(offset, 10),
+			"chunk-size": strconv.Itoa(chunkSize),
+		})
+		if err != nil {
+			if api.IsTrapError(err) && offset == 0 {
+				return readFileContents(file, size)
+			}
+			return "", fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		data := chunk["data"]
+		sb.WriteString(data)
+		offset += int64(len(data))
+		if data == "" || len(data) < chunkSize || (size > 0 && offset >= size) {
+			break
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func readFileContents(file map[string]string, size int64) (string, error) {
+	contents := file["contents"]
+	if size > 0 && int64(len(contents)) < size {
+		return "", fmt.Errorf("export is %d bytes but only %d can be read; RouterOS 7.13 or later is required", size, len(contents))
+	}
+	return contents, nil
+}
+
+// waitForFile polls for a file, since /export returns before the file is
+// written on some versions.
+func waitForFile(ctx context.Context, client Backend, name string) (map[string]string, error) {
+	for attempt := 0; attempt < 10; attempt++ {
+		files, err := client.Run(ctx, "/file/print", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find %s: %w", name, err)
+		}
+		for _, f := range files {
+			if f["name"] == name {
+				return f, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	return nil, fmt.Errorf("export file %s did not appear", name)
+}
+
+// normalizeExport removes the export time header and trailing whitespace so
+// that unchanged configurations compare equal.
+func normalizeExport(export string) string {
+	lines := strings.Split(strings.ReplaceAll(export, "\r\n", "\n"), "\n")
+
+	var out []string
+	for i, line := range lines {
+		if i == 0 && exportHeader.MatchString(line) {
+			continue
+		}
+		out = append(out, strings.TrimRight(line, " \t"))
+	}
+
+	return strings.TrimSpace(strings.Join(out, "\n")) + "\n"
+}
+
+// changeUsers returns the users that changed the configuration since the
+// given time, according to the router log. When no change entries name a
+// user, users that logged in during that time are returned instead.
+func changeUsers(entries []LogEntry, since time.Time) []string {
+	changed := make(map[string]bool)
+	loggedIn := make(map[string]bool)
+
+	for _, e := range entries {
+		if e.Time.Before(since) {
+			continue
+		}
+		if m := changeByPattern.FindStringSubmatch(e.Message); m != nil {
+			changed[m[1]] = true
+		}
+		if e.Category == LogCategoryAccount {
+			if m := loginPattern.FindStringSubmatch(e.Message); m != nil {
+				loggedIn[m[1]] = true
+			}
+		}
+	}
+
+	users := changed
+	if len(users) == 0 {
+		users = loggedIn
+	}
+
+	result := make([]string, 0, len(users))
+	for u := range users {
+		result = append(result, u)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,145 @@
+package mikrotik
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/backup"
+)
+
+func TestNormalizeExport(t *testing.T) {
+	a := "# jan/02/2024 10:00:00 by RouterOS 7.12\r\n# software id = ABCD-1234\r\n/ip address\r\nadd address=10.0.0.1/24 interface=ether1  \r\n"
+	b := "# jan/03/2024 11:30:00 by RouterOS 7.12\n# software id = ABCD-1234\n/ip address\nadd address=10.0.0.1/24 interface=ether1\n\n"
+
+	if normalizeExport(a) != normalizeExport(b) {
+		t.Errorf("exports differing only in header should be equal:\n%q\n%q", normalizeExport(a), normalizeExport(b))
+	}
+
+	want := "# software id = ABCD-1234\n/ip address\nadd address=10.0.0.1/24 interface=ether1\n"
+	if got := normalizeExport(a); got != want {
+		t.Errorf("normalizeExport() = %q, want %q", got, want)
+	}
+}
+
+func TestChangeUsers(t *testing.T) {
+	since := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	entry := func(minutes int, category, message string) LogEntry {
+		return LogEntry{Time: since.Add(time.Duration(minutes) * time.Minute), Category: category, Message: message}
+	}
+
+	tests := []struct {
+		name    string
+		entries []LogEntry
+		want    []string
+	}{
+		{
+			name: "routeros 6",
+			entries: []LogEntry{
+				entry(5, LogCategorySystem, "address added by admin"),
+				entry(6, LogCategorySystem, "filter rule changed by noc"),
+			},
+			want: []string{"admin", "noc"},
+		},
+		{
+			name: "routeros 7",
+			entries: []LogEntry{
+				entry(5, LogCategorySystem, "address added by winbox-3.40/tcp-msg(winbox):jane@10.0.0.5/action:12 (/ip address add address=10.1.1.1/24)"),
+			},
+			want: []string{"jane"},
+		},
+		{
+			name: "before previous backup",
+			entries: []LogEntry{
+				entry(-5, LogCategorySystem, "address added by admin"),
+				entry(5, LogCategorySystem, "queue changed by noc"),
+			},
+			want: []string{"noc"},
+		},
+		{
+			name: "login fallback",
+			entries: []LogEntry{
+				entry(-5, LogCategoryAccount, "user old logged in from 10.0.0.9 via ssh"),
+				entry(5, LogCategoryAccount, "user admin logged in from 10.0.0.5 via winbox"),
+				entry(6, LogCategoryAccount, "user admin logged out from 10.0.0.5 via winbox"),
+			},
+			want: []string{"admin"},
+		},
+		{
+			name:    "unknown",
+			entries: []LogEntry{entry(5, LogCategoryPPPoE, "<pppoe-john>: disconnected")},
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := changeUsers(tt.entries, since)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("changeUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigChangeEvent(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	prev := &backup.Version{ID: "20240301T110000Z"}
+	version := &backup.Version{ID: "20240301T120000Z"}
+	diff := backup.Compare("a\nb\n", "a\nc\nd\n")
+
+	event := configChangeEvent(diff, []string{"admin"}, prev, version, false, now)
+	if event.Type != EventConfigChange {
+		t.Errorf("Type = %s, want %s", event.Type, EventConfigChange)
+	}
+	if event.Message != "Configuration changed by admin (+2 -1 lines)" {
+		t.Errorf("Message = %q", event.Message)
+	}
+	if event.Attributes["diff"] != diff.Unified || event.Attributes["previous_version"] != prev.ID || event.Attributes["version"] != version.ID {
+		t.Errorf("Attributes = %v", event.Attributes)
+	}
+
+	event = configChangeEvent(diff, nil, prev, version, false, now)
+	if !strings.Contains(event.Message, "unknown user") {
+		t.Errorf("Message = %q, want unknown user", event.Message)
+	}
+
+	large := backup.Compare("", strings.Repeat("add comment=xxxxxxxxxxxxxxxx\n", 5000))
+	event = configChangeEvent(large, nil, prev, version, false, now)
+	if len(event.Attributes["diff"]) != maxDiffAttribute || event.Attributes["diff_truncated"] != "true" {
+		t.Errorf("diff of %d bytes not truncated to %d", len(large.Unified), maxDiffAttribute)
+	}
+
+	// Exports with sensitive values never leave the backup store
+	secret := backup.Compare("/interface wireless security-profiles\nadd wpa2-pre-shared-key=old\n", "/interface wireless security-profiles\nadd wpa2-pre-shared-key=new\n")
+	event = configChangeEvent(secret, []string{"admin"}, prev, version, true, now)
+	if _, ok := event.Attributes["diff"]; ok || event.Attributes["diff_omitted"] != "true" {
+		t.Errorf("Attributes = %v, want the diff omitted", event.Attributes)
+	}
+	for k, v := range event.Attributes {
+		if strings.Contains(v, "pre-shared-key") {
+			t.Errorf("attribute %s = %q leaks the export", k, v)
+		}
+	}
+	if event.Attributes["added_lines"] != "1" || event.Attributes["removed_lines"] != "1" || event.Attributes["users"] != "admin" {
+		t.Errorf("Attributes = %v", event.Attributes)
+	}
+}
+
+func TestBackupTracker(t *testing.T) {
+	tracker := newBackupTracker()
+	now := time.Now()
+
+	if !tracker.due("r1", time.Hour, now) {
+		t.Error("first backup should be due")
+	}
+	if tracker.due("r1", time.Hour, now.Add(30*time.Minute)) {
+		t.Error("backup should not be due before the interval")
+	}
+	if !tracker.due("r2", time.Hour, now.Add(30*time.Minute)) {
+		t.Error("routers should be tracked independently")
+	}
+	if !tracker.due("r1", time.Hour, now.Add(time.Hour)) {
+		t.Error("backup should be due after the interval")
+	}
+}
@@ -0,0 +1,302 @@
+// Package cli runs RouterOS commands on the console over SSH, for routers
+// with the API service disabled. Console output is parsed into the same
+// records that the binary API returns, and errors are reported as
+// api.APIError.
+package cli
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/sshclient"
+)
+
+// Config contains SSH connection settings.
+type Config struct {
+	Address               string // host:port
+	Username              string
+	Password              string // Password, or the passphrase of Key
+	Key                   string // Private key file path or PEM content
+	KnownHosts            string
+	InsecureIgnoreHostKey bool
+	Timeout               time.Duration
+}
+
+// conn runs console commands; *sshclient.Client implements it.
+type conn interface {
+	Run(ctx context.Context, command string) ([]byte, error)
+	Close() error
+}
+
+// Client runs RouterOS commands over SSH.
+type Client struct {
+	config *Config
+
+	mu        sync.Mutex
+	conn      conn
+	noShowIDs bool // RouterOS 6 does not know "print show-ids"
+}
+
+// singletons are menus without items, whose print does not accept detail.
+var singletons = map[string]bool{
+	"/system/resource":                 true,
+	"/system/identity":                 true,
+	"/system/license":                  true,
+	"/system/routerboard":              true,
+	"/system/clock":                    true,
+	"/ip/firewall/connection/tracking": true,
+}
+
+// statsMenus are printed a second time with stats-detail, since counters are
+// not part of their detail output; the items are merged by ID.
+var statsMenus = map[string]bool{
+	"/interface": true,
+}
+
+// consoleError matches the errors the console prints instead of output.
+var consoleError = regexp.MustCompile(`^(bad command name|syntax error|expected |no such |input does not match|invalid |ambiguous |failure: |couldn't |not enough permissions)`)
+
+// NewClient creates a new SSH console client.
+func NewClient(config *Config) *Client {
+	return &Client{config: config}
+}
+
+// Connect establishes the SSH connection.
+func (c *Client) Connect(ctx context.Context) error {
+	client, err := sshclient.Dial(ctx, sshclient.Options{
+		Address:               c.config.Address,
+		Username:              c.config.Username,
+		Password:              c.config.Password,
+		Key:                   c.config.Key,
+		KnownHosts:            c.config.KnownHosts,
+		InsecureIgnoreHostKey: c.config.InsecureIgnoreHostKey,
+		Timeout:               c.config.Timeout,
+	})
+	if err != nil {
+		if sshclient.IsAuthError(err) {
+			return api.NewAuthError(err.Error())
+		}
+		return api.NewConnectionError("failed to connect", err)
+	}
+
+	c.mu.Lock()
+	c.conn = client
+	c.mu.Unlock()
+	return nil
+}
+
+// Close closes the SSH connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Run executes an API command, such as "/interface/print", on the console
+// and returns its output as API records. Arguments are passed as
+// name=value; .proplist becomes proplist.
+func (c *Client) Run(ctx context.Context, command string, args map[string]string) ([]map[string]string, error) {
+	menu, verb := splitCommand(command)
+	if verb != "print" {
+		out, err := c.exec(ctx, consoleCommand(menu, verb, nil, args))
+		if err != nil {
+			return nil, err
+		}
+		return parseOutput(out), nil
+	}
+
+	if singletons[menu] {
+		out, err := c.exec(ctx, consoleCommand(menu, "print", nil, args))
+		if err != nil {
+			return nil, err
+		}
+		return parseOutput(out), nil
+	}
+
+	records, err := c.print(ctx, menu, "detail", args)
+	if err != nil || !statsMenus[menu] {
+		return records, err
+	}
+
+	// Versions without stats-detail only have the detail counters
+	stats, err := c.print(ctx, menu, "stats-detail", args)
+	if err != nil {
+		if api.IsTrapError(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	byID := make(map[string]map[string]string, len(stats))
+	for _, s := range stats {
+		byID[s[".id"]+"|"+s["name"]] = s
+	}
+	for _, r := range records {
+		for k, v := range byID[r[".id"]+"|"+r["name"]] {
+			if _, ok := r[k]; !ok {
+				r[k] = v
+			}
+		}
+	}
+	return records, nil
+}
+
+// print runs a print of a menu with items, with their internal IDs where
+// supported.
+func (c *Client) print(ctx context.Context, menu, mode string, args map[string]string) ([]map[string]string, error) {
+	c.mu.Lock()
+	showIDs := !c.noShowIDs
+	c.mu.Unlock()
+
+	if showIDs {
+		out, err := c.exec(ctx, consoleCommand(menu, "print", []string{mode, "without-paging", "show-ids"}, args))
+		if err == nil {
+			return parseOutput(out), nil
+		}
+		if !api.IsTrapError(err) {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.noShowIDs = true
+		c.mu.Unlock()
+	}
+
+	out, err := c.exec(ctx, consoleCommand(menu, "print", []string{mode, "without-paging"}, args))
+	if err != nil {
+		return nil, err
+	}
+	return parseOutput(out), nil
+}
+
+// RunOne executes a command and returns the first record.
+func (c *Client) RunOne(ctx context.Context, command string, args map[string]string) (map[string]string, error) {
+	results, err := c.Run(ctx, command, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// RunStream executes a command and calls fn for every record. The console
+// output is read completely before the first call.
+func (c *Client) RunStream(ctx context.Context, command string, args map[string]string, fn func(map[string]string) error) error {
+	results, err := c.Run(ctx, command, args)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping sends a test command to verify the connection is alive.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.RunOne(ctx, "/system/resource/print", nil)
+	return err
+}
+
+// Export returns the output of /export with args, without writing a file
+// on the router.
+func (c *Client) Export(ctx context.Context, args map[string]string) (string, error) {
+	return c.exec(ctx, consoleCommand("", "export", nil, args))
+}
+
+// exec runs a console command and turns console errors into trap errors.
+func (c *Client) exec(ctx context.Context, command string) (string, error) {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return "", api.ErrNotConnected
+	}
+
+	out, err := conn.Run(ctx, command)
+	if err != nil {
+		var exit *sshclient.ExitError
+		if errors.As(err, &exit) {
+			return "", trapError(exit.Stderr)
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", api.NewConnectionError("ssh command failed", err)
+	}
+
+	text := strings.ReplaceAll(string(out), "\r", "")
+	if first := strings.TrimSpace(text); consoleError.MatchString(first) && !strings.Contains(first, "\n") {
+		return "", trapError(first)
+	}
+	return text, nil
+}
+
+func trapError(message string) error {
+	return api.NewTrapError(&api.Reply{
+		Type: "!trap",
+		Data: map[string]string{"message": message},
+	})
+}
+
+// splitCommand splits an API command into its menu and verb, e.g.
+// "/interface/ethernet/print" into "/interface/ethernet" and "print".
+func splitCommand(command string) (menu, verb string) {
+	i := strings.LastIndexByte(command, '/')
+	if i < 0 {
+		return "", command
+	}
+	return command[:i], command[i+1:]
+}
+
+// consoleCommand builds a console command line. Arguments are sorted, and
+// empty values become flags such as "hide-sensitive".
+func consoleCommand(menu, verb string, flags []string, args map[string]string) string {
+	words := []string{strings.ReplaceAll(menu, "/", " ") + " " + verb}
+	if menu == "" {
+		words[0] = "/" + verb
+	} else {
+		words[0] = "/" + strings.TrimSpace(words[0])
+	}
+	words = append(words, flags...)
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := args[name]
+		if name == ".proplist" {
+			var props []string
+			for _, p := range strings.Split(value, ",") {
+				if p != ".id" && p != "" {
+					props = append(props, p)
+				}
+			}
+			if len(props) == 0 {
+				continue
+			}
+			name, value = "proplist", strings.Join(props, ",")
+		}
+		if value == "" {
+			words = append(words, name)
+			continue
+		}
+		words = append(words, name+"="+quote(value))
+	}
+	return strings.Join(words, " ")
+}
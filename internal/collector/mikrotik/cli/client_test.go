@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+// fakeConn answers console commands from a table and records them.
+type fakeConn struct {
+	outputs  map[string]string
+	errs     map[string]error
+	commands []string
+}
+
+func (f *fakeConn) Run(_ context.Context, command string) ([]byte, error) {
+	f.commands = append(f.commands, command)
+	if err := f.errs[command]; err != nil {
+		return nil, err
+	}
+	out, ok := f.outputs[command]
+	if !ok {
+		return []byte("bad command name x (line 1 column 2)\r\n"), nil
+	}
+	return []byte(out), nil
+}
+
+func (f *fakeConn) Close() error { return nil }
+
+func newTestClient(outputs map[string]string) (*Client, *fakeConn) {
+	conn := &fakeConn{outputs: outputs}
+	return &Client{config: &Config{}, conn: conn}, conn
+}
+
+func TestRun(t *testing.T) {
+	client, conn := newTestClient(map[string]string{
+		"/interface print detail without-paging show-ids": `Flags: X - disabled, R - running
+ *1  R  name="ether1" type="ether" mtu=1500
+ *2 X   name="ether2" type="ether" mtu=1500
+`,
+		"/interface print stats-detail without-paging show-ids": `Flags: X - disabled, R - running
+ *1  R  name="ether1" rx-byte=1 000 tx-byte=2000
+ *2 X   name="ether2" rx-byte=0 tx-byte=0
+`,
+		"/system resource print": "  cpu-load: 7%\n  version: 7.14 (stable)\n",
+		"/interface ethernet print detail without-paging show-ids proplist=name,speed": ` *1  name="ether1" speed=1Gbps
+`,
+	})
+	ctx := context.Background()
+
+	interfaces, err := client.Run(ctx, "/interface/print", nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(interfaces) != 2 || interfaces[0]["running"] != "true" || interfaces[0]["rx-byte"] != "1000" || interfaces[1]["disabled"] != "true" {
+		t.Errorf("interfaces = %v", interfaces)
+	}
+
+	resource, err := client.RunOne(ctx, "/system/resource/print", nil)
+	if err != nil || resource["cpu-load"] != "7" {
+		t.Errorf("RunOne() = %v, %v", resource, err)
+	}
+
+	ether, err := client.Run(ctx, "/interface/ethernet/print", map[string]string{".proplist": ".id,name,speed"})
+	if err != nil || len(ether) != 1 || ether[0]["speed"] != "1Gbps" {
+		t.Errorf("Run(proplist) = %v, %v", ether, err)
+	}
+
+	_, err = client.Run(ctx, "/nonexistent/print", nil)
+	if !api.IsTrapError(err) {
+		t.Errorf("unknown command error = %v, want trap", err)
+	}
+	if len(conn.commands) != 6 {
+		t.Errorf("commands = %q", conn.commands)
+	}
+}
+
+func TestRun_StatsDetailError(t *testing.T) {
+	detail := map[string]string{
+		"/interface print detail without-paging show-ids": ` *1  R  name="ether1" type="ether"
+`,
+	}
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"unknown to the router", nil, false},
+		{"connection lost", errors.New("ssh: connection lost"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, conn := newTestClient(detail)
+			if tt.err != nil {
+				conn.errs = map[string]error{"/interface print stats-detail without-paging show-ids": tt.err}
+			}
+			interfaces, err := client.Run(context.Background(), "/interface/print", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(interfaces) != 1 {
+				t.Errorf("interfaces = %v, want the detail output", interfaces)
+			}
+		})
+	}
+}
+
+func TestRun_WithoutShowIDs(t *testing.T) {
+	client, conn := newTestClient(map[string]string{
+		"/ppp active print detail without-paging": ` 0   name="alice" service=pppoe caller-id="AA:BB:CC:DD:EE:01" address=100.64.0.2 uptime=1h2m
+`,
+	})
+
+	for i := 0; i < 2; i++ {
+		sessions, err := client.Run(context.Background(), "/ppp/active/print", nil)
+		if err != nil || len(sessions) != 1 || sessions[0]["name"] != "alice" {
+			t.Fatalf("Run() = %v, %v", sessions, err)
+		}
+	}
+	// show-ids is tried once
+	if len(conn.commands) != 3 {
+		t.Errorf("commands = %q", conn.commands)
+	}
+}
+
+func TestRunStream_Ping(t *testing.T) {
+	client, _ := newTestClient(map[string]string{
+		"/ping address=192.0.2.1 count=2": `  SEQ HOST                                     SIZE TTL TIME       STATUS
+    0 192.0.2.1                                  56  60 1ms
+    1 192.0.2.1                                  56  60 2ms
+    sent=2 received=2 packet-loss=0% min-rtt=1ms avg-rtt=1ms max-rtt=2ms
+`,
+	})
+
+	var seqs []string
+	err := client.RunStream(context.Background(), "/ping", map[string]string{"address": "192.0.2.1", "count": "2"}, func(r map[string]string) error {
+		seqs = append(seqs, r["seq"]+":"+r["time"])
+		return nil
+	})
+	if err != nil || len(seqs) != 2 || seqs[1] != "1:2ms" {
+		t.Errorf("RunStream() = %v, %v", seqs, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	client, _ := newTestClient(map[string]string{
+		"/export hide-sensitive terse": "# model = RB5009\n/system identity set name=core\n",
+	})
+
+	export, err := client.Export(context.Background(), map[string]string{"terse": "", "hide-sensitive": ""})
+	if err != nil || export != "# model = RB5009\n/system identity set name=core\n" {
+		t.Errorf("Export() = %q, %v", export, err)
+	}
+	if _, err := client.Export(context.Background(), map[string]string{"show-sensitive": ""}); !api.IsTrapError(err) {
+		t.Errorf("Export(unknown flag) error = %v, want trap", err)
+	}
+}
+
+func TestRun_NotConnected(t *testing.T) {
+	client := NewClient(&Config{})
+	if _, err := client.Run(context.Background(), "/system/resource/print", nil); !errors.Is(err, api.ErrNotConnected) {
+		t.Errorf("Run() error = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestConsoleCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		args    map[string]string
+		want    string
+	}{
+		{"/ip/firewall/nat/print", map[string]string{".proplist": "chain,action"}, "/ip firewall nat print proplist=chain,action"},
+		{"/file/remove", map[string]string{"numbers": "backup.rsc"}, "/file remove numbers=backup.rsc"},
+		{"/tool/traceroute", map[string]string{"address": "192.0.2.1", "routing-table": "vrf a"}, `/tool traceroute address=192.0.2.1 routing-table="vrf a"`},
+		{"/export", map[string]string{"terse": ""}, "/export terse"},
+	}
+	for _, tt := range tests {
+		menu, verb := splitCommand(tt.command)
+		if got := consoleCommand(menu, verb, nil, tt.args); got != tt.want {
+			t.Errorf("consoleCommand(%s) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package cli
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// recordStart matches the first line of an item in "print detail"
+	// output: its number, or its internal ID with show-ids.
+	recordStart = regexp.MustCompile(`^\s*(\*[0-9A-Fa-f]+|\d+)(\s|$)`)
+
+	// legendEntry matches a flag in a "Flags:" legend, e.g. "X - disabled".
+	legendEntry = regexp.MustCompile(`([A-Za-z*+]) - ([A-Za-z][A-Za-z0-9-]*)`)
+
+	// singletonLine matches a property of a menu without items, such as
+	// /system resource: "    cpu-load: 5%".
+	singletonLine = regexp.MustCompile(`^\s*([a-z0-9][a-z0-9-]*): ?(.*)$`)
+
+	// tableHeader matches a column header, e.g. "  SEQ HOST  SIZE TTL TIME".
+	tableHeader = regexp.MustCompile(`^\s*(#\s+)?[A-Z][A-Z0-9-]*(\s+[A-Z][A-Z0-9-]*)+\s*$`)
+
+	percentValue  = regexp.MustCompile(`^(\d+(?:\.\d+)?)%$`)
+	sizeValue     = regexp.MustCompile(`^(\d+(?:\.\d+)?)(KiB|MiB|GiB|TiB)$`)
+	groupedNumber = regexp.MustCompile(`^\d{1,3}( \d{3})+$`)
+)
+
+var sizeUnits = map[string]float64{
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// parseOutput parses console output into records: column tables, as printed
+// by /ping and /tool traceroute, or "print detail" items and properties.
+func parseOutput(out string) []map[string]string {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "Columns:") {
+			continue
+		}
+		if tableHeader.MatchString(line) {
+			return parseTable(out)
+		}
+		break
+	}
+	return parseDetail(out)
+}
+
+// parseDetail parses "print detail" output. Items start with their number
+// or ID and continue on indented lines; flags are named from the "Flags:"
+// legend and reported as "true" or "false", as the API does. Menus without
+// items print "name: value" lines, which are returned as a single record.
+func parseDetail(out string) []map[string]string {
+	lines := strings.Split(strings.ReplaceAll(out, "\r", ""), "\n")
+
+	flags := make(map[rune]string)
+	var records []map[string]string
+	var text []string
+	var id, flagChars string
+
+	flush := func() {
+		if text == nil {
+			return
+		}
+		record := make(map[string]string)
+		for _, name := range flags {
+			record[name] = "false"
+		}
+		for _, c := range flagChars {
+			if name, ok := flags[c]; ok {
+				record[name] = "true"
+			}
+		}
+		if strings.HasPrefix(id, "*") {
+			record[".id"] = id
+		}
+		parseProperties(strings.Join(text, " "), record)
+		records = append(records, record)
+		text = nil
+	}
+
+	inLegend := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			inLegend = false
+			continue
+		case strings.HasPrefix(trimmed, "Flags:"):
+			inLegend = true
+			for _, m := range legendEntry.FindAllStringSubmatch(trimmed, -1) {
+				flags[rune(m[1][0])] = strings.ToLower(m[2])
+			}
+			continue
+		case strings.HasPrefix(trimmed, "Columns:"):
+			continue
+		case inLegend && !strings.Contains(trimmed, "=") && legendEntry.MatchString(trimmed):
+			for _, m := range legendEntry.FindAllStringSubmatch(trimmed, -1) {
+				flags[rune(m[1][0])] = strings.ToLower(m[2])
+			}
+			continue
+		}
+		inLegend = false
+
+		if m := recordStart.FindStringSubmatch(line); m != nil {
+			flush()
+			id = m[1]
+			rest := strings.TrimSpace(line[len(m[0]):])
+			flagChars, rest = splitFlags(rest)
+			text = []string{}
+			if comment, ok := strings.CutPrefix(rest, ";;;"); ok {
+				text = append(text, "comment="+quote(strings.TrimSpace(comment)))
+				continue
+			}
+			text = append(text, rest)
+			continue
+		}
+		if text != nil {
+			if comment, ok := strings.CutPrefix(trimmed, ";;;"); ok {
+				text = append(text, "comment="+quote(strings.TrimSpace(comment)))
+				continue
+			}
+			text = append(text, trimmed)
+		}
+	}
+	flush()
+
+	if len(records) == 0 {
+		if record := parseSingleton(lines); len(record) > 0 {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// splitFlags separates the flag letters that precede the properties of an
+// item, e.g. "XR name=ether1".
+func splitFlags(s string) (flags, rest string) {
+	for {
+		token, remainder, _ := strings.Cut(s, " ")
+		if token == "" || strings.ContainsAny(token, `=";`) || !isFlagToken(token) {
+			return flags, s
+		}
+		flags += token
+		s = strings.TrimSpace(remainder)
+	}
+}
+
+func isFlagToken(token string) bool {
+	for _, c := range token {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '*' || c == '+') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseProperties parses space-separated name=value pairs into record.
+// Values may be quoted; unquoted words without a name continue the previous
+// value, as in grouped numbers like "rx-byte=1 234 567".
+func parseProperties(s string, record map[string]string) {
+	var name string
+	var value strings.Builder
+	quoted := false
+	commit := func() {
+		if name == "" {
+			return
+		}
+		v := value.String()
+		if !quoted {
+			v = normalizeValue(v)
+		}
+		record[name] = v
+	}
+
+	for i := 0; i < len(s); {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+
+		end := i
+		for end < len(s) && s[end] != ' ' && s[end] != '=' {
+			end++
+		}
+		if end >= len(s) || s[end] != '=' {
+			// A word without a name
+			end = strings.IndexByte(s[i:], ' ')
+			if end < 0 {
+				end = len(s) - i
+			}
+			if name != "" && !quoted {
+				value.WriteByte(' ')
+				value.WriteString(s[i : i+end])
+			}
+			i += end
+			continue
+		}
+
+		commit()
+		name = s[i:end]
+		value.Reset()
+		i = end + 1
+
+		if i < len(s) && s[i] == '"' {
+			quoted = true
+			i += unquoteInto(s[i:], &value)
+			continue
+		}
+		quoted = false
+		end = strings.IndexByte(s[i:], ' ')
+		if end < 0 {
+			end = len(s) - i
+		}
+		value.WriteString(s[i : i+end])
+		i += end
+	}
+	commit()
+}
+
+// unquoteInto decodes the quoted string at the start of s into b and returns
+// the number of bytes consumed. RouterOS escapes quotes, backslashes and
+// control characters, and prints other bytes as \XX.
+func unquoteInto(s string, b *strings.Builder) int {
+	i := 1
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '"':
+			return i + 1
+		case c == '\\' && i+1 < len(s):
+			next := s[i+1]
+			switch next {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$', '?', '_':
+				b.WriteByte(next)
+			default:
+				if i+2 < len(s) {
+					if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+						b.WriteByte(byte(v))
+						i += 3
+						continue
+					}
+				}
+				b.WriteByte(next)
+			}
+			i += 2
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return i
+}
+
+// parseSingleton parses "name: value" properties.
+func parseSingleton(lines []string) map[string]string {
+	record := make(map[string]string)
+	var last string
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if m := singletonLine.FindStringSubmatch(line); m != nil {
+			last = m[1]
+			record[last] = normalizeValue(strings.TrimSpace(m[2]))
+			continue
+		}
+		// A wrapped value
+		if last != "" {
+			record[last] = strings.TrimSpace(record[last] + " " + strings.TrimSpace(line))
+		}
+	}
+	return record
+}
+
+// parseTable parses column tables. Cells are assigned to the header they
+// overlap, since numbers are right-aligned and text left-aligned. Tables
+// printed again as they are updated are numbered by .section, as the API
+// does for /tool traceroute.
+func parseTable(out string) []map[string]string {
+	type column struct {
+		name       string
+		start, end int
+	}
+
+	var columns []column
+	var records []map[string]string
+	section := -1
+	for _, line := range strings.Split(strings.ReplaceAll(out, "\r", ""), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "Columns:") {
+			continue
+		}
+		if tableHeader.MatchString(line) {
+			columns = columns[:0]
+			for _, loc := range wordPattern.FindAllStringIndex(line, -1) {
+				columns = append(columns, column{
+					name:  strings.ToLower(line[loc[0]:loc[1]]),
+					start: loc[0],
+					end:   loc[1],
+				})
+			}
+			section++
+			continue
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		// Summary lines such as "sent=5 received=5 packet-loss=0%"
+		if first, _, _ := strings.Cut(trimmed, " "); strings.Contains(first, "=") {
+			continue
+		}
+
+		record := map[string]string{".section": strconv.Itoa(section)}
+		for _, loc := range wordPattern.FindAllStringIndex(line, -1) {
+			best, bestDistance := 0, -1
+			for i, col := range columns {
+				distance := 0
+				switch {
+				case loc[1] <= col.start:
+					distance = col.start - loc[1] + 1
+				case loc[0] >= col.end:
+					distance = loc[0] - col.end + 1
+				}
+				if bestDistance < 0 || distance < bestDistance {
+					best, bestDistance = i, distance
+				}
+			}
+			name := columns[best].name
+			if name == "#" {
+				continue
+			}
+			word := line[loc[0]:loc[1]]
+			if record[name] != "" {
+				word = record[name] + " " + word
+			}
+			record[name] = word
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+var wordPattern = regexp.MustCompile(`\S+`)
+
+// normalizeValue converts the console's human-readable forms back to the
+// API's: "yes"/"no" to "true"/"false", "5%" to "5", sizes such as
+// "200.5MiB" to bytes and grouped numbers such as "1 234 567" to digits.
+func normalizeValue(v string) string {
+	switch {
+	case v == "yes":
+		return "true"
+	case v == "no":
+		return "false"
+	case groupedNumber.MatchString(v):
+		return strings.ReplaceAll(v, " ", "")
+	}
+	if m := percentValue.FindStringSubmatch(v); m != nil {
+		return m[1]
+	}
+	if m := sizeValue.FindStringSubmatch(v); m != nil {
+		n, _ := strconv.ParseFloat(m[1], 64)
+		return strconv.FormatInt(int64(n*sizeUnits[m[2]]), 10)
+	}
+	return v
+}
+
+// quote quotes s as a console argument value when needed.
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"\\$;[]{}?=\n") {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '"', '\\', '$':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDetail(t *testing.T) {
+	out := `Flags: D - dynamic; X - disabled, R - running; S - slave
+ *1   R  name="ether1" default-name="ether1" type="ether" mtu=1500 actual-mtu=1500
+         mac-address=48:8F:5A:00:00:01 last-link-up-time=2024-01-02 10:00:00
+         link-downs=0
+
+ *2  XS  ;;; spare "uplink"
+         name="ether2" type="ether" mtu=1500 comment-free=yes
+
+ *3  D   name="<pppoe-alice>" type="pppoe-in" mtu=1480 rx-byte=1 234 567
+`
+	got := parseDetail(out)
+	want := []map[string]string{
+		{
+			".id": "*1", "dynamic": "false", "disabled": "false", "running": "true", "slave": "false",
+			"name": "ether1", "default-name": "ether1", "type": "ether", "mtu": "1500", "actual-mtu": "1500",
+			"mac-address": "48:8F:5A:00:00:01", "last-link-up-time": "2024-01-02 10:00:00", "link-downs": "0",
+		},
+		{
+			".id": "*2", "dynamic": "false", "disabled": "true", "running": "false", "slave": "true",
+			"comment": `spare "uplink"`, "name": "ether2", "type": "ether", "mtu": "1500", "comment-free": "true",
+		},
+		{
+			".id": "*3", "dynamic": "true", "disabled": "false", "running": "false", "slave": "false",
+			"name": "<pppoe-alice>", "type": "pppoe-in", "mtu": "1480", "rx-byte": "1234567",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDetail() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseDetail_Singleton(t *testing.T) {
+	out := `                   uptime: 1w2d3h4m5s
+                  version: 7.12.1 (stable)
+               build-time: 2023-11-24 11:01:16
+              free-memory: 200.5MiB
+             total-memory: 1024.0MiB
+                 cpu-load: 5%
+           free-hdd-space: 100.0KiB
+        architecture-name: arm64
+               board-name: RB5009UG+S+
+`
+	got := parseDetail(out)
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	r := got[0]
+	checks := map[string]string{
+		"uptime":       "1w2d3h4m5s",
+		"version":      "7.12.1 (stable)",
+		"free-memory":  "210239488",
+		"total-memory": "1073741824",
+		"cpu-load":     "5",
+		"board-name":   "RB5009UG+S+",
+	}
+	for name, want := range checks {
+		if r[name] != want {
+			t.Errorf("%s = %q, want %q", name, r[name], want)
+		}
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	ping := `  SEQ HOST                                     SIZE TTL TIME       STATUS
+    0 1.1.1.1                                    56  57 11ms402us
+    1 1.1.1.1                                                          timeout
+    2 1.1.1.1                                    56  57 9ms
+    sent=3 received=2 packet-loss=33% min-rtt=9ms avg-rtt=10ms max-rtt=11ms
+`
+	got := parseOutput(ping)
+	want := []map[string]string{
+		{".section": "0", "seq": "0", "host": "1.1.1.1", "size": "56", "ttl": "57", "time": "11ms402us"},
+		{".section": "0", "seq": "1", "host": "1.1.1.1", "status": "timeout"},
+		{".section": "0", "seq": "2", "host": "1.1.1.1", "size": "56", "ttl": "57", "time": "9ms"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ping =\n%v\nwant\n%v", got, want)
+	}
+
+	traceroute := `Columns: ADDRESS, LOSS, SENT, LAST, AVG, BEST, WORST, STD-DEV
+#  ADDRESS       LOSS  SENT  LAST   AVG  BEST  WORST  STD-DEV
+1  10.0.0.1      0%       1  0.4ms  0.4  0.4   0.4          0
+2                100%     1  timeout
+#  ADDRESS       LOSS  SENT  LAST   AVG  BEST  WORST  STD-DEV
+1  10.0.0.1      0%       2  0.5ms  0.5  0.4   0.5        0.1
+2  192.0.2.1     0%       2  3ms    3    3     3            0
+`
+	got = parseOutput(traceroute)
+	if len(got) != 4 {
+		t.Fatalf("got %d hops, want 4", len(got))
+	}
+	if got[3][".section"] != "1" || got[3]["address"] != "192.0.2.1" || got[3]["loss"] != "0%" || got[3]["last"] != "3ms" {
+		t.Errorf("last hop = %v", got[3])
+	}
+	if got[1]["address"] != "" || got[1]["last"] != "timeout" {
+		t.Errorf("timed out hop = %v", got[1])
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := map[string]string{
+		"yes":         "true",
+		"no":          "false",
+		"5%":          "5",
+		"12.5%":       "12.5",
+		"1.5KiB":      "1536",
+		"2GiB":        "2147483648",
+		"1 234":       "1234",
+		"ether1":      "ether1",
+		"1w2d":        "1w2d",
+		"10.0.0.1/24": "10.0.0.1/24",
+	}
+	for in, want := range tests {
+		if got := normalizeValue(in); got != want {
+			t.Errorf("normalizeValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseProperties_Escapes(t *testing.T) {
+	record := make(map[string]string)
+	parseProperties(`message="user \"alice\" logged in\nvia ssh" name="caf\C3\A9" price=\$5`, record)
+	if record["message"] != "user \"alice\" logged in\nvia ssh" {
+		t.Errorf("message = %q", record["message"])
+	}
+	if record["name"] != "café" {
+		t.Errorf("name = %q", record["name"])
+	}
+}
@@ -6,33 +6,64 @@ import (
 	"sync"
 	"time"
 
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/backup"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/natlog"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
 )
 
 // Collector implements the collector interface for MikroTik RouterOS.
 type Collector struct {
-	name        string
-	config      *Config
+	name         string
+	config       *Config
 	ifaceTracker *interfaceTracker
-	mu          sync.RWMutex
+	natLog       *natlog.Log
+	natFlows     *natFlowTracker
+	l2Tracker    *l2Tracker
+	logTracker   *logTracker
+	netwatch     *netwatchTracker
+	backups      *backup.Store
+	backupDue    *backupTracker
+	asns         *asnTable
+	asnFile      string
+	onData       func(*CollectedData)
+	mu           sync.RWMutex
 }
 
 // CollectedData contains all data collected from a MikroTik router.
 type CollectedData struct {
 	*models.MetricsData
-	System       *SystemMetrics      `json:"system,omitempty"`
-	Interfaces   []InterfaceMetrics  `json:"interfaces,omitempty"`
-	PPPoE        []PPPoESession      `json:"pppoe_sessions,omitempty"`
-	PPPoEServers []PPPoEServerStats  `json:"pppoe_servers,omitempty"`
-	NAT          []NATConnection     `json:"nat_connections,omitempty"`
-	NATStats     *NATStats           `json:"nat_stats,omitempty"`
-	DHCPLeases   []DHCPLease         `json:"dhcp_leases,omitempty"`
-	DHCPPools    []DHCPPoolStats     `json:"dhcp_pools,omitempty"`
-	DHCPServers  []DHCPServerStats   `json:"dhcp_servers,omitempty"`
-	CollectedAt  time.Time           `json:"collected_at"`
-	Errors       []string            `json:"errors,omitempty"`
+	System        *SystemMetrics     `json:"system,omitempty"`
+	Interfaces    []InterfaceMetrics `json:"interfaces,omitempty"`
+	PPPoE         []PPPoESession     `json:"pppoe_sessions,omitempty"`
+	PPPoEServers  []PPPoEServerStats `json:"pppoe_servers,omitempty"`
+	NAT           []NATConnection    `json:"nat_connections,omitempty"`
+	NATStats      *NATStats          `json:"nat_stats,omitempty"`
+	NATAggregates *NATAggregates     `json:"nat_aggregates,omitempty"`
+	DHCPLeases    []DHCPLease        `json:"dhcp_leases,omitempty"`
+	DHCPPools     []DHCPPoolStats    `json:"dhcp_pools,omitempty"`
+	DHCPServers   []DHCPServerStats  `json:"dhcp_servers,omitempty"`
+	Neighbors     *NeighborTables    `json:"neighbors,omitempty"`
+	IPv6          *IPv6Data          `json:"ipv6,omitempty"`
+	Posture       *PostureReport     `json:"posture,omitempty"`
+	Probes        *ProbeResults      `json:"probes,omitempty"`
+	CollectedAt   time.Time          `json:"collected_at"`
+	Errors        []string           `json:"errors,omitempty"`
+}
+
+// PPPoESessionCount returns the number of active PPPoE sessions. Without the
+// sessions themselves, as when an output leaves them out, it is summed from
+// the per-server statistics.
+func (d *CollectedData) PPPoESessionCount() int {
+	if d.PPPoE != nil {
+		return len(d.PPPoE)
+	}
+	n := 0
+	for _, server := range d.PPPoEServers {
+		n += server.ActiveSessions
+	}
+	return n
 }
 
 // NewCollector creates a new MikroTik collector with default configuration.
@@ -49,6 +80,11 @@ func NewCollectorWithConfig(config *Config) *Collector {
 		name:         "mikrotik",
 		config:       config,
 		ifaceTracker: newInterfaceTracker(),
+		natFlows:     newNATFlowTracker(),
+		l2Tracker:    newL2Tracker(),
+		logTracker:   newLogTracker(),
+		netwatch:     newNetwatchTracker(),
+		backupDue:    newBackupTracker(),
 	}
 }
 
@@ -69,15 +105,41 @@ func (c *Collector) SetConfig(config *Config) {
 	c.config = config
 }
 
+// SetNATLog enables NAT translation logging. The full connection table is
+// then streamed on every collection, even when NAT rows are not collected.
+func (c *Collector) SetNATLog(natLog *natlog.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.natLog = natLog
+}
+
+// SetBackupStore enables configuration backups. Each router is exported
+// every Backup.Interval and changed configurations are stored in store.
+func (c *Collector) SetBackupStore(store *backup.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.backups = store
+}
+
+// SetDataHandler registers a function that is given the full data of every
+// successful Collect, for outputs that need more than the base model, such
+// as PPPoE and DHCP details. It is called before Collect returns and must
+// not change the data.
+func (c *Collector) SetDataHandler(handler func(*CollectedData)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onData = handler
+}
+
 // GetConfig returns a copy of the current configuration.
 func (c *Collector) GetConfig() *Config {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
+
 	if c.config == nil {
 		return DefaultConfig()
 	}
-	
+
 	// Return a shallow copy
 	cfg := *c.config
 	return &cfg
@@ -89,11 +151,19 @@ func (c *Collector) Collect(ctx context.Context, router *models.RouterConfig) (*
 	if err != nil {
 		return nil, err
 	}
+
+	c.mu.RLock()
+	onData := c.onData
+	c.mu.RUnlock()
+	if onData != nil {
+		onData(data)
+	}
 	return data.MetricsData, nil
 }
 
-// CollectAll collects all configured metrics from a MikroTik router.
-func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig) (*CollectedData, error) {
+// RouterConfig returns the configuration used for router: the collector's
+// configuration with the settings in the router metadata applied over it.
+func (c *Collector) RouterConfig(router *models.RouterConfig) (*Config, error) {
 	c.mu.RLock()
 	cfg := c.config
 	c.mu.RUnlock()
@@ -101,9 +171,30 @@ func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig)
 	if cfg == nil {
 		cfg = DefaultConfig()
 	}
+	cfg, err := cfg.Apply(router.Metadata, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid router metadata: %w", err)
+	}
+	return cfg, nil
+}
+
+// CollectAll collects all configured metrics from a MikroTik router.
+func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig) (*CollectedData, error) {
+	cfg, err := c.RouterConfig(router)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	natLog := c.natLog
+	backups := c.backups
+	c.mu.RUnlock()
 
-	// Create API client
-	client := c.createClient(router, cfg)
+	// Create API or SSH client
+	client, err := c.createBackend(router, cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Connect to router
 	if err := client.Connect(ctx); err != nil {
@@ -155,14 +246,56 @@ func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig)
 		}
 	}
 
-	// Collect NAT connections
-	if cfg.Collect.NAT {
-		connections, stats, err := c.collectNAT(ctx, client)
+	// Collect NAT connections; the translation log and aggregation need the
+	// full table even when connection rows are not collected
+	if cfg.Collect.NAT || natLog != nil || cfg.NAT.Aggregation.Enabled {
+		var snap *natlog.Snapshot
+		if natLog != nil {
+			snap = natLog.Begin(router.ID, data.CollectedAt)
+			if err := c.collectPortBlocks(ctx, client, snap); err != nil {
+				data.Errors = append(data.Errors, fmt.Sprintf("nat rules: %v", err))
+			}
+		}
+
+		var agg *natAggregator
+		var prevAt time.Time
+		if cfg.NAT.Aggregation.Enabled {
+			asns, err := c.asnTable(cfg.NAT.Aggregation.ASNFile)
+			if err != nil {
+				data.Errors = append(data.Errors, fmt.Sprintf("nat aggregation: %v", err))
+			}
+			var prevFlows map[uint64]int64
+			prevFlows, prevAt = c.natFlows.previous(router.ID)
+			agg = newNATAggregator(cfg.NAT.Aggregation, asns, prevFlows)
+		}
+
+		connections, stats, err := c.collectNAT(ctx, client, snap, agg)
 		if err != nil {
 			data.Errors = append(data.Errors, fmt.Sprintf("nat: %v", err))
+			if snap != nil {
+				if err := snap.Abort(); err != nil {
+					data.Errors = append(data.Errors, fmt.Sprintf("natlog: %v", err))
+				}
+			}
 		} else {
-			data.NAT = connections
-			data.NATStats = stats
+			if snap != nil {
+				if err := snap.Commit(); err != nil {
+					data.Errors = append(data.Errors, fmt.Sprintf("natlog: %v", err))
+				}
+			}
+			if agg != nil {
+				var interval time.Duration
+				if !prevAt.IsZero() {
+					interval = data.CollectedAt.Sub(prevAt)
+				}
+				c.natFlows.store(router.ID, agg.flows, data.CollectedAt)
+				data.NATAggregates = agg.result(interval)
+				data.addCustomMetrics(data.NATAggregates.Metrics())
+			}
+			if cfg.Collect.NAT {
+				data.NAT = connections
+				data.NATStats = stats
+			}
 		}
 	}
 
@@ -178,9 +311,109 @@ func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig)
 		}
 	}
 
+	// Collect layer-2 tables and detect changes
+	if cfg.Collect.Neighbors {
+		tables, err := c.collectNeighbors(ctx, client)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("neighbors: %v", err))
+		} else {
+			data.Neighbors = tables
+			data.Events = append(data.Events, c.l2Tracker.update(router.ID, tables, data.CollectedAt)...)
+		}
+	}
+
+	// Collect IPv6 addresses, pools and prefix delegations
+	if cfg.Collect.IPv6 {
+		ipv6, err := c.collectIPv6(ctx, client)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("ipv6: %v", err))
+		} else {
+			data.IPv6 = ipv6
+		}
+	}
+
+	// Collect new router log entries
+	if cfg.Collect.Logs {
+		events, err := c.collectLogs(ctx, client, router.ID, cfg.Logs, data.CollectedAt)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("logs: %v", err))
+		} else {
+			data.Events = append(data.Events, events...)
+		}
+	}
+
+	// Probe targets from the router and read netwatch states
+	if cfg.Collect.Probes {
+		probes, err := c.collectProbes(ctx, client, cfg.Probes)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("probes: %v", err))
+		} else {
+			data.Probes = probes
+			data.addCustomMetrics(probes.Metrics())
+			data.Events = append(data.Events, c.netwatch.update(router.ID, probes.Netwatch, data.CollectedAt)...)
+		}
+	}
+
+	// Inventory software and services and evaluate security posture
+	if cfg.Collect.Posture {
+		report, err := c.collectPosture(ctx, client, cfg.Posture, cfg.API.UseTLS)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("posture: %v", err))
+		} else {
+			for _, e := range report.Errors {
+				data.Errors = append(data.Errors, fmt.Sprintf("posture: %s", e))
+			}
+			data.Posture = report
+			data.addCustomMetrics(report.Metrics())
+		}
+	}
+
+	// Back up the configuration and report changes
+	if backups != nil && c.backupDue.due(router.ID, cfg.Backup.Interval, data.CollectedAt) {
+		event, err := c.backupConfig(ctx, client, router.ID, cfg.Backup, backups, data.CollectedAt)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("backup: %v", err))
+		} else if event != nil {
+			data.Events = append(data.Events, *event)
+		}
+	}
+
 	return data, nil
 }
 
+// addCustomMetrics merges metrics into the base model's custom metrics.
+func (d *CollectedData) addCustomMetrics(metrics map[string]float64) {
+	if d.MetricsData.CustomMetrics == nil {
+		d.MetricsData.CustomMetrics = make(map[string]float64, len(metrics))
+	}
+	for name, value := range metrics {
+		d.MetricsData.CustomMetrics[name] = value
+	}
+}
+
+// asnTable returns the prefix-to-ASN table loaded from path, loading it on
+// first use. It returns nil when no path is configured.
+func (c *Collector) asnTable(path string) (*asnTable, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.asns != nil && c.asnFile == path {
+		return c.asns, nil
+	}
+
+	table, err := loadASNTable(path)
+	if err != nil {
+		return nil, err
+	}
+	c.asns = table
+	c.asnFile = path
+	return table, nil
+}
+
 // HealthCheck verifies connectivity to the MikroTik router.
 func (c *Collector) HealthCheck(ctx context.Context, router *models.RouterConfig) error {
 	if router.Address == "" {
@@ -191,20 +424,28 @@ func (c *Collector) HealthCheck(ctx context.Context, router *models.RouterConfig
 		return fmt.Errorf("router username is required")
 	}
 
-	if router.Credentials.Password == "" {
+	opts, err := ParseRouterOptions(router)
+	if err != nil {
+		return err
+	}
+	if opts.Backend == BackendSSH {
+		if router.Credentials.Password == "" && router.Credentials.SSHKey == "" {
+			return fmt.Errorf("router password or ssh_key is required")
+		}
+	} else if opts.Backend != BackendReplay && router.Credentials.Password == "" {
 		return fmt.Errorf("router password is required")
 	}
 
-	c.mu.RLock()
-	cfg := c.config
-	c.mu.RUnlock()
-
-	if cfg == nil {
-		cfg = DefaultConfig()
+	cfg, err := c.RouterConfig(router)
+	if err != nil {
+		return err
 	}
 
-	// Create API client and test connection
-	client := c.createClient(router, cfg)
+	// Create client and test connection
+	client, err := c.createBackend(router, cfg)
+	if err != nil {
+		return err
+	}
 
 	if err := client.Connect(ctx); err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
@@ -220,8 +461,11 @@ func (c *Collector) HealthCheck(ctx context.Context, router *models.RouterConfig
 }
 
 // createClient creates an API client for the given router configuration.
-func (c *Collector) createClient(router *models.RouterConfig, cfg *Config) *api.Client {
+func (c *Collector) createClient(router *models.RouterConfig, cfg *Config, opts *RouterOptions) *api.Client {
 	port := cfg.API.Port
+	if opts.APIPort != 0 {
+		port = opts.APIPort
+	}
 	if port == 0 {
 		if cfg.API.UseTLS {
 			port = 8729
@@ -239,6 +483,7 @@ func (c *Collector) createClient(router *models.RouterConfig, cfg *Config) *api.
 		Timeout:            cfg.API.Timeout,
 		RetryAttempts:      cfg.API.RetryAttempts,
 		RetryDelay:         cfg.API.RetryDelay,
+		RecordFile:         opts.RecordFile,
 	}
 
 	if clientConfig.Timeout == 0 {
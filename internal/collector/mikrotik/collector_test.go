@@ -2,9 +2,14 @@ package mikrotik
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/apisim"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
 )
 
@@ -181,6 +186,193 @@ func TestCollector_HealthCheck_ValidatesConfig(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for missing password")
 	}
+
+	// SSH accepts a key instead of a password
+	router.Credentials.SSHKey = "/nonexistent/id_ed25519"
+	router.Metadata = map[string]interface{}{"backend": "ssh"}
+
+	err = c.HealthCheck(ctx, router)
+	if err == nil || strings.Contains(err.Error(), "required") {
+		t.Errorf("Expected connection error for ssh backend, got %v", err)
+	}
+}
+
+func TestCollectAll_Simulated(t *testing.T) {
+	sim := apisim.NewRouter("pop-1-bng", "monitor", "secret")
+	sim.Populate(apisim.Profile{Interfaces: 4, Sessions: 20, Leases: 10, Connections: 30})
+	srv, err := apisim.Listen("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.Collect.NAT = true
+	cfg.API.RetryAttempts = 1
+	cfg.API.RetryDelay = 10 * time.Millisecond
+	c := NewCollectorWithConfig(cfg)
+	router := &models.RouterConfig{
+		ID:      "pop-1-bng",
+		Address: "127.0.0.1",
+		Credentials: models.RouterCredentials{
+			Username: "monitor",
+			Password: "secret",
+		},
+		Metadata: map[string]interface{}{"api_port": srv.Port()},
+	}
+	ctx := context.Background()
+
+	data, err := c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if data.System == nil || data.System.RouterIdentity != "pop-1-bng" || data.System.CPUPercent != 12 {
+		t.Errorf("system = %+v", data.System)
+	}
+	if len(data.Interfaces) != 24 || data.Interfaces[0].SpeedMbps != 1000 {
+		t.Errorf("got %d interfaces, first %+v", len(data.Interfaces), data.Interfaces[0])
+	}
+	if len(data.PPPoE) != 20 || len(data.PPPoEServers) != 1 || data.PPPoEServers[0].ActiveSessions != 20 {
+		t.Errorf("got %d sessions, servers %+v", len(data.PPPoE), data.PPPoEServers)
+	}
+	if len(data.DHCPLeases) != 10 || len(data.DHCPServers) != 1 || data.DHCPServers[0].ActiveLeases != 10 {
+		t.Errorf("got %d leases, servers %+v", len(data.DHCPLeases), data.DHCPServers)
+	}
+	if data.NATStats == nil || data.NATStats.TotalConnections != 30 || data.NATStats.TCPConnections != 10 {
+		t.Errorf("nat stats = %+v", data.NATStats)
+	}
+	if len(data.Errors) != 0 {
+		t.Errorf("errors = %v", data.Errors)
+	}
+
+	// A failing section is reported without failing the collection
+	sim.Inject("/ppp/active/print", apisim.Fault{Trap: "interrupted", Count: 1})
+	data, err = c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) != 1 || !strings.HasPrefix(data.Errors[0], "pppoe:") || len(data.Interfaces) != 24 {
+		t.Errorf("errors = %v", data.Errors)
+	}
+
+	// A router that drops the connection at login fails the collection
+	sim.Inject("/login", apisim.Fault{Disconnect: true})
+	if _, err := c.CollectAll(ctx, router); err == nil {
+		t.Error("CollectAll() succeeded against a router dropping logins")
+	}
+}
+
+func TestCollectAll_RecordReplay(t *testing.T) {
+	sim := apisim.NewRouter("pop-2-bng", "monitor", "secret")
+	sim.SetLoginMode(apisim.LoginLegacy)
+	sim.Populate(apisim.Profile{Interfaces: 2, Sessions: 5, Leases: 3, Connections: 9})
+	sim.Inject("/ip/dhcp-server/lease/print", apisim.Fault{Trap: "action timed out"})
+	srv, err := apisim.Listen("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer srv.Close()
+
+	cfg := DefaultConfig()
+	cfg.Collect.NAT = true
+	recording := filepath.Join(t.TempDir(), "pop-2-bng.jsonl")
+	router := &models.RouterConfig{
+		ID:      "pop-2-bng",
+		Address: "127.0.0.1",
+		Credentials: models.RouterCredentials{
+			Username: "monitor",
+			Password: "secret",
+		},
+		Metadata: map[string]interface{}{"api_port": srv.Port(), "record_file": recording},
+	}
+
+	live, err := NewCollectorWithConfig(cfg).CollectAll(context.Background(), router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(recording)
+	if err != nil {
+		t.Fatalf("recording not written: %v", err)
+	}
+	if strings.Contains(string(raw), "secret") || strings.Contains(string(raw), "monitor") {
+		t.Error("recording contains credentials")
+	}
+
+	router.Metadata = map[string]interface{}{"backend": "replay", "replay_file": recording}
+	replayed, err := NewCollectorWithConfig(cfg).CollectAll(context.Background(), router)
+	if err != nil {
+		t.Fatalf("CollectAll(replay) error = %v", err)
+	}
+
+	if !reflect.DeepEqual(replayed.System, live.System) {
+		t.Errorf("system = %+v, want %+v", replayed.System, live.System)
+	}
+	if !reflect.DeepEqual(replayed.PPPoE, live.PPPoE) || !reflect.DeepEqual(replayed.NATStats, live.NATStats) {
+		t.Errorf("pppoe or nat differ: %+v, %+v", replayed.NATStats, live.NATStats)
+	}
+	if len(replayed.Interfaces) != len(live.Interfaces) || len(replayed.Interfaces) != 7 {
+		t.Errorf("got %d interfaces, want %d", len(replayed.Interfaces), len(live.Interfaces))
+	}
+	if !reflect.DeepEqual(replayed.Errors, live.Errors) || len(live.Errors) != 1 {
+		t.Errorf("errors = %v, want %v", replayed.Errors, live.Errors)
+	}
+}
+
+func TestParseRouterOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		want     RouterOptions
+		wantErr  bool
+	}{
+		{
+			name: "default",
+			want: RouterOptions{Backend: BackendAPI, SSHPort: 22, RESTPort: 443},
+		},
+		{
+			name:     "ssh with dashboard metadata",
+			metadata: map[string]interface{}{"backend": "ssh", "ssh_port": 2222, "known_hosts": "/etc/ispagent/known_hosts", "location": "pop-1"},
+			want:     RouterOptions{Backend: BackendSSH, SSHPort: 2222, KnownHosts: "/etc/ispagent/known_hosts", RESTPort: 443},
+		},
+		{
+			name:     "rest over plain http",
+			metadata: map[string]interface{}{"backend": "rest", "rest_plain_http": true},
+			want:     RouterOptions{Backend: BackendREST, SSHPort: 22, RESTPort: 80, RESTPlainHTTP: true},
+		},
+		{
+			name:     "api on another port",
+			metadata: map[string]interface{}{"api_port": 18728},
+			want:     RouterOptions{Backend: BackendAPI, APIPort: 18728, SSHPort: 22, RESTPort: 443},
+		},
+		{
+			name:     "replay",
+			metadata: map[string]interface{}{"backend": "replay", "replay_file": "testdata/core-01.jsonl"},
+			want:     RouterOptions{Backend: BackendReplay, SSHPort: 22, RESTPort: 443, ReplayFile: "testdata/core-01.jsonl"},
+		},
+		{
+			name:     "replay without a file",
+			metadata: map[string]interface{}{"backend": "replay"},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown backend",
+			metadata: map[string]interface{}{"backend": "telnet"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRouterOptions(&models.RouterConfig{Metadata: tt.metadata})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRouterOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("ParseRouterOptions() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
 }
 
 func TestDefaultConfig(t *testing.T) {
@@ -267,6 +459,200 @@ func TestConfig_WithNATSampling(t *testing.T) {
 	}
 }
 
+func TestConfig_WithNATSampleMode(t *testing.T) {
+	if mode := DefaultConfig().NAT.SampleMode; mode != NATSampleHash {
+		t.Errorf("Expected default sample mode %q, got %q", NATSampleHash, mode)
+	}
+
+	cfg := DefaultConfig().WithNATSampleMode(NATSampleRandom)
+	if cfg.NAT.SampleMode != NATSampleRandom {
+		t.Errorf("Expected sample mode %q, got %q", NATSampleRandom, cfg.NAT.SampleMode)
+	}
+}
+
+func TestConfig_WithNATAggregation(t *testing.T) {
+	if DefaultConfig().NAT.Aggregation.Enabled {
+		t.Error("Expected NAT aggregation to be disabled by default")
+	}
+
+	cfg := DefaultConfig().WithNATAggregation(20, "/etc/ispagent/asn.txt")
+	if !cfg.NAT.Aggregation.Enabled {
+		t.Error("Expected NAT aggregation to be enabled")
+	}
+	if cfg.NAT.Aggregation.TopN != 20 {
+		t.Errorf("Expected top_n 20, got %d", cfg.NAT.Aggregation.TopN)
+	}
+	if cfg.NAT.Aggregation.ASNFile != "/etc/ispagent/asn.txt" {
+		t.Errorf("Expected ASN file to be set, got %q", cfg.NAT.Aggregation.ASNFile)
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]interface{}
+		strict   bool
+		wantErr  bool
+		check    func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults kept",
+			check: func(t *testing.T, cfg *Config) {
+				if !reflect.DeepEqual(cfg, DefaultConfig()) {
+					t.Errorf("Apply(nil) = %+v, want defaults", cfg)
+				}
+			},
+		},
+		{
+			name: "nat aggregation",
+			settings: map[string]interface{}{
+				"collect": map[string]interface{}{"nat": true},
+				"nat": map[string]interface{}{
+					"sample_rate": 0.5,
+					"aggregation": map[string]interface{}{"enabled": true, "top_n": 20, "asn_file": "/etc/ispagent/asn.txt"},
+				},
+			},
+			strict: true,
+			check: func(t *testing.T, cfg *Config) {
+				if !cfg.Collect.NAT || !cfg.Collect.System || cfg.NAT.SampleRate != 0.5 || cfg.NAT.MaxConnections != 10000 {
+					t.Errorf("NAT settings = %+v, collect = %+v", cfg.NAT, cfg.Collect)
+				}
+				agg := cfg.NAT.Aggregation
+				if !agg.Enabled || agg.TopN != 20 || agg.MaxKeys != 100000 || agg.ASNFile != "/etc/ispagent/asn.txt" {
+					t.Errorf("aggregation = %+v", agg)
+				}
+			},
+		},
+		{
+			name:     "router metadata with other keys",
+			settings: map[string]interface{}{"backend": "ssh", "location": "pop-1", "api": map[string]interface{}{"timeout": "30s"}},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.API.Timeout != 30*time.Second {
+					t.Errorf("API timeout = %v, want 30s", cfg.API.Timeout)
+				}
+			},
+		},
+		{
+			name: "logs",
+			settings: map[string]interface{}{
+				"collect": map[string]interface{}{"logs": true},
+				"logs":    map[string]interface{}{"categories": []string{"pppoe", "account"}, "rate_limit": 120, "backlog_on_start": true},
+			},
+			strict: true,
+			check: func(t *testing.T, cfg *Config) {
+				logs := cfg.Logs
+				if !cfg.Collect.Logs || !reflect.DeepEqual(logs.Categories, []string{"pppoe", "account"}) || logs.RateLimit != 120 || !logs.BacklogOnStart || logs.DedupWindow != 5*time.Minute {
+					t.Errorf("logs = %+v, collect = %+v", logs, cfg.Collect)
+				}
+			},
+		},
+		{
+			name:     "unknown log category",
+			settings: map[string]interface{}{"logs": map[string]interface{}{"categories": []string{"ppp"}}},
+			wantErr:  true,
+		},
+		{
+			name: "probes",
+			settings: map[string]interface{}{
+				"collect": map[string]interface{}{"probes": true},
+				"probes": map[string]interface{}{
+					"targets":    []map[string]interface{}{{"name": "upstream-dns", "address": "1.1.1.1"}, {"address": "10.20.0.1", "routing_table": "customers"}},
+					"count":      3,
+					"interval":   "500ms",
+					"traceroute": true,
+				},
+			},
+			strict: true,
+			check: func(t *testing.T, cfg *Config) {
+				p := cfg.Probes
+				want := []ProbeTarget{{Name: "upstream-dns", Address: "1.1.1.1"}, {Address: "10.20.0.1", RoutingTable: "customers"}}
+				if !cfg.Collect.Probes || !reflect.DeepEqual(p.Targets, want) || p.Count != 3 || p.Interval != 500*time.Millisecond || !p.Traceroute || p.MaxHops != 30 {
+					t.Errorf("probes = %+v, collect = %+v", p, cfg.Collect)
+				}
+			},
+		},
+		{
+			name:     "probe target without address",
+			settings: map[string]interface{}{"probes": map[string]interface{}{"targets": []map[string]interface{}{{"name": "upstream-dns"}}}},
+			wantErr:  true,
+		},
+		{
+			name:     "probes without echo requests",
+			settings: map[string]interface{}{"probes": map[string]interface{}{"targets": []map[string]interface{}{{"address": "1.1.1.1"}}, "count": 0}},
+			wantErr:  true,
+		},
+		{
+			name:     "posture",
+			settings: map[string]interface{}{"collect": map[string]interface{}{"posture": true}, "posture": map[string]interface{}{"min_version": "7.12.1", "wan_interfaces": []string{"ether1", "uplinks"}}},
+			strict:   true,
+			check: func(t *testing.T, cfg *Config) {
+				if !cfg.Collect.Posture || cfg.Posture.MinVersion != "7.12.1" || !reflect.DeepEqual(cfg.Posture.WANInterfaces, []string{"ether1", "uplinks"}) {
+					t.Errorf("posture = %+v, collect = %+v", cfg.Posture, cfg.Collect)
+				}
+			},
+		},
+		{
+			name:     "invalid minimum version",
+			settings: map[string]interface{}{"posture": map[string]interface{}{"min_version": "latest"}},
+			wantErr:  true,
+		},
+		{
+			name:     "negated WAN interface",
+			settings: map[string]interface{}{"posture": map[string]interface{}{"wan_interfaces": []string{"!LAN"}}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown key in strict mode",
+			settings: map[string]interface{}{"colect": map[string]interface{}{"nat": true}},
+			strict:   true,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid sample rate",
+			settings: map[string]interface{}{"nat": map[string]interface{}{"sample_rate": 2}},
+			wantErr:  true,
+		},
+		{
+			name:     "aggregation without buckets",
+			settings: map[string]interface{}{"nat": map[string]interface{}{"aggregation": map[string]interface{}{"enabled": true, "top_n": 0}}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := DefaultConfig()
+			cfg, err := base.Apply(tt.settings, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(base, DefaultConfig()) {
+				t.Error("Apply() modified the base config")
+			}
+			if err == nil && tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestCollector_RouterConfig(t *testing.T) {
+	c := NewCollectorWithConfig(DefaultConfig().WithNATAggregation(10, ""))
+	cfg, err := c.RouterConfig(&models.RouterConfig{
+		ID:       "bng-1",
+		Metadata: map[string]interface{}{"nat": map[string]interface{}{"aggregation": map[string]interface{}{"top_n": 5}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.NAT.Aggregation.Enabled || cfg.NAT.Aggregation.TopN != 5 {
+		t.Errorf("aggregation = %+v, want the collector's with top_n 5", cfg.NAT.Aggregation)
+	}
+	if c.GetConfig().NAT.Aggregation.TopN != 10 {
+		t.Error("router metadata modified the collector config")
+	}
+}
+
 func TestConfig_EnableDisableAll(t *testing.T) {
 	cfg := DefaultConfig().DisableAll()
 
@@ -285,6 +671,21 @@ func TestConfig_EnableDisableAll(t *testing.T) {
 	if !cfg.Collect.NAT {
 		t.Error("Expected NAT collection to be enabled")
 	}
+	if !cfg.Collect.Neighbors {
+		t.Error("Expected neighbor collection to be enabled")
+	}
+	if !cfg.Collect.IPv6 {
+		t.Error("Expected IPv6 collection to be enabled")
+	}
+	if !cfg.Collect.Logs {
+		t.Error("Expected log collection to be enabled")
+	}
+	if !cfg.Collect.Posture {
+		t.Error("Expected posture collection to be enabled")
+	}
+	if !cfg.Collect.Probes {
+		t.Error("Expected probe collection to be enabled")
+	}
 }
 
 func TestInterfaceTracker(t *testing.T) {
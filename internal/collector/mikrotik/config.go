@@ -1,7 +1,14 @@
 package mikrotik
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config contains configuration for the MikroTik collector.
@@ -18,6 +25,18 @@ type Config struct {
 
 	// NAT collection settings
 	NAT NATConfig `yaml:"nat,omitempty"`
+
+	// Log ingestion settings
+	Logs LogConfig `yaml:"logs,omitempty"`
+
+	// Router-side probe settings
+	Probes ProbeConfig `yaml:"probes,omitempty"`
+
+	// Security posture settings
+	Posture PostureConfig `yaml:"posture,omitempty"`
+
+	// Configuration backup settings
+	Backup BackupConfig `yaml:"backup,omitempty"`
 }
 
 // APIConfig contains API connection settings.
@@ -37,6 +56,11 @@ type CollectConfig struct {
 	PPPoE      bool `yaml:"pppoe"`
 	NAT        bool `yaml:"nat"`
 	DHCP       bool `yaml:"dhcp"`
+	Neighbors  bool `yaml:"neighbors"` // ARP, IPv6 neighbors, bridge hosts, MNDP/CDP/LLDP
+	IPv6       bool `yaml:"ipv6"`      // IPv6 addresses, pools and DHCPv6-PD bindings
+	Logs       bool `yaml:"logs"`      // Router log entries as events
+	Posture    bool `yaml:"posture"`   // Package, firmware and service inventory with findings
+	Probes     bool `yaml:"probes"`    // Ping/traceroute from the router and netwatch states
 }
 
 // NATConfig contains NAT-specific collection settings.
@@ -45,10 +69,90 @@ type NATConfig struct {
 	SamplingEnabled bool `yaml:"sampling_enabled"`
 	// SampleRate is the fraction of connections to sample (0.0-1.0)
 	SampleRate float64 `yaml:"sample_rate"`
+	// SampleMode selects how connections are sampled: NATSampleHash (default)
+	// keeps the same flows across polls, NATSampleRandom samples independently
+	SampleMode string `yaml:"sample_mode,omitempty"`
 	// MaxConnections limits the number of connections to collect
 	MaxConnections int `yaml:"max_connections"`
+	// Aggregation rolls the full connection table up into top talkers
+	Aggregation NATAggregationConfig `yaml:"aggregation"`
+}
+
+// NATAggregationConfig configures NAT flow aggregation.
+type NATAggregationConfig struct {
+	// Enabled turns on aggregation; it works whether or not rows are collected
+	Enabled bool `yaml:"enabled"`
+	// TopN is the number of buckets reported per dimension
+	TopN int `yaml:"top_n"`
+	// MaxKeys bounds the buckets tracked per dimension during one poll
+	MaxKeys int `yaml:"max_keys,omitempty"`
+	// ASNFile is an optional prefix-to-ASN table for destination ASNs
+	ASNFile string `yaml:"asn_file,omitempty"`
 }
 
+// LogConfig contains router log ingestion settings.
+type LogConfig struct {
+	// Categories limits forwarded entries to these categories (system,
+	// pppoe, dhcp, firewall, account, other); empty forwards all
+	Categories []string `yaml:"categories,omitempty"`
+	// DedupWindow suppresses identical entries within this window
+	DedupWindow time.Duration `yaml:"dedup_window"`
+	// RateLimit is the number of entries forwarded per minute per router
+	RateLimit int `yaml:"rate_limit"`
+	// BacklogOnStart forwards the entries already in the router's log
+	// buffer on the first poll instead of only newer ones
+	BacklogOnStart bool `yaml:"backlog_on_start"`
+}
+
+// ProbeConfig contains settings for probes run on the router.
+type ProbeConfig struct {
+	// Targets are pinged from every router on each poll
+	Targets []ProbeTarget `yaml:"targets,omitempty"`
+	// Count is the number of echo requests per target
+	Count int `yaml:"count"`
+	// Interval is the time between echo requests
+	Interval time.Duration `yaml:"interval"`
+	// Traceroute also traces the path to each target
+	Traceroute bool `yaml:"traceroute"`
+	// MaxHops limits the traceroute length
+	MaxHops int `yaml:"max_hops,omitempty"`
+}
+
+// ProbeTarget is an address probed from the router.
+type ProbeTarget struct {
+	Name         string `yaml:"name,omitempty"`
+	Address      string `yaml:"address"`
+	SrcAddress   string `yaml:"src_address,omitempty"`
+	Interface    string `yaml:"interface,omitempty"`
+	RoutingTable string `yaml:"routing_table,omitempty"` // VRF or policy routing table
+}
+
+// PostureConfig contains security posture settings.
+type PostureConfig struct {
+	// MinVersion is the oldest acceptable RouterOS version; older routers
+	// are reported as critical
+	MinVersion string `yaml:"min_version"`
+
+	// WANInterfaces are the interfaces and interface lists traffic from the
+	// internet arrives on; when empty, names containing "wan" are taken
+	WANInterfaces []string `yaml:"wan_interfaces,omitempty"`
+}
+
+// BackupConfig contains configuration backup settings. Backups run only when
+// a backup store is set on the collector.
+type BackupConfig struct {
+	// Interval is the minimum time between exports of a router
+	Interval time.Duration `yaml:"interval"`
+	// ShowSensitive includes passwords and keys in the stored exports
+	ShowSensitive bool `yaml:"show_sensitive"`
+}
+
+// NAT sampling modes.
+const (
+	NATSampleHash   = "hash"
+	NATSampleRandom = "random"
+)
+
 // DefaultConfig returns a Config with default values.
 func DefaultConfig() *Config {
 	return &Config{
@@ -65,15 +169,121 @@ func DefaultConfig() *Config {
 			PPPoE:      true,
 			NAT:        false, // Disabled by default due to performance impact
 			DHCP:       true,
+			Neighbors:  false,
+			IPv6:       false,
+			Logs:       false,
+			Posture:    false,
+			Probes:     false,
 		},
 		NAT: NATConfig{
 			SamplingEnabled: false,
 			SampleRate:      1.0,
+			SampleMode:      NATSampleHash,
 			MaxConnections:  10000,
+			Aggregation: NATAggregationConfig{
+				Enabled: false,
+				TopN:    10,
+				MaxKeys: 100000,
+			},
+		},
+		Logs: LogConfig{
+			DedupWindow: 5 * time.Minute,
+			RateLimit:   60,
+		},
+		Probes: ProbeConfig{
+			Count:    5,
+			Interval: 200 * time.Millisecond,
+			MaxHops:  30,
+		},
+		Posture: PostureConfig{
+			MinVersion: "6.49.10",
+		},
+		Backup: BackupConfig{
+			Interval: time.Hour,
 		},
 	}
 }
 
+// Apply returns a copy of c with settings applied over it. settings has the
+// YAML layout of Config, as the mikrotik section of the agent configuration
+// and the metadata of MikroTik routers do; keys it leaves out keep their
+// values. With strict, unknown keys are an error. The result is validated.
+func (c *Config) Apply(settings map[string]interface{}, strict bool) (*Config, error) {
+	cfg := *c
+	if len(settings) > 0 {
+		raw, err := yaml.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(strict)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the settings for values the collector cannot use.
+func (c *Config) Validate() error {
+	switch c.NAT.SampleMode {
+	case "", NATSampleHash, NATSampleRandom:
+	default:
+		return fmt.Errorf("nat.sample_mode must be %q or %q", NATSampleHash, NATSampleRandom)
+	}
+	if c.NAT.SampleRate < 0 || c.NAT.SampleRate > 1 {
+		return fmt.Errorf("nat.sample_rate must be between 0 and 1")
+	}
+	if c.NAT.MaxConnections < 0 {
+		return fmt.Errorf("nat.max_connections must not be negative")
+	}
+	if c.NAT.Aggregation.Enabled && c.NAT.Aggregation.TopN <= 0 {
+		return fmt.Errorf("nat.aggregation.top_n must be positive")
+	}
+	if c.NAT.Aggregation.MaxKeys < 0 {
+		return fmt.Errorf("nat.aggregation.max_keys must not be negative")
+	}
+	for _, category := range c.Logs.Categories {
+		switch category {
+		case LogCategorySystem, LogCategoryPPPoE, LogCategoryDHCP, LogCategoryFirewall, LogCategoryAccount, LogCategoryOther:
+		default:
+			return fmt.Errorf("logs.categories: unknown category %q", category)
+		}
+	}
+	if c.Logs.RateLimit < 0 {
+		return fmt.Errorf("logs.rate_limit must not be negative")
+	}
+	if c.Logs.DedupWindow < 0 {
+		return fmt.Errorf("logs.dedup_window must not be negative")
+	}
+	for i, target := range c.Probes.Targets {
+		if target.Address == "" {
+			return fmt.Errorf("probes.targets[%d].address is required", i)
+		}
+	}
+	if len(c.Probes.Targets) > 0 && c.Probes.Count <= 0 {
+		return fmt.Errorf("probes.count must be positive")
+	}
+	if c.Probes.Interval < 0 {
+		return fmt.Errorf("probes.interval must not be negative")
+	}
+	if c.Probes.MaxHops < 0 {
+		return fmt.Errorf("probes.max_hops must not be negative")
+	}
+	if v := c.Posture.MinVersion; v != "" && (v[0] < '0' || v[0] > '9') {
+		return fmt.Errorf("posture.min_version must be a RouterOS version such as 7.12.1")
+	}
+	for i, name := range c.Posture.WANInterfaces {
+		if strings.TrimSpace(name) == "" || strings.HasPrefix(name, "!") {
+			return fmt.Errorf("posture.wan_interfaces[%d] must be an interface or interface list name", i)
+		}
+	}
+	return nil
+}
+
 // WithTLS returns a config with TLS enabled.
 func (c *Config) WithTLS() *Config {
 	c.API.UseTLS = true
@@ -109,6 +319,28 @@ func (c *Config) WithNATSampling(rate float64, maxConn int) *Config {
 	return c
 }
 
+// WithNATSampleMode returns a config with the given NAT sampling mode.
+func (c *Config) WithNATSampleMode(mode string) *Config {
+	c.NAT.SampleMode = mode
+	return c
+}
+
+// WithNATAggregation returns a config with NAT aggregation enabled, reporting
+// the topN largest buckets per dimension.
+func (c *Config) WithNATAggregation(topN int, asnFile string) *Config {
+	c.NAT.Aggregation.Enabled = true
+	c.NAT.Aggregation.TopN = topN
+	c.NAT.Aggregation.ASNFile = asnFile
+	return c
+}
+
+// WithProbeTargets returns a config with router-side probes of targets.
+func (c *Config) WithProbeTargets(targets ...ProbeTarget) *Config {
+	c.Collect.Probes = true
+	c.Probes.Targets = targets
+	return c
+}
+
 // EnableAll enables collection of all metric types.
 func (c *Config) EnableAll() *Config {
 	c.Collect.System = true
@@ -116,6 +348,11 @@ func (c *Config) EnableAll() *Config {
 	c.Collect.PPPoE = true
 	c.Collect.NAT = true
 	c.Collect.DHCP = true
+	c.Collect.Neighbors = true
+	c.Collect.IPv6 = true
+	c.Collect.Logs = true
+	c.Collect.Posture = true
+	c.Collect.Probes = true
 	return c
 }
 
@@ -126,5 +363,10 @@ func (c *Config) DisableAll() *Config {
 	c.Collect.PPPoE = false
 	c.Collect.NAT = false
 	c.Collect.DHCP = false
+	c.Collect.Neighbors = false
+	c.Collect.IPv6 = false
+	c.Collect.Logs = false
+	c.Collect.Posture = false
+	c.Collect.Probes = false
 	return c
 }
@@ -4,8 +4,6 @@ import (
 	"context"
 	"strings"
 	"time"
-
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
 )
 
 // DHCPLease represents a DHCP lease entry.
@@ -51,7 +49,7 @@ type DHCPServerStats struct {
 }
 
 // collectDHCP collects DHCP lease information from the router.
-func (c *Collector) collectDHCP(ctx context.Context, client *api.Client) ([]DHCPLease, []DHCPPoolStats, []DHCPServerStats, error) {
+func (c *Collector) collectDHCP(ctx context.Context, client Backend) ([]DHCPLease, []DHCPPoolStats, []DHCPServerStats, error) {
 	// Get DHCP leases
 	leases, err := client.Run(ctx, "/ip/dhcp-server/lease/print", nil)
 	if err != nil {
@@ -7,6 +7,14 @@ import (
 	"time"
 )
 
+// Patterns used by the parsers below, compiled once since they run for
+// every row of large tables.
+var (
+	uptimePattern = regexp.MustCompile(`(\d+)([wdhms])`)
+	speedPattern  = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(gbps|mbps|kbps|bps)?$`)
+	memoryPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(gib|mib|kib|gb|mb|kb|b)?$`)
+)
+
 // ParseUptime parses RouterOS uptime string (e.g., "1w2d3h4m5s") to seconds.
 func ParseUptime(uptime string) int64 {
 	if uptime == "" {
@@ -16,9 +24,8 @@ func ParseUptime(uptime string) int64 {
 	var total int64
 	uptime = strings.TrimSpace(uptime)
 
-	// Regular expression to match time components
-	re := regexp.MustCompile(`(\d+)([wdhms])`)
-	matches := re.FindAllStringSubmatch(uptime, -1)
+	// Match time components
+	matches := uptimePattern.FindAllStringSubmatch(uptime, -1)
 
 	for _, match := range matches {
 		if len(match) != 3 {
@@ -60,8 +67,7 @@ func ParseSpeed(speed string) int64 {
 	}
 
 	// Extract number and unit
-	re := regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(gbps|mbps|kbps|bps)?$`)
-	matches := re.FindStringSubmatch(speed)
+	matches := speedPattern.FindStringSubmatch(speed)
 
 	if len(matches) < 2 {
 		return 0
@@ -147,8 +153,7 @@ func ParseMemory(mem string) int64 {
 	mem = strings.TrimSpace(strings.ToLower(mem))
 
 	// Extract number and unit
-	re := regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*(gib|mib|kib|gb|mb|kb|b)?$`)
-	matches := re.FindStringSubmatch(mem)
+	matches := memoryPattern.FindStringSubmatch(mem)
 
 	if len(matches) < 2 {
 		// Try parsing as plain number (bytes)
@@ -2,10 +2,10 @@ package mikrotik
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
 )
 
@@ -25,6 +25,12 @@ type InterfaceMetrics struct {
 	FullDuplex     bool    `json:"full_duplex,omitempty"`
 }
 
+// IsSubscriber reports whether the interface exists for one subscriber
+// session, such as the dynamic <pppoe-user> interfaces of a PPPoE server.
+func (m *InterfaceMetrics) IsSubscriber() bool {
+	return strings.HasSuffix(m.Type, "-in") || strings.HasPrefix(m.Name, "<")
+}
+
 // interfaceState stores previous counter values for rate calculation.
 type interfaceState struct {
 	rxBytes    uint64
@@ -82,7 +88,7 @@ func (t *interfaceTracker) updateAndCalculateRates(name string, rxBytes, txBytes
 }
 
 // collectInterfaces collects interface metrics from the router.
-func (c *Collector) collectInterfaces(ctx context.Context, client *api.Client) ([]InterfaceMetrics, error) {
+func (c *Collector) collectInterfaces(ctx context.Context, client Backend) ([]InterfaceMetrics, error) {
 	// Get all interfaces
 	interfaces, err := client.Run(ctx, "/interface/print", nil)
 	if err != nil {
@@ -152,7 +158,7 @@ type ethernetStats struct {
 	fullDuplex bool
 }
 
-func (c *Collector) getEthernetStats(ctx context.Context, client *api.Client, name string) (*ethernetStats, error) {
+func (c *Collector) getEthernetStats(ctx context.Context, client Backend, name string) (*ethernetStats, error) {
 	// Get ethernet interface stats
 	results, err := client.Run(ctx, "/interface/ethernet/print", map[string]string{
 		".proplist": "name,speed,full-duplex",
@@ -0,0 +1,206 @@
+package mikrotik
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// IPv6PoolStats contains IPv6 prefix pool statistics.
+type IPv6PoolStats struct {
+	Name          string  `json:"name"`
+	Prefix        string  `json:"prefix"`
+	PrefixLength  int     `json:"prefix_length"` // Size of each delegated prefix
+	TotalPrefixes int64   `json:"total_prefixes"`
+	UsedPrefixes  int64   `json:"used_prefixes"`
+	FreePrefixes  int64   `json:"free_prefixes"`
+	Utilization   float64 `json:"utilization_percent"`
+	ExpireTime    int64   `json:"expire_time_seconds,omitempty"`
+	InvalidPrefix bool    `json:"invalid_prefix,omitempty"` // Pool prefix could not be parsed
+}
+
+// DHCPv6Binding represents a DHCPv6 prefix delegation binding.
+type DHCPv6Binding struct {
+	ID            string    `json:"id"`
+	Prefix        string    `json:"prefix"`
+	DUID          string    `json:"duid,omitempty"`
+	IAID          int64     `json:"iaid,omitempty"`
+	Server        string    `json:"server,omitempty"`
+	Subscriber    string    `json:"subscriber,omitempty"` // PPP user for per-session servers
+	Pool          string    `json:"pool,omitempty"`
+	Status        string    `json:"status,omitempty"` // bound, waiting
+	ClientAddress string    `json:"client_address,omitempty"`
+	LifeTime      int64     `json:"life_time_seconds,omitempty"`
+	ExpiresAfter  int64     `json:"expires_after,omitempty"` // Seconds until expiry
+	LastSeen      int64     `json:"last_seen_seconds,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+	Comment       string    `json:"comment,omitempty"`
+	Dynamic       bool      `json:"dynamic,omitempty"`
+}
+
+// IPv6Address represents an address configured on a router interface.
+type IPv6Address struct {
+	Address   string `json:"address"`
+	Interface string `json:"interface"`
+	FromPool  string `json:"from_pool,omitempty"`
+	Advertise bool   `json:"advertise,omitempty"`
+	EUI64     bool   `json:"eui_64,omitempty"`
+	Dynamic   bool   `json:"dynamic,omitempty"`
+	LinkLocal bool   `json:"link_local,omitempty"`
+	Global    bool   `json:"global,omitempty"`
+	Invalid   bool   `json:"invalid,omitempty"`
+	Disabled  bool   `json:"disabled,omitempty"`
+}
+
+// IPv6Data contains IPv6 pools, prefix delegation bindings and addresses.
+type IPv6Data struct {
+	Pools     []IPv6PoolStats `json:"pools,omitempty"`
+	Bindings  []DHCPv6Binding `json:"bindings,omitempty"`
+	Addresses []IPv6Address   `json:"addresses,omitempty"`
+}
+
+// collectIPv6 collects IPv6 address inventory, pool utilization and
+// DHCPv6-PD bindings. It fails when addresses cannot be listed, which means
+// the IPv6 package is disabled, and when pools or bindings cannot be read
+// for any reason but the router not knowing the command.
+func (c *Collector) collectIPv6(ctx context.Context, client Backend) (*IPv6Data, error) {
+	addresses, err := client.Run(ctx, "/ipv6/address/print", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &IPv6Data{}
+	for _, a := range addresses {
+		data.Addresses = append(data.Addresses, parseIPv6Address(a))
+	}
+
+	// Pool and DHCPv6 server menus might not exist; an empty table is not
+	// an error
+	pools, err := runOptional(ctx, client, "/ipv6/pool/print")
+	if err != nil {
+		return nil, err
+	}
+	used, err := runOptional(ctx, client, "/ipv6/pool/used/print")
+	if err != nil {
+		return nil, err
+	}
+	data.Pools = parseIPv6Pools(pools, used)
+
+	bindings, err := runOptional(ctx, client, "/ipv6/dhcp-server/binding/print")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, b := range bindings {
+		binding := parseDHCPv6Binding(b)
+		if binding.ExpiresAfter > 0 {
+			binding.ExpiresAt = now.Add(time.Duration(binding.ExpiresAfter) * time.Second)
+		}
+		data.Bindings = append(data.Bindings, binding)
+	}
+
+	return data, nil
+}
+
+// parseIPv6Pools computes pool utilization from /ipv6/pool and the prefixes
+// handed out from each pool in /ipv6/pool/used.
+func parseIPv6Pools(pools, used []map[string]string) []IPv6PoolStats {
+	usage := make(map[string]int64)
+	for _, u := range used {
+		usage[u["pool"]]++
+	}
+
+	var result []IPv6PoolStats
+	for _, p := range pools {
+		stats := IPv6PoolStats{
+			Name:         p["name"],
+			Prefix:       p["prefix"],
+			PrefixLength: int(ParseInt64(p["prefix-length"])),
+			UsedPrefixes: usage[p["name"]],
+			ExpireTime:   ParseUptime(p["expire-time"]),
+		}
+
+		total, ok := countIPv6Prefixes(stats.Prefix, stats.PrefixLength)
+		if !ok {
+			stats.InvalidPrefix = true
+		}
+		stats.TotalPrefixes = total
+		stats.FreePrefixes = total - stats.UsedPrefixes
+		if stats.FreePrefixes < 0 {
+			stats.FreePrefixes = 0
+		}
+		if total > 0 {
+			stats.Utilization = float64(stats.UsedPrefixes) / float64(total) * 100
+		}
+
+		result = append(result, stats)
+	}
+
+	return result
+}
+
+// countIPv6Prefixes returns how many prefixes of length delegated fit in
+// pool, capped at 2^62.
+func countIPv6Prefixes(pool string, delegated int) (int64, bool) {
+	prefix, err := netip.ParsePrefix(pool)
+	if err != nil || delegated < prefix.Bits() || delegated > 128 {
+		return 0, false
+	}
+
+	bits := delegated - prefix.Bits()
+	if bits > 62 {
+		bits = 62
+	}
+	return int64(1) << bits, true
+}
+
+func parseDHCPv6Binding(b map[string]string) DHCPv6Binding {
+	return DHCPv6Binding{
+		ID:            b[".id"],
+		Prefix:        b["address"],
+		DUID:          b["duid"],
+		IAID:          ParseInt64(b["iaid"]),
+		Server:        b["server"],
+		Subscriber:    subscriberFromServer(b["server"]),
+		Pool:          b["prefix-pool"],
+		Status:        b["status"],
+		ClientAddress: b["client-address"],
+		LifeTime:      ParseUptime(b["life-time"]),
+		ExpiresAfter:  ParseUptime(b["expires-after"]),
+		LastSeen:      ParseUptime(b["last-seen"]),
+		Comment:       b["comment"],
+		Dynamic:       b["dynamic"] == "true",
+	}
+}
+
+// subscriberFromServer extracts the PPP user from the name of the DHCPv6
+// server RouterOS creates for each PPP session, e.g. "<pppoe-john>".
+func subscriberFromServer(server string) string {
+	if !strings.HasPrefix(server, "<") || !strings.HasSuffix(server, ">") {
+		return ""
+	}
+	name := server[1 : len(server)-1]
+
+	for _, prefix := range []string{"pppoe-", "l2tp-", "pptp-", "sstp-", "ovpn-"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix)
+		}
+	}
+	return ""
+}
+
+func parseIPv6Address(a map[string]string) IPv6Address {
+	return IPv6Address{
+		Address:   a["address"],
+		Interface: SafeString(a["actual-interface"], a["interface"]),
+		FromPool:  a["from-pool"],
+		Advertise: a["advertise"] == "true",
+		EUI64:     a["eui-64"] == "true",
+		Dynamic:   a["dynamic"] == "true",
+		LinkLocal: a["link-local"] == "true",
+		Global:    a["global"] == "true",
+		Invalid:   a["invalid"] == "true",
+		Disabled:  a["disabled"] == "true",
+	}
+}
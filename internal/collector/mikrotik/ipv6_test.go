@@ -0,0 +1,116 @@
+package mikrotik
+
+import "testing"
+
+func TestCountIPv6Prefixes(t *testing.T) {
+	tests := []struct {
+		pool      string
+		delegated int
+		want      int64
+		ok        bool
+	}{
+		{"2001:db8:1000::/40", 56, 65536, true},
+		{"2001:db8:1000::/48", 64, 65536, true},
+		{"2001:db8::/48", 48, 1, true},
+		{"2001:db8::/32", 128, 1 << 62, true},
+		{"2001:db8::/48", 40, 0, false},
+		{"invalid", 56, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pool, func(t *testing.T) {
+			got, ok := countIPv6Prefixes(tt.pool, tt.delegated)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("countIPv6Prefixes(%q, %d) = %d, %v; want %d, %v", tt.pool, tt.delegated, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseIPv6Pools(t *testing.T) {
+	pools := []map[string]string{
+		{"name": "pd-pool", "prefix": "2001:db8:1000::/52", "prefix-length": "56"},
+		{"name": "broken", "prefix": "nope", "prefix-length": "64"},
+	}
+	used := []map[string]string{
+		{"pool": "pd-pool", "prefix": "2001:db8:1000::/56", "info": "<pppoe-john>"},
+		{"pool": "pd-pool", "prefix": "2001:db8:1000:100::/56", "info": "<pppoe-jane>"},
+		{"pool": "pd-pool", "prefix": "2001:db8:1000:200::/56", "info": "<pppoe-joe>"},
+		{"pool": "pd-pool", "prefix": "2001:db8:1000:300::/56", "info": "<pppoe-ann>"},
+	}
+
+	stats := parseIPv6Pools(pools, used)
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 pools, got %d", len(stats))
+	}
+
+	pd := stats[0]
+	if pd.TotalPrefixes != 16 || pd.UsedPrefixes != 4 || pd.FreePrefixes != 12 {
+		t.Errorf("unexpected counts %+v", pd)
+	}
+	if pd.Utilization != 25 {
+		t.Errorf("expected 25%% utilization, got %v", pd.Utilization)
+	}
+
+	if !stats[1].InvalidPrefix || stats[1].TotalPrefixes != 0 {
+		t.Errorf("expected invalid pool to be flagged, got %+v", stats[1])
+	}
+}
+
+func TestParseDHCPv6Binding(t *testing.T) {
+	b := parseDHCPv6Binding(map[string]string{
+		".id":           "*1",
+		"address":       "2001:db8:1000:100::/56",
+		"duid":          "0x00030001aabbccddeeff",
+		"iaid":          "1",
+		"server":        "<pppoe-john>",
+		"status":        "bound",
+		"life-time":     "3d",
+		"expires-after": "2d23h",
+		"dynamic":       "true",
+	})
+
+	if b.Prefix != "2001:db8:1000:100::/56" {
+		t.Errorf("unexpected prefix %s", b.Prefix)
+	}
+	if b.Subscriber != "john" {
+		t.Errorf("expected subscriber john, got %q", b.Subscriber)
+	}
+	if b.LifeTime != 3*86400 || b.ExpiresAfter != 2*86400+23*3600 {
+		t.Errorf("unexpected lifetimes %d/%d", b.LifeTime, b.ExpiresAfter)
+	}
+	if !b.Dynamic || b.IAID != 1 {
+		t.Errorf("unexpected binding %+v", b)
+	}
+}
+
+func TestSubscriberFromServer(t *testing.T) {
+	tests := map[string]string{
+		"<pppoe-john>":    "john",
+		"<l2tp-branch-1>": "branch-1",
+		"<vlan100>":       "",
+		"dhcpv6-lan":      "",
+		"":                "",
+	}
+
+	for server, want := range tests {
+		if got := subscriberFromServer(server); got != want {
+			t.Errorf("subscriberFromServer(%q) = %q, want %q", server, got, want)
+		}
+	}
+}
+
+func TestParseIPv6Address(t *testing.T) {
+	a := parseIPv6Address(map[string]string{
+		"address":          "2001:db8:1::1/64",
+		"interface":        "bridge1",
+		"actual-interface": "bridge1",
+		"from-pool":        "lan-pool",
+		"advertise":        "true",
+		"global":           "true",
+	})
+
+	if a.Interface != "bridge1" || a.FromPool != "lan-pool" || !a.Advertise || !a.Global || a.LinkLocal {
+		t.Errorf("unexpected address %+v", a)
+	}
+}
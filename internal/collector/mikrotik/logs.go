@@ -0,0 +1,354 @@
+package mikrotik
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// Log event types.
+const (
+	EventRouterLog        = "router_log"
+	EventRouterLogDropped = "router_log_dropped"
+)
+
+// Log categories.
+const (
+	LogCategorySystem   = "system"
+	LogCategoryPPPoE    = "pppoe"
+	LogCategoryDHCP     = "dhcp"
+	LogCategoryFirewall = "firewall"
+	LogCategoryAccount  = "account"
+	LogCategoryOther    = "other"
+)
+
+// logTopicCategories maps RouterOS log topics to categories. Severity topics
+// (info, warning, error, critical, debug) are not listed.
+var logTopicCategories = map[string]string{
+	"system":    LogCategorySystem,
+	"interface": LogCategorySystem,
+	"health":    LogCategorySystem,
+	"script":    LogCategorySystem,
+	"pppoe":     LogCategoryPPPoE,
+	"ppp":       LogCategoryPPPoE,
+	"l2tp":      LogCategoryPPPoE,
+	"pptp":      LogCategoryPPPoE,
+	"sstp":      LogCategoryPPPoE,
+	"ovpn":      LogCategoryPPPoE,
+	"dhcp":      LogCategoryDHCP,
+	"firewall":  LogCategoryFirewall,
+	"account":   LogCategoryAccount,
+	"radius":    LogCategoryAccount,
+}
+
+// logWarningPatterns raise informational entries that usually explain an
+// outage or an attack to warning severity.
+var logWarningPatterns = []string{
+	"login failure",
+	"authentication failed",
+	"link down",
+	"disconnected",
+}
+
+// LogEntry represents a classified /log entry.
+type LogEntry struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Topics   []string  `json:"topics"`
+	Message  string    `json:"message"`
+	Category string    `json:"category"`
+	Severity string    `json:"severity"`
+}
+
+// collectLogs reads the router's log buffer and returns the entries that
+// are new since the previous poll as events.
+//
+// RouterOS keeps the log in a ring buffer (1000 lines by default), so the
+// whole buffer is streamed and entries up to the last seen .id are skipped.
+func (c *Collector) collectLogs(ctx context.Context, client Backend, routerID string, cfg LogConfig, now time.Time) ([]models.Event, error) {
+	entries, err := readLog(ctx, client, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.logTracker.process(routerID, entries, cfg, now), nil
+}
+
+// readLog returns the whole log buffer of the router.
+func readLog(ctx context.Context, client Backend, now time.Time) ([]LogEntry, error) {
+	var entries []LogEntry
+	err := client.RunStream(ctx, "/log/print", map[string]string{
+		".proplist": ".id,time,topics,message",
+	}, func(e map[string]string) error {
+		entries = append(entries, parseLogEntry(e, now))
+		return nil
+	})
+	return entries, err
+}
+
+func parseLogEntry(e map[string]string, now time.Time) LogEntry {
+	entry := LogEntry{
+		ID:      e[".id"],
+		Time:    parseLogTime(e["time"], now),
+		Message: e["message"],
+	}
+	if topics := e["topics"]; topics != "" {
+		entry.Topics = strings.Split(topics, ",")
+	}
+	entry.Category, entry.Severity = classifyLog(entry.Topics, entry.Message)
+	return entry
+}
+
+// classifyLog derives the category and severity of a log entry from its
+// topics, e.g. "pppoe,ppp,info" or "system,error,critical".
+func classifyLog(topics []string, message string) (category, severity string) {
+	severity = models.SeverityInfo
+	other := false
+
+	for _, topic := range topics {
+		switch topic {
+		case "critical", "error":
+			severity = models.SeverityCritical
+			continue
+		case "warning":
+			if severity != models.SeverityCritical {
+				severity = models.SeverityWarning
+			}
+			continue
+		case "info", "debug", "packet", "raw":
+			continue
+		}
+
+		if cat, ok := logTopicCategories[topic]; ok {
+			if category == "" {
+				category = cat
+			}
+		} else {
+			other = true
+		}
+	}
+
+	switch {
+	case category != "":
+	case other:
+		category = LogCategoryOther
+	default:
+		category = LogCategorySystem
+	}
+
+	if severity == models.SeverityInfo {
+		lower := strings.ToLower(message)
+		for _, pattern := range logWarningPatterns {
+			if strings.Contains(lower, pattern) {
+				severity = models.SeverityWarning
+				break
+			}
+		}
+	}
+
+	return category, severity
+}
+
+// parseLogTime parses the time of a log entry. RouterOS omits the date for
+// entries from today and the year for entries from this year, e.g.
+// "12:34:56", "jan/02 12:34:56" or, since 7.10, "01-02 12:34:56".
+func parseLogTime(s string, now time.Time) time.Time {
+	if s == "" {
+		return now
+	}
+
+	loc := now.Location()
+
+	if t, err := time.ParseInLocation("15:04:05", s, loc); err == nil {
+		t = time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+		if t.After(now.Add(time.Minute)) {
+			// Logged before midnight, read after it
+			t = t.AddDate(0, 0, -1)
+		}
+		return t
+	}
+
+	for _, layout := range []string{"Jan/02 15:04:05", "01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+			if t.After(now.Add(time.Minute)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t
+		}
+	}
+
+	for _, layout := range []string{"Jan/02/2006 15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t
+		}
+	}
+
+	return now
+}
+
+// parseLogID parses a RouterOS log .id such as "*1A2B".
+func parseLogID(id string) (uint64, bool) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(id, "*"), 16, 64)
+	return n, err == nil
+}
+
+// logTracker keeps each router's log cursor, deduplication and rate
+// limiting state between polls.
+type logTracker struct {
+	mu      sync.Mutex
+	routers map[string]*logState
+}
+
+type logState struct {
+	cursor     uint64
+	seen       map[string]*logDedup // Category + message -> last forwarded
+	tokens     float64
+	lastRefill time.Time
+}
+
+type logDedup struct {
+	entry      LogEntry
+	forwarded  time.Time
+	suppressed int
+}
+
+func newLogTracker() *logTracker {
+	return &logTracker{
+		routers: make(map[string]*logState),
+	}
+}
+
+// process returns events for entries newer than routerID's cursor. Entries
+// identical to one forwarded within the dedup window are counted instead of
+// forwarded and reported once the window has passed. At most RateLimit
+// entries per minute are forwarded; the number of dropped entries is
+// reported in a single summary event.
+func (t *logTracker) process(routerID string, entries []LogEntry, cfg LogConfig, now time.Time) []models.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rateLimit := float64(cfg.RateLimit)
+	if rateLimit <= 0 {
+		rateLimit = 60
+	}
+
+	state, known := t.routers[routerID]
+	if !known {
+		state = &logState{
+			seen:       make(map[string]*logDedup),
+			tokens:     rateLimit,
+			lastRefill: now,
+		}
+		t.routers[routerID] = state
+	}
+
+	// Refill the rate limiter
+	state.tokens += now.Sub(state.lastRefill).Minutes() * rateLimit
+	if state.tokens > rateLimit {
+		state.tokens = rateLimit
+	}
+	state.lastRefill = now
+
+	var maxID uint64
+	for _, e := range entries {
+		if id, ok := parseLogID(e.ID); ok && id > maxID {
+			maxID = id
+		}
+	}
+
+	cursor := state.cursor
+	if len(entries) > 0 {
+		if maxID < cursor {
+			// IDs restart when the router reboots
+			cursor = 0
+		}
+		state.cursor = maxID
+	}
+
+	if !known && !cfg.BacklogOnStart {
+		return nil
+	}
+
+	categories := make(map[string]bool, len(cfg.Categories))
+	for _, c := range cfg.Categories {
+		categories[c] = true
+	}
+
+	var events []models.Event
+	dropped := 0
+
+	for key, d := range state.seen {
+		if now.Sub(d.forwarded) < cfg.DedupWindow {
+			continue
+		}
+		if d.suppressed > 0 {
+			event := logEvent(d.entry)
+			event.Timestamp = now
+			event.Attributes["repeated"] = strconv.Itoa(d.suppressed)
+			events = append(events, event)
+		}
+		delete(state.seen, key)
+	}
+
+	for _, e := range entries {
+		id, ok := parseLogID(e.ID)
+		if !ok || id <= cursor {
+			continue
+		}
+		if len(categories) > 0 && !categories[e.Category] {
+			continue
+		}
+
+		key := e.Category + "|" + e.Message
+		if d, ok := state.seen[key]; ok {
+			d.suppressed++
+			continue
+		}
+
+		if state.tokens < 1 {
+			dropped++
+			continue
+		}
+		state.tokens--
+
+		events = append(events, logEvent(e))
+
+		if cfg.DedupWindow > 0 {
+			state.seen[key] = &logDedup{entry: e, forwarded: now}
+		}
+	}
+
+	if dropped > 0 {
+		events = append(events, models.Event{
+			Type:      EventRouterLogDropped,
+			Severity:  models.SeverityWarning,
+			Message:   fmt.Sprintf("%d log entries dropped by rate limit", dropped),
+			Timestamp: now,
+			Attributes: map[string]string{
+				"dropped": strconv.Itoa(dropped),
+			},
+		})
+	}
+
+	return events
+}
+
+func logEvent(e LogEntry) models.Event {
+	return models.Event{
+		Type:      EventRouterLog,
+		Severity:  e.Severity,
+		Message:   e.Message,
+		Timestamp: e.Time,
+		Attributes: map[string]string{
+			"category": e.Category,
+			"topics":   strings.Join(e.Topics, ","),
+			"log_id":   e.ID,
+		},
+	}
+}
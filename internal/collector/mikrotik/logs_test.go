@@ -0,0 +1,184 @@
+package mikrotik
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func TestClassifyLog(t *testing.T) {
+	tests := []struct {
+		topics   []string
+		message  string
+		category string
+		severity string
+	}{
+		{[]string{"pppoe", "ppp", "info"}, "<pppoe-john>: connected", LogCategoryPPPoE, models.SeverityInfo},
+		{[]string{"pppoe", "ppp", "info"}, "<pppoe-john>: authentication failed", LogCategoryPPPoE, models.SeverityWarning},
+		{[]string{"system", "error", "critical"}, "login failure for user admin from 10.0.0.5 via ssh", LogCategorySystem, models.SeverityCritical},
+		{[]string{"interface", "info"}, "ether1 link down", LogCategorySystem, models.SeverityWarning},
+		{[]string{"dhcp", "info"}, "defconf assigned 192.168.88.10 to AA:BB:CC:DD:EE:FF", LogCategoryDHCP, models.SeverityInfo},
+		{[]string{"firewall", "info"}, "input: in:ether1 out:(unknown 0)", LogCategoryFirewall, models.SeverityInfo},
+		{[]string{"account", "info"}, "user admin logged in from 10.0.0.5 via winbox", LogCategoryAccount, models.SeverityInfo},
+		{[]string{"ospf", "warning"}, "neighbor state change", LogCategoryOther, models.SeverityWarning},
+		{[]string{"info"}, "router rebooted", LogCategorySystem, models.SeverityInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			category, severity := classifyLog(tt.topics, tt.message)
+			if category != tt.category || severity != tt.severity {
+				t.Errorf("classifyLog(%v) = %s/%s, want %s/%s", tt.topics, category, severity, tt.category, tt.severity)
+			}
+		})
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"00:00:10", time.Date(2024, 3, 1, 0, 0, 10, 0, time.UTC)},
+		{"23:59:50", time.Date(2024, 2, 29, 23, 59, 50, 0, time.UTC)},
+		{"feb/28 10:00:00", time.Date(2024, 2, 28, 10, 0, 0, 0, time.UTC)},
+		{"dec/31 10:00:00", time.Date(2023, 12, 31, 10, 0, 0, 0, time.UTC)},
+		{"02-28 10:00:00", time.Date(2024, 2, 28, 10, 0, 0, 0, time.UTC)},
+		{"jan/02/2023 10:00:00", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{"2023-01-02 10:00:00", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{"garbage", now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := parseLogTime(tt.input, now); !got.Equal(tt.want) {
+				t.Errorf("parseLogTime(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func logEntries(ids ...int) []LogEntry {
+	var entries []LogEntry
+	for _, id := range ids {
+		entries = append(entries, LogEntry{
+			ID:       fmt.Sprintf("*%X", id),
+			Message:  fmt.Sprintf("message %d", id),
+			Category: LogCategorySystem,
+			Severity: models.SeverityInfo,
+		})
+	}
+	return entries
+}
+
+func TestLogTracker_Cursor(t *testing.T) {
+	tr := newLogTracker()
+	cfg := LogConfig{RateLimit: 100}
+	now := time.Now()
+
+	if events := tr.process("r1", logEntries(1, 2, 3), cfg, now); len(events) != 0 {
+		t.Fatalf("expected first poll to only set the cursor, got %d events", len(events))
+	}
+
+	events := tr.process("r1", logEntries(2, 3, 4, 5), cfg, now.Add(time.Minute))
+	if len(events) != 2 || events[0].Attributes["log_id"] != "*4" || events[1].Attributes["log_id"] != "*5" {
+		t.Fatalf("expected entries *4 and *5, got %+v", events)
+	}
+
+	// An empty buffer keeps the cursor
+	tr.process("r1", nil, cfg, now.Add(2*time.Minute))
+	if events := tr.process("r1", logEntries(4, 5), cfg, now.Add(3*time.Minute)); len(events) != 0 {
+		t.Errorf("expected no events, got %+v", events)
+	}
+
+	// After a reboot IDs start over
+	if events := tr.process("r1", logEntries(1, 2), cfg, now.Add(4*time.Minute)); len(events) != 2 {
+		t.Errorf("expected entries after reboot to be forwarded, got %d", len(events))
+	}
+}
+
+func TestLogTracker_BacklogOnStart(t *testing.T) {
+	tr := newLogTracker()
+
+	events := tr.process("r1", logEntries(1, 2, 3), LogConfig{BacklogOnStart: true}, time.Now())
+	if len(events) != 3 {
+		t.Errorf("expected backlog to be forwarded, got %d events", len(events))
+	}
+}
+
+func TestLogTracker_Dedup(t *testing.T) {
+	tr := newLogTracker()
+	cfg := LogConfig{DedupWindow: 5 * time.Minute, RateLimit: 100, BacklogOnStart: true}
+	now := time.Now()
+
+	repeat := func(ids ...int) []LogEntry {
+		entries := logEntries(ids...)
+		for i := range entries {
+			entries[i].Message = "ether1 link down"
+		}
+		return entries
+	}
+
+	events := tr.process("r1", repeat(1, 2, 3), cfg, now)
+	if len(events) != 1 {
+		t.Fatalf("expected duplicates to be suppressed, got %d events", len(events))
+	}
+
+	events = tr.process("r1", repeat(4), cfg, now.Add(time.Minute))
+	if len(events) != 0 {
+		t.Fatalf("expected duplicate within window to be suppressed, got %+v", events)
+	}
+
+	events = tr.process("r1", nil, cfg, now.Add(6*time.Minute))
+	if len(events) != 1 || events[0].Attributes["repeated"] != "3" {
+		t.Fatalf("expected a repeat summary once the window passed, got %+v", events)
+	}
+
+	events = tr.process("r1", repeat(5), cfg, now.Add(7*time.Minute))
+	if len(events) != 1 || events[0].Attributes["repeated"] != "" {
+		t.Errorf("expected entry to be forwarded again after the window, got %+v", events)
+	}
+}
+
+func TestLogTracker_RateLimit(t *testing.T) {
+	tr := newLogTracker()
+	cfg := LogConfig{RateLimit: 10, BacklogOnStart: true}
+	now := time.Now()
+
+	ids := make([]int, 25)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+
+	events := tr.process("r1", logEntries(ids...), cfg, now)
+	if len(events) != 11 {
+		t.Fatalf("expected 10 entries and a drop summary, got %d events", len(events))
+	}
+	last := events[len(events)-1]
+	if last.Type != EventRouterLogDropped || last.Attributes["dropped"] != "15" {
+		t.Errorf("unexpected drop summary %+v", last)
+	}
+
+	// Half a minute refills half the budget
+	events = tr.process("r1", logEntries(26, 27, 28, 29, 30, 31, 32), cfg, now.Add(30*time.Second))
+	if len(events) != 6 {
+		t.Errorf("expected 5 entries and a drop summary, got %d events", len(events))
+	}
+}
+
+func TestLogTracker_Categories(t *testing.T) {
+	tr := newLogTracker()
+	cfg := LogConfig{Categories: []string{LogCategoryPPPoE}, BacklogOnStart: true}
+
+	entries := logEntries(1, 2)
+	entries[1].Category = LogCategoryPPPoE
+
+	events := tr.process("r1", entries, cfg, time.Now())
+	if len(events) != 1 || events[0].Attributes["category"] != LogCategoryPPPoE {
+		t.Errorf("expected only the pppoe entry, got %+v", events)
+	}
+}
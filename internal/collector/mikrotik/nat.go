@@ -2,53 +2,74 @@ package mikrotik
 
 import (
 	"context"
+	"hash/fnv"
+	"math"
 	"math/rand/v2"
+	"strings"
 
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/natlog"
 )
 
 // NATConnection represents a NAT connection entry.
 type NATConnection struct {
-	Protocol    string `json:"protocol"`
-	SrcAddress  string `json:"src_address"`
-	SrcPort     int64  `json:"src_port,omitempty"`
-	DstAddress  string `json:"dst_address"`
-	DstPort     int64  `json:"dst_port,omitempty"`
-	ReplyAddr   string `json:"reply_addr,omitempty"`
-	ReplyPort   int64  `json:"reply_port,omitempty"`
-	TCPState    string `json:"tcp_state,omitempty"`
-	Timeout     int64  `json:"timeout_seconds,omitempty"`
-	Assured     bool   `json:"assured,omitempty"`
-	Confirmed   bool   `json:"confirmed,omitempty"`
-	Dying       bool   `json:"dying,omitempty"`
-	FastTracked bool   `json:"fast_tracked,omitempty"`
-	GREKey      string `json:"gre_key,omitempty"`
-	GREVersion  string `json:"gre_version,omitempty"`
-	ICMPCode    int64  `json:"icmp_code,omitempty"`
-	ICMPType    int64  `json:"icmp_type,omitempty"`
-	ICMPId      int64  `json:"icmp_id,omitempty"`
-	RxBytes     int64  `json:"rx_bytes,omitempty"`
-	TxBytes     int64  `json:"tx_bytes,omitempty"`
-	RxPackets   int64  `json:"rx_packets,omitempty"`
-	TxPackets   int64  `json:"tx_packets,omitempty"`
+	Protocol     string `json:"protocol"`
+	SrcAddress   string `json:"src_address"`
+	SrcPort      int64  `json:"src_port,omitempty"`
+	DstAddress   string `json:"dst_address"`
+	DstPort      int64  `json:"dst_port,omitempty"`
+	ReplyAddr    string `json:"reply_addr,omitempty"`
+	ReplyPort    int64  `json:"reply_port,omitempty"`
+	ReplyDstAddr string `json:"reply_dst_addr,omitempty"` // Translated source for src-nat
+	ReplyDstPort int64  `json:"reply_dst_port,omitempty"`
+	TCPState     string `json:"tcp_state,omitempty"`
+	Timeout      int64  `json:"timeout_seconds,omitempty"`
+	Assured      bool   `json:"assured,omitempty"`
+	Confirmed    bool   `json:"confirmed,omitempty"`
+	Dying        bool   `json:"dying,omitempty"`
+	FastTracked  bool   `json:"fast_tracked,omitempty"`
+	GREKey       string `json:"gre_key,omitempty"`
+	GREVersion   string `json:"gre_version,omitempty"`
+	ICMPCode     int64  `json:"icmp_code,omitempty"`
+	ICMPType     int64  `json:"icmp_type,omitempty"`
+	ICMPId       int64  `json:"icmp_id,omitempty"`
+	RxBytes      int64  `json:"rx_bytes,omitempty"`
+	TxBytes      int64  `json:"tx_bytes,omitempty"`
+	RxPackets    int64  `json:"rx_packets,omitempty"`
+	TxPackets    int64  `json:"tx_packets,omitempty"`
 }
 
 // NATStats contains NAT statistics.
 type NATStats struct {
-	TotalConnections  int   `json:"total_connections"`
-	SampledCount      int   `json:"sampled_count,omitempty"`
-	TCPConnections    int   `json:"tcp_connections"`
-	UDPConnections    int   `json:"udp_connections"`
-	ICMPConnections   int   `json:"icmp_connections"`
-	OtherConnections  int   `json:"other_connections"`
-	MaxEntries        int64 `json:"max_entries,omitempty"`
-	TotalTCPEntries   int64 `json:"total_tcp_entries,omitempty"`
-	TotalUDPEntries   int64 `json:"total_udp_entries,omitempty"`
-	TotalICMPEntries  int64 `json:"total_icmp_entries,omitempty"`
+	TotalConnections int   `json:"total_connections"`
+	SampledCount     int   `json:"sampled_count,omitempty"`
+	Truncated        bool  `json:"truncated,omitempty"` // MaxConnections was reached
+	TCPConnections   int   `json:"tcp_connections"`
+	UDPConnections   int   `json:"udp_connections"`
+	ICMPConnections  int   `json:"icmp_connections"`
+	OtherConnections int   `json:"other_connections"`
+	MaxEntries       int64 `json:"max_entries,omitempty"`
+	TotalTCPEntries  int64 `json:"total_tcp_entries,omitempty"`
+	TotalUDPEntries  int64 `json:"total_udp_entries,omitempty"`
+	TotalICMPEntries int64 `json:"total_icmp_entries,omitempty"`
 }
 
+// natProplist limits the connection listing to the fields parseNATConnection
+// reads, which roughly halves the transfer size on busy routers.
+var natProplist = strings.Join([]string{
+	"protocol", "src-address", "dst-address", "reply-src-address", "reply-dst-address",
+	"tcp-state", "timeout", "assured", "confirmed", "dying", "fasttrack",
+	"gre-key", "gre-version", "icmp-code", "icmp-type", "icmp-id",
+	"orig-bytes", "repl-bytes", "orig-packets", "repl-packets",
+}, ",")
+
 // collectNAT collects NAT/connection tracking information from the router.
-func (c *Collector) collectNAT(ctx context.Context, client *api.Client) ([]NATConnection, *NATStats, error) {
+//
+// The connection table is streamed rather than loaded into memory: every
+// entry is counted, but only entries that pass sampling are parsed, and at
+// most MaxConnections of them are kept. When snap is non-nil every entry's
+// translation is recorded in it, and when agg is non-nil every entry is
+// aggregated, regardless of sampling.
+func (c *Collector) collectNAT(ctx context.Context, client Backend, snap *natlog.Snapshot, agg *natAggregator) ([]NATConnection, *NATStats, error) {
 	stats := &NATStats{}
 
 	// Get connection tracking stats first
@@ -60,37 +81,28 @@ func (c *Collector) collectNAT(ctx context.Context, client *api.Client) ([]NATCo
 		stats.TotalICMPEntries = ParseInt64(ctStats["total-icmp-entries"])
 	}
 
-	// Get active connections
-	connections, err := client.Run(ctx, "/ip/firewall/connection/print", nil)
-	if err != nil {
-		return nil, stats, err
-	}
-
-	stats.TotalConnections = len(connections)
-
-	var result []NATConnection
 	maxConns := c.config.NAT.MaxConnections
 	if maxConns <= 0 {
 		maxConns = 10000
 	}
+	sampler := newNATSampler(c.config.NAT)
 
-	for idx, conn := range connections {
-		// Apply sampling if enabled
-		if c.config.NAT.SamplingEnabled && c.config.NAT.SampleRate < 1.0 {
-			if rand.Float64() > c.config.NAT.SampleRate {
-				continue
-			}
-		}
+	var result []NATConnection
 
-		// Apply max connections limit
-		if len(result) >= maxConns {
-			break
-		}
+	err = client.RunStream(ctx, "/ip/firewall/connection/print", map[string]string{
+		".proplist": natProplist,
+	}, func(conn map[string]string) error {
+		stats.TotalConnections++
 
-		natConn := parseNATConnection(conn)
+		if snap != nil {
+			recordTranslation(snap, conn)
+		}
+		if agg != nil {
+			agg.add(conn)
+		}
 
 		// Count by protocol
-		switch natConn.Protocol {
+		switch conn["protocol"] {
 		case "tcp":
 			stats.TCPConnections++
 		case "udp":
@@ -101,12 +113,21 @@ func (c *Collector) collectNAT(ctx context.Context, client *api.Client) ([]NATCo
 			stats.OtherConnections++
 		}
 
-		result = append(result, natConn)
+		if !sampler.keep(conn) {
+			return nil
+		}
 
-		// Safety check for very large connection tables
-		if idx > 100000 {
-			break
+		// Apply max connections limit; keep reading so totals stay accurate
+		if len(result) >= maxConns {
+			stats.Truncated = true
+			return nil
 		}
+
+		result = append(result, parseNATConnection(conn))
+		return nil
+	})
+	if err != nil {
+		return nil, stats, err
 	}
 
 	stats.SampledCount = len(result)
@@ -114,6 +135,96 @@ func (c *Collector) collectNAT(ctx context.Context, client *api.Client) ([]NATCo
 	return result, stats, nil
 }
 
+// recordTranslation adds the translations implied by a connection entry:
+// src-nat rewrites the source, which shows up as the reply destination, and
+// dst-nat rewrites the destination, which shows up as the reply source.
+func recordTranslation(snap *natlog.Snapshot, conn map[string]string) {
+	protocol := conn["protocol"]
+	snap.AddConnection(protocol, conn["src-address"], conn["reply-dst-address"])
+	snap.AddConnection(protocol, conn["reply-src-address"], conn["dst-address"])
+}
+
+// collectPortBlocks records static port-block allocations from src-nat and
+// netmap rules that map a single private host to a public address and port
+// range, as used by deterministic CGNAT setups.
+func (c *Collector) collectPortBlocks(ctx context.Context, client Backend, snap *natlog.Snapshot) error {
+	rules, err := client.Run(ctx, "/ip/firewall/nat/print", map[string]string{
+		".proplist": "chain,action,src-address,to-addresses,to-ports,disabled",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule["disabled"] == "true" || rule["chain"] != "srcnat" {
+			continue
+		}
+		if action := rule["action"]; action != "src-nat" && action != "netmap" {
+			continue
+		}
+
+		start, end, ok := natlog.ParsePortRange(rule["to-ports"])
+		if !ok {
+			continue
+		}
+
+		// Subnets and address ranges are skipped by AddPortBlock
+		private := strings.TrimSuffix(rule["src-address"], "/32")
+		public := strings.TrimSuffix(rule["to-addresses"], "/32")
+		snap.AddPortBlock(private, public, start, end)
+	}
+
+	return nil
+}
+
+// natSampler decides which connections are kept when sampling is enabled.
+type natSampler struct {
+	enabled   bool
+	random    bool
+	rate      float64
+	threshold uint64
+}
+
+func newNATSampler(cfg NATConfig) *natSampler {
+	s := &natSampler{
+		enabled: cfg.SamplingEnabled && cfg.SampleRate < 1.0,
+		random:  cfg.SampleMode == NATSampleRandom,
+		rate:    cfg.SampleRate,
+	}
+	if s.rate > 0 {
+		s.threshold = uint64(s.rate * float64(math.MaxUint64))
+	}
+	return s
+}
+
+// keep reports whether a raw connection entry should be sampled.
+//
+// In hash mode the decision is a pure function of the connection's 5-tuple,
+// so a flow that is sampled once stays sampled for as long as it exists.
+func (s *natSampler) keep(conn map[string]string) bool {
+	if !s.enabled {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	if s.random {
+		return rand.Float64() < s.rate
+	}
+	return natTupleHash(conn) < s.threshold
+}
+
+// natTupleHash hashes protocol, source and destination address:port.
+func natTupleHash(conn map[string]string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(conn["protocol"]))
+	h.Write([]byte{0})
+	h.Write([]byte(conn["src-address"]))
+	h.Write([]byte{0})
+	h.Write([]byte(conn["dst-address"]))
+	return h.Sum64()
+}
+
 func parseNATConnection(conn map[string]string) NATConnection {
 	natConn := NATConnection{
 		Protocol:    conn["protocol"],
@@ -134,6 +245,7 @@ func parseNATConnection(conn map[string]string) NATConnection {
 	natConn.SrcAddress, natConn.SrcPort = parseAddressPort(conn["src-address"])
 	natConn.DstAddress, natConn.DstPort = parseAddressPort(conn["dst-address"])
 	natConn.ReplyAddr, natConn.ReplyPort = parseAddressPort(conn["reply-src-address"])
+	natConn.ReplyDstAddr, natConn.ReplyDstPort = parseAddressPort(conn["reply-dst-address"])
 
 	// ICMP specific
 	natConn.ICMPCode = ParseInt64(conn["icmp-code"])
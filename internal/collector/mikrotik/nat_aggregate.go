@@ -0,0 +1,259 @@
+package mikrotik
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NATTalker is an aggregated traffic bucket, such as one source address.
+type NATTalker struct {
+	Key         string `json:"key"`
+	Connections int    `json:"connections"`
+	Bytes       int64  `json:"bytes"` // Bytes transferred during the interval
+}
+
+// NATTopList holds the largest buckets of one dimension, ranked both ways.
+type NATTopList struct {
+	ByBytes       []NATTalker `json:"by_bytes"`
+	ByConnections []NATTalker `json:"by_connections"`
+}
+
+// NATAggregates summarizes the whole connection table for one interval.
+type NATAggregates struct {
+	IntervalSeconds  float64     `json:"interval_seconds,omitempty"` // 0 on the first poll
+	Sources          NATTopList  `json:"top_sources"`
+	DestinationASNs  *NATTopList `json:"top_destination_asns,omitempty"` // Only with an ASN file
+	DestinationPorts NATTopList  `json:"top_destination_ports"`
+	Protocols        []NATTalker `json:"protocols"`
+}
+
+// natOtherKey collects buckets beyond the aggregation key limit.
+const natOtherKey = "other"
+
+// natAggregator rolls streamed connections up into per-interval buckets.
+//
+// Connection byte counters cover the connection's whole lifetime, so the
+// counters seen in the previous poll are subtracted to get interval bytes.
+type natAggregator struct {
+	topN    int
+	maxKeys int
+	asns    *asnTable
+
+	prevFlows map[uint64]int64
+	flows     map[uint64]int64
+
+	sources   map[string]*NATTalker
+	destASNs  map[string]*NATTalker
+	destPorts map[string]*NATTalker
+	protocols map[string]*NATTalker
+}
+
+func newNATAggregator(cfg NATAggregationConfig, asns *asnTable, prevFlows map[uint64]int64) *natAggregator {
+	a := &natAggregator{
+		topN:      cfg.TopN,
+		maxKeys:   cfg.MaxKeys,
+		asns:      asns,
+		prevFlows: prevFlows,
+		flows:     make(map[uint64]int64, len(prevFlows)),
+		sources:   make(map[string]*NATTalker),
+		destPorts: make(map[string]*NATTalker),
+		protocols: make(map[string]*NATTalker),
+	}
+	if a.topN <= 0 {
+		a.topN = 10
+	}
+	if a.maxKeys <= 0 {
+		a.maxKeys = 100000
+	}
+	if asns != nil {
+		a.destASNs = make(map[string]*NATTalker)
+	}
+	return a
+}
+
+// add accounts a raw connection entry.
+func (a *natAggregator) add(conn map[string]string) {
+	protocol := conn["protocol"]
+	if protocol == "" {
+		protocol = "unknown"
+	}
+
+	total := ParseInt64(conn["orig-bytes"]) + ParseInt64(conn["repl-bytes"])
+	flow := natTupleHash(conn)
+	a.flows[flow] = total
+
+	bytes := total
+	if prev, ok := a.prevFlows[flow]; ok && prev <= total {
+		bytes = total - prev
+	}
+
+	srcAddr, _ := parseAddressPort(conn["src-address"])
+	dstAddr, dstPort := parseAddressPort(conn["dst-address"])
+
+	a.bump(a.protocols, protocol, bytes)
+	if srcAddr != "" {
+		a.bump(a.sources, srcAddr, bytes)
+	}
+
+	portKey := protocol
+	if dstPort > 0 {
+		portKey = protocol + "/" + strconv.FormatInt(dstPort, 10)
+	}
+	a.bump(a.destPorts, portKey, bytes)
+
+	if a.destASNs != nil {
+		asnKey := "unknown"
+		if addr, err := netip.ParseAddr(dstAddr); err == nil {
+			if asn := a.asns.lookup(addr); asn != 0 {
+				asnKey = strconv.FormatUint(uint64(asn), 10)
+			}
+		}
+		a.bump(a.destASNs, asnKey, bytes)
+	}
+}
+
+// bump adds a connection to the bucket for key, folding new keys into
+// natOtherKey once maxKeys buckets exist so memory stays bounded.
+func (a *natAggregator) bump(buckets map[string]*NATTalker, key string, bytes int64) {
+	t, ok := buckets[key]
+	if !ok {
+		if len(buckets) >= a.maxKeys {
+			key = natOtherKey
+			t, ok = buckets[key]
+		}
+		if !ok {
+			t = &NATTalker{Key: key}
+			buckets[key] = t
+		}
+	}
+	t.Connections++
+	t.Bytes += bytes
+}
+
+// result returns the aggregates for the interval.
+func (a *natAggregator) result(interval time.Duration) *NATAggregates {
+	agg := &NATAggregates{
+		IntervalSeconds:  interval.Seconds(),
+		Sources:          topTalkers(a.sources, a.topN),
+		DestinationPorts: topTalkers(a.destPorts, a.topN),
+		Protocols:        topTalkers(a.protocols, len(a.protocols)).ByBytes,
+	}
+	if a.destASNs != nil {
+		asns := topTalkers(a.destASNs, a.topN)
+		agg.DestinationASNs = &asns
+	}
+	return agg
+}
+
+func topTalkers(buckets map[string]*NATTalker, n int) NATTopList {
+	all := make([]NATTalker, 0, len(buckets))
+	for _, t := range buckets {
+		all = append(all, *t)
+	}
+
+	byBytes := make([]NATTalker, len(all))
+	copy(byBytes, all)
+	sort.Slice(byBytes, func(i, j int) bool {
+		if byBytes[i].Bytes != byBytes[j].Bytes {
+			return byBytes[i].Bytes > byBytes[j].Bytes
+		}
+		return byBytes[i].Key < byBytes[j].Key
+	})
+
+	byConns := all
+	sort.Slice(byConns, func(i, j int) bool {
+		if byConns[i].Connections != byConns[j].Connections {
+			return byConns[i].Connections > byConns[j].Connections
+		}
+		return byConns[i].Key < byConns[j].Key
+	})
+
+	if len(byBytes) > n {
+		byBytes = byBytes[:n]
+		byConns = byConns[:n]
+	}
+
+	return NATTopList{ByBytes: byBytes, ByConnections: byConns}
+}
+
+// All returns the buckets of the list, each once, those ranked by bytes
+// first.
+func (l *NATTopList) All() []NATTalker {
+	all := make([]NATTalker, 0, len(l.ByBytes))
+	seen := make(map[string]bool, len(l.ByBytes))
+	for _, list := range [][]NATTalker{l.ByBytes, l.ByConnections} {
+		for _, t := range list {
+			if !seen[t.Key] {
+				seen[t.Key] = true
+				all = append(all, t)
+			}
+		}
+	}
+	return all
+}
+
+// Metrics flattens the aggregates into named values suitable for
+// MetricsData.CustomMetrics, e.g. `nat_top_destination_port_bytes{port="tcp/443"}`.
+// Top sources are subscriber addresses, so they are left out; they are
+// reported with the sessions, where they are redacted.
+func (a *NATAggregates) Metrics() map[string]float64 {
+	m := make(map[string]float64)
+
+	for _, t := range a.Protocols {
+		m[fmt.Sprintf("nat_protocol_connections{protocol=%q}", t.Key)] = float64(t.Connections)
+		m[fmt.Sprintf("nat_protocol_bytes{protocol=%q}", t.Key)] = float64(t.Bytes)
+	}
+
+	addTop := func(name, label string, top *NATTopList) {
+		for _, t := range top.ByBytes {
+			m[fmt.Sprintf("nat_top_%s_bytes{%s=%q}", name, label, t.Key)] = float64(t.Bytes)
+		}
+		for _, t := range top.ByConnections {
+			m[fmt.Sprintf("nat_top_%s_connections{%s=%q}", name, label, t.Key)] = float64(t.Connections)
+		}
+	}
+	addTop("destination_port", "port", &a.DestinationPorts)
+	if a.DestinationASNs != nil {
+		addTop("destination_asn", "asn", a.DestinationASNs)
+	}
+
+	return m
+}
+
+// natFlowTracker remembers each router's flow byte counters between polls.
+type natFlowTracker struct {
+	mu      sync.Mutex
+	routers map[string]*natFlowState
+}
+
+type natFlowState struct {
+	flows map[uint64]int64
+	at    time.Time
+}
+
+func newNATFlowTracker() *natFlowTracker {
+	return &natFlowTracker{
+		routers: make(map[string]*natFlowState),
+	}
+}
+
+// previous returns the flows and time of routerID's last successful poll.
+func (t *natFlowTracker) previous(routerID string) (map[uint64]int64, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if st, ok := t.routers[routerID]; ok {
+		return st.flows, st.at
+	}
+	return nil, time.Time{}
+}
+
+func (t *natFlowTracker) store(routerID string, flows map[uint64]int64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routers[routerID] = &natFlowState{flows: flows, at: at}
+}
@@ -0,0 +1,227 @@
+package mikrotik
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func aggConn(protocol, src, dst string, origBytes, replBytes string) map[string]string {
+	return map[string]string{
+		"protocol":    protocol,
+		"src-address": src,
+		"dst-address": dst,
+		"orig-bytes":  origBytes,
+		"repl-bytes":  replBytes,
+	}
+}
+
+func TestNATAggregator_TopTalkers(t *testing.T) {
+	agg := newNATAggregator(NATAggregationConfig{TopN: 2}, nil, nil)
+
+	agg.add(aggConn("tcp", "100.64.0.1:1000", "93.184.216.34:443", "1000", "9000"))
+	agg.add(aggConn("tcp", "100.64.0.1:1001", "93.184.216.34:443", "100", "100"))
+	agg.add(aggConn("udp", "100.64.0.2:5000", "8.8.8.8:53", "50", "50"))
+	agg.add(aggConn("udp", "100.64.0.3:5000", "8.8.8.8:53", "50", "50"))
+	agg.add(aggConn("udp", "100.64.0.3:5001", "8.8.4.4:53", "50", "50"))
+	agg.add(aggConn("icmp", "100.64.0.4", "1.1.1.1", "10", "10"))
+
+	res := agg.result(0)
+
+	if len(res.Sources.ByBytes) != 2 {
+		t.Fatalf("expected top 2 sources, got %d", len(res.Sources.ByBytes))
+	}
+	if res.Sources.ByBytes[0].Key != "100.64.0.1" || res.Sources.ByBytes[0].Bytes != 10200 {
+		t.Errorf("unexpected top source by bytes %+v", res.Sources.ByBytes[0])
+	}
+	// 100.64.0.1 and 100.64.0.3 both have 2 connections; ties sort by key
+	if res.Sources.ByConnections[0].Key != "100.64.0.1" || res.Sources.ByConnections[1].Key != "100.64.0.3" {
+		t.Errorf("unexpected top sources by connections %+v", res.Sources.ByConnections)
+	}
+
+	if res.DestinationPorts.ByConnections[0].Key != "udp/53" || res.DestinationPorts.ByConnections[0].Connections != 3 {
+		t.Errorf("unexpected top port %+v", res.DestinationPorts.ByConnections[0])
+	}
+
+	if len(res.Protocols) != 3 {
+		t.Fatalf("expected every protocol to be reported, got %+v", res.Protocols)
+	}
+	if res.Protocols[0].Key != "tcp" {
+		t.Errorf("expected tcp to lead the protocol breakdown, got %s", res.Protocols[0].Key)
+	}
+
+	if res.DestinationASNs != nil {
+		t.Error("destination ASNs should be omitted without an ASN table")
+	}
+}
+
+func TestNATAggregator_IntervalBytes(t *testing.T) {
+	first := newNATAggregator(NATAggregationConfig{}, nil, nil)
+	first.add(aggConn("tcp", "100.64.0.1:1000", "1.1.1.1:443", "1000", "1000"))
+	first.add(aggConn("tcp", "100.64.0.2:1000", "1.1.1.1:443", "500", "500"))
+
+	second := newNATAggregator(NATAggregationConfig{}, nil, first.flows)
+	// Same flow, counters grew by 1500
+	second.add(aggConn("tcp", "100.64.0.1:1000", "1.1.1.1:443", "2000", "1500"))
+	// New flow on the same tuple after the old one ended: counters reset
+	second.add(aggConn("tcp", "100.64.0.2:1000", "1.1.1.1:443", "10", "10"))
+
+	res := second.result(time.Minute)
+
+	got := map[string]int64{}
+	for _, s := range res.Sources.ByBytes {
+		got[s.Key] = s.Bytes
+	}
+	if got["100.64.0.1"] != 1500 {
+		t.Errorf("expected 1500 interval bytes, got %d", got["100.64.0.1"])
+	}
+	if got["100.64.0.2"] != 20 {
+		t.Errorf("expected reset flow to count fully, got %d", got["100.64.0.2"])
+	}
+	if res.IntervalSeconds != 60 {
+		t.Errorf("expected 60s interval, got %v", res.IntervalSeconds)
+	}
+}
+
+func TestNATAggregator_MaxKeys(t *testing.T) {
+	agg := newNATAggregator(NATAggregationConfig{TopN: 10, MaxKeys: 2}, nil, nil)
+
+	agg.add(aggConn("tcp", "100.64.0.1:1", "1.1.1.1:443", "1", "0"))
+	agg.add(aggConn("tcp", "100.64.0.2:1", "1.1.1.1:443", "1", "0"))
+	agg.add(aggConn("tcp", "100.64.0.3:1", "1.1.1.1:443", "1", "0"))
+	agg.add(aggConn("tcp", "100.64.0.4:1", "1.1.1.1:443", "1", "0"))
+
+	if len(agg.sources) != 3 {
+		t.Fatalf("expected 2 sources plus %q, got %d buckets", natOtherKey, len(agg.sources))
+	}
+	if agg.sources[natOtherKey].Connections != 2 {
+		t.Errorf("expected overflow to fold into %q, got %+v", natOtherKey, agg.sources[natOtherKey])
+	}
+}
+
+func TestNATAggregator_DestinationASNs(t *testing.T) {
+	asns := &asnTable{byLen: make(map[int]map[netip.Prefix]uint32)}
+	asns.add(netip.MustParsePrefix("8.8.8.0/24"), 15169)
+
+	agg := newNATAggregator(NATAggregationConfig{}, asns, nil)
+	agg.add(aggConn("udp", "100.64.0.1:5000", "8.8.8.8:53", "10", "10"))
+	agg.add(aggConn("udp", "100.64.0.1:5001", "9.9.9.9:53", "10", "10"))
+
+	res := agg.result(0)
+	if res.DestinationASNs == nil {
+		t.Fatal("expected destination ASNs with an ASN table")
+	}
+
+	keys := map[string]bool{}
+	for _, t := range res.DestinationASNs.ByBytes {
+		keys[t.Key] = true
+	}
+	if !keys["15169"] || !keys["unknown"] {
+		t.Errorf("expected 15169 and unknown buckets, got %+v", res.DestinationASNs.ByBytes)
+	}
+}
+
+func TestNATAggregates_Metrics(t *testing.T) {
+	agg := newNATAggregator(NATAggregationConfig{}, nil, nil)
+	agg.add(aggConn("tcp", "100.64.0.1:1000", "1.1.1.1:443", "100", "200"))
+
+	m := agg.result(0).Metrics()
+
+	tests := map[string]float64{
+		`nat_protocol_connections{protocol="tcp"}`:       1,
+		`nat_protocol_bytes{protocol="tcp"}`:             300,
+		`nat_top_destination_port_bytes{port="tcp/443"}`: 300,
+	}
+	for name, want := range tests {
+		if got, ok := m[name]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", name, got, ok, want)
+		}
+	}
+	for name := range m {
+		if strings.Contains(name, "100.64.0.1") {
+			t.Errorf("subscriber address in metric %s", name)
+		}
+	}
+}
+
+func TestNATFlowTracker(t *testing.T) {
+	tr := newNATFlowTracker()
+
+	if flows, at := tr.previous("r1"); flows != nil || !at.IsZero() {
+		t.Error("expected no state before the first poll")
+	}
+
+	now := time.Now()
+	tr.store("r1", map[uint64]int64{1: 100}, now)
+
+	flows, at := tr.previous("r1")
+	if flows[1] != 100 || !at.Equal(now) {
+		t.Errorf("unexpected state %v at %v", flows, at)
+	}
+	if flows, _ := tr.previous("r2"); flows != nil {
+		t.Error("state must be kept per router")
+	}
+}
+
+func TestASNTable_Lookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	data := `# prefix asn
+8.0.0.0/8 3356
+8.8.8.0/24 AS15169
+2001:4860::/32 15169
+::/0 65000
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := loadASNTable(path)
+	if err != nil {
+		t.Fatalf("loadASNTable() error = %v", err)
+	}
+
+	tests := []struct {
+		addr string
+		want uint32
+	}{
+		{"8.8.8.8", 15169},
+		{"8.8.4.4", 3356},
+		{"9.9.9.9", 0},
+		{"::ffff:8.8.8.8", 15169},
+		{"2001:4860:4860::8888", 15169},
+		{"2a00::1", 65000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := table.lookup(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("lookup(%s) = %d, want %d", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadASNTable_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing asn": "8.8.8.0/24\n",
+		"bad prefix":  "8.8.8.0/33 15169\n",
+		"bad asn":     "8.8.8.0/24 google\n",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "asn.txt")
+			os.WriteFile(path, []byte(data), 0644)
+			if _, err := loadASNTable(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	if _, err := loadASNTable(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
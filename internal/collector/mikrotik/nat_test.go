@@ -0,0 +1,145 @@
+package mikrotik
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/natlog"
+)
+
+func TestNATSampler_Disabled(t *testing.T) {
+	s := newNATSampler(NATConfig{SamplingEnabled: false, SampleRate: 0.1})
+
+	for i := 0; i < 100; i++ {
+		if !s.keep(natRow(i)) {
+			t.Fatal("sampler should keep everything when sampling is disabled")
+		}
+	}
+}
+
+func TestNATSampler_HashIsDeterministic(t *testing.T) {
+	cfg := NATConfig{SamplingEnabled: true, SampleRate: 0.25, SampleMode: NATSampleHash}
+	first := newNATSampler(cfg)
+	second := newNATSampler(cfg)
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		row := natRow(i)
+		if first.keep(row) != second.keep(row) {
+			t.Fatalf("sampling decision differs between polls for %v", row)
+		}
+		if first.keep(row) {
+			kept++
+		}
+	}
+
+	// Roughly a quarter of the flows should be sampled
+	if kept < 2000 || kept > 3000 {
+		t.Errorf("expected ~2500 sampled flows, got %d", kept)
+	}
+}
+
+func TestNATSampler_DefaultModeIsHash(t *testing.T) {
+	s := newNATSampler(NATConfig{SamplingEnabled: true, SampleRate: 0.5})
+	if s.random {
+		t.Error("expected hash sampling when no mode is configured")
+	}
+}
+
+func TestNATSampler_ZeroRate(t *testing.T) {
+	s := newNATSampler(NATConfig{SamplingEnabled: true, SampleRate: 0})
+	if s.keep(natRow(1)) {
+		t.Error("sample rate 0 should drop every connection")
+	}
+}
+
+func TestNATTupleHash(t *testing.T) {
+	a := map[string]string{"protocol": "tcp", "src-address": "10.0.0.1:1000", "dst-address": "1.1.1.1:443"}
+	b := map[string]string{"protocol": "tcp", "src-address": "10.0.0.1:1001", "dst-address": "1.1.1.1:443"}
+
+	if natTupleHash(a) != natTupleHash(a) {
+		t.Error("hash should be stable")
+	}
+	if natTupleHash(a) == natTupleHash(b) {
+		t.Error("different source ports should hash differently")
+	}
+}
+
+func TestParseNATConnection(t *testing.T) {
+	conn := parseNATConnection(map[string]string{
+		"protocol":          "tcp",
+		"src-address":       "100.64.0.10:51234",
+		"dst-address":       "93.184.216.34:443",
+		"reply-src-address": "93.184.216.34:443",
+		"tcp-state":         "established",
+		"timeout":           "23h59m",
+		"assured":           "true",
+		"orig-bytes":        "1200",
+		"repl-bytes":        "64000",
+	})
+
+	if conn.SrcAddress != "100.64.0.10" || conn.SrcPort != 51234 {
+		t.Errorf("unexpected source %s:%d", conn.SrcAddress, conn.SrcPort)
+	}
+	if conn.DstPort != 443 {
+		t.Errorf("expected destination port 443, got %d", conn.DstPort)
+	}
+	if conn.Timeout != 86340 {
+		t.Errorf("expected timeout 86340s, got %d", conn.Timeout)
+	}
+	if !conn.Assured {
+		t.Error("expected assured connection")
+	}
+	if conn.TxBytes != 1200 || conn.RxBytes != 64000 {
+		t.Errorf("unexpected byte counters tx=%d rx=%d", conn.TxBytes, conn.RxBytes)
+	}
+}
+
+func natRow(i int) map[string]string {
+	return map[string]string{
+		"protocol":    "tcp",
+		"src-address": fmt.Sprintf("100.64.%d.%d:%d", i/250%250, i%250, 1024+i%60000),
+		"dst-address": "93.184.216.34:443",
+	}
+}
+
+func TestRecordTranslation(t *testing.T) {
+	natLog, err := natlog.Open(natlog.Options{Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer natLog.Close()
+
+	now := time.Now()
+	snap := natLog.Begin("r1", now)
+
+	// Subscriber behind src-nat
+	recordTranslation(snap, map[string]string{
+		"protocol":          "tcp",
+		"src-address":       "100.64.0.10:51000",
+		"dst-address":       "93.184.216.34:443",
+		"reply-src-address": "93.184.216.34:443",
+		"reply-dst-address": "203.0.113.5:40123",
+	})
+	// Port forward to an internal server
+	recordTranslation(snap, map[string]string{
+		"protocol":          "tcp",
+		"src-address":       "198.51.100.7:60000",
+		"dst-address":       "203.0.113.5:8080",
+		"reply-src-address": "192.168.1.20:80",
+		"reply-dst-address": "198.51.100.7:60000",
+	})
+	snap.Commit()
+
+	matches, _ := natLog.Lookup(netip.MustParseAddr("203.0.113.5"), 40123, "tcp", now)
+	if len(matches) != 1 || matches[0].PrivateAddr != "100.64.0.10" {
+		t.Errorf("expected src-nat mapping to 100.64.0.10, got %+v", matches)
+	}
+
+	matches, _ = natLog.Lookup(netip.MustParseAddr("203.0.113.5"), 8080, "tcp", now)
+	if len(matches) != 1 || matches[0].PrivateAddr != "192.168.1.20" {
+		t.Errorf("expected dst-nat mapping to 192.168.1.20, got %+v", matches)
+	}
+}
@@ -0,0 +1,379 @@
+package mikrotik
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// Layer-2 event types.
+const (
+	EventMACMove    = "mac_move"
+	EventNewDevice  = "new_device"
+	EventIPConflict = "ip_conflict"
+)
+
+// l2ForgetAfter is how long a MAC address that is no longer in the bridge
+// host table is remembered, so a device that briefly ages out is not
+// reported as new when it comes back.
+const l2ForgetAfter = 24 * time.Hour
+
+// ARPEntry represents an /ip/arp entry.
+type ARPEntry struct {
+	Address    string `json:"address"`
+	MACAddress string `json:"mac_address,omitempty"`
+	Interface  string `json:"interface"`
+	Status     string `json:"status,omitempty"` // reachable, stale, failed, permanent, ...
+	Dynamic    bool   `json:"dynamic,omitempty"`
+	Complete   bool   `json:"complete,omitempty"`
+	Invalid    bool   `json:"invalid,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty"`
+}
+
+// IPv6Neighbor represents an /ipv6/neighbor entry.
+type IPv6Neighbor struct {
+	Address    string `json:"address"`
+	MACAddress string `json:"mac_address,omitempty"`
+	Interface  string `json:"interface"`
+	Status     string `json:"status,omitempty"`
+	Router     bool   `json:"router,omitempty"`
+}
+
+// BridgeHost represents an /interface/bridge/host entry.
+type BridgeHost struct {
+	MACAddress  string `json:"mac_address"`
+	Bridge      string `json:"bridge"`
+	OnInterface string `json:"on_interface"`
+	VLANID      int64  `json:"vlan_id,omitempty"`
+	Local       bool   `json:"local,omitempty"`
+	External    bool   `json:"external,omitempty"`
+	Dynamic     bool   `json:"dynamic,omitempty"`
+	Age         int64  `json:"age_seconds,omitempty"`
+}
+
+// DiscoveredNeighbor represents an /ip/neighbor entry learned via MNDP,
+// CDP or LLDP.
+type DiscoveredNeighbor struct {
+	Interface       string `json:"interface"`
+	Address         string `json:"address,omitempty"`
+	IPv6Address     string `json:"ipv6_address,omitempty"`
+	MACAddress      string `json:"mac_address,omitempty"`
+	Identity        string `json:"identity,omitempty"`
+	Platform        string `json:"platform,omitempty"`
+	Version         string `json:"version,omitempty"`
+	Board           string `json:"board,omitempty"`
+	RemoteInterface string `json:"remote_interface,omitempty"`
+	DiscoveredBy    string `json:"discovered_by,omitempty"` // Comma-separated: mndp, cdp, lldp
+	Uptime          int64  `json:"uptime_seconds,omitempty"`
+}
+
+// NeighborTables contains the layer-2 tables of a router.
+type NeighborTables struct {
+	ARP           []ARPEntry           `json:"arp,omitempty"`
+	IPv6Neighbors []IPv6Neighbor       `json:"ipv6_neighbors,omitempty"`
+	BridgeHosts   []BridgeHost         `json:"bridge_hosts,omitempty"`
+	Discovered    []DiscoveredNeighbor `json:"discovered,omitempty"`
+}
+
+// collectNeighbors collects ARP, IPv6 neighbor, bridge host and neighbor
+// discovery tables. Only the ARP table is required; the others depend on
+// installed packages and configuration and are skipped when the router does
+// not know them. Any other error fails the collection, so that the change
+// detection does not take an unread table for an empty one.
+func (c *Collector) collectNeighbors(ctx context.Context, client Backend) (*NeighborTables, error) {
+	arp, err := client.Run(ctx, "/ip/arp/print", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := &NeighborTables{}
+	for _, a := range arp {
+		tables.ARP = append(tables.ARP, parseARPEntry(a))
+	}
+
+	// IPv6 package might be disabled
+	ipv6, err := runOptional(ctx, client, "/ipv6/neighbor/print")
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range ipv6 {
+		tables.IPv6Neighbors = append(tables.IPv6Neighbors, IPv6Neighbor{
+			Address:    n["address"],
+			MACAddress: strings.ToUpper(n["mac-address"]),
+			Interface:  n["interface"],
+			Status:     n["status"],
+			Router:     n["router"] == "true",
+		})
+	}
+
+	// No bridges might be configured
+	hosts, err := runOptional(ctx, client, "/interface/bridge/host/print")
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hosts {
+		tables.BridgeHosts = append(tables.BridgeHosts, BridgeHost{
+			MACAddress:  strings.ToUpper(h["mac-address"]),
+			Bridge:      h["bridge"],
+			OnInterface: h["on-interface"],
+			VLANID:      ParseInt64(h["vid"]),
+			Local:       h["local"] == "true",
+			External:    h["external"] == "true",
+			Dynamic:     h["dynamic"] == "true",
+			Age:         ParseUptime(h["age"]),
+		})
+	}
+
+	// Neighbor discovery might be disabled
+	neighbors, err := runOptional(ctx, client, "/ip/neighbor/print")
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range neighbors {
+		tables.Discovered = append(tables.Discovered, DiscoveredNeighbor{
+			Interface:       n["interface"],
+			Address:         n["address4"],
+			IPv6Address:     n["address6"],
+			MACAddress:      strings.ToUpper(n["mac-address"]),
+			Identity:        n["identity"],
+			Platform:        n["platform"],
+			Version:         n["version"],
+			Board:           n["board"],
+			RemoteInterface: n["interface-name"],
+			DiscoveredBy:    n["discovered-by"],
+			Uptime:          ParseUptime(n["uptime"]),
+		})
+	}
+
+	return tables, nil
+}
+
+func parseARPEntry(a map[string]string) ARPEntry {
+	return ARPEntry{
+		Address:    a["address"],
+		MACAddress: strings.ToUpper(a["mac-address"]),
+		Interface:  a["interface"],
+		Status:     a["status"],
+		Dynamic:    a["dynamic"] == "true",
+		Complete:   a["complete"] == "true",
+		Invalid:    a["invalid"] == "true",
+		Disabled:   a["disabled"] == "true",
+	}
+}
+
+// l2Tracker detects layer-2 changes between polls of each router.
+type l2Tracker struct {
+	mu      sync.Mutex
+	routers map[string]*l2State
+}
+
+type l2State struct {
+	hosts    map[string]*l2Host    // bridge + MAC -> last known port
+	bindings map[string]*ipBinding // interface + IP -> MAC addresses seen
+}
+
+type l2Host struct {
+	port     string
+	lastSeen time.Time
+}
+
+type ipBinding struct {
+	mac           string               // MAC address of the last poll
+	macs          map[string]time.Time // MAC addresses seen within l2ConflictWindow
+	lastSeen      time.Time
+	conflictSince time.Time // Zero when not in conflict
+	lastConflict  time.Time
+}
+
+// l2ConflictWindow is how long an address must resolve to a single MAC
+// before a conflict is considered over. It also bounds how far apart two
+// MAC addresses may be seen for an address that flaps between them.
+const l2ConflictWindow = 10 * time.Minute
+
+func newL2Tracker() *l2Tracker {
+	return &l2Tracker{
+		routers: make(map[string]*l2State),
+	}
+}
+
+// update compares tables with the previous polls of routerID and returns
+// the detected changes. The first poll of a router only establishes a
+// baseline for MAC moves and new devices.
+func (t *l2Tracker) update(routerID string, tables *NeighborTables, now time.Time) []models.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, known := t.routers[routerID]
+	if !known {
+		state = &l2State{
+			hosts:    make(map[string]*l2Host),
+			bindings: make(map[string]*ipBinding),
+		}
+		t.routers[routerID] = state
+	}
+
+	var events []models.Event
+
+	for _, h := range tables.BridgeHosts {
+		if h.Local || h.MACAddress == "" || h.OnInterface == "" {
+			continue
+		}
+
+		// A MAC address is learned per VLAN, so a device using one MAC on
+		// several VLANs, such as a CPE or a VRRP router, is one host on each
+		key := h.Bridge + "|" + strconv.FormatInt(h.VLANID, 10) + "|" + h.MACAddress
+		prev, seen := state.hosts[key]
+		n := len(events)
+		switch {
+		case !seen && known:
+			events = append(events, models.Event{
+				Type:      EventNewDevice,
+				Severity:  models.SeverityInfo,
+				Message:   fmt.Sprintf("New device %s on %s (%s)", h.MACAddress, h.OnInterface, h.Bridge),
+				Timestamp: now,
+				Attributes: map[string]string{
+					"mac_address": h.MACAddress,
+					"bridge":      h.Bridge,
+					"interface":   h.OnInterface,
+				},
+			})
+		case seen && prev.port != h.OnInterface:
+			events = append(events, models.Event{
+				Type:      EventMACMove,
+				Severity:  models.SeverityWarning,
+				Message:   fmt.Sprintf("MAC %s moved from %s to %s (%s)", h.MACAddress, prev.port, h.OnInterface, h.Bridge),
+				Timestamp: now,
+				Attributes: map[string]string{
+					"mac_address":    h.MACAddress,
+					"bridge":         h.Bridge,
+					"from_interface": prev.port,
+					"interface":      h.OnInterface,
+				},
+			})
+		}
+
+		if len(events) > n && h.VLANID != 0 {
+			events[n].Attributes["vlan_id"] = strconv.FormatInt(h.VLANID, 10)
+		}
+
+		state.hosts[key] = &l2Host{port: h.OnInterface, lastSeen: now}
+	}
+
+	for key, h := range state.hosts {
+		if now.Sub(h.lastSeen) > l2ForgetAfter {
+			delete(state.hosts, key)
+		}
+	}
+
+	for key, macs := range addressBindings(tables) {
+		b, ok := state.bindings[key]
+		if !ok {
+			b = &ipBinding{macs: make(map[string]time.Time)}
+			state.bindings[key] = b
+		}
+
+		// Two MACs at once, or a MAC returning after another one took over
+		// the address, means two devices are using it. A MAC that simply
+		// replaces another one is a device swap.
+		conflict := len(macs) > 1
+		for _, mac := range macs {
+			if seenAt, ok := b.macs[mac]; ok && b.mac != "" && mac != b.mac && now.Sub(seenAt) <= l2ConflictWindow {
+				conflict = true
+			}
+		}
+
+		for _, mac := range macs {
+			b.macs[mac] = now
+		}
+		for mac, seenAt := range b.macs {
+			if now.Sub(seenAt) > l2ConflictWindow {
+				delete(b.macs, mac)
+			}
+		}
+		b.mac = macs[0]
+		b.lastSeen = now
+
+		if conflict {
+			b.lastConflict = now
+			if b.conflictSince.IsZero() {
+				b.conflictSince = now
+				events = append(events, conflictEvent(key, b, now))
+			}
+		} else if !b.conflictSince.IsZero() && now.Sub(b.lastConflict) > l2ConflictWindow {
+			b.conflictSince = time.Time{}
+		}
+	}
+
+	for key, b := range state.bindings {
+		if now.Sub(b.lastSeen) > l2ForgetAfter {
+			delete(state.bindings, key)
+		}
+	}
+
+	return events
+}
+
+func conflictEvent(key string, b *ipBinding, now time.Time) models.Event {
+	iface, address, _ := strings.Cut(key, "|")
+
+	macs := make([]string, 0, len(b.macs))
+	for mac := range b.macs {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+
+	return models.Event{
+		Type:      EventIPConflict,
+		Severity:  models.SeverityWarning,
+		Message:   fmt.Sprintf("IP conflict on %s: %s is used by %s", iface, address, strings.Join(macs, ", ")),
+		Timestamp: now,
+		Attributes: map[string]string{
+			"address":       address,
+			"interface":     iface,
+			"mac_addresses": strings.Join(macs, ","),
+		},
+	}
+}
+
+// addressBindings returns the MAC addresses each interface + IP resolves to
+// in the ARP and IPv6 neighbor tables, sorted.
+func addressBindings(tables *NeighborTables) map[string][]string {
+	bindings := make(map[string][]string)
+	add := func(iface, address, mac string) {
+		if address == "" || mac == "" {
+			return
+		}
+		key := iface + "|" + address
+		for _, m := range bindings[key] {
+			if m == mac {
+				return
+			}
+		}
+		bindings[key] = append(bindings[key], mac)
+	}
+
+	for _, a := range tables.ARP {
+		if a.Invalid || a.Disabled || a.Status == "failed" {
+			continue
+		}
+		add(a.Interface, a.Address, a.MACAddress)
+	}
+	for _, n := range tables.IPv6Neighbors {
+		if n.Status == "failed" || n.Status == "noarp" {
+			continue
+		}
+		add(n.Interface, n.Address, n.MACAddress)
+	}
+
+	for _, macs := range bindings {
+		sort.Strings(macs)
+	}
+
+	return bindings
+}
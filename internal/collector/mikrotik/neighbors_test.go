@@ -0,0 +1,247 @@
+package mikrotik
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/apisim"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func bridgeHost(mac, port string) BridgeHost {
+	return BridgeHost{MACAddress: mac, Bridge: "bridge1", OnInterface: port}
+}
+
+func TestL2Tracker_FirstPollIsBaseline(t *testing.T) {
+	tr := newL2Tracker()
+
+	events := tr.update("r1", &NeighborTables{
+		BridgeHosts: []BridgeHost{bridgeHost("AA:AA:AA:AA:AA:01", "ether2")},
+	}, time.Now())
+
+	if len(events) != 0 {
+		t.Errorf("expected no events on the first poll, got %+v", events)
+	}
+}
+
+func TestL2Tracker_NewDeviceAndMove(t *testing.T) {
+	tr := newL2Tracker()
+	now := time.Now()
+
+	tr.update("r1", &NeighborTables{
+		BridgeHosts: []BridgeHost{
+			bridgeHost("AA:AA:AA:AA:AA:01", "ether2"),
+			{MACAddress: "AA:AA:AA:AA:AA:FF", Bridge: "bridge1", OnInterface: "bridge1", Local: true},
+		},
+	}, now)
+
+	events := tr.update("r1", &NeighborTables{
+		BridgeHosts: []BridgeHost{
+			bridgeHost("AA:AA:AA:AA:AA:01", "ether3"),
+			bridgeHost("AA:AA:AA:AA:AA:02", "ether4"),
+		},
+	}, now.Add(time.Minute))
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Type != EventMACMove || events[0].Attributes["from_interface"] != "ether2" || events[0].Attributes["interface"] != "ether3" {
+		t.Errorf("unexpected move event %+v", events[0])
+	}
+	if events[1].Type != EventNewDevice || events[1].Attributes["interface"] != "ether4" {
+		t.Errorf("unexpected new device event %+v", events[1])
+	}
+
+	// Unchanged table produces no further events
+	events = tr.update("r1", &NeighborTables{
+		BridgeHosts: []BridgeHost{
+			bridgeHost("AA:AA:AA:AA:AA:01", "ether3"),
+			bridgeHost("AA:AA:AA:AA:AA:02", "ether4"),
+		},
+	}, now.Add(2*time.Minute))
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %+v", events)
+	}
+}
+
+func TestL2Tracker_MACOnTwoVLANs(t *testing.T) {
+	tr := newL2Tracker()
+	now := time.Now()
+	tables := &NeighborTables{
+		BridgeHosts: []BridgeHost{
+			{MACAddress: "00:00:5E:00:01:01", Bridge: "bridge1", OnInterface: "ether2", VLANID: 10},
+			{MACAddress: "00:00:5E:00:01:01", Bridge: "bridge1", OnInterface: "ether3", VLANID: 20},
+		},
+	}
+
+	tr.update("r1", tables, now)
+	for i := 1; i <= 3; i++ {
+		if events := tr.update("r1", tables, now.Add(time.Duration(i)*time.Minute)); len(events) != 0 {
+			t.Fatalf("poll %d: expected no events, got %+v", i, events)
+		}
+	}
+
+	// Moving on one VLAN is still reported
+	tables.BridgeHosts[1].OnInterface = "ether4"
+	events := tr.update("r1", tables, now.Add(5*time.Minute))
+	if len(events) != 1 || events[0].Type != EventMACMove || events[0].Attributes["from_interface"] != "ether3" ||
+		events[0].Attributes["vlan_id"] != "20" {
+		t.Errorf("expected a move on VLAN 20, got %+v", events)
+	}
+}
+
+func TestL2Tracker_AgedOutHostIsNotNew(t *testing.T) {
+	tr := newL2Tracker()
+	now := time.Now()
+	host := &NeighborTables{BridgeHosts: []BridgeHost{bridgeHost("AA:AA:AA:AA:AA:01", "ether2")}}
+
+	tr.update("r1", host, now)
+	tr.update("r1", &NeighborTables{}, now.Add(time.Minute))
+
+	if events := tr.update("r1", host, now.Add(time.Hour)); len(events) != 0 {
+		t.Errorf("expected returning host to be remembered, got %+v", events)
+	}
+	if events := tr.update("r1", &NeighborTables{}, now.Add(48*time.Hour)); len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events := tr.update("r1", host, now.Add(49*time.Hour)); len(events) != 1 || events[0].Type != EventNewDevice {
+		t.Errorf("expected host to be new again after %v, got %+v", l2ForgetAfter, events)
+	}
+}
+
+func arpTable(mac string) *NeighborTables {
+	return &NeighborTables{ARP: []ARPEntry{{Address: "192.168.88.10", MACAddress: mac, Interface: "bridge1"}}}
+}
+
+func TestL2Tracker_IPConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		macs     []string
+		interval time.Duration
+		want     int
+	}{
+		{"stable", []string{"A", "A", "A"}, time.Minute, 0},
+		{"device swap", []string{"A", "B", "B", "B"}, time.Minute, 0},
+		{"flapping", []string{"A", "B", "A", "B", "A"}, time.Minute, 1},
+		{"slow swap back", []string{"A", "B", "A"}, time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newL2Tracker()
+			now := time.Now()
+
+			var conflicts int
+			for i, mac := range tt.macs {
+				for _, e := range tr.update("r1", arpTable(mac), now.Add(time.Duration(i)*tt.interval)) {
+					if e.Type == EventIPConflict {
+						conflicts++
+					}
+				}
+			}
+
+			if conflicts != tt.want {
+				t.Errorf("expected %d conflict events, got %d", tt.want, conflicts)
+			}
+		})
+	}
+}
+
+func TestL2Tracker_SimultaneousConflict(t *testing.T) {
+	tr := newL2Tracker()
+
+	events := tr.update("r1", &NeighborTables{
+		ARP: []ARPEntry{
+			{Address: "10.0.0.5", MACAddress: "AA:AA:AA:AA:AA:02", Interface: "ether2"},
+			{Address: "10.0.0.5", MACAddress: "AA:AA:AA:AA:AA:01", Interface: "ether2"},
+			// Same address on another segment is not a conflict
+			{Address: "10.0.0.6", MACAddress: "AA:AA:AA:AA:AA:03", Interface: "ether2"},
+			{Address: "10.0.0.6", MACAddress: "AA:AA:AA:AA:AA:04", Interface: "ether3"},
+			// Failed entries are ignored
+			{Address: "10.0.0.7", MACAddress: "AA:AA:AA:AA:AA:05", Interface: "ether2"},
+			{Address: "10.0.0.7", MACAddress: "AA:AA:AA:AA:AA:06", Interface: "ether2", Status: "failed"},
+		},
+	}, time.Now())
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 conflict, got %+v", events)
+	}
+	if got := events[0].Attributes["mac_addresses"]; got != "AA:AA:AA:AA:AA:01,AA:AA:AA:AA:AA:02" {
+		t.Errorf("unexpected conflicting MACs %q", got)
+	}
+}
+
+func TestParseARPEntry(t *testing.T) {
+	e := parseARPEntry(map[string]string{
+		"address":     "192.168.88.10",
+		"mac-address": "aa:bb:cc:dd:ee:ff",
+		"interface":   "bridge1",
+		"status":      "reachable",
+		"dynamic":     "true",
+		"complete":    "true",
+	})
+
+	if e.MACAddress != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("expected MAC to be normalized, got %s", e.MACAddress)
+	}
+	if !e.Dynamic || !e.Complete || e.Invalid {
+		t.Errorf("unexpected flags %+v", e)
+	}
+}
+
+func TestCollectAll_NeighborErrors(t *testing.T) {
+	sim := apisim.NewRouter("pop-1-sw", "monitor", "secret")
+	sim.SetTable("/ip/arp", []map[string]string{{".id": "*1", "address": "10.0.0.2", "mac-address": "aa:aa:aa:aa:aa:01", "interface": "bridge1"}})
+	sim.SetTable("/interface/bridge/host", []map[string]string{
+		{".id": "*1", "mac-address": "aa:aa:aa:aa:aa:01", "bridge": "bridge1", "on-interface": "ether2"},
+	})
+	srv, err := apisim.Listen("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer srv.Close()
+
+	cfg := DefaultConfig().DisableAll()
+	cfg.Collect.Neighbors = true
+	cfg.API.Timeout = 200 * time.Millisecond
+	cfg.API.RetryAttempts = 1
+	c := NewCollectorWithConfig(cfg)
+	router := &models.RouterConfig{
+		ID:          "pop-1-sw",
+		Address:     "127.0.0.1",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "secret"},
+		Metadata:    map[string]interface{}{"api_port": srv.Port()},
+	}
+	ctx := context.Background()
+
+	// Menus the router does not have, here IPv6 and discovery, are skipped
+	data, err := c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) != 0 || data.Neighbors == nil || len(data.Neighbors.BridgeHosts) != 1 {
+		t.Fatalf("errors = %v, neighbors = %+v", data.Errors, data.Neighbors)
+	}
+
+	// A bridge host table that times out is an error, not an empty table
+	sim.Inject("/interface/bridge/host/print", apisim.Fault{Delay: time.Second, Count: 1})
+	data, err = c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) != 1 || !strings.HasPrefix(data.Errors[0], "neighbors:") || data.Neighbors != nil {
+		t.Fatalf("errors = %v, neighbors = %+v", data.Errors, data.Neighbors)
+	}
+
+	// so the hosts seen again afterwards are not reported as new devices
+	sim.ClearFaults()
+	data, err = c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) != 0 || len(data.Events) != 0 {
+		t.Errorf("errors = %v, events = %+v", data.Errors, data.Events)
+	}
+}
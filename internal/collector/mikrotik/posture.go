@@ -0,0 +1,476 @@
+package mikrotik
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// Posture checks.
+const (
+	PostureCheckVersion         = "routeros_version"
+	PostureCheckFirmware        = "routerboard_firmware"
+	PostureCheckPackages        = "package_versions"
+	PostureCheckInsecureService = "insecure_service"
+	PostureCheckExposedService  = "exposed_service"
+	PostureCheckDefaultUser     = "default_user"
+	PostureCheckAPITLS          = "api_tls"
+)
+
+// insecureServices transfer credentials in plain text.
+var insecureServices = map[string]bool{
+	"telnet": true,
+	"ftp":    true,
+	"www":    true,
+	"api":    true,
+}
+
+// PackageInfo describes an installed RouterOS package.
+type PackageInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time,omitempty"`
+	Disabled  bool   `json:"disabled,omitempty"`
+}
+
+// FirmwareInfo describes the RouterBOARD firmware. It is absent on CHR and
+// x86 installations.
+type FirmwareInfo struct {
+	Model            string `json:"model,omitempty"`
+	SerialNumber     string `json:"serial_number,omitempty"`
+	FirmwareType     string `json:"firmware_type,omitempty"`
+	CurrentFirmware  string `json:"current_firmware"`
+	UpgradeFirmware  string `json:"upgrade_firmware"`
+	UpgradeAvailable bool   `json:"upgrade_available"`
+}
+
+// ServiceInfo describes an IP service (/ip/service).
+type ServiceInfo struct {
+	Name        string   `json:"name"`
+	Port        int      `json:"port"`
+	Addresses   []string `json:"addresses,omitempty"` // Allowed source prefixes; empty allows all
+	Certificate string   `json:"certificate,omitempty"`
+	Disabled    bool     `json:"disabled"`
+	Exposed     bool     `json:"exposed"` // Reachable from any address
+}
+
+// PostureFinding is a single security posture problem.
+type PostureFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Subject  string `json:"subject,omitempty"` // Service, package or user concerned
+	Message  string `json:"message"`
+}
+
+// PostureReport is the software, firmware and security posture of a router.
+type PostureReport struct {
+	Version       string           `json:"version"`
+	Packages      []PackageInfo    `json:"packages,omitempty"`
+	Firmware      *FirmwareInfo    `json:"firmware,omitempty"`
+	Services      []ServiceInfo    `json:"services,omitempty"`
+	DefaultUser   bool             `json:"default_user"`
+	APITLS        bool             `json:"api_tls"`        // api-ssl is enabled with a certificate
+	InputFiltered bool             `json:"input_filtered"` // Input chain ends in a catch-all drop
+	Findings      []PostureFinding `json:"findings,omitempty"`
+	Errors        []string         `json:"errors,omitempty"` // Parts that could not be read
+}
+
+// firewallRule is the subset of an input filter rule needed to decide
+// whether services are reachable.
+type firewallRule struct {
+	action    string
+	protocol  string
+	dstPort   string
+	scoped    bool   // Limited by source, destination or connection state
+	inputFrom string // in-interface or in-interface-list, e.g. "!LAN"
+}
+
+// wanSide holds the interfaces and interface lists facing the internet.
+type wanSide struct {
+	names map[string]bool
+	guess bool // No names were configured; names containing "wan" count
+}
+
+// newWANSide returns the WAN side made of the configured names, or of the
+// names containing "wan" when none are, extended through the interface list
+// members: the members of a WAN list are WAN interfaces, and a list holding
+// a WAN interface is a WAN list.
+func newWANSide(configured []string, members []map[string]string) wanSide {
+	w := wanSide{names: make(map[string]bool), guess: len(configured) == 0}
+	for _, name := range configured {
+		w.names[name] = true
+	}
+	for _, m := range members {
+		if !ParseBool(m["disabled"]) && w.covers(m["list"]) {
+			w.names[m["interface"]] = true
+		}
+	}
+	for _, m := range members {
+		if !ParseBool(m["disabled"]) && w.covers(m["interface"]) {
+			w.names[m["list"]] = true
+		}
+	}
+	return w
+}
+
+// covers reports whether name is a WAN interface or interface list.
+func (w wanSide) covers(name string) bool {
+	if name == "" {
+		return false
+	}
+	return w.names[name] || (w.guess && strings.Contains(strings.ToLower(name), "wan"))
+}
+
+// collectPosture gathers the package, firmware, service and user inventory
+// and evaluates it. agentTLS reports whether the agent itself connects over
+// API-SSL.
+func (c *Collector) collectPosture(ctx context.Context, client Backend, cfg PostureConfig, agentTLS bool) (*PostureReport, error) {
+	resource, err := client.RunOne(ctx, "/system/resource/print", nil)
+	if err != nil {
+		return nil, err
+	}
+	report := &PostureReport{Version: resource["version"]}
+
+	packages, err := client.Run(ctx, "/system/package/print", nil)
+	if err != nil {
+		return nil, fmt.Errorf("packages: %w", err)
+	}
+	for _, p := range packages {
+		report.Packages = append(report.Packages, PackageInfo{
+			Name:      p["name"],
+			Version:   p["version"],
+			BuildTime: p["build-time"],
+			Disabled:  ParseBool(p["disabled"]),
+		})
+	}
+
+	// RouterBOARD information does not exist on CHR
+	if rb, err := client.RunOne(ctx, "/system/routerboard/print", nil); err == nil {
+		report.Firmware = parseFirmware(rb)
+	}
+
+	services, err := client.Run(ctx, "/ip/service/print", nil)
+	if err != nil {
+		return nil, fmt.Errorf("services: %w", err)
+	}
+
+	// Without the firewall rules, whether a service is reachable is
+	// unknown, so none is reported as exposed
+	filters, err := client.Run(ctx, "/ip/firewall/filter/print", nil)
+	firewallKnown := err == nil
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("firewall filter: %v", err))
+	}
+	rules := parseInputRules(filters)
+
+	// Without the list members, only the WAN names themselves are known
+	members, err := runOptional(ctx, client, "/interface/list/member/print")
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("interface lists: %v", err))
+	}
+	wan := newWANSide(cfg.WANInterfaces, members)
+	report.InputFiltered = inputFiltered(rules, wan)
+
+	for _, s := range services {
+		svc := parseService(s)
+		svc.Exposed = firewallKnown && !svc.Disabled && len(svc.Addresses) == 0 && serviceReachable(rules, svc.Port, wan)
+		report.Services = append(report.Services, svc)
+	}
+	report.APITLS = apiTLS(report.Services)
+
+	users, err := client.Run(ctx, "/user/print", nil)
+	if err == nil {
+		for _, u := range users {
+			if u["name"] == "admin" && !ParseBool(u["disabled"]) {
+				report.DefaultUser = true
+			}
+		}
+	}
+
+	report.Findings = evaluatePosture(report, cfg, agentTLS)
+	return report, nil
+}
+
+func parseFirmware(rb map[string]string) *FirmwareInfo {
+	if rb == nil || rb["routerboard"] != "true" {
+		return nil
+	}
+	fw := &FirmwareInfo{
+		Model:           rb["model"],
+		SerialNumber:    rb["serial-number"],
+		FirmwareType:    rb["firmware-type"],
+		CurrentFirmware: rb["current-firmware"],
+		UpgradeFirmware: rb["upgrade-firmware"],
+	}
+	fw.UpgradeAvailable = fw.UpgradeFirmware != "" && compareVersions(fw.UpgradeFirmware, fw.CurrentFirmware) > 0
+	return fw
+}
+
+func parseService(s map[string]string) ServiceInfo {
+	svc := ServiceInfo{
+		Name:        s["name"],
+		Port:        int(ParseInt64(s["port"])),
+		Certificate: s["certificate"],
+		Disabled:    ParseBool(s["disabled"]),
+	}
+	for _, addr := range strings.Split(s["address"], ",") {
+		switch addr = strings.TrimSpace(addr); addr {
+		case "":
+		case "0.0.0.0/0", "::/0":
+			// Allows every source
+			svc.Addresses = nil
+			return svc
+		default:
+			svc.Addresses = append(svc.Addresses, addr)
+		}
+	}
+	return svc
+}
+
+func parseInputRules(filters []map[string]string) []firewallRule {
+	var rules []firewallRule
+	for _, f := range filters {
+		if ParseBool(f["disabled"]) || f["chain"] != "input" {
+			continue
+		}
+		rules = append(rules, firewallRule{
+			action:    f["action"],
+			protocol:  f["protocol"],
+			dstPort:   f["dst-port"],
+			inputFrom: SafeString(f["in-interface-list"], f["in-interface"]),
+			scoped: f["src-address"] != "" || f["src-address-list"] != "" ||
+				f["src-mac-address"] != "" || f["dst-address"] != "" ||
+				f["connection-state"] != "" || f["ipsec-policy"] != "",
+		})
+	}
+	return rules
+}
+
+// isCatchAllDrop reports whether r drops all remaining input from the WAN.
+// Rules limited to interfaces, such as the default "drop all not coming from
+// LAN", only count when they cover the WAN side.
+func (r firewallRule) isCatchAllDrop(wan wanSide) bool {
+	return (r.action == "drop" || r.action == "reject") && !r.scoped && r.protocol == "" && r.dstPort == "" && r.fromWAN(wan)
+}
+
+// fromWAN reports whether r applies to traffic arriving from the WAN: it is
+// not limited to interfaces, names a WAN interface or list, or excludes one
+// that is not ("!LAN").
+func (r firewallRule) fromWAN(wan wanSide) bool {
+	if r.inputFrom == "" {
+		return true
+	}
+	name, negated := strings.CutPrefix(r.inputFrom, "!")
+	return negated != wan.covers(name)
+}
+
+// opensPort reports whether r accepts TCP port from any WAN source. Rules
+// without a port (accept ICMP, accept from LAN) are not considered, and
+// rules for a named interface only count when it is on the WAN side.
+func (r firewallRule) opensPort(port int, wan wanSide) bool {
+	if r.action != "accept" || r.scoped || r.dstPort == "" || !portInList(r.dstPort, port) {
+		return false
+	}
+	if r.protocol != "" && r.protocol != "tcp" {
+		return false
+	}
+	return r.fromWAN(wan)
+}
+
+func inputFiltered(rules []firewallRule, wan wanSide) bool {
+	for _, r := range rules {
+		if r.isCatchAllDrop(wan) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceReachable reports whether TCP port is reachable from any source:
+// either it is accepted before the first catch-all drop, or there is no
+// such drop.
+func serviceReachable(rules []firewallRule, port int, wan wanSide) bool {
+	for _, r := range rules {
+		if r.isCatchAllDrop(wan) {
+			return false
+		}
+		if r.opensPort(port, wan) {
+			return true
+		}
+	}
+	return true
+}
+
+// portInList reports whether port is in a RouterOS port list such as
+// "22,8291" or "8000-8999".
+func portInList(list string, port int) bool {
+	for _, item := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			continue
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil {
+				continue
+			}
+		}
+		if port >= start && port <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluatePosture returns the findings for a report.
+func evaluatePosture(report *PostureReport, cfg PostureConfig, agentTLS bool) []PostureFinding {
+	var findings []PostureFinding
+	add := func(check, severity, subject, format string, args ...any) {
+		findings = append(findings, PostureFinding{
+			Check:    check,
+			Severity: severity,
+			Subject:  subject,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if cfg.MinVersion != "" && report.Version != "" && compareVersions(report.Version, cfg.MinVersion) < 0 {
+		add(PostureCheckVersion, models.SeverityCritical, "routeros",
+			"RouterOS %s is below minimum version %s", versionNumber(report.Version), cfg.MinVersion)
+	}
+
+	for _, p := range report.Packages {
+		if p.Disabled || report.Version == "" {
+			continue
+		}
+		if compareVersions(p.Version, report.Version) != 0 {
+			add(PostureCheckPackages, models.SeverityWarning, p.Name,
+				"Package %s version %s does not match RouterOS %s", p.Name, p.Version, versionNumber(report.Version))
+		}
+	}
+
+	if fw := report.Firmware; fw != nil && fw.UpgradeAvailable {
+		add(PostureCheckFirmware, models.SeverityWarning, "routerboard",
+			"RouterBOARD firmware %s is older than %s", fw.CurrentFirmware, fw.UpgradeFirmware)
+	}
+
+	for _, s := range report.Services {
+		if s.Disabled {
+			continue
+		}
+		if s.Name == "api-ssl" || s.Name == "www-ssl" {
+			if s.Certificate == "" || s.Certificate == "none" {
+				add(PostureCheckAPITLS, models.SeverityWarning, s.Name,
+					"%s is enabled without a certificate", s.Name)
+			}
+		}
+		if s.Exposed {
+			severity := models.SeverityWarning
+			if insecureServices[s.Name] || s.Name == "winbox" || s.Name == "ssh" || s.Name == "api-ssl" {
+				severity = models.SeverityCritical
+			}
+			add(PostureCheckExposedService, severity, s.Name,
+				"%s open to WAN (port %d reachable from any address)", s.Name, s.Port)
+		} else if insecureServices[s.Name] && s.Name != "api" {
+			add(PostureCheckInsecureService, models.SeverityWarning, s.Name,
+				"%s is enabled and sends credentials in plain text", s.Name)
+		}
+	}
+
+	if report.DefaultUser {
+		add(PostureCheckDefaultUser, models.SeverityWarning, "admin",
+			"Default user admin is enabled")
+	}
+
+	if !agentTLS {
+		if report.APITLS {
+			add(PostureCheckAPITLS, models.SeverityWarning, "api",
+				"Agent uses the plain API although api-ssl is available")
+		} else {
+			add(PostureCheckAPITLS, models.SeverityWarning, "api",
+				"API-SSL is not available; credentials are sent in plain text")
+		}
+	}
+
+	return findings
+}
+
+// apiTLS reports whether api-ssl is enabled with a certificate.
+func apiTLS(services []ServiceInfo) bool {
+	for _, s := range services {
+		if s.Name == "api-ssl" && !s.Disabled && s.Certificate != "" && s.Certificate != "none" {
+			return true
+		}
+	}
+	return false
+}
+
+// Metrics returns finding counts by severity, e.g.
+// posture_findings{severity="critical"}.
+func (r *PostureReport) Metrics() map[string]float64 {
+	metrics := map[string]float64{
+		`posture_findings{severity="critical"}`: 0,
+		`posture_findings{severity="warning"}`:  0,
+	}
+	for _, f := range r.Findings {
+		metrics[fmt.Sprintf("posture_findings{severity=%q}", f.Severity)]++
+	}
+	return metrics
+}
+
+// versionNumber strips the release channel from a RouterOS version such as
+// "7.12.1 (stable)".
+func versionNumber(version string) string {
+	v, _, _ := strings.Cut(strings.TrimSpace(version), " ")
+	return v
+}
+
+// compareVersions compares two RouterOS versions numerically, returning -1,
+// 0 or 1. Pre-release suffixes ("7.13beta2", "7.13rc1") sort before the
+// release.
+func compareVersions(a, b string) int {
+	pa := strings.Split(versionNumber(a), ".")
+	pb := strings.Split(versionNumber(b), ".")
+
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		na, sa := versionPart(pa, i)
+		nb, sb := versionPart(pb, i)
+		switch {
+		case na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case sa != sb:
+			// A suffix marks a pre-release of the same number
+			if sa == "" {
+				return 1
+			}
+			if sb == "" {
+				return -1
+			}
+			if sa < sb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) (int, string) {
+	if i >= len(parts) {
+		return 0, ""
+	}
+	p := parts[i]
+	n := 0
+	j := 0
+	for ; j < len(p) && p[j] >= '0' && p[j] <= '9'; j++ {
+		n = n*10 + int(p[j]-'0')
+	}
+	return n, p[j:]
+}
@@ -0,0 +1,370 @@
+package mikrotik
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/apisim"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"7.12.1 (stable)", "7.12.1", 0},
+		{"7.12", "7.12.0", 0},
+		{"6.49.10 (long-term)", "7.1", -1},
+		{"7.10", "7.9", 1},
+		{"7.13beta2", "7.13", -1},
+		{"7.13rc1", "7.13beta2", 1},
+		{"7.13", "7.12.1", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := compareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortInList(t *testing.T) {
+	tests := []struct {
+		list string
+		port int
+		want bool
+	}{
+		{"8291", 8291, true},
+		{"22,8291", 8291, true},
+		{"22, 23", 23, true},
+		{"8000-9000", 8291, true},
+		{"8000-8200", 8291, false},
+		{"winbox", 8291, false},
+	}
+
+	for _, tt := range tests {
+		if got := portInList(tt.list, tt.port); got != tt.want {
+			t.Errorf("portInList(%q, %d) = %v, want %v", tt.list, tt.port, got, tt.want)
+		}
+	}
+}
+
+// defconfInput is the input chain of the RouterOS default configuration.
+var defconfInput = []map[string]string{
+	{"chain": "input", "action": "accept", "connection-state": "established,related,untracked"},
+	{"chain": "input", "action": "drop", "connection-state": "invalid"},
+	{"chain": "input", "action": "accept", "protocol": "icmp"},
+	{"chain": "input", "action": "accept", "dst-address": "127.0.0.1"},
+	{"chain": "input", "action": "drop", "in-interface-list": "!LAN"},
+}
+
+func TestServiceReachable(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []map[string]string
+		wan     []string            // posture.wan_interfaces
+		members []map[string]string // /interface/list/member
+		want    bool
+	}{
+		{name: "no firewall", want: true},
+		{name: "default configuration", filters: defconfInput, want: false},
+		{
+			name: "accepted before drop",
+			filters: append([]map[string]string{
+				{"chain": "input", "action": "accept", "protocol": "tcp", "dst-port": "22,8291"},
+			}, defconfInput...),
+			want: true,
+		},
+		{
+			name: "accepted from management list",
+			filters: append([]map[string]string{
+				{"chain": "input", "action": "accept", "protocol": "tcp", "dst-port": "8291", "src-address-list": "mgmt"},
+			}, defconfInput...),
+			want: false,
+		},
+		{
+			name: "accepted on LAN",
+			filters: append([]map[string]string{
+				{"chain": "input", "action": "accept", "protocol": "tcp", "dst-port": "8291", "in-interface-list": "LAN"},
+			}, defconfInput...),
+			want: false,
+		},
+		{
+			name: "drop limited to LAN",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface-list": "LAN"},
+			},
+			want: true,
+		},
+		{
+			name: "drop limited to WAN",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface": "ether1-wan"},
+			},
+			want: false,
+		},
+		{
+			name: "drop of all but WAN",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface-list": "!WAN"},
+			},
+			want: true,
+		},
+		{
+			name: "drop on uplink not named wan",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface": "ether1"},
+			},
+			want: true,
+		},
+		{
+			name: "drop on configured uplink",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface": "ether1"},
+			},
+			wan:  []string{"ether1"},
+			want: false,
+		},
+		{
+			name: "drop on member of WAN list",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface": "ether1"},
+			},
+			members: []map[string]string{{"list": "WAN", "interface": "ether1"}},
+			want:    false,
+		},
+		{
+			name: "drop on list holding configured uplink",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface-list": "uplinks"},
+			},
+			wan:     []string{"sfp-sfpplus1"},
+			members: []map[string]string{{"list": "uplinks", "interface": "sfp-sfpplus1"}, {"list": "LAN", "interface": "bridge"}},
+			want:    false,
+		},
+		{
+			name: "accepted on configured uplink",
+			filters: append([]map[string]string{
+				{"chain": "input", "action": "accept", "protocol": "tcp", "dst-port": "8291", "in-interface": "sfp-sfpplus1"},
+			}, defconfInput...),
+			wan:  []string{"sfp-sfpplus1"},
+			want: true,
+		},
+		{
+			name: "configured names replace the guess",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface": "ether1-wan"},
+			},
+			wan:  []string{"sfp-sfpplus1"},
+			want: true,
+		},
+		{
+			name: "drop rule disabled",
+			filters: []map[string]string{
+				{"chain": "input", "action": "drop", "in-interface-list": "!LAN", "disabled": "true"},
+			},
+			want: true,
+		},
+		{
+			name: "forward chain ignored",
+			filters: []map[string]string{
+				{"chain": "forward", "action": "drop"},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceReachable(parseInputRules(tt.filters), 8291, newWANSide(tt.wan, tt.members)); got != tt.want {
+				t.Errorf("serviceReachable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseService(t *testing.T) {
+	svc := parseService(map[string]string{"name": "ssh", "port": "22", "address": "10.0.0.0/8,192.168.0.0/16", "disabled": "false"})
+	if len(svc.Addresses) != 2 || svc.Port != 22 || svc.Disabled {
+		t.Errorf("parseService() = %+v", svc)
+	}
+
+	svc = parseService(map[string]string{"name": "winbox", "port": "8291", "address": "10.0.0.0/8,0.0.0.0/0"})
+	if len(svc.Addresses) != 0 {
+		t.Errorf("Addresses = %v, want none for 0.0.0.0/0", svc.Addresses)
+	}
+}
+
+func TestParseFirmware(t *testing.T) {
+	if fw := parseFirmware(map[string]string{"routerboard": "false"}); fw != nil {
+		t.Errorf("parseFirmware() = %+v, want nil for CHR", fw)
+	}
+
+	fw := parseFirmware(map[string]string{
+		"routerboard":      "true",
+		"model":            "RB5009UG+S+",
+		"current-firmware": "7.11",
+		"upgrade-firmware": "7.12.1",
+	})
+	if fw == nil || !fw.UpgradeAvailable {
+		t.Errorf("parseFirmware() = %+v, want upgrade available", fw)
+	}
+}
+
+func TestEvaluatePosture(t *testing.T) {
+	report := &PostureReport{
+		Version: "6.48.6 (long-term)",
+		Packages: []PackageInfo{
+			{Name: "routeros", Version: "6.48.6"},
+			{Name: "wireless", Version: "6.48.1"},
+		},
+		Firmware: &FirmwareInfo{CurrentFirmware: "6.47", UpgradeFirmware: "6.48.6", UpgradeAvailable: true},
+		Services: []ServiceInfo{
+			{Name: "telnet", Port: 23},
+			{Name: "winbox", Port: 8291, Exposed: true},
+			{Name: "ssh", Port: 22, Addresses: []string{"10.0.0.0/8"}},
+			{Name: "ftp", Port: 21, Disabled: true},
+			{Name: "api-ssl", Port: 8729, Certificate: "none"},
+		},
+		DefaultUser: true,
+	}
+
+	findings := evaluatePosture(report, PostureConfig{MinVersion: "6.49.10"}, false)
+
+	want := map[string]string{
+		PostureCheckVersion + "/routeros":       models.SeverityCritical,
+		PostureCheckPackages + "/wireless":      models.SeverityWarning,
+		PostureCheckFirmware + "/routerboard":   models.SeverityWarning,
+		PostureCheckInsecureService + "/telnet": models.SeverityWarning,
+		PostureCheckExposedService + "/winbox":  models.SeverityCritical,
+		PostureCheckAPITLS + "/api-ssl":         models.SeverityWarning,
+		PostureCheckDefaultUser + "/admin":      models.SeverityWarning,
+		PostureCheckAPITLS + "/api":             models.SeverityWarning,
+	}
+	got := make(map[string]string)
+	for _, f := range findings {
+		got[f.Check+"/"+f.Subject] = f.Severity
+	}
+	for key, severity := range want {
+		if got[key] != severity {
+			t.Errorf("finding %s = %q, want %q", key, got[key], severity)
+		}
+	}
+	if len(findings) != len(want) {
+		t.Errorf("got %d findings, want %d: %+v", len(findings), len(want), findings)
+	}
+
+	report.Findings = findings
+	metrics := report.Metrics()
+	if metrics[`posture_findings{severity="critical"}`] != 2 || metrics[`posture_findings{severity="warning"}`] != 6 {
+		t.Errorf("Metrics() = %v", metrics)
+	}
+}
+
+func TestEvaluatePosture_Clean(t *testing.T) {
+	report := &PostureReport{
+		Version:  "7.12.1 (stable)",
+		Packages: []PackageInfo{{Name: "routeros", Version: "7.12.1"}},
+		Services: []ServiceInfo{
+			{Name: "api-ssl", Port: 8729, Certificate: "api"},
+			{Name: "winbox", Port: 8291},
+		},
+		APITLS: true,
+	}
+
+	if findings := evaluatePosture(report, PostureConfig{MinVersion: "6.49.10"}, true); len(findings) != 0 {
+		t.Errorf("evaluatePosture() = %+v, want no findings", findings)
+	}
+}
+
+func TestCollectPosture_FirewallUnreadable(t *testing.T) {
+	sim := apisim.NewRouter("bng-1", "monitor", "secret")
+	sim.SetTable("/system/package", []map[string]string{{"name": "routeros", "version": "7.14.3"}})
+	sim.SetTable("/ip/service", []map[string]string{{"name": "winbox", "port": "8291"}})
+	sim.SetTable("/user", []map[string]string{{"name": "monitor"}})
+	sim.SetTable("/ip/firewall/filter", defconfInput)
+	sim.Inject("/ip/firewall/filter/print", apisim.Fault{Trap: "not enough permissions (9)"})
+	srv, err := apisim.Listen("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer srv.Close()
+
+	cfg := DefaultConfig().DisableAll()
+	cfg.Collect.Posture = true
+	cfg.API.Timeout = time.Second
+	c := NewCollectorWithConfig(cfg)
+	router := &models.RouterConfig{
+		ID:          "bng-1",
+		Address:     "127.0.0.1",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "secret"},
+		Metadata:    map[string]interface{}{"api_port": srv.Port()},
+	}
+	ctx := context.Background()
+
+	// Without the rules, winbox is not reported as open to WAN
+	data, err := c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if data.Posture == nil || len(data.Posture.Errors) != 1 || len(data.Errors) != 1 || !strings.HasPrefix(data.Errors[0], "posture: firewall filter:") {
+		t.Fatalf("errors = %v, posture = %+v", data.Errors, data.Posture)
+	}
+	for _, f := range data.Posture.Findings {
+		if f.Check == PostureCheckExposedService {
+			t.Errorf("finding %+v without firewall rules", f)
+		}
+	}
+
+	// With them, the default configuration protects it
+	sim.ClearFaults()
+	data, err = c.CollectAll(ctx, router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) != 0 || !data.Posture.InputFiltered || data.Posture.Services[0].Exposed {
+		t.Errorf("errors = %v, posture = %+v", data.Errors, data.Posture)
+	}
+}
+
+func TestCollectPosture_UplinkInWANList(t *testing.T) {
+	sim := apisim.NewRouter("bng-1", "monitor", "secret")
+	sim.SetTable("/system/package", []map[string]string{{"name": "routeros", "version": "7.14.3"}})
+	sim.SetTable("/ip/service", []map[string]string{{"name": "winbox", "port": "8291"}})
+	sim.SetTable("/user", []map[string]string{{"name": "monitor"}})
+	sim.SetTable("/ip/firewall/filter", []map[string]string{
+		{"chain": "input", "action": "accept", "connection-state": "established,related"},
+		{"chain": "input", "action": "drop", "in-interface": "sfp-sfpplus1"},
+	})
+	sim.SetTable("/interface/list/member", []map[string]string{{"list": "WAN", "interface": "sfp-sfpplus1"}})
+	srv, err := apisim.Listen("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer srv.Close()
+
+	cfg := DefaultConfig().DisableAll()
+	cfg.Collect.Posture = true
+	cfg.API.Timeout = time.Second
+	c := NewCollectorWithConfig(cfg)
+	router := &models.RouterConfig{
+		ID:          "bng-1",
+		Address:     "127.0.0.1",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "secret"},
+		Metadata:    map[string]interface{}{"api_port": srv.Port()},
+	}
+
+	// The uplink is not named like a WAN, but its list is
+	data, err := c.CollectAll(context.Background(), router)
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) != 0 || !data.Posture.InputFiltered || data.Posture.Services[0].Exposed {
+		t.Errorf("errors = %v, posture = %+v", data.Errors, data.Posture)
+	}
+}
@@ -2,8 +2,6 @@ package mikrotik
 
 import (
 	"context"
-
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
 )
 
 // PPPoESession represents a PPPoE session.
@@ -37,7 +35,7 @@ type PPPoEServerStats struct {
 }
 
 // collectPPPoE collects PPPoE session information from the router.
-func (c *Collector) collectPPPoE(ctx context.Context, client *api.Client) ([]PPPoESession, []PPPoEServerStats, error) {
+func (c *Collector) collectPPPoE(ctx context.Context, client Backend) ([]PPPoESession, []PPPoEServerStats, error) {
 	// Get active PPPoE sessions
 	sessions, err := client.Run(ctx, "/ppp/active/print", nil)
 	if err != nil {
@@ -0,0 +1,392 @@
+package mikrotik
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// EventNetwatchChange is raised when a netwatch host goes up or down.
+const EventNetwatchChange = "netwatch_change"
+
+// rttPattern matches the components of a RouterOS round-trip time such as
+// "12ms", "12ms345us", "1s2ms" or "12.3ms".
+var rttPattern = regexp.MustCompile(`([\d.]+)(us|ms|s)`)
+
+// PingResult contains the result of pinging a target from the router.
+type PingResult struct {
+	Target     string  `json:"target"`
+	Address    string  `json:"address"`
+	Sent       int     `json:"sent"`
+	Received   int     `json:"received"`
+	PacketLoss float64 `json:"packet_loss_percent"`
+	MinRTTMs   float64 `json:"min_rtt_ms"`
+	AvgRTTMs   float64 `json:"avg_rtt_ms"`
+	MaxRTTMs   float64 `json:"max_rtt_ms"`
+	JitterMs   float64 `json:"jitter_ms"` // Mean difference between consecutive RTTs
+	Error      string  `json:"error,omitempty"`
+}
+
+// TracerouteHop is a single hop of a traceroute.
+type TracerouteHop struct {
+	Hop        int     `json:"hop"`
+	Address    string  `json:"address,omitempty"` // Empty when the hop did not answer
+	PacketLoss float64 `json:"packet_loss_percent"`
+	Sent       int     `json:"sent"`
+	LastRTTMs  float64 `json:"last_rtt_ms,omitempty"`
+	AvgRTTMs   float64 `json:"avg_rtt_ms,omitempty"`
+	BestRTTMs  float64 `json:"best_rtt_ms,omitempty"`
+	WorstRTTMs float64 `json:"worst_rtt_ms,omitempty"`
+	Status     string  `json:"status,omitempty"`
+}
+
+// TracerouteResult contains the path from the router to a target.
+type TracerouteResult struct {
+	Target  string          `json:"target"`
+	Address string          `json:"address"`
+	Hops    []TracerouteHop `json:"hops"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// NetwatchHost is the state of a /tool/netwatch entry.
+type NetwatchHost struct {
+	Name       string    `json:"name,omitempty"`
+	Host       string    `json:"host"`
+	Type       string    `json:"type,omitempty"` // simple, icmp, tcp-conn, http-get (7.x)
+	Status     string    `json:"status"`         // up, down, unknown
+	Since      time.Time `json:"since,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	RTTAvgMs   float64   `json:"rtt_avg_ms,omitempty"`
+	RTTJitter  float64   `json:"rtt_jitter_ms,omitempty"`
+	PacketLoss float64   `json:"packet_loss_percent,omitempty"`
+	Disabled   bool      `json:"disabled,omitempty"`
+}
+
+// ProbeResults contains probe results and netwatch states.
+type ProbeResults struct {
+	Ping       []PingResult       `json:"ping,omitempty"`
+	Traceroute []TracerouteResult `json:"traceroute,omitempty"`
+	Netwatch   []NetwatchHost     `json:"netwatch,omitempty"`
+}
+
+// collectProbes pings (and optionally traces) the configured targets from
+// the router and reads the netwatch table. A failing target is reported in
+// its result rather than failing the collection; a netwatch table that
+// cannot be read fails it.
+func (c *Collector) collectProbes(ctx context.Context, client Backend, cfg ProbeConfig) (*ProbeResults, error) {
+	results := &ProbeResults{}
+
+	for _, target := range cfg.Targets {
+		ping, err := ping(ctx, client, target, cfg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			ping.Error = err.Error()
+		}
+		results.Ping = append(results.Ping, ping)
+
+		if cfg.Traceroute {
+			trace, err := traceroute(ctx, client, target, cfg)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				trace.Error = err.Error()
+			}
+			results.Traceroute = append(results.Traceroute, trace)
+		}
+	}
+
+	// Netwatch is skipped when the router does not know it
+	netwatch, err := runOptional(ctx, client, "/tool/netwatch/print")
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range netwatch {
+		results.Netwatch = append(results.Netwatch, parseNetwatchHost(n))
+	}
+
+	return results, nil
+}
+
+// probeArgs returns the arguments shared by /ping and /tool/traceroute.
+func probeArgs(target ProbeTarget) map[string]string {
+	args := map[string]string{"address": target.Address}
+	if target.SrcAddress != "" {
+		args["src-address"] = target.SrcAddress
+	}
+	if target.Interface != "" {
+		args["interface"] = target.Interface
+	}
+	if target.RoutingTable != "" {
+		args["routing-table"] = target.RoutingTable
+	}
+	return args
+}
+
+func ping(ctx context.Context, client Backend, target ProbeTarget, cfg ProbeConfig) (PingResult, error) {
+	args := probeArgs(target)
+	args["count"] = strconv.Itoa(cfg.Count)
+	if cfg.Interval > 0 {
+		args["interval"] = fmt.Sprintf("%dms", cfg.Interval.Milliseconds())
+	}
+
+	var replies []map[string]string
+	err := client.RunStream(ctx, "/ping", args, func(r map[string]string) error {
+		replies = append(replies, r)
+		return nil
+	})
+
+	result := parsePing(replies)
+	result.Target = SafeString(target.Name, target.Address)
+	result.Address = target.Address
+	return result, err
+}
+
+// parsePing computes ping statistics from the per-packet replies. RouterOS
+// sends one reply per sequence number, repeated with a status while it is
+// waiting; the last reply of each sequence wins.
+func parsePing(replies []map[string]string) PingResult {
+	bySeq := make(map[int]map[string]string)
+	var order []int
+	for _, r := range replies {
+		seq, err := strconv.Atoi(r["seq"])
+		if err != nil {
+			continue
+		}
+		if _, ok := bySeq[seq]; !ok {
+			order = append(order, seq)
+		}
+		bySeq[seq] = r
+	}
+
+	result := PingResult{Sent: len(order)}
+
+	var rtts []float64
+	for _, seq := range order {
+		r := bySeq[seq]
+		if r["status"] != "" || r["time"] == "" {
+			continue
+		}
+		rtts = append(rtts, parseRTT(r["time"]))
+	}
+	result.Received = len(rtts)
+
+	if result.Sent > 0 {
+		result.PacketLoss = float64(result.Sent-result.Received) / float64(result.Sent) * 100
+	}
+	result.MinRTTMs, result.AvgRTTMs, result.MaxRTTMs, result.JitterMs = rttStats(rtts)
+
+	return result
+}
+
+// rttStats returns the minimum, average, maximum and jitter of rtts.
+func rttStats(rtts []float64) (lo, avg, hi, jitter float64) {
+	if len(rtts) == 0 {
+		return 0, 0, 0, 0
+	}
+
+	lo, hi = rtts[0], rtts[0]
+	var sum, diffs float64
+	for i, rtt := range rtts {
+		sum += rtt
+		lo = math.Min(lo, rtt)
+		hi = math.Max(hi, rtt)
+		if i > 0 {
+			diffs += math.Abs(rtt - rtts[i-1])
+		}
+	}
+	avg = sum / float64(len(rtts))
+	if len(rtts) > 1 {
+		jitter = diffs / float64(len(rtts)-1)
+	}
+	return lo, avg, hi, jitter
+}
+
+// parseRTT parses a RouterOS round-trip time to milliseconds.
+func parseRTT(s string) float64 {
+	var ms float64
+	for _, m := range rttPattern.FindAllStringSubmatch(s, -1) {
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		switch m[2] {
+		case "s":
+			ms += value * 1000
+		case "ms":
+			ms += value
+		case "us":
+			ms += value / 1000
+		}
+	}
+	return ms
+}
+
+func traceroute(ctx context.Context, client Backend, target ProbeTarget, cfg ProbeConfig) (TracerouteResult, error) {
+	args := probeArgs(target)
+	args["count"] = "1"
+	if cfg.MaxHops > 0 {
+		args["max-hops"] = strconv.Itoa(cfg.MaxHops)
+	}
+
+	var replies []map[string]string
+	err := client.RunStream(ctx, "/tool/traceroute", args, func(r map[string]string) error {
+		replies = append(replies, r)
+		return nil
+	})
+
+	return TracerouteResult{
+		Target:  SafeString(target.Name, target.Address),
+		Address: target.Address,
+		Hops:    parseTraceroute(replies),
+	}, err
+}
+
+// parseTraceroute returns the hops of the last complete section. RouterOS
+// streams the whole hop table again each time it is updated, marking each
+// copy with a .section number.
+func parseTraceroute(replies []map[string]string) []TracerouteHop {
+	last := ""
+	for _, r := range replies {
+		last = r[".section"]
+	}
+
+	var hops []TracerouteHop
+	for _, r := range replies {
+		if r[".section"] != last {
+			continue
+		}
+		hops = append(hops, TracerouteHop{
+			Hop:        len(hops) + 1,
+			Address:    r["address"],
+			PacketLoss: ParseFloat64(strings.TrimSuffix(r["loss"], "%")),
+			Sent:       int(ParseInt64(r["sent"])),
+			LastRTTMs:  parseRTT(r["last"]),
+			AvgRTTMs:   parseRTT(r["avg"]),
+			BestRTTMs:  parseRTT(r["best"]),
+			WorstRTTMs: parseRTT(r["worst"]),
+			Status:     r["status"],
+		})
+	}
+	return hops
+}
+
+func parseNetwatchHost(n map[string]string) NetwatchHost {
+	return NetwatchHost{
+		Name:       n["name"],
+		Host:       n["host"],
+		Type:       n["type"],
+		Status:     n["status"],
+		Since:      ParseTimestamp(n["since"]),
+		Comment:    n["comment"],
+		RTTAvgMs:   parseRTT(n["rtt-avg"]),
+		RTTJitter:  parseRTT(n["rtt-jitter"]),
+		PacketLoss: ParseFloat64(strings.TrimSuffix(n["loss-percent"], "%")),
+		Disabled:   ParseBool(n["disabled"]),
+	}
+}
+
+// Metrics returns probe results as custom metrics, e.g.
+// probe_rtt_avg_ms{target="upstream"} and netwatch_up{host="10.0.0.1"}.
+func (p *ProbeResults) Metrics() map[string]float64 {
+	metrics := make(map[string]float64)
+	for _, r := range p.Ping {
+		if r.Error != "" && r.Sent == 0 {
+			continue
+		}
+		label := fmt.Sprintf("{target=%q}", r.Target)
+		metrics["probe_packet_loss_percent"+label] = r.PacketLoss
+		if r.Received > 0 {
+			metrics["probe_rtt_min_ms"+label] = r.MinRTTMs
+			metrics["probe_rtt_avg_ms"+label] = r.AvgRTTMs
+			metrics["probe_rtt_max_ms"+label] = r.MaxRTTMs
+			metrics["probe_jitter_ms"+label] = r.JitterMs
+		}
+	}
+	for _, t := range p.Traceroute {
+		if len(t.Hops) > 0 {
+			metrics[fmt.Sprintf("probe_hops{target=%q}", t.Target)] = float64(len(t.Hops))
+		}
+	}
+	for _, n := range p.Netwatch {
+		if n.Disabled || n.Status == "unknown" {
+			continue
+		}
+		up := 0.0
+		if n.Status == "up" {
+			up = 1
+		}
+		metrics[fmt.Sprintf("netwatch_up{host=%q}", SafeString(n.Name, n.Host))] = up
+	}
+	return metrics
+}
+
+// netwatchTracker remembers the netwatch states of each router to report
+// transitions.
+type netwatchTracker struct {
+	mu      sync.Mutex
+	routers map[string]map[string]string // Router -> host -> status
+}
+
+func newNetwatchTracker() *netwatchTracker {
+	return &netwatchTracker{
+		routers: make(map[string]map[string]string),
+	}
+}
+
+// update returns an event for every host whose status changed between up
+// and down since the previous poll. The first poll only records states.
+func (t *netwatchTracker) update(routerID string, hosts []NetwatchHost, now time.Time) []models.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, known := t.routers[routerID]
+	current := make(map[string]string, len(hosts))
+
+	var events []models.Event
+	for _, h := range hosts {
+		if h.Disabled || (h.Status != "up" && h.Status != "down") {
+			continue
+		}
+		key := SafeString(h.Name, h.Host)
+		current[key] = h.Status
+
+		old, ok := prev[key]
+		if !known || !ok || old == h.Status {
+			continue
+		}
+
+		severity := models.SeverityInfo
+		if h.Status == "down" {
+			severity = models.SeverityCritical
+		}
+		timestamp := now
+		if !h.Since.IsZero() {
+			timestamp = h.Since
+		}
+		events = append(events, models.Event{
+			Type:      EventNetwatchChange,
+			Severity:  severity,
+			Message:   fmt.Sprintf("Netwatch host %s is %s", key, h.Status),
+			Timestamp: timestamp,
+			Attributes: map[string]string{
+				"host":     h.Host,
+				"status":   h.Status,
+				"previous": old,
+				"comment":  h.Comment,
+			},
+		})
+	}
+
+	t.routers[routerID] = current
+	return events
+}
@@ -0,0 +1,143 @@
+package mikrotik
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func TestParseRTT(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"12ms", 12},
+		{"12ms345us", 12.345},
+		{"500us", 0.5},
+		{"1s2ms", 1002},
+		{"12.3ms", 12.3},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRTT(tt.input); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("parseRTT(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParsePing(t *testing.T) {
+	replies := []map[string]string{
+		{"seq": "0", "host": "1.1.1.1", "time": "10ms", "ttl": "58"},
+		{"seq": "1", "host": "1.1.1.1", "time": "14ms", "ttl": "58"},
+		{"seq": "2", "host": "1.1.1.1", "status": "timeout"},
+		{"seq": "3", "host": "1.1.1.1", "time": "12ms", "ttl": "58"},
+		// Status update repeated for the same sequence
+		{"seq": "3", "host": "1.1.1.1", "time": "12ms", "ttl": "58", "sent": "4", "received": "3"},
+	}
+
+	result := parsePing(replies)
+
+	if result.Sent != 4 || result.Received != 3 {
+		t.Fatalf("Sent/Received = %d/%d, want 4/3", result.Sent, result.Received)
+	}
+	if result.PacketLoss != 25 {
+		t.Errorf("PacketLoss = %v, want 25", result.PacketLoss)
+	}
+	if result.MinRTTMs != 10 || result.AvgRTTMs != 12 || result.MaxRTTMs != 14 {
+		t.Errorf("RTT = %v/%v/%v, want 10/12/14", result.MinRTTMs, result.AvgRTTMs, result.MaxRTTMs)
+	}
+	// |14-10| and |12-14|
+	if result.JitterMs != 3 {
+		t.Errorf("JitterMs = %v, want 3", result.JitterMs)
+	}
+
+	if empty := parsePing(nil); empty.Sent != 0 || empty.PacketLoss != 0 {
+		t.Errorf("parsePing(nil) = %+v", empty)
+	}
+}
+
+func TestParseTraceroute(t *testing.T) {
+	replies := []map[string]string{
+		{".section": "0", "address": "10.0.0.1", "loss": "0%", "sent": "1", "last": "1ms"},
+		{".section": "0", "address": "", "loss": "100%", "sent": "1", "status": "timeout"},
+		{".section": "1", "address": "10.0.0.1", "loss": "0%", "sent": "1", "last": "1ms", "avg": "1ms", "best": "1ms", "worst": "1ms"},
+		{".section": "1", "address": "", "loss": "100%", "sent": "1", "status": "timeout"},
+		{".section": "1", "address": "1.1.1.1", "loss": "0%", "sent": "1", "last": "12.5ms", "avg": "12.5ms"},
+	}
+
+	hops := parseTraceroute(replies)
+	if len(hops) != 3 {
+		t.Fatalf("got %d hops, want 3", len(hops))
+	}
+	if hops[2].Hop != 3 || hops[2].Address != "1.1.1.1" || hops[2].LastRTTMs != 12.5 {
+		t.Errorf("hop 3 = %+v", hops[2])
+	}
+	if hops[1].PacketLoss != 100 || hops[1].Address != "" {
+		t.Errorf("hop 2 = %+v", hops[1])
+	}
+}
+
+func TestProbeResults_Metrics(t *testing.T) {
+	results := &ProbeResults{
+		Ping: []PingResult{
+			{Target: "upstream", Sent: 5, Received: 5, AvgRTTMs: 12, JitterMs: 1},
+			{Target: "dead", Sent: 5, PacketLoss: 100},
+			{Target: "broken", Error: "invalid address"},
+		},
+		Netwatch: []NetwatchHost{
+			{Host: "10.0.0.1", Status: "up"},
+			{Name: "gw", Host: "10.0.0.2", Status: "down"},
+			{Host: "10.0.0.3", Status: "unknown"},
+		},
+	}
+
+	metrics := results.Metrics()
+
+	if metrics[`probe_rtt_avg_ms{target="upstream"}`] != 12 {
+		t.Errorf("metrics = %v", metrics)
+	}
+	if metrics[`probe_packet_loss_percent{target="dead"}`] != 100 {
+		t.Error("expected loss metric for unreachable target")
+	}
+	if _, ok := metrics[`probe_rtt_avg_ms{target="dead"}`]; ok {
+		t.Error("unexpected RTT metric for unreachable target")
+	}
+	if _, ok := metrics[`probe_packet_loss_percent{target="broken"}`]; ok {
+		t.Error("unexpected metric for failed probe")
+	}
+	if metrics[`netwatch_up{host="10.0.0.1"}`] != 1 || metrics[`netwatch_up{host="gw"}`] != 0 {
+		t.Errorf("netwatch metrics = %v", metrics)
+	}
+	if _, ok := metrics[`netwatch_up{host="10.0.0.3"}`]; ok {
+		t.Error("unexpected metric for unknown netwatch state")
+	}
+}
+
+func TestNetwatchTracker(t *testing.T) {
+	tracker := newNetwatchTracker()
+	now := time.Now()
+
+	hosts := []NetwatchHost{{Host: "10.0.0.1", Status: "up"}, {Host: "10.0.0.2", Status: "up"}}
+	if events := tracker.update("r1", hosts, now); len(events) != 0 {
+		t.Fatalf("first poll returned %d events, want 0", len(events))
+	}
+
+	hosts[1].Status = "down"
+	hosts = append(hosts, NetwatchHost{Host: "10.0.0.3", Status: "down"})
+	events := tracker.update("r1", hosts, now.Add(time.Minute))
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].Type != EventNetwatchChange || events[0].Severity != models.SeverityCritical || events[0].Attributes["host"] != "10.0.0.2" {
+		t.Errorf("event = %+v", events[0])
+	}
+
+	hosts[1].Status = "up"
+	events = tracker.update("r1", hosts, now.Add(2*time.Minute))
+	if len(events) != 1 || events[0].Severity != models.SeverityInfo {
+		t.Errorf("recovery events = %+v", events)
+	}
+}
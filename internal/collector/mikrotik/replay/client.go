@@ -0,0 +1,174 @@
+// Package replay implements a MikroTik backend that answers commands from
+// a recording made with api.ClientConfig.RecordFile, so that a capture from
+// a customer's router can be collected again and kept as a regression test.
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+// Client replays recorded exchanges. Each command is answered by the next
+// recorded exchange for it, preferring one with the same arguments; once
+// they are used up, the last one is repeated, so a capture of one poll can
+// be collected any number of times.
+type Client struct {
+	mu     sync.Mutex
+	queues map[string][]*api.Exchange
+	last   map[string]*api.Exchange
+}
+
+// NewClient creates a client replaying exchanges. Logins are skipped.
+func NewClient(exchanges []api.Exchange) *Client {
+	c := &Client{
+		queues: make(map[string][]*api.Exchange),
+		last:   make(map[string]*api.Exchange),
+	}
+	for i := range exchanges {
+		ex := &exchanges[i]
+		if ex.Command == "/login" {
+			continue
+		}
+		c.queues[ex.Command] = append(c.queues[ex.Command], ex)
+	}
+	return c
+}
+
+// Load creates a client replaying the recording file at path.
+func Load(path string) (*Client, error) {
+	exchanges, err := api.LoadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(exchanges), nil
+}
+
+// Connect does nothing; the recording is always available.
+func (c *Client) Connect(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing.
+func (c *Client) Close() error {
+	return nil
+}
+
+// Run replays a command and returns the records of the reply.
+func (c *Client) Run(ctx context.Context, command string, args map[string]string) ([]map[string]string, error) {
+	var result []map[string]string
+	err := c.RunStream(ctx, command, args, func(r map[string]string) error {
+		result = append(result, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunOne replays a command and returns the first record.
+func (c *Client) RunOne(ctx context.Context, command string, args map[string]string) (map[string]string, error) {
+	results, err := c.Run(ctx, command, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// RunStream replays a command and calls fn for every recorded record. A
+// recorded trap, fatal error or read error is returned as the API client
+// would return it. Commands missing from the recording fail with a trap,
+// as unknown menus do on a router.
+func (c *Client) RunStream(ctx context.Context, command string, args map[string]string, fn func(map[string]string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ex := c.next(command, args)
+	if ex == nil {
+		return api.NewTrapError(&api.Reply{
+			Type: "!trap",
+			Data: map[string]string{"message": "no such command prefix (not in recording)"},
+		})
+	}
+
+	var fnErr, trapErr error
+	for _, r := range ex.Replies {
+		reply := &api.Reply{Type: r.Type, Data: r.Data}
+		switch {
+		case reply.IsFatal():
+			return api.NewFatalError(reply)
+		case reply.IsTrap():
+			trapErr = api.NewTrapError(reply)
+		case reply.IsData():
+			if fnErr == nil && trapErr == nil {
+				fnErr = fn(copyRecord(r.Data))
+			}
+		case reply.IsDone():
+			if trapErr != nil {
+				return trapErr
+			}
+			return fnErr
+		}
+	}
+
+	if ex.Error != "" {
+		return api.NewProtocolError("failed to decode reply", errors.New(ex.Error))
+	}
+	return api.ErrConnectionClosed
+}
+
+// Ping replays the system resource command, as the API client does.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.RunOne(ctx, "/system/resource/print", nil)
+	return err
+}
+
+// next takes the exchange that answers command.
+func (c *Client) next(command string, args map[string]string) *api.Exchange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	queue := c.queues[command]
+	if len(queue) == 0 {
+		return c.last[command]
+	}
+
+	i := 0
+	for j, ex := range queue {
+		if sameArgs(ex.Args, args) {
+			i = j
+			break
+		}
+	}
+	ex := queue[i]
+	c.queues[command] = append(queue[:i:i], queue[i+1:]...)
+	c.last[command] = ex
+	return ex
+}
+
+func sameArgs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func copyRecord(data map[string]string) map[string]string {
+	record := make(map[string]string, len(data))
+	for k, v := range data {
+		record[k] = v
+	}
+	return record
+}
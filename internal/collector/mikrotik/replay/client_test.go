@@ -0,0 +1,84 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+const recording = `
+{"time":"2026-10-01T10:00:00Z","command":"/login","args":{"name":"<scrubbed>","password":"<scrubbed>"},"replies":[{"type":"!done"}]}
+{"time":"2026-10-01T10:00:00Z","command":"/system/resource/print","replies":[{"type":"!re","data":{"cpu-load":"7","version":"6.38.7 (bugfix)"}},{"type":"!done"}]}
+{"time":"2026-10-01T10:00:01Z","command":"/log/print","args":{".proplist":".id,time,topics,message"},"replies":[{"type":"!re","data":{".id":"*1","message":"first"}},{"type":"!done"}]}
+{"time":"2026-10-01T10:00:01Z","command":"/log/print","args":{"follow-only":"","from":"*1"},"replies":[{"type":"!re","data":{".id":"*2","message":"second"}},{"type":"!done"}]}
+{"time":"2026-10-01T10:00:02Z","command":"/ip/hotspot/print","replies":[{"type":"!trap","data":{"message":"no such command prefix"}},{"type":"!done"}]}
+{"time":"2026-10-01T10:00:02Z","command":"/ppp/active/print","replies":[{"type":"!re","data":{"name":"user1"}},{"type":"!fatal","data":{"message":"out of memory"}}]}
+{"time":"2026-10-01T10:00:03Z","command":"/ip/arp/print","replies":[{"type":"!re","data":{"address":"10.0.0.1"}}],"error":"failed to read word: EOF"}
+`
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	exchanges, err := api.ReadRecording(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("ReadRecording() error = %v", err)
+	}
+	return NewClient(exchanges)
+}
+
+func TestClient_Run(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	// A capture of one poll can be collected repeatedly
+	for i := 0; i < 2; i++ {
+		resource, err := client.RunOne(ctx, "/system/resource/print", nil)
+		if err != nil || resource["version"] != "6.38.7 (bugfix)" {
+			t.Errorf("RunOne() = %v, %v", resource, err)
+		}
+	}
+
+	// Exchanges with the same arguments are preferred over recorded order
+	logs, err := client.Run(ctx, "/log/print", map[string]string{"from": "*1", "follow-only": ""})
+	if err != nil || len(logs) != 1 || logs[0]["message"] != "second" {
+		t.Errorf("Run(from) = %v, %v", logs, err)
+	}
+	logs, err = client.Run(ctx, "/log/print", map[string]string{".proplist": ".id,time,topics,message", "count": "10"})
+	if err != nil || len(logs) != 1 || logs[0]["message"] != "first" {
+		t.Errorf("Run() = %v, %v", logs, err)
+	}
+
+	if err := client.Ping(ctx); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		command string
+		check   func(error) bool
+	}{
+		{"/ip/hotspot/print", api.IsTrapError},
+		{"/interface/wireless/print", api.IsTrapError},
+		{"/ppp/active/print", func(err error) bool {
+			var apiErr *api.APIError
+			return errors.As(err, &apiErr) && apiErr.Type == api.ErrTypeFatal
+		}},
+		{"/ip/arp/print", func(err error) bool { return err != nil && !api.IsTrapError(err) }},
+		{"/login", api.IsTrapError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			_, err := client.Run(ctx, tt.command, nil)
+			if !tt.check(err) {
+				t.Errorf("Run() error = %v", err)
+			}
+		})
+	}
+}
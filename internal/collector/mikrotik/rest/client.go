@@ -0,0 +1,308 @@
+// Package rest implements a client for the RouterOS 7 REST API, which
+// exposes the same menus and commands as the binary API over HTTPS. Replies
+// are returned as API records and errors as api.APIError.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+// ClientConfig contains REST API connection settings.
+type ClientConfig struct {
+	Address            string // host:port
+	Username           string
+	Password           string
+	UseTLS             bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	// RequestTimeout bounds a whole request, including reading the reply;
+	// it defaults to DefaultRequestTimeout.
+	RequestTimeout time.Duration
+}
+
+// DefaultRequestTimeout bounds a request that sets no RequestTimeout. It
+// leaves room for streaming large tables while a stalled reply still fails.
+const DefaultRequestTimeout = 2 * time.Minute
+
+// Client is a RouterOS REST API client.
+type Client struct {
+	config  *ClientConfig
+	baseURL string
+	http    *http.Client
+}
+
+// errorReply is the body of an unsuccessful REST reply, e.g.
+// {"error":400,"message":"Bad Request","detail":"no such command"}.
+type errorReply struct {
+	Error   int    `json:"error"`
+	Message string `json:"message"`
+	Detail  string `json:"detail"`
+}
+
+// NewClient creates a new REST API client.
+func NewClient(config *ClientConfig) *Client {
+	scheme := "http"
+	if config.UseTLS {
+		scheme = "https"
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	requestTimeout := config.RequestTimeout
+	if requestTimeout == 0 {
+		requestTimeout = DefaultRequestTimeout
+	}
+	// The timeout bounds connecting and waiting for a reply; reading it is
+	// only bounded by the longer request timeout, so large tables can be
+	// streamed
+	dialer := &net.Dialer{Timeout: timeout}
+	return &Client{
+		config:  config,
+		baseURL: scheme + "://" + config.Address + "/rest",
+		http: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: config.InsecureSkipVerify,
+				},
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     30 * time.Second,
+			},
+		},
+	}
+}
+
+// Connect verifies that the router is reachable and accepts the
+// credentials. The REST API is stateless, so no connection is kept.
+func (c *Client) Connect(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/system/identity", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Close releases idle connections.
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// Run executes an API command, such as "/interface/print", and returns the
+// records of the reply.
+func (c *Client) Run(ctx context.Context, command string, args map[string]string) ([]map[string]string, error) {
+	var result []map[string]string
+	err := c.RunStream(ctx, command, args, func(r map[string]string) error {
+		result = append(result, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RunOne executes a command and returns the first record.
+func (c *Client) RunOne(ctx context.Context, command string, args map[string]string) (map[string]string, error) {
+	results, err := c.Run(ctx, command, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0], nil
+}
+
+// RunStream executes a command and calls fn for every record as it is
+// decoded, without buffering the whole reply. Commands are sent as POST
+// requests with the arguments as a JSON object; .proplist may be given
+// comma-separated, as for the binary API.
+func (c *Client) RunStream(ctx context.Context, command string, args map[string]string, fn func(map[string]string) error) error {
+	body := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if k == ".proplist" {
+			body[k] = strings.Split(v, ",")
+			continue
+		}
+		body[k] = v
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, command, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := decodeRecords(resp.Body, fn); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isTimeout(err) {
+			return api.NewTimeoutError(fmt.Sprintf("reading the reply to %s timed out", command))
+		}
+		return err
+	}
+	return nil
+}
+
+// Ping sends a test command to verify the connection is alive.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.RunOne(ctx, "/system/resource/print", nil)
+	return err
+}
+
+// do sends a request and maps unsuccessful replies to API errors.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, api.NewProtocolError("failed to encode request", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, api.NewConnectionError("invalid request", err)
+	}
+	req.SetBasicAuth(c.config.Username, c.config.Password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if isTimeout(err) {
+			return nil, api.NewTimeoutError(fmt.Sprintf("%s %s timed out", method, path))
+		}
+		return nil, api.NewConnectionError("request failed", err)
+	}
+
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, replyError(resp)
+}
+
+// isTimeout reports whether err is a network or request timeout.
+func isTimeout(err error) bool {
+	var netErr interface{ Timeout() bool }
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// replyError converts an unsuccessful reply to an API error: 401 is an
+// authentication failure, other RouterOS errors are traps.
+func replyError(resp *http.Response) error {
+	var reply errorReply
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := json.Unmarshal(data, &reply); err != nil || reply.Message == "" {
+		reply.Message = http.StatusText(resp.StatusCode)
+	}
+
+	message := reply.Message
+	if reply.Detail != "" {
+		message = reply.Detail
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return api.NewAuthError("authentication failed: " + message)
+	case resp.StatusCode >= 500 && reply.Detail == "":
+		return api.NewConnectionError("server error", fmt.Errorf("%d %s", resp.StatusCode, message))
+	default:
+		return api.NewTrapError(&api.Reply{
+			Type: "!trap",
+			Data: map[string]string{"message": message},
+		})
+	}
+}
+
+// decodeRecords decodes a reply body, which is an array of objects, a
+// single object for menus without items, or empty for commands without
+// output. Values are converted to the strings the binary API returns.
+func decodeRecords(r io.Reader, fn func(map[string]string) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return api.NewProtocolError("failed to decode reply", err)
+	}
+
+	switch tok {
+	case json.Delim('['):
+		for dec.More() {
+			var obj map[string]interface{}
+			if err := dec.Decode(&obj); err != nil {
+				return api.NewProtocolError("failed to decode reply", err)
+			}
+			if err := fn(toRecord(obj)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case json.Delim('{'):
+		obj := make(map[string]interface{})
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return api.NewProtocolError("failed to decode reply", err)
+			}
+			var value interface{}
+			if err := dec.Decode(&value); err != nil {
+				return api.NewProtocolError("failed to decode reply", err)
+			}
+			obj[fmt.Sprint(keyTok)] = value
+		}
+		return fn(toRecord(obj))
+	default:
+		return api.NewProtocolError("unexpected reply", fmt.Errorf("%v", tok))
+	}
+}
+
+func toRecord(obj map[string]interface{}) map[string]string {
+	record := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case string:
+			record[k] = v
+		case bool:
+			record[k] = strconv.FormatBool(v)
+		case json.Number:
+			record[k] = v.String()
+		case nil:
+		default:
+			data, _ := json.Marshal(v)
+			record[k] = string(data)
+		}
+	}
+	return record
+}
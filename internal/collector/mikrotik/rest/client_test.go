@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
+)
+
+// newTestRouter serves a small RouterOS REST API with basic auth.
+func newTestRouter(t *testing.T) (*httptest.Server, *[]map[string]interface{}) {
+	t.Helper()
+	var bodies []map[string]interface{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/system/identity", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"core-01"}`))
+	})
+	mux.HandleFunc("POST /rest/system/resource/print", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"cpu-load":"7","free-memory":"209715200","total-memory":"1073741824","uptime":"1w2d","version":"7.14 (stable)"}]`))
+	})
+	mux.HandleFunc("POST /rest/interface/print", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Write([]byte(`[
+			{".id":"*1","name":"ether1","running":"true","rx-byte":"1000","mtu":1500},
+			{".id":"*2","name":"ether2","running":"false","disabled":true,"comment":null}
+		]`))
+	})
+	mux.HandleFunc("POST /rest/ping", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		w.Write([]byte(`[{"seq":"0","host":"192.0.2.1","time":"1ms"},{"seq":"1","host":"192.0.2.1","status":"timeout"}]`))
+	})
+	mux.HandleFunc("POST /rest/file/remove", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("POST /rest/ip/hotspot/print", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":400,"message":"Bad Request","detail":"no such command or directory (hotspot)"}`))
+	})
+	mux.HandleFunc("POST /rest/system/reboot", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":401,"message":"Unauthorized"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &bodies
+}
+
+func newTestClient(srv *httptest.Server, password string) *Client {
+	return NewClient(&ClientConfig{
+		Address:            strings.TrimPrefix(srv.URL, "https://"),
+		Username:           "admin",
+		Password:           password,
+		UseTLS:             true,
+		InsecureSkipVerify: true,
+		Timeout:            2 * time.Second,
+	})
+}
+
+func TestClient_Run(t *testing.T) {
+	srv, bodies := newTestRouter(t)
+	client := newTestClient(srv, "secret")
+	ctx := context.Background()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	resource, err := client.RunOne(ctx, "/system/resource/print", nil)
+	if err != nil || resource["cpu-load"] != "7" || resource["version"] != "7.14 (stable)" {
+		t.Errorf("RunOne() = %v, %v", resource, err)
+	}
+
+	interfaces, err := client.Run(ctx, "/interface/print", map[string]string{".proplist": "name,running"})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(interfaces) != 2 || interfaces[0]["mtu"] != "1500" || interfaces[1]["disabled"] != "true" {
+		t.Errorf("interfaces = %v", interfaces)
+	}
+	if _, ok := interfaces[1]["comment"]; ok {
+		t.Error("null values should be left out")
+	}
+	if proplist, _ := (*bodies)[0][".proplist"].([]interface{}); len(proplist) != 2 {
+		t.Errorf(".proplist sent as %v, want a list", (*bodies)[0][".proplist"])
+	}
+
+	removed, err := client.Run(ctx, "/file/remove", map[string]string{"numbers": "x.rsc"})
+	if err != nil || len(removed) != 0 {
+		t.Errorf("Run(/file/remove) = %v, %v", removed, err)
+	}
+}
+
+func TestClient_RunStream(t *testing.T) {
+	srv, bodies := newTestRouter(t)
+	client := newTestClient(srv, "secret")
+
+	var seqs []string
+	err := client.RunStream(context.Background(), "/ping", map[string]string{"address": "192.0.2.1", "count": "2"}, func(r map[string]string) error {
+		seqs = append(seqs, r["seq"])
+		return nil
+	})
+	if err != nil || len(seqs) != 2 {
+		t.Errorf("RunStream() = %v, %v", seqs, err)
+	}
+	if (*bodies)[0]["address"] != "192.0.2.1" || (*bodies)[0]["count"] != "2" {
+		t.Errorf("ping arguments = %v", (*bodies)[0])
+	}
+
+	stop := errors.New("stop")
+	err = client.RunStream(context.Background(), "/ping", nil, func(map[string]string) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("RunStream() error = %v, want the callback's error", err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	srv, _ := newTestRouter(t)
+	ctx := context.Background()
+
+	err := newTestClient(srv, "wrong").Connect(ctx)
+	if !api.IsAuthError(err) {
+		t.Errorf("Connect(wrong password) error = %v, want auth error", err)
+	}
+
+	client := newTestClient(srv, "secret")
+	_, err = client.Run(ctx, "/ip/hotspot/print", nil)
+	var apiErr *api.APIError
+	if !api.IsTrapError(err) || !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "no such command") {
+		t.Errorf("Run(unknown menu) error = %v, want trap", err)
+	}
+
+	_, err = client.Run(ctx, "/system/reboot", nil)
+	if !api.IsConnectionError(err) {
+		t.Errorf("Run(server error) error = %v, want connection error", err)
+	}
+
+	srv.Close()
+	if err := client.Ping(ctx); !api.IsConnectionError(err) {
+		t.Errorf("Ping(closed server) error = %v, want connection error", err)
+	}
+}
+
+func TestClient_StalledReply(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `[{".id":"*1","name":"ether1"},`)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewClient(&ClientConfig{
+		Address:        strings.TrimPrefix(srv.URL, "http://"),
+		Username:       "admin",
+		Timeout:        time.Second,
+		RequestTimeout: 100 * time.Millisecond,
+	})
+	start := time.Now()
+	_, err := client.Run(context.Background(), "/interface/print", nil)
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != api.ErrTypeTimeout {
+		t.Errorf("Run(stalled reply) error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run(stalled reply) took %v", elapsed)
+	}
+}
@@ -3,7 +3,6 @@ package mikrotik
 import (
 	"context"
 
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/api"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
 )
 
@@ -24,7 +23,7 @@ type SystemMetrics struct {
 }
 
 // collectSystem collects system resource metrics from the router.
-func (c *Collector) collectSystem(ctx context.Context, client *api.Client) (*SystemMetrics, error) {
+func (c *Collector) collectSystem(ctx context.Context, client Backend) (*SystemMetrics, error) {
 	metrics := &SystemMetrics{}
 
 	// Get system resource info
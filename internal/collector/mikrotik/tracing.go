@@ -0,0 +1,98 @@
+package mikrotik
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer of router sessions. Spans go to the global
+// tracer provider, which does nothing unless tracing is set up.
+const tracerName = "github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+
+// tracedBackend wraps a backend in spans: one for connecting and one for
+// every command, so slow logins and slow menus show up in traces.
+type tracedBackend struct {
+	Backend
+	attrs []attribute.KeyValue
+}
+
+// tracedExporter is a tracedBackend whose backend exports configurations
+// directly.
+type tracedExporter struct {
+	*tracedBackend
+	exporter exporter
+}
+
+// traceBackend wraps client in spans carrying the router ID and backend.
+func traceBackend(client Backend, routerID, backend string) Backend {
+	t := &tracedBackend{
+		Backend: client,
+		attrs: []attribute.KeyValue{
+			attribute.String("router.id", routerID),
+			attribute.String("routeros.backend", backend),
+		},
+	}
+	if e, ok := client.(exporter); ok {
+		return &tracedExporter{tracedBackend: t, exporter: e}
+	}
+	return t
+}
+
+func (t *tracedBackend) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.attrs...), trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *tracedBackend) Connect(ctx context.Context) error {
+	ctx, span := t.start(ctx, "routeros.connect")
+	err := t.Backend.Connect(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedBackend) Run(ctx context.Context, command string, args map[string]string) ([]map[string]string, error) {
+	ctx, span := t.start(ctx, command, attribute.String("routeros.command", command))
+	records, err := t.Backend.Run(ctx, command, args)
+	span.SetAttributes(attribute.Int("routeros.records", len(records)))
+	endSpan(span, err)
+	return records, err
+}
+
+func (t *tracedBackend) RunOne(ctx context.Context, command string, args map[string]string) (map[string]string, error) {
+	ctx, span := t.start(ctx, command, attribute.String("routeros.command", command))
+	record, err := t.Backend.RunOne(ctx, command, args)
+	endSpan(span, err)
+	return record, err
+}
+
+func (t *tracedBackend) RunStream(ctx context.Context, command string, args map[string]string, fn func(map[string]string) error) error {
+	ctx, span := t.start(ctx, command, attribute.String("routeros.command", command))
+	records := 0
+	err := t.Backend.RunStream(ctx, command, args, func(record map[string]string) error {
+		records++
+		return fn(record)
+	})
+	span.SetAttributes(attribute.Int("routeros.records", records))
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedExporter) Export(ctx context.Context, args map[string]string) (string, error) {
+	ctx, span := t.start(ctx, "/export", attribute.String("routeros.command", "/export"))
+	export, err := t.exporter.Export(ctx, args)
+	endSpan(span, err)
+	return export, err
+}
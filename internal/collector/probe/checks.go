@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// probeTCP measures the time to establish a TCP connection.
+func probeTCP(ctx context.Context, address string, opts TCPOptions) Result {
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(opts.Port)))
+	if err != nil {
+		return Result{Err: err}
+	}
+	elapsed := time.Since(start)
+	conn.Close()
+
+	return Result{Success: true, Duration: elapsed}
+}
+
+// probeHTTP requests the URL and checks the status code. For HTTPS the
+// remaining certificate lifetime is reported as well.
+func probeHTTP(ctx context.Context, address string, opts HTTPOptions) Result {
+	url := opts.URL
+	if url == "" {
+		url = "http://" + net.JoinHostPort(address, "80") + "/"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Result{Err: err}
+	}
+	req.Header.Set("User-Agent", "ISPVisualMonitor-Agent probe")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	elapsed := time.Since(start)
+
+	result := Result{
+		Duration: elapsed,
+		Metrics: map[string]float64{
+			"probe_http_status_code": float64(resp.StatusCode),
+		},
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		expiry := resp.TLS.PeerCertificates[0].NotAfter
+		result.Metrics["probe_tls_cert_expiry_seconds"] = time.Until(expiry).Seconds()
+	}
+
+	if statusAccepted(resp.StatusCode, opts.ExpectStatus) {
+		result.Success = true
+	} else {
+		result.Err = fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return result
+}
+
+func statusAccepted(code int, expect []int) bool {
+	if len(expect) == 0 {
+		return code >= 200 && code < 400
+	}
+	return slices.Contains(expect, code)
+}
+
+// probeDNS resolves the name through the system resolver or opts.Server.
+func probeDNS(ctx context.Context, address string, opts DNSOptions) Result {
+	name := opts.Name
+	if name == "" {
+		name = address
+	}
+
+	resolver := net.DefaultResolver
+	if opts.Server != "" {
+		server := opts.Server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	start := time.Now()
+	addrs, err := resolver.LookupHost(ctx, name)
+	elapsed := time.Since(start)
+	if err != nil {
+		return Result{Duration: elapsed, Err: err}
+	}
+
+	result := Result{
+		Success:  true,
+		Duration: elapsed,
+		Metrics: map[string]float64{
+			"probe_dns_answers": float64(len(addrs)),
+		},
+	}
+	if len(opts.Expect) > 0 && !slices.ContainsFunc(addrs, func(a string) bool {
+		return slices.Contains(opts.Expect, a)
+	}) {
+		result.Success = false
+		result.Err = fmt.Errorf("%s resolved to %v, expected one of %v", name, addrs, opts.Expect)
+	}
+	return result
+}
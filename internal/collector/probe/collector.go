@@ -0,0 +1,283 @@
+// Package probe implements a collector that checks targets from the agent
+// host itself with ICMP, TCP, HTTP and DNS probes.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Check names.
+const (
+	CheckICMP = "icmp"
+	CheckTCP  = "tcp"
+	CheckHTTP = "http"
+	CheckDNS  = "dns"
+)
+
+// Probe event types.
+const (
+	EventProbeFailed    = "probe_failed"
+	EventProbeRecovered = "probe_recovered"
+)
+
+// Target describes the checks run against a router entry of type "probe",
+// read from its metadata.
+type Target struct {
+	Checks  []string      `yaml:"checks"`
+	Timeout time.Duration `yaml:"timeout"`
+	ICMP    ICMPOptions   `yaml:"icmp"`
+	TCP     TCPOptions    `yaml:"tcp"`
+	HTTP    HTTPOptions   `yaml:"http"`
+	DNS     DNSOptions    `yaml:"dns"`
+}
+
+// ICMPOptions configures the ICMP echo check.
+type ICMPOptions struct {
+	Count    int           `yaml:"count"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// TCPOptions configures the TCP connect check.
+type TCPOptions struct {
+	Port int `yaml:"port"`
+}
+
+// HTTPOptions configures the HTTP(S) check.
+type HTTPOptions struct {
+	// URL defaults to http://<address>/
+	URL string `yaml:"url"`
+	// ExpectStatus lists accepted status codes; empty accepts 200-399
+	ExpectStatus       []int `yaml:"expect_status,omitempty"`
+	InsecureSkipVerify bool  `yaml:"insecure_skip_verify"`
+}
+
+// DNSOptions configures the DNS resolution check.
+type DNSOptions struct {
+	// Name is resolved; it defaults to the target address
+	Name string `yaml:"name"`
+	// Server is queried instead of the system resolver, e.g. "10.0.0.53:53"
+	Server string `yaml:"server,omitempty"`
+	// Expect lists addresses of which at least one must be returned
+	Expect []string `yaml:"expect,omitempty"`
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Check    string
+	Success  bool
+	Duration time.Duration
+	Metrics  map[string]float64 // Check-specific values, without labels
+	Err      error
+}
+
+// Collector runs probes from the agent host.
+type Collector struct {
+	name   string
+	states *stateTracker
+}
+
+// NewCollector creates a new probe collector.
+func NewCollector() collector.Collector {
+	return NewProbeCollector()
+}
+
+// NewProbeCollector creates a new probe collector.
+func NewProbeCollector() *Collector {
+	return &Collector{
+		name:   "probe",
+		states: newStateTracker(),
+	}
+}
+
+// Name returns the collector name.
+func (c *Collector) Name() string {
+	return c.name
+}
+
+// Type returns the router type.
+func (c *Collector) Type() string {
+	return "probe"
+}
+
+// Collect runs the configured checks against the target. Failing checks are
+// reported in the metrics; only an invalid target configuration is an error.
+func (c *Collector) Collect(ctx context.Context, router *models.RouterConfig) (*models.MetricsData, error) {
+	target, err := ParseTarget(router)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &models.MetricsData{
+		RouterID:      router.ID,
+		Timestamp:     time.Now(),
+		CustomMetrics: make(map[string]float64),
+	}
+
+	for _, check := range target.Checks {
+		result := c.run(ctx, check, router.Address, target)
+
+		label := fmt.Sprintf("{check=%q}", check)
+		success := 0.0
+		if result.Success {
+			success = 1
+		}
+		data.CustomMetrics["probe_success"+label] = success
+		if result.Duration > 0 {
+			data.CustomMetrics["probe_duration_ms"+label] = float64(result.Duration.Microseconds()) / 1000
+		}
+		for name, value := range result.Metrics {
+			data.CustomMetrics[name+label] = value
+		}
+
+		if event := c.states.update(router.ID, result, data.Timestamp); event != nil {
+			data.Events = append(data.Events, *event)
+		}
+	}
+
+	return data, nil
+}
+
+func (c *Collector) run(ctx context.Context, check, address string, target *Target) Result {
+	timeout := target.Timeout
+	if check == CheckICMP {
+		timeout = time.Duration(target.ICMP.Count) * (target.Timeout + target.ICMP.Interval)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var result Result
+	switch check {
+	case CheckICMP:
+		result = probeICMP(ctx, address, target.ICMP, target.Timeout)
+	case CheckTCP:
+		result = probeTCP(ctx, address, target.TCP)
+	case CheckHTTP:
+		result = probeHTTP(ctx, address, target.HTTP)
+	case CheckDNS:
+		result = probeDNS(ctx, address, target.DNS)
+	}
+	result.Check = check
+	return result
+}
+
+// HealthCheck verifies the target configuration and that the address
+// resolves.
+func (c *Collector) HealthCheck(ctx context.Context, router *models.RouterConfig) error {
+	if _, err := ParseTarget(router); err != nil {
+		return err
+	}
+	if _, err := net.DefaultResolver.LookupHost(ctx, router.Address); err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", router.Address, err)
+	}
+	return nil
+}
+
+// ParseTarget reads the probe target from the router metadata and applies
+// defaults. Without checks, the target is pinged.
+func ParseTarget(router *models.RouterConfig) (*Target, error) {
+	if router.Address == "" {
+		return nil, fmt.Errorf("probe address is required")
+	}
+
+	target := &Target{}
+	if len(router.Metadata) > 0 {
+		// Metadata is decoded generically with the rest of the configuration
+		raw, err := yaml.Marshal(router.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe metadata: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, target); err != nil {
+			return nil, fmt.Errorf("invalid probe metadata: %w", err)
+		}
+	}
+
+	if len(target.Checks) == 0 {
+		target.Checks = []string{CheckICMP}
+	}
+	if target.Timeout == 0 {
+		target.Timeout = 2 * time.Second
+	}
+	if target.ICMP.Count == 0 {
+		target.ICMP.Count = 5
+	}
+	if target.ICMP.Interval == 0 {
+		target.ICMP.Interval = 200 * time.Millisecond
+	}
+
+	for i, check := range target.Checks {
+		check = strings.ToLower(check)
+		target.Checks[i] = check
+		switch check {
+		case CheckICMP, CheckHTTP, CheckDNS:
+		case CheckTCP:
+			if target.TCP.Port <= 0 || target.TCP.Port > 65535 {
+				return nil, fmt.Errorf("tcp check requires a port")
+			}
+		default:
+			return nil, fmt.Errorf("unknown probe check: %s", check)
+		}
+	}
+
+	return target, nil
+}
+
+// stateTracker remembers which checks of each target were failing to
+// report failures and recoveries once.
+type stateTracker struct {
+	mu      sync.Mutex
+	failing map[string]bool // Router ID + check
+}
+
+func newStateTracker() *stateTracker {
+	return &stateTracker{
+		failing: make(map[string]bool),
+	}
+}
+
+func (t *stateTracker) update(routerID string, result Result, now time.Time) *models.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := routerID + "|" + result.Check
+	wasFailing := t.failing[key]
+
+	switch {
+	case !result.Success && !wasFailing:
+		t.failing[key] = true
+		message := fmt.Sprintf("%s probe failed", result.Check)
+		if result.Err != nil {
+			message = fmt.Sprintf("%s probe failed: %v", result.Check, result.Err)
+		}
+		return &models.Event{
+			Type:      EventProbeFailed,
+			Severity:  models.SeverityCritical,
+			Message:   message,
+			Timestamp: now,
+			Attributes: map[string]string{
+				"check": result.Check,
+			},
+		}
+	case result.Success && wasFailing:
+		delete(t.failing, key)
+		return &models.Event{
+			Type:      EventProbeRecovered,
+			Severity:  models.SeverityInfo,
+			Message:   fmt.Sprintf("%s probe recovered", result.Check),
+			Timestamp: now,
+			Attributes: map[string]string{
+				"check": result.Check,
+			},
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseTarget(t *testing.T) {
+	var router models.RouterConfig
+	err := yaml.Unmarshal([]byte(`
+id: probe-1
+type: probe
+address: example.net
+metadata:
+  checks: [ICMP, tcp, http]
+  timeout: 500ms
+  tcp:
+    port: 443
+  http:
+    url: https://example.net/health
+    expect_status: [200, 204]
+`), &router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := ParseTarget(&router)
+	if err != nil {
+		t.Fatalf("ParseTarget() error = %v", err)
+	}
+	if len(target.Checks) != 3 || target.Checks[0] != CheckICMP {
+		t.Errorf("Checks = %v", target.Checks)
+	}
+	if target.Timeout != 500*time.Millisecond || target.TCP.Port != 443 {
+		t.Errorf("Timeout/Port = %v/%d", target.Timeout, target.TCP.Port)
+	}
+	if target.HTTP.URL != "https://example.net/health" || len(target.HTTP.ExpectStatus) != 2 {
+		t.Errorf("HTTP = %+v", target.HTTP)
+	}
+	if target.ICMP.Count != 5 || target.ICMP.Interval != 200*time.Millisecond {
+		t.Errorf("ICMP defaults = %+v", target.ICMP)
+	}
+}
+
+func TestParseTarget_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		router models.RouterConfig
+	}{
+		{"no address", models.RouterConfig{}},
+		{"tcp without port", models.RouterConfig{Address: "10.0.0.1", Metadata: map[string]interface{}{"checks": []interface{}{"tcp"}}}},
+		{"unknown check", models.RouterConfig{Address: "10.0.0.1", Metadata: map[string]interface{}{"checks": []interface{}{"smtp"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTarget(&tt.router); err == nil {
+				t.Error("ParseTarget() expected error")
+			}
+		})
+	}
+
+	target, err := ParseTarget(&models.RouterConfig{Address: "10.0.0.1"})
+	if err != nil || len(target.Checks) != 1 || target.Checks[0] != CheckICMP {
+		t.Errorf("default checks = %v, %v", target, err)
+	}
+}
+
+func TestProbeTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if result := probeTCP(ctx, "127.0.0.1", TCPOptions{Port: port}); !result.Success || result.Err != nil {
+		t.Errorf("probeTCP() = %+v, want success", result)
+	}
+
+	ln.Close()
+	if result := probeTCP(ctx, "127.0.0.1", TCPOptions{Port: port}); result.Success || result.Err == nil {
+		t.Errorf("probeTCP() on closed port = %+v, want failure", result)
+	}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	result := probeHTTP(ctx, "", HTTPOptions{URL: srv.URL + "/", InsecureSkipVerify: true})
+	if !result.Success {
+		t.Fatalf("probeHTTP() = %+v, want success", result)
+	}
+	if result.Metrics["probe_http_status_code"] != 200 || result.Metrics["probe_tls_cert_expiry_seconds"] <= 0 {
+		t.Errorf("Metrics = %v", result.Metrics)
+	}
+
+	result = probeHTTP(ctx, "", HTTPOptions{URL: srv.URL + "/down", InsecureSkipVerify: true})
+	if result.Success || result.Metrics["probe_http_status_code"] != 503 {
+		t.Errorf("probeHTTP(/down) = %+v, want failure with 503", result)
+	}
+
+	result = probeHTTP(ctx, "", HTTPOptions{URL: srv.URL + "/down", InsecureSkipVerify: true, ExpectStatus: []int{503}})
+	if !result.Success {
+		t.Errorf("probeHTTP(/down) with expected 503 = %+v, want success", result)
+	}
+
+	// The test certificate is not trusted
+	if result := probeHTTP(ctx, "", HTTPOptions{URL: srv.URL + "/"}); result.Success {
+		t.Error("probeHTTP() with untrusted certificate succeeded")
+	}
+}
+
+func TestProbeDNS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if result := probeDNS(ctx, "localhost", DNSOptions{}); !result.Success {
+		t.Errorf("probeDNS(localhost) = %+v, want success", result)
+	}
+	if result := probeDNS(ctx, "localhost", DNSOptions{Expect: []string{"192.0.2.1"}}); result.Success {
+		t.Error("probeDNS() with unexpected answer succeeded")
+	}
+}
+
+func TestICMPResult(t *testing.T) {
+	result := icmpResult(4, []time.Duration{10 * time.Millisecond, 14 * time.Millisecond, 12 * time.Millisecond})
+
+	if !result.Success {
+		t.Fatal("expected success")
+	}
+	want := map[string]float64{
+		"probe_packet_loss_percent": 25,
+		"probe_rtt_min_ms":          10,
+		"probe_rtt_avg_ms":          12,
+		"probe_rtt_max_ms":          14,
+		"probe_jitter_ms":           3,
+	}
+	for name, value := range want {
+		if result.Metrics[name] != value {
+			t.Errorf("%s = %v, want %v", name, result.Metrics[name], value)
+		}
+	}
+
+	if lost := icmpResult(3, nil); lost.Success || lost.Metrics["probe_packet_loss_percent"] != 100 {
+		t.Errorf("icmpResult(3, nil) = %+v", lost)
+	}
+}
+
+func TestCollect_Events(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	c := NewProbeCollector()
+	router := &models.RouterConfig{
+		ID:      "probe-1",
+		Type:    "probe",
+		Address: "127.0.0.1",
+		Metadata: map[string]interface{}{
+			"checks": []interface{}{"tcp"},
+			"tcp":    map[string]interface{}{"port": port},
+		},
+	}
+	label := `{check="tcp"}`
+
+	data, err := c.Collect(context.Background(), router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.CustomMetrics["probe_success"+label] != 1 || len(data.Events) != 0 {
+		t.Errorf("up: metrics = %v, events = %v", data.CustomMetrics, data.Events)
+	}
+
+	ln.Close()
+	for i := 0; i < 2; i++ {
+		data, _ = c.Collect(context.Background(), router)
+		if data.CustomMetrics["probe_success"+label] != 0 {
+			t.Errorf("down: probe_success = %v", data.CustomMetrics["probe_success"+label])
+		}
+		wantEvents := 0
+		if i == 0 {
+			wantEvents = 1
+		}
+		if len(data.Events) != wantEvents {
+			t.Fatalf("poll %d: got %d events, want %d", i, len(data.Events), wantEvents)
+		}
+	}
+	ln, err = net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Skipf("port %d no longer available: %v", port, err)
+	}
+	defer ln.Close()
+
+	data, _ = c.Collect(context.Background(), router)
+	if len(data.Events) != 1 || data.Events[0].Type != EventProbeRecovered {
+		t.Errorf("recovery events = %+v", data.Events)
+	}
+}
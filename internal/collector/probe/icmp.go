@@ -0,0 +1,169 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Protocol numbers for icmp.ParseMessage.
+const (
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// probeICMP sends opts.Count echo requests one after another and reports
+// round-trip times, jitter and loss.
+//
+// Unprivileged ICMP datagram sockets are used, so the agent does not need
+// root or CAP_NET_RAW; the agent's group must be allowed by the
+// net.ipv4.ping_group_range sysctl instead.
+func probeICMP(ctx context.Context, address string, opts ICMPOptions, timeout time.Duration) Result {
+	ip, err := resolveIP(ctx, address)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	network, listen, echoType := "udp4", "0.0.0.0", icmp.Type(ipv4.ICMPTypeEcho)
+	protocol := protocolICMP
+	if ip.To4() == nil {
+		network, listen, echoType = "udp6", "::", ipv6.ICMPTypeEchoRequest
+		protocol = protocolICMPv6
+	}
+
+	conn, err := icmp.ListenPacket(network, listen)
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to open ICMP socket (check net.ipv4.ping_group_range): %w", err)}
+	}
+	defer conn.Close()
+
+	// The kernel replaces the identifier on datagram sockets, so replies are
+	// matched by sequence number and a random payload
+	token := make([]byte, 16)
+	rand.Read(token)
+
+	var rtts []time.Duration
+	sent := 0
+	for seq := 0; seq < opts.Count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(opts.Interval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		rtt, err := echo(ctx, conn, &net.UDPAddr{IP: ip}, echoType, protocol, seq, token, timeout)
+		sent++
+		if err == nil {
+			rtts = append(rtts, rtt)
+		}
+	}
+
+	return icmpResult(sent, rtts)
+}
+
+// echo sends one echo request and waits for its reply.
+func echo(ctx context.Context, conn *icmp.PacketConn, dst net.Addr, echoType icmp.Type, protocol, seq int, token []byte, timeout time.Duration) (time.Duration, error) {
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: seq, Data: token},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		reply, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil {
+			continue
+		}
+		if body, ok := reply.Body.(*icmp.Echo); ok && body.Seq == seq && bytes.Equal(body.Data, token) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// icmpResult computes loss and round-trip statistics.
+func icmpResult(sent int, rtts []time.Duration) Result {
+	result := Result{
+		Success: len(rtts) > 0,
+		Metrics: make(map[string]float64),
+	}
+	if sent > 0 {
+		result.Metrics["probe_packet_loss_percent"] = float64(sent-len(rtts)) / float64(sent) * 100
+	}
+	if len(rtts) == 0 {
+		result.Err = fmt.Errorf("no reply to %d echo requests", sent)
+		return result
+	}
+
+	lo, hi := math.MaxFloat64, 0.0
+	var sum, diffs float64
+	for i, rtt := range rtts {
+		ms := float64(rtt.Microseconds()) / 1000
+		sum += ms
+		lo = math.Min(lo, ms)
+		hi = math.Max(hi, ms)
+		if i > 0 {
+			diffs += math.Abs(ms - float64(rtts[i-1].Microseconds())/1000)
+		}
+	}
+	avg := sum / float64(len(rtts))
+
+	result.Duration = time.Duration(avg * float64(time.Millisecond))
+	result.Metrics["probe_rtt_min_ms"] = lo
+	result.Metrics["probe_rtt_avg_ms"] = avg
+	result.Metrics["probe_rtt_max_ms"] = hi
+	if len(rtts) > 1 {
+		result.Metrics["probe_jitter_ms"] = diffs / float64(len(rtts)-1)
+	}
+	return result
+}
+
+func resolveIP(ctx context.Context, address string) (net.IP, error) {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip, nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", address)
+	if err != nil {
+		return nil, err
+	}
+	// Prefer IPv4, which every host can reach
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip, nil
+		}
+	}
+	return ips[0], nil
+}
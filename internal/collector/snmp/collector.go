@@ -0,0 +1,451 @@
+// Package snmp implements a collector for devices that are monitored over
+// SNMP v2c or v3, such as switches, OLTs and routers of other vendors.
+package snmp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// SystemInfo contains the SNMPv2-MIB system group.
+type SystemInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ObjectID    string `json:"object_id"`
+}
+
+// InterfaceMetrics contains extended interface metrics with rate
+// calculations.
+type InterfaceMetrics struct {
+	models.InterfaceMetrics
+
+	Index        int     `json:"index"`
+	Type         int64   `json:"type"` // IANAifType
+	Alias        string  `json:"alias,omitempty"`
+	AdminUp      bool    `json:"admin_up"`
+	HighCapacity bool    `json:"high_capacity"` // 64-bit ifXTable counters
+	RxBps        float64 `json:"rx_bps,omitempty"`
+	TxBps        float64 `json:"tx_bps,omitempty"`
+	RxPps        float64 `json:"rx_pps,omitempty"`
+	TxPps        float64 `json:"tx_pps,omitempty"`
+
+	hasRates bool // False on the first poll
+}
+
+// Sensor is an ENTITY-SENSOR-MIB reading converted to its base unit.
+type Sensor struct {
+	Index string  `json:"index"`
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+	OK    bool    `json:"ok"`
+}
+
+// CollectedData contains all data collected from a device.
+type CollectedData struct {
+	*models.MetricsData
+	Info        SystemInfo         `json:"info"`
+	Profile     string             `json:"profile,omitempty"` // Vendor profile applied
+	Interfaces  []InterfaceMetrics `json:"interfaces,omitempty"`
+	Sensors     []Sensor           `json:"sensors,omitempty"`
+	CollectedAt time.Time          `json:"collected_at"`
+	Errors      []string           `json:"errors,omitempty"`
+}
+
+// Collector polls devices over SNMP.
+type Collector struct {
+	name     string
+	mu       sync.RWMutex
+	profiles *Profiles
+	rates    *rateTracker
+}
+
+// NewCollector creates a new SNMP collector.
+func NewCollector() collector.Collector {
+	return NewSNMPCollector()
+}
+
+// NewSNMPCollector creates a new SNMP collector.
+func NewSNMPCollector() *Collector {
+	return &Collector{
+		name:     "snmp",
+		profiles: BuiltinProfiles(),
+		rates:    newRateTracker(),
+	}
+}
+
+// Name returns the collector name.
+func (c *Collector) Name() string {
+	return c.name
+}
+
+// Type returns the router type.
+func (c *Collector) Type() string {
+	return "snmp"
+}
+
+// SetProfiles replaces the vendor profiles, e.g. with those returned by
+// LoadProfiles.
+func (c *Collector) SetProfiles(profiles *Profiles) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.profiles = profiles
+}
+
+// Collect collects metrics from an SNMP device.
+func (c *Collector) Collect(ctx context.Context, router *models.RouterConfig) (*models.MetricsData, error) {
+	data, err := c.CollectAll(ctx, router)
+	if err != nil {
+		return nil, err
+	}
+	return data.MetricsData, nil
+}
+
+// CollectAll collects all data from an SNMP device. Failure to read the
+// system group is an error; MIBs the device does not implement are skipped
+// and other failures are recorded in Errors.
+func (c *Collector) CollectAll(ctx context.Context, router *models.RouterConfig) (*CollectedData, error) {
+	target, err := ParseTarget(router)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newClient(router, target)
+	client.Context = ctx
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", router.Address, err)
+	}
+	defer client.Conn.Close()
+
+	return c.collect(client, router.ID, target, time.Now())
+}
+
+func (c *Collector) collect(w walker, routerID string, target *Target, now time.Time) (*CollectedData, error) {
+	data := &CollectedData{
+		MetricsData: &models.MetricsData{
+			RouterID:      routerID,
+			Timestamp:     now,
+			CustomMetrics: make(map[string]float64),
+		},
+		CollectedAt: now,
+	}
+
+	info, uptime, err := collectSystem(w)
+	if err != nil {
+		return nil, err
+	}
+	data.Info = *info
+	data.System.UptimeSeconds = uptime
+
+	interfaces, err := c.collectInterfaces(w, routerID, target, now)
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("interfaces: %v", err))
+	}
+	data.Interfaces = interfaces
+	for _, iface := range interfaces {
+		data.MetricsData.Interfaces = append(data.MetricsData.Interfaces, iface.InterfaceMetrics)
+
+		label := fmt.Sprintf("{interface=%q}", iface.Name)
+		if iface.hasRates {
+			data.CustomMetrics["interface_rx_bps"+label] = iface.RxBps
+			data.CustomMetrics["interface_tx_bps"+label] = iface.TxBps
+			data.CustomMetrics["interface_rx_pps"+label] = iface.RxPps
+			data.CustomMetrics["interface_tx_pps"+label] = iface.TxPps
+		}
+	}
+
+	if err := collectHostResources(w, &data.System); err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("host resources: %v", err))
+	}
+
+	sensors, err := collectSensors(w)
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("sensors: %v", err))
+	}
+	data.Sensors = sensors
+	for _, sensor := range sensors {
+		if !sensor.OK {
+			continue
+		}
+		data.CustomMetrics[fmt.Sprintf("sensor_%s{sensor=%q}", sensor.Type, sensor.Name)] = sensor.Value
+		if sensor.Type == "celsius" && sensor.Value > data.System.TemperatureCelsius {
+			data.System.TemperatureCelsius = sensor.Value
+		}
+	}
+
+	// Read proprietary OIDs of the device's vendor profile
+	c.mu.RLock()
+	profiles := c.profiles
+	c.mu.RUnlock()
+	profile, err := profiles.resolve(target.Profile, data.Info)
+	if err != nil {
+		data.Errors = append(data.Errors, fmt.Sprintf("profile: %v", err))
+	} else if profile != nil {
+		data.Profile = profile.Name
+		result, err := profile.collect(w)
+		if err != nil {
+			data.Errors = append(data.Errors, fmt.Sprintf("profile %s: %v", profile.Name, err))
+		}
+		applySystem(&data.System, result.system)
+		for name, value := range result.metrics {
+			data.CustomMetrics[name] = value
+		}
+	}
+
+	return data, nil
+}
+
+// applySystem overrides system metrics with values read through a profile.
+// Memory usage is completed from whichever two of used, free and total the
+// profile provides.
+func applySystem(system *models.SystemMetrics, values map[string]float64) {
+	if v, ok := values["cpu_percent"]; ok {
+		system.CPUPercent = v
+	}
+	if v, ok := values["temperature_celsius"]; ok {
+		system.TemperatureCelsius = v
+	}
+
+	used, hasUsed := values["memory_used_bytes"]
+	free, hasFree := values["memory_free_bytes"]
+	total, hasTotal := values["memory_total_bytes"]
+	switch {
+	case hasUsed && hasFree:
+		total, hasTotal = used+free, true
+	case hasTotal && hasFree:
+		used, hasUsed = total-free, true
+	}
+	if hasUsed && hasTotal {
+		system.MemoryUsedBytes = int64(used)
+		system.MemoryTotalBytes = int64(total)
+		if total > 0 {
+			system.MemoryPercent = used / total * 100
+		}
+	}
+	if v, ok := values["memory_percent"]; ok {
+		system.MemoryPercent = v
+	}
+}
+
+// HealthCheck reads sysUpTime to verify reachability and credentials.
+func (c *Collector) HealthCheck(ctx context.Context, router *models.RouterConfig) error {
+	target, err := ParseTarget(router)
+	if err != nil {
+		return err
+	}
+
+	client := newClient(router, target)
+	client.Context = ctx
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", router.Address, err)
+	}
+	defer client.Conn.Close()
+
+	if _, err := client.Get([]string{oidSysUpTime}); err != nil {
+		return fmt.Errorf("snmp get failed: %w", err)
+	}
+	return nil
+}
+
+// collectSystem reads the system group and returns the uptime in seconds.
+func collectSystem(w walker) (*SystemInfo, int64, error) {
+	packet, err := w.Get([]string{oidSysDescr, oidSysObjectID, oidSysUpTime, oidSysName})
+	if err != nil {
+		return nil, 0, fmt.Errorf("snmp get failed: %w", err)
+	}
+
+	info := &SystemInfo{}
+	var uptime int64
+	for _, pdu := range packet.Variables {
+		switch normalizeOID(pdu.Name) {
+		case oidSysDescr:
+			info.Description = pduString(pdu)
+		case oidSysObjectID:
+			info.ObjectID = pduString(pdu)
+		case oidSysUpTime:
+			uptime = pduInt(pdu) / 100 // Hundredths of a second
+		case oidSysName:
+			info.Name = pduString(pdu)
+		}
+	}
+	return info, uptime, nil
+}
+
+// collectInterfaces reads ifTable and, where available, the 64-bit counters
+// of ifXTable.
+func (c *Collector) collectInterfaces(w walker, routerID string, target *Target, now time.Time) ([]InterfaceMetrics, error) {
+	rows, err := walkColumns(w, oidIfEntry,
+		ifDescr, ifType, ifSpeed, ifAdminStatus, ifOperStatus,
+		ifInOctets, ifInUcastPkts, ifInDiscards, ifInErrors,
+		ifOutOctets, ifOutUcastPkts, ifOutDiscards, ifOutErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	// ifXTable is optional on SNMPv1-era agents
+	xrows, err := walkColumns(w, oidIfXEntry,
+		ifName, ifHCInOctets, ifHCInUcastPkts, ifHCOutOctets, ifHCOutUcastPkts, ifHighSpeed, ifAlias)
+	if err != nil {
+		xrows = nil
+	}
+
+	var result []InterfaceMetrics
+	seen := make(map[string]bool)
+	for _, index := range rows.indexes() {
+		row, xrow := rows[index], xrows[index]
+
+		name := pduString(xrow[ifName])
+		if name == "" {
+			name = pduString(row[ifDescr])
+		}
+		if !target.matchInterface(name) {
+			continue
+		}
+
+		ifIndex, _ := strconv.Atoi(index)
+		metrics := InterfaceMetrics{
+			InterfaceMetrics: models.InterfaceMetrics{
+				Name:        name,
+				Description: pduString(row[ifDescr]),
+				IsUp:        pduInt(row[ifOperStatus]) == 1,
+				SpeedMbps:   pduInt(row[ifSpeed]) / 1_000_000,
+				RxBytes:     pduInt(row[ifInOctets]),
+				TxBytes:     pduInt(row[ifOutOctets]),
+				RxPackets:   pduInt(row[ifInUcastPkts]),
+				TxPackets:   pduInt(row[ifOutUcastPkts]),
+				RxErrors:    pduInt(row[ifInErrors]),
+				TxErrors:    pduInt(row[ifOutErrors]),
+				RxDrops:     pduInt(row[ifInDiscards]),
+				TxDrops:     pduInt(row[ifOutDiscards]),
+			},
+			Index:   ifIndex,
+			Type:    pduInt(row[ifType]),
+			Alias:   pduString(xrow[ifAlias]),
+			AdminUp: pduInt(row[ifAdminStatus]) == 1,
+		}
+
+		// ifSpeed saturates at 4.29 Gbit/s
+		if speed, ok := xrow[ifHighSpeed]; ok && pduInt(speed) > 0 {
+			metrics.SpeedMbps = pduInt(speed)
+		}
+
+		sample := counterSample{
+			rxBytes:   uint64(metrics.RxBytes),
+			txBytes:   uint64(metrics.TxBytes),
+			rxPackets: uint64(metrics.RxPackets),
+			txPackets: uint64(metrics.TxPackets),
+			wrap:      wrap32,
+			timestamp: now,
+		}
+		if _, ok := xrow[ifHCInOctets]; ok {
+			metrics.HighCapacity = true
+			sample = counterSample{
+				rxBytes:   pduUint(xrow[ifHCInOctets]),
+				txBytes:   pduUint(xrow[ifHCOutOctets]),
+				rxPackets: pduUint(xrow[ifHCInUcastPkts]),
+				txPackets: pduUint(xrow[ifHCOutUcastPkts]),
+				wrap:      wrap64,
+				timestamp: now,
+			}
+			metrics.RxBytes = int64(sample.rxBytes)
+			metrics.TxBytes = int64(sample.txBytes)
+			metrics.RxPackets = int64(sample.rxPackets)
+			metrics.TxPackets = int64(sample.txPackets)
+		}
+
+		key := routerID + "|" + index
+		seen[key] = true
+		if rxBps, txBps, rxPps, txPps, ok := c.rates.update(key, sample); ok {
+			metrics.RxBps, metrics.TxBps = rxBps, txBps
+			metrics.RxPps, metrics.TxPps = rxPps, txPps
+			metrics.hasRates = true
+		}
+
+		result = append(result, metrics)
+	}
+	c.rates.forget(routerID, seen)
+
+	return result, nil
+}
+
+// collectHostResources sets CPU and memory usage from HOST-RESOURCES-MIB.
+// Devices without the MIB are left untouched.
+func collectHostResources(w walker, system *models.SystemMetrics) error {
+	loads, err := walkColumn(w, oidHrProcessorLoad)
+	if err != nil {
+		return err
+	}
+	if len(loads) > 0 {
+		var sum int64
+		for _, pdu := range loads {
+			sum += pduInt(pdu)
+		}
+		system.CPUPercent = float64(sum) / float64(len(loads))
+	}
+
+	storage, err := walkColumns(w, oidHrStorageEntry,
+		hrStorageType, hrStorageUnits, hrStorageSize, hrStorageUsed)
+	if err != nil {
+		return err
+	}
+	for _, index := range storage.indexes() {
+		row := storage[index]
+		if normalizeOID(pduString(row[hrStorageType])) != oidHrStorageRAM {
+			continue
+		}
+		units := pduInt(row[hrStorageUnits])
+		system.MemoryTotalBytes = pduInt(row[hrStorageSize]) * units
+		system.MemoryUsedBytes = pduInt(row[hrStorageUsed]) * units
+		if system.MemoryTotalBytes > 0 {
+			system.MemoryPercent = float64(system.MemoryUsedBytes) / float64(system.MemoryTotalBytes) * 100
+		}
+		break
+	}
+
+	return nil
+}
+
+// collectSensors reads ENTITY-SENSOR-MIB sensors, named by entPhysicalName.
+func collectSensors(w walker) ([]Sensor, error) {
+	rows, err := walkColumns(w, oidEntPhySensorEntry,
+		entPhySensorType, entPhySensorScale, entPhySensorPrecision, entPhySensorValue, entPhySensorOperStatus)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	// Names are optional
+	names, _ := walkColumn(w, oidEntPhysicalName)
+
+	var sensors []Sensor
+	for _, index := range rows.indexes() {
+		row := rows[index]
+		if _, ok := row[entPhySensorValue]; !ok {
+			continue
+		}
+
+		sensorType, ok := sensorTypes[pduInt(row[entPhySensorType])]
+		if !ok {
+			sensorType = "other"
+		}
+		name := pduString(names[index])
+		if name == "" {
+			name = index
+		}
+
+		sensors = append(sensors, Sensor{
+			Index: index,
+			Name:  name,
+			Type:  sensorType,
+			Value: sensorValue(pduInt(row[entPhySensorValue]), pduInt(row[entPhySensorScale]), pduInt(row[entPhySensorPrecision])),
+			OK:    pduInt(row[entPhySensorOperStatus]) == sensorStatusOK,
+		})
+	}
+
+	return sensors, nil
+}
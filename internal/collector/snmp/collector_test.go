@@ -0,0 +1,378 @@
+package snmp
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/gosnmp/gosnmp"
+)
+
+// testAgent is an SNMPv2c agent stand-in answering Get, GetNext and GetBulk
+// requests from a fixed OID table.
+type testAgent struct {
+	conn      *net.UDPConn
+	community string
+
+	mu     sync.Mutex
+	values map[string]gosnmp.SnmpPDU
+}
+
+func newTestAgent(t *testing.T, community string) *testAgent {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &testAgent{
+		conn:      conn,
+		community: community,
+		values:    make(map[string]gosnmp.SnmpPDU),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go a.serve()
+	return a
+}
+
+func (a *testAgent) port() int {
+	return a.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (a *testAgent) set(oid string, typ gosnmp.Asn1BER, value interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.values[oid] = gosnmp.SnmpPDU{Name: oid, Type: typ, Value: value}
+}
+
+func (a *testAgent) serve() {
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: a.community}
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		request, err := decoder.SnmpDecodePacket(buf[:n])
+		if err != nil || request.Community != a.community {
+			continue
+		}
+
+		response := &gosnmp.SnmpPacket{
+			Version:   gosnmp.Version2c,
+			Community: a.community,
+			PDUType:   gosnmp.GetResponse,
+			RequestID: request.RequestID,
+			Variables: a.answer(request),
+		}
+		out, err := response.MarshalMsg()
+		if err != nil {
+			continue
+		}
+		a.conn.WriteToUDP(out, addr)
+	}
+}
+
+func (a *testAgent) answer(request *gosnmp.SnmpPacket) []gosnmp.SnmpPDU {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	oids := make([]string, 0, len(a.values))
+	for oid := range a.values {
+		oids = append(oids, oid)
+	}
+	sort.Slice(oids, func(i, j int) bool { return compareOIDs(oids[i], oids[j]) < 0 })
+
+	next := func(oid string) gosnmp.SnmpPDU {
+		i := sort.Search(len(oids), func(i int) bool { return compareOIDs(oids[i], oid) > 0 })
+		if i == len(oids) {
+			return gosnmp.SnmpPDU{Name: oid, Type: gosnmp.EndOfMibView}
+		}
+		return a.values[oids[i]]
+	}
+
+	var variables []gosnmp.SnmpPDU
+	switch request.PDUType {
+	case gosnmp.GetRequest:
+		for _, v := range request.Variables {
+			pdu, ok := a.values[normalizeOID(v.Name)]
+			if !ok {
+				pdu = gosnmp.SnmpPDU{Name: v.Name, Type: gosnmp.NoSuchObject}
+			}
+			variables = append(variables, pdu)
+		}
+	case gosnmp.GetNextRequest:
+		for _, v := range request.Variables {
+			variables = append(variables, next(normalizeOID(v.Name)))
+		}
+	case gosnmp.GetBulkRequest:
+		nonRepeaters := int(request.NonRepeaters)
+		for i := 0; i < nonRepeaters && i < len(request.Variables); i++ {
+			variables = append(variables, next(normalizeOID(request.Variables[i].Name)))
+		}
+		cursors := make([]string, 0, len(request.Variables))
+		for _, v := range request.Variables[min(nonRepeaters, len(request.Variables)):] {
+			cursors = append(cursors, normalizeOID(v.Name))
+		}
+		for r := 0; r < int(request.MaxRepetitions) && len(cursors) > 0; r++ {
+			for i, cursor := range cursors {
+				pdu := next(cursor)
+				variables = append(variables, pdu)
+				cursors[i] = pdu.Name
+			}
+		}
+	}
+	return variables
+}
+
+// populate loads a two-port switch with host resources and two sensors.
+func (a *testAgent) populate(rxOctets uint64) {
+	a.set(oidSysDescr, gosnmp.OctetString, []byte("Test Switch 1.0"))
+	a.set(oidSysObjectID, gosnmp.ObjectIdentifier, ".1.3.6.1.4.1.99999.1")
+	a.set(oidSysUpTime, gosnmp.TimeTicks, uint32(123456))
+	a.set(oidSysName, gosnmp.OctetString, []byte("sw1"))
+
+	for _, port := range []struct {
+		index string
+		name  string
+		up    int
+	}{{"1", "ge-0/0/1", 1}, {"2", "ge-0/0/2", 2}} {
+		a.set(oidIfEntry+".2."+port.index, gosnmp.OctetString, []byte("GigabitEthernet "+port.index))
+		a.set(oidIfEntry+".3."+port.index, gosnmp.Integer, 6)
+		a.set(oidIfEntry+".5."+port.index, gosnmp.Gauge32, uint(1_000_000_000))
+		a.set(oidIfEntry+".7."+port.index, gosnmp.Integer, 1)
+		a.set(oidIfEntry+".8."+port.index, gosnmp.Integer, port.up)
+		a.set(oidIfEntry+".10."+port.index, gosnmp.Counter32, uint(rxOctets&0xffffffff))
+		a.set(oidIfEntry+".14."+port.index, gosnmp.Counter32, uint(3))
+		a.set(oidIfEntry+".16."+port.index, gosnmp.Counter32, uint(500))
+		a.set(oidIfXEntry+".1."+port.index, gosnmp.OctetString, []byte(port.name))
+		a.set(oidIfXEntry+".6."+port.index, gosnmp.Counter64, rxOctets)
+		a.set(oidIfXEntry+".10."+port.index, gosnmp.Counter64, uint64(500))
+		a.set(oidIfXEntry+".15."+port.index, gosnmp.Gauge32, uint(10000))
+		a.set(oidIfXEntry+".18."+port.index, gosnmp.OctetString, []byte("uplink "+port.index))
+	}
+
+	a.set(oidHrProcessorLoad+".196608", gosnmp.Integer, 10)
+	a.set(oidHrProcessorLoad+".196609", gosnmp.Integer, 30)
+	a.set(oidHrStorageEntry+".2.1", gosnmp.ObjectIdentifier, oidHrStorageRAM)
+	a.set(oidHrStorageEntry+".4.1", gosnmp.Integer, 1024)
+	a.set(oidHrStorageEntry+".5.1", gosnmp.Integer, 1000)
+	a.set(oidHrStorageEntry+".6.1", gosnmp.Integer, 250)
+	a.set(oidHrStorageEntry+".2.31", gosnmp.ObjectIdentifier, ".1.3.6.1.2.1.25.2.1.4")
+	a.set(oidHrStorageEntry+".4.31", gosnmp.Integer, 4096)
+	a.set(oidHrStorageEntry+".5.31", gosnmp.Integer, 100000)
+	a.set(oidHrStorageEntry+".6.31", gosnmp.Integer, 90000)
+
+	// 41.5 degrees Celsius and 12000 millivolts
+	for _, sensor := range []struct {
+		index                                string
+		name                                 string
+		typ, scale, precision, value, status int
+	}{{"10", "CPU", 8, 9, 1, 415, 1}, {"11", "PSU 1", 4, 8, 0, 12000, 1}} {
+		a.set(oidEntPhySensorEntry+".1."+sensor.index, gosnmp.Integer, sensor.typ)
+		a.set(oidEntPhySensorEntry+".2."+sensor.index, gosnmp.Integer, sensor.scale)
+		a.set(oidEntPhySensorEntry+".3."+sensor.index, gosnmp.Integer, sensor.precision)
+		a.set(oidEntPhySensorEntry+".4."+sensor.index, gosnmp.Integer, sensor.value)
+		a.set(oidEntPhySensorEntry+".5."+sensor.index, gosnmp.Integer, sensor.status)
+		a.set(oidEntPhysicalName+"."+sensor.index, gosnmp.OctetString, []byte(sensor.name))
+	}
+}
+
+func testRouter(port int) *models.RouterConfig {
+	return &models.RouterConfig{
+		ID:          "sw1",
+		Type:        "snmp",
+		Address:     "127.0.0.1",
+		Credentials: models.RouterCredentials{Password: "public"},
+		Metadata: map[string]interface{}{
+			"port":    port,
+			"timeout": "1s",
+		},
+	}
+}
+
+func TestCollectAll(t *testing.T) {
+	agent := newTestAgent(t, "public")
+	agent.populate(5_000_000_000)
+
+	c := NewSNMPCollector()
+	data, err := c.CollectAll(context.Background(), testRouter(agent.port()))
+	if err != nil {
+		t.Fatalf("CollectAll() error = %v", err)
+	}
+	if len(data.Errors) > 0 {
+		t.Errorf("Errors = %v", data.Errors)
+	}
+
+	if data.Info.Name != "sw1" || data.Info.ObjectID != ".1.3.6.1.4.1.99999.1" || data.System.UptimeSeconds != 1234 {
+		t.Errorf("Info = %+v, uptime = %d", data.Info, data.System.UptimeSeconds)
+	}
+	if data.System.CPUPercent != 20 {
+		t.Errorf("CPUPercent = %v, want 20", data.System.CPUPercent)
+	}
+	if data.System.MemoryTotalBytes != 1024000 || data.System.MemoryPercent != 25 {
+		t.Errorf("memory = %d bytes, %v%%", data.System.MemoryTotalBytes, data.System.MemoryPercent)
+	}
+	if data.System.TemperatureCelsius != 41.5 {
+		t.Errorf("TemperatureCelsius = %v, want 41.5", data.System.TemperatureCelsius)
+	}
+	if data.CustomMetrics[`sensor_volts_dc{sensor="PSU 1"}`] != 12 {
+		t.Errorf("CustomMetrics = %v", data.CustomMetrics)
+	}
+
+	if len(data.Interfaces) != 2 {
+		t.Fatalf("got %d interfaces, want 2", len(data.Interfaces))
+	}
+	iface := data.Interfaces[0]
+	if iface.Name != "ge-0/0/1" || iface.Index != 1 || !iface.IsUp || iface.Alias != "uplink 1" {
+		t.Errorf("interface = %+v", iface)
+	}
+	// The 64-bit counter is used instead of the wrapped 32-bit one
+	if !iface.HighCapacity || iface.RxBytes != 5_000_000_000 || iface.SpeedMbps != 10000 || iface.RxErrors != 3 {
+		t.Errorf("counters = %+v", iface.InterfaceMetrics)
+	}
+	if data.Interfaces[1].IsUp {
+		t.Error("ge-0/0/2 should be down")
+	}
+	if len(data.MetricsData.Interfaces) != 2 {
+		t.Errorf("base model has %d interfaces", len(data.MetricsData.Interfaces))
+	}
+}
+
+func TestCollect_Rates(t *testing.T) {
+	agent := newTestAgent(t, "public")
+	agent.populate(1_000_000)
+
+	router := testRouter(agent.port())
+	target, err := ParseTarget(router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.InterfaceInclude = []string{"ge-0/0/1"}
+
+	client := newClient(router, target)
+	client.Context = context.Background()
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Conn.Close()
+
+	c := NewSNMPCollector()
+	now := time.Now()
+	data, err := c.collect(client, router.ID, target, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Interfaces) != 1 {
+		t.Fatalf("include filter: got %d interfaces", len(data.Interfaces))
+	}
+	if _, ok := data.CustomMetrics[`interface_rx_bps{interface="ge-0/0/1"}`]; ok {
+		t.Error("first poll should not report rates")
+	}
+
+	agent.populate(2_250_000)
+	data, err = c.collect(client, router.ID, target, now.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := data.Interfaces[0].RxBps; got != 1_000_000 {
+		t.Errorf("RxBps = %v, want 1000000", got)
+	}
+	if got, ok := data.CustomMetrics[`interface_tx_bps{interface="ge-0/0/1"}`]; !ok || got != 0 {
+		t.Errorf("interface_tx_bps = %v, %v; want 0", got, ok)
+	}
+}
+
+func TestCollectAll_WrongCommunity(t *testing.T) {
+	agent := newTestAgent(t, "secret")
+	agent.populate(0)
+
+	router := testRouter(agent.port())
+	router.Metadata["timeout"] = "200ms"
+	if _, err := NewSNMPCollector().CollectAll(context.Background(), router); err == nil {
+		t.Error("CollectAll() with wrong community succeeded")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	router := &models.RouterConfig{
+		Address:     "10.0.0.2",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "authpass1"},
+		Metadata: map[string]interface{}{
+			"version": "3",
+			"v3": map[string]interface{}{
+				"auth_protocol": "sha256",
+				"priv_protocol": "aes",
+			},
+		},
+	}
+	target, err := ParseTarget(router)
+	if err != nil {
+		t.Fatalf("ParseTarget() error = %v", err)
+	}
+	if target.Port != 161 || target.MaxRepetitions != 25 {
+		t.Errorf("defaults = %+v", target)
+	}
+
+	client := newClient(router, target)
+	usm := client.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if client.Version != gosnmp.Version3 || client.MsgFlags != gosnmp.AuthPriv {
+		t.Errorf("Version/MsgFlags = %v/%v", client.Version, client.MsgFlags)
+	}
+	if usm.UserName != "monitor" || usm.AuthenticationProtocol != gosnmp.SHA256 || usm.PrivacyProtocol != gosnmp.AES || usm.PrivacyPassphrase != "authpass1" {
+		t.Errorf("USM = %+v", usm)
+	}
+
+	errorCases := map[string]*models.RouterConfig{
+		"no community": {Address: "10.0.0.2"},
+		"v3 no user":   {Address: "10.0.0.2", Metadata: map[string]interface{}{"version": "3"}},
+		"bad version":  {Address: "10.0.0.2", Credentials: models.RouterCredentials{Password: "public"}, Metadata: map[string]interface{}{"version": "1"}},
+		"bad auth": {Address: "10.0.0.2", Credentials: models.RouterCredentials{Username: "u", Password: "p"},
+			Metadata: map[string]interface{}{"version": "3", "v3": map[string]interface{}{"auth_protocol": "crc32"}}},
+	}
+	for name, router := range errorCases {
+		if _, err := ParseTarget(router); err == nil {
+			t.Errorf("%s: ParseTarget() expected error", name)
+		}
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name              string
+		current, previous uint64
+		limit             uint64
+		want              uint64
+	}{
+		{"increase", 150, 100, wrap32, 50},
+		{"32-bit wrap", 10, wrap32 - 9, wrap32, 20},
+		{"64-bit wrap", 10, wrap64 - 9, wrap64, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterDelta(tt.current, tt.previous, tt.limit); got != tt.want {
+				t.Errorf("counterDelta() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensorValue(t *testing.T) {
+	tests := []struct {
+		value, scale, precision int64
+		want                    float64
+	}{
+		{415, 9, 1, 41.5},
+		{12000, 8, 0, 12},
+		{3, 10, 0, 3000},
+		{27, 0, 0, 27},
+	}
+	for _, tt := range tests {
+		if got := sensorValue(tt.value, tt.scale, tt.precision); got != tt.want {
+			t.Errorf("sensorValue(%d, %d, %d) = %v, want %v", tt.value, tt.scale, tt.precision, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package snmp
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/gosnmp/gosnmp"
+	"gopkg.in/yaml.v3"
+)
+
+// Target contains the SNMP settings of a device, read from the metadata of
+// a router entry of type "snmp". The v2c community or v3 user and
+// authentication passphrase are taken from its credentials.
+type Target struct {
+	// Version is "2c" (default) or "3"
+	Version        string        `yaml:"version"`
+	Port           uint16        `yaml:"port"`
+	Community      string        `yaml:"community,omitempty"` // Overrides credentials.password
+	Timeout        time.Duration `yaml:"timeout"`
+	Retries        int           `yaml:"retries"`
+	MaxRepetitions uint32        `yaml:"max_repetitions"`
+	V3             V3Options     `yaml:"v3"`
+
+	// Profile names the vendor profile; empty selects it by sysObjectID and
+	// sysDescr, "none" disables profiles
+	Profile string `yaml:"profile,omitempty"`
+
+	// Interface filtering by ifName (or ifDescr) glob
+	InterfaceInclude []string `yaml:"interface_include,omitempty"`
+	InterfaceExclude []string `yaml:"interface_exclude,omitempty"`
+}
+
+// V3Options contains SNMPv3 USM settings.
+type V3Options struct {
+	// AuthProtocol is MD5, SHA (default), SHA224, SHA256, SHA384 or SHA512
+	AuthProtocol string `yaml:"auth_protocol"`
+	// PrivProtocol is DES, AES, AES192, AES256, AES192C or AES256C; empty
+	// disables privacy
+	PrivProtocol string `yaml:"priv_protocol"`
+	// PrivPassword defaults to the authentication passphrase
+	PrivPassword string `yaml:"priv_password,omitempty"`
+	ContextName  string `yaml:"context_name,omitempty"`
+}
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// ParseTarget reads the SNMP settings from the router metadata and applies
+// defaults.
+func ParseTarget(router *models.RouterConfig) (*Target, error) {
+	if router.Address == "" {
+		return nil, fmt.Errorf("router address is required")
+	}
+
+	target := &Target{}
+	if len(router.Metadata) > 0 {
+		raw, err := yaml.Marshal(router.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snmp metadata: %w", err)
+		}
+		if err := yaml.Unmarshal(raw, target); err != nil {
+			return nil, fmt.Errorf("invalid snmp metadata: %w", err)
+		}
+	}
+
+	if target.Version == "" {
+		target.Version = "2c"
+	}
+	if target.Port == 0 {
+		target.Port = 161
+	}
+	if target.Timeout == 0 {
+		target.Timeout = 5 * time.Second
+	}
+	if target.Retries == 0 {
+		target.Retries = 2
+	}
+	if target.MaxRepetitions == 0 {
+		target.MaxRepetitions = 25
+	}
+
+	switch target.Version {
+	case "2c":
+		if target.Community == "" {
+			target.Community = router.Credentials.Password
+		}
+		if target.Community == "" {
+			return nil, fmt.Errorf("snmp community is required")
+		}
+	case "3":
+		if router.Credentials.Username == "" {
+			return nil, fmt.Errorf("snmpv3 user is required")
+		}
+		if _, ok := authProtocols[strings.ToUpper(target.V3.AuthProtocol)]; target.V3.AuthProtocol != "" && !ok {
+			return nil, fmt.Errorf("unknown snmpv3 auth protocol: %s", target.V3.AuthProtocol)
+		}
+		if _, ok := privProtocols[strings.ToUpper(target.V3.PrivProtocol)]; target.V3.PrivProtocol != "" && !ok {
+			return nil, fmt.Errorf("unknown snmpv3 privacy protocol: %s", target.V3.PrivProtocol)
+		}
+		if target.V3.PrivProtocol != "" && router.Credentials.Password == "" {
+			return nil, fmt.Errorf("snmpv3 privacy requires authentication")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported snmp version: %s", target.Version)
+	}
+
+	return target, nil
+}
+
+// newClient returns an unconnected SNMP client for the router.
+func newClient(router *models.RouterConfig, target *Target) *gosnmp.GoSNMP {
+	client := &gosnmp.GoSNMP{
+		Target:         router.Address,
+		Port:           target.Port,
+		Transport:      "udp",
+		Timeout:        target.Timeout,
+		Retries:        target.Retries,
+		MaxOids:        gosnmp.MaxOids,
+		MaxRepetitions: target.MaxRepetitions,
+	}
+
+	if target.Version == "2c" {
+		client.Version = gosnmp.Version2c
+		client.Community = target.Community
+		return client
+	}
+
+	client.Version = gosnmp.Version3
+	client.SecurityModel = gosnmp.UserSecurityModel
+	client.ContextName = target.V3.ContextName
+
+	usm := &gosnmp.UsmSecurityParameters{UserName: router.Credentials.Username}
+	client.MsgFlags = gosnmp.NoAuthNoPriv
+	if router.Credentials.Password != "" {
+		client.MsgFlags = gosnmp.AuthNoPriv
+		usm.AuthenticationProtocol = gosnmp.SHA
+		if p, ok := authProtocols[strings.ToUpper(target.V3.AuthProtocol)]; ok {
+			usm.AuthenticationProtocol = p
+		}
+		usm.AuthenticationPassphrase = router.Credentials.Password
+
+		if p, ok := privProtocols[strings.ToUpper(target.V3.PrivProtocol)]; ok {
+			client.MsgFlags = gosnmp.AuthPriv
+			usm.PrivacyProtocol = p
+			usm.PrivacyPassphrase = target.V3.PrivPassword
+			if usm.PrivacyPassphrase == "" {
+				usm.PrivacyPassphrase = router.Credentials.Password
+			}
+		}
+	}
+	client.SecurityParameters = usm
+
+	return client
+}
+
+// matchInterface reports whether an interface passes the include and
+// exclude globs.
+func (t *Target) matchInterface(name string) bool {
+	if len(t.InterfaceInclude) > 0 {
+		included := false
+		for _, pattern := range t.InterfaceInclude {
+			if ok, _ := path.Match(pattern, name); ok {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, pattern := range t.InterfaceExclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
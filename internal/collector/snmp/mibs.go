@@ -0,0 +1,236 @@
+package snmp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// SNMPv2-MIB system group.
+const (
+	oidSysDescr    = ".1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = ".1.3.6.1.2.1.1.2.0"
+	oidSysUpTime   = ".1.3.6.1.2.1.1.3.0"
+	oidSysName     = ".1.3.6.1.2.1.1.5.0"
+)
+
+// IF-MIB ifTable and ifXTable entries and their columns.
+const (
+	oidIfEntry  = ".1.3.6.1.2.1.2.2.1"
+	oidIfXEntry = ".1.3.6.1.2.1.31.1.1.1"
+
+	ifDescr        = 2
+	ifType         = 3
+	ifSpeed        = 5
+	ifAdminStatus  = 7
+	ifOperStatus   = 8
+	ifInOctets     = 10
+	ifInUcastPkts  = 11
+	ifInDiscards   = 13
+	ifInErrors     = 14
+	ifOutOctets    = 16
+	ifOutUcastPkts = 17
+	ifOutDiscards  = 19
+	ifOutErrors    = 20
+
+	ifName           = 1
+	ifHCInOctets     = 6
+	ifHCInUcastPkts  = 7
+	ifHCOutOctets    = 10
+	ifHCOutUcastPkts = 11
+	ifHighSpeed      = 15
+	ifAlias          = 18
+)
+
+// HOST-RESOURCES-MIB processor and storage tables.
+const (
+	oidHrProcessorLoad = ".1.3.6.1.2.1.25.3.3.1.2"
+	oidHrStorageEntry  = ".1.3.6.1.2.1.25.2.3.1"
+	oidHrStorageRAM    = ".1.3.6.1.2.1.25.2.1.2"
+
+	hrStorageType  = 2
+	hrStorageDescr = 3
+	hrStorageUnits = 4
+	hrStorageSize  = 5
+	hrStorageUsed  = 6
+)
+
+// ENTITY-SENSOR-MIB entPhySensorTable and ENTITY-MIB entPhysicalName.
+const (
+	oidEntPhySensorEntry = ".1.3.6.1.2.1.99.1.1.1"
+	oidEntPhysicalName   = ".1.3.6.1.2.1.47.1.1.1.1.7"
+
+	entPhySensorType       = 1
+	entPhySensorScale      = 2
+	entPhySensorPrecision  = 3
+	entPhySensorValue      = 4
+	entPhySensorOperStatus = 5
+
+	sensorStatusOK = 1
+	scaleUnits     = 9
+)
+
+// sensorTypes names the EntitySensorDataType values.
+var sensorTypes = map[int64]string{
+	1:  "other",
+	2:  "unknown",
+	3:  "volts_ac",
+	4:  "volts_dc",
+	5:  "amperes",
+	6:  "watts",
+	7:  "hertz",
+	8:  "celsius",
+	9:  "percent_rh",
+	10: "rpm",
+	11: "cmm",
+	12: "truthvalue",
+}
+
+// walker is the subset of *gosnmp.GoSNMP used by the collector.
+type walker interface {
+	Get(oids []string) (*gosnmp.SnmpPacket, error)
+	BulkWalkAll(rootOid string) ([]gosnmp.SnmpPDU, error)
+}
+
+// table holds walked columns of a conceptual table, by row index and column.
+type table map[string]map[int]gosnmp.SnmpPDU
+
+// walkColumns walks the given columns of a table entry. Rows missing from a
+// column simply lack that column.
+func walkColumns(w walker, entry string, columns ...int) (table, error) {
+	rows := make(table)
+	for _, column := range columns {
+		root := fmt.Sprintf("%s.%d", entry, column)
+		pdus, err := w.BulkWalkAll(root)
+		if err != nil {
+			return nil, fmt.Errorf("walk %s: %w", root, err)
+		}
+		for _, pdu := range pdus {
+			index, ok := indexOf(pdu.Name, root)
+			if !ok || isException(pdu) {
+				continue
+			}
+			if rows[index] == nil {
+				rows[index] = make(map[int]gosnmp.SnmpPDU)
+			}
+			rows[index][column] = pdu
+		}
+	}
+	return rows, nil
+}
+
+// walkColumn walks a single column, returning values by row index.
+func walkColumn(w walker, column string) (map[string]gosnmp.SnmpPDU, error) {
+	pdus, err := w.BulkWalkAll(column)
+	if err != nil {
+		return nil, fmt.Errorf("walk %s: %w", column, err)
+	}
+	values := make(map[string]gosnmp.SnmpPDU, len(pdus))
+	for _, pdu := range pdus {
+		if index, ok := indexOf(pdu.Name, column); ok && !isException(pdu) {
+			values[index] = pdu
+		}
+	}
+	return values, nil
+}
+
+// indexes returns the row indexes of the table in numeric order.
+func (t table) indexes() []string {
+	indexes := make([]string, 0, len(t))
+	for index := range t {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return compareOIDs(indexes[i], indexes[j]) < 0
+	})
+	return indexes
+}
+
+// indexOf strips the column prefix from an instance OID. A scalar instance
+// walked directly, such as sysUpTime.0, has an empty index.
+func indexOf(name, root string) (string, bool) {
+	name, root = normalizeOID(name), normalizeOID(root)
+	if name == root {
+		return "", true
+	}
+	if !strings.HasPrefix(name, root+".") {
+		return "", false
+	}
+	return name[len(root)+1:], true
+}
+
+// normalizeOID returns the OID with a leading dot, as gosnmp reports it.
+func normalizeOID(oid string) string {
+	return "." + strings.TrimPrefix(oid, ".")
+}
+
+// compareOIDs compares dotted OIDs numerically.
+func compareOIDs(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "."), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.ParseUint(as[i], 10, 64)
+		y, _ := strconv.ParseUint(bs[i], 10, 64)
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// isException reports whether the varbind carries no value.
+func isException(pdu gosnmp.SnmpPDU) bool {
+	switch pdu.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+		return true
+	}
+	return false
+}
+
+// pduInt returns the value of an integer, counter, gauge or timeticks varbind.
+func pduInt(pdu gosnmp.SnmpPDU) int64 {
+	if isException(pdu) {
+		return 0
+	}
+	return gosnmp.ToBigInt(pdu.Value).Int64()
+}
+
+// pduUint returns the value of a counter varbind.
+func pduUint(pdu gosnmp.SnmpPDU) uint64 {
+	if isException(pdu) {
+		return 0
+	}
+	return gosnmp.ToBigInt(pdu.Value).Uint64()
+}
+
+// pduString returns the value of an octet string or object identifier
+// varbind.
+func pduString(pdu gosnmp.SnmpPDU) string {
+	switch v := pdu.Value.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// sensorValue converts an entPhySensorValue to its base unit.
+func sensorValue(value, scale, precision int64) float64 {
+	if scale == 0 {
+		scale = scaleUnits
+	}
+	exponent := int(3*(scale-scaleUnits) - precision)
+	if exponent < 0 {
+		// Dividing keeps values such as 415 / 10 exact
+		return float64(value) / math.Pow10(-exponent)
+	}
+	return float64(value) * math.Pow10(exponent)
+}
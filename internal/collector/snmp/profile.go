@@ -0,0 +1,473 @@
+package snmp
+
+import (
+	"embed"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosnmp/gosnmp"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile selection values of the "profile" metadata key besides a profile
+// name.
+const (
+	ProfileAuto = ""
+	ProfileNone = "none"
+)
+
+// Value transforms.
+const (
+	TransformMilliwattToDBm = "mw_to_dbm"
+)
+
+// Aggregations of multi-row values.
+const (
+	AggregateAvg = "avg"
+	AggregateMin = "min"
+	AggregateMax = "max"
+	AggregateSum = "sum"
+)
+
+//go:embed profiles/*.yaml
+var builtinProfiles embed.FS
+
+// Profile maps a device family to the proprietary OIDs it exposes CPU,
+// memory, temperature and other values under. Profiles are declared in YAML;
+// see the files in the profiles directory.
+type Profile struct {
+	Name    string        `yaml:"name"`
+	Match   ProfileMatch  `yaml:"match"`
+	System  SystemProfile `yaml:"system"`
+	Metrics []Metric      `yaml:"metrics"`
+
+	descr []*regexp.Regexp
+}
+
+// ProfileMatch selects the devices a profile applies to. A device matches
+// when its sysObjectID is below one of the prefixes or its sysDescr matches
+// one of the regular expressions.
+type ProfileMatch struct {
+	SysObjectID []string `yaml:"sys_object_id"`
+	SysDescr    []string `yaml:"sys_descr"`
+}
+
+// SystemProfile lists the OIDs of system values. Values found replace those
+// read from HOST-RESOURCES-MIB and ENTITY-SENSOR-MIB.
+type SystemProfile struct {
+	CPUPercent         *Value `yaml:"cpu_percent"`
+	MemoryPercent      *Value `yaml:"memory_percent"`
+	MemoryUsedBytes    *Value `yaml:"memory_used_bytes"`
+	MemoryFreeBytes    *Value `yaml:"memory_free_bytes"`
+	MemoryTotalBytes   *Value `yaml:"memory_total_bytes"`
+	TemperatureCelsius *Value `yaml:"temperature_celsius"`
+}
+
+// Value describes how a number is read: the OID is walked, each row is
+// transformed as raw*scale+offset followed by Transform, and the rows are
+// combined with Aggregate.
+type Value struct {
+	OID        string  `yaml:"oid"`
+	Aggregate  string  `yaml:"aggregate"` // avg (default), min, max or sum
+	Scale      float64 `yaml:"scale"`     // Default 1
+	Offset     float64 `yaml:"offset"`
+	Transform  string  `yaml:"transform"`   // Optional, mw_to_dbm
+	IgnoreZero bool    `yaml:"ignore_zero"` // Skip rows of 0, e.g. boards without a sensor
+}
+
+// Metric is a custom metric reported once per row, e.g. the optical receive
+// power of every transceiver.
+type Metric struct {
+	Name  string `yaml:"name"`
+	Value `yaml:",inline"`
+	// Label names the row label; it defaults to "index"
+	Label string `yaml:"label"`
+	// LabelOID is a column with the same index whose value is the label,
+	// e.g. ifName; the index is used when it has no value
+	LabelOID string `yaml:"label_oid"`
+}
+
+// ParseProfile decodes and validates a YAML profile.
+func ParseProfile(raw []byte) (*Profile, error) {
+	profile := &Profile{}
+	if err := yaml.Unmarshal(raw, profile); err != nil {
+		return nil, err
+	}
+	if profile.Name == "" {
+		return nil, fmt.Errorf("profile name is required")
+	}
+	if profile.Name == ProfileNone {
+		return nil, fmt.Errorf("profile name %q is reserved", ProfileNone)
+	}
+
+	for _, pattern := range profile.Match.SysDescr {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: invalid sys_descr pattern: %w", profile.Name, err)
+		}
+		profile.descr = append(profile.descr, re)
+	}
+	for i, prefix := range profile.Match.SysObjectID {
+		if !validOID(prefix) {
+			return nil, fmt.Errorf("profile %s: invalid sys_object_id %q", profile.Name, prefix)
+		}
+		profile.Match.SysObjectID[i] = normalizeOID(prefix)
+	}
+
+	for _, value := range profile.System.values() {
+		if err := value.validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+	}
+	for i := range profile.Metrics {
+		metric := &profile.Metrics[i]
+		if metric.Name == "" {
+			return nil, fmt.Errorf("profile %s: metric name is required", profile.Name)
+		}
+		if err := metric.Value.validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: metric %s: %w", profile.Name, metric.Name, err)
+		}
+		if metric.LabelOID != "" && !validOID(metric.LabelOID) {
+			return nil, fmt.Errorf("profile %s: metric %s: invalid label_oid %q", profile.Name, metric.Name, metric.LabelOID)
+		}
+		if metric.Label == "" {
+			metric.Label = "index"
+		}
+	}
+
+	return profile, nil
+}
+
+func (v *Value) validate() error {
+	if !validOID(v.OID) {
+		return fmt.Errorf("invalid oid %q", v.OID)
+	}
+	v.OID = normalizeOID(v.OID)
+	switch v.Aggregate {
+	case "":
+		v.Aggregate = AggregateAvg
+	case AggregateAvg, AggregateMin, AggregateMax, AggregateSum:
+	default:
+		return fmt.Errorf("unknown aggregate %q", v.Aggregate)
+	}
+	switch v.Transform {
+	case "", TransformMilliwattToDBm:
+	default:
+		return fmt.Errorf("unknown transform %q", v.Transform)
+	}
+	if v.Scale == 0 {
+		v.Scale = 1
+	}
+	return nil
+}
+
+// values returns the configured system values.
+func (s *SystemProfile) values() []*Value {
+	var values []*Value
+	for _, v := range []*Value{s.CPUPercent, s.MemoryPercent, s.MemoryUsedBytes, s.MemoryFreeBytes, s.MemoryTotalBytes, s.TemperatureCelsius} {
+		if v != nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Matches reports whether the profile applies to a device.
+func (p *Profile) Matches(sysObjectID, sysDescr string) bool {
+	if sysObjectID != "" {
+		oid := normalizeOID(sysObjectID)
+		for _, prefix := range p.Match.SysObjectID {
+			if oid == prefix || strings.HasPrefix(oid, prefix+".") {
+				return true
+			}
+		}
+	}
+	for _, re := range p.descr {
+		if re.MatchString(sysDescr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Profiles is an ordered set of profiles; the first match wins.
+type Profiles struct {
+	list []*Profile
+}
+
+// BuiltinProfiles returns the profiles shipped with the agent.
+func BuiltinProfiles() *Profiles {
+	files, err := builtinProfiles.ReadDir("profiles")
+	if err != nil {
+		panic(err)
+	}
+
+	profiles := &Profiles{}
+	for _, file := range files {
+		raw, err := builtinProfiles.ReadFile("profiles/" + file.Name())
+		if err != nil {
+			panic(err)
+		}
+		profile, err := ParseProfile(raw)
+		if err != nil {
+			panic(fmt.Sprintf("built-in SNMP profile %s: %v", file.Name(), err))
+		}
+		profiles.list = append(profiles.list, profile)
+	}
+	return profiles
+}
+
+// LoadProfiles reads *.yaml and *.yml profiles from dir. They are matched
+// before the built-in profiles, and replace built-in profiles of the same
+// name.
+func LoadProfiles(dir string) (*Profiles, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	profiles := &Profiles{}
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SNMP profile: %w", err)
+		}
+		profile, err := ParseProfile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNMP profile %s: %w", path, err)
+		}
+		if seen[profile.Name] {
+			return nil, fmt.Errorf("duplicate SNMP profile %s in %s", profile.Name, path)
+		}
+		seen[profile.Name] = true
+		profiles.list = append(profiles.list, profile)
+	}
+
+	for _, profile := range BuiltinProfiles().list {
+		if !seen[profile.Name] {
+			profiles.list = append(profiles.list, profile)
+		}
+	}
+	return profiles, nil
+}
+
+// Get returns the named profile, or nil.
+func (p *Profiles) Get(name string) *Profile {
+	for _, profile := range p.list {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+// Match returns the first profile that applies to a device, or nil.
+func (p *Profiles) Match(sysObjectID, sysDescr string) *Profile {
+	for _, profile := range p.list {
+		if profile.Matches(sysObjectID, sysDescr) {
+			return profile
+		}
+	}
+	return nil
+}
+
+// Names returns the profile names in match order.
+func (p *Profiles) Names() []string {
+	names := make([]string, 0, len(p.list))
+	for _, profile := range p.list {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// resolve selects the profile for a device by the "profile" metadata value.
+func (p *Profiles) resolve(selection string, info SystemInfo) (*Profile, error) {
+	switch selection {
+	case ProfileNone:
+		return nil, nil
+	case ProfileAuto:
+		return p.Match(info.ObjectID, info.Description), nil
+	}
+	profile := p.Get(selection)
+	if profile == nil {
+		return nil, fmt.Errorf("unknown profile %s", selection)
+	}
+	return profile, nil
+}
+
+// profileResult contains the values read through a profile.
+type profileResult struct {
+	system  map[string]float64 // By SystemProfile yaml key
+	metrics map[string]float64
+}
+
+// collect reads the profile's values. OIDs the device does not implement
+// are skipped; walk errors are returned after everything else was read.
+func (p *Profile) collect(w walker) (*profileResult, error) {
+	result := &profileResult{
+		system:  make(map[string]float64),
+		metrics: make(map[string]float64),
+	}
+	var errs []string
+
+	system := map[string]*Value{
+		"cpu_percent":         p.System.CPUPercent,
+		"memory_percent":      p.System.MemoryPercent,
+		"memory_used_bytes":   p.System.MemoryUsedBytes,
+		"memory_free_bytes":   p.System.MemoryFreeBytes,
+		"memory_total_bytes":  p.System.MemoryTotalBytes,
+		"temperature_celsius": p.System.TemperatureCelsius,
+	}
+	for key, value := range system {
+		if value == nil {
+			continue
+		}
+		rows, err := walkColumn(w, value.OID)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if v, ok := value.aggregate(rows); ok {
+			result.system[key] = v
+		}
+	}
+
+	labels := make(map[string]map[string]gosnmp.SnmpPDU)
+	for _, metric := range p.Metrics {
+		rows, err := walkColumn(w, metric.OID)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		var names map[string]gosnmp.SnmpPDU
+		if metric.LabelOID != "" {
+			if names = labels[metric.LabelOID]; names == nil {
+				// Labels are optional
+				names, _ = walkColumn(w, metric.LabelOID)
+				labels[metric.LabelOID] = names
+			}
+		}
+
+		for index, pdu := range rows {
+			v, ok := metric.apply(pdu)
+			if !ok {
+				continue
+			}
+			label := pduString(names[index])
+			if label == "" {
+				label = index
+			}
+			if label == "" {
+				result.metrics[metric.Name] = v
+				continue
+			}
+			result.metrics[fmt.Sprintf("%s{%s=%q}", metric.Name, metric.Label, label)] = v
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return result, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// apply converts a raw value. Rows without a numeric value, zero rows when
+// IgnoreZero is set and non-positive powers for mw_to_dbm are skipped.
+func (v *Value) apply(pdu gosnmp.SnmpPDU) (float64, bool) {
+	raw, ok := pduFloat(pdu)
+	if !ok || (v.IgnoreZero && raw == 0) {
+		return 0, false
+	}
+
+	value := raw*v.Scale + v.Offset
+	if v.Transform == TransformMilliwattToDBm {
+		if value <= 0 {
+			return 0, false
+		}
+		value = 10 * math.Log10(value)
+	}
+	return value, true
+}
+
+// aggregate combines the converted rows.
+func (v *Value) aggregate(rows map[string]gosnmp.SnmpPDU) (float64, bool) {
+	var values []float64
+	for _, pdu := range rows {
+		if value, ok := v.apply(pdu); ok {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+
+	result := values[0]
+	switch v.Aggregate {
+	case AggregateMin:
+		for _, value := range values[1:] {
+			result = math.Min(result, value)
+		}
+	case AggregateMax:
+		for _, value := range values[1:] {
+			result = math.Max(result, value)
+		}
+	default:
+		for _, value := range values[1:] {
+			result += value
+		}
+		if v.Aggregate == AggregateAvg {
+			result /= float64(len(values))
+		}
+	}
+	return result, true
+}
+
+// pduFloat returns a numeric value, including floats and numbers sent as
+// strings, which some vendors use for fractional values.
+func pduFloat(pdu gosnmp.SnmpPDU) (float64, bool) {
+	if isException(pdu) {
+		return 0, false
+	}
+	switch v := pdu.Value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case []byte, string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(pduString(pdu)), 64)
+		return f, err == nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		f, _ := new(big.Float).SetInt(gosnmp.ToBigInt(v)).Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+// validOID reports whether s is a dotted numeric OID.
+func validOID(s string) bool {
+	s = strings.TrimPrefix(s, ".")
+	if s == "" {
+		return false
+	}
+	for _, part := range strings.Split(s, ".") {
+		if _, err := strconv.ParseUint(part, 10, 32); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package snmp
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/gosnmp/gosnmp"
+)
+
+func TestBuiltinProfiles_Match(t *testing.T) {
+	profiles := BuiltinProfiles()
+
+	tests := []struct {
+		name        string
+		sysObjectID string
+		sysDescr    string
+		want        string
+	}{
+		{"cisco", ".1.3.6.1.4.1.9.1.2494", "Cisco IOS Software", "cisco"},
+		{"juniper", "1.3.6.1.4.1.2636.1.1.1.2.21", "Juniper Networks, Inc. mx204", "juniper"},
+		{"huawei", ".1.3.6.1.4.1.2011.2.224.67", "Huawei Versatile Routing Platform", "huawei"},
+		{"edgeos by description", ".1.3.6.1.4.1.8072.3.2.10", "EdgeOS v2.0.9-hotfix.7", "ubiquiti-edgeos"},
+		{"mimosa", ".1.3.6.1.4.1.43356.1.1.1", "Mimosa B5c", "mimosa"},
+		{"prefix on arc boundary", ".1.3.6.1.4.1.99.1", "", ""},
+		{"unknown", ".1.3.6.1.4.1.8072.3.2.10", "Linux server 6.1.0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if profile := profiles.Match(tt.sysObjectID, tt.sysDescr); profile != nil {
+				got = profile.Name
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProfile_Errors(t *testing.T) {
+	tests := map[string]string{
+		"no name":          `match: {sys_object_id: [".1.3.6.1.4.1.9"]}`,
+		"reserved name":    `name: none`,
+		"bad sys_descr":    "name: x\nmatch: {sys_descr: [\"(\"]}",
+		"bad oid":          "name: x\nsystem: {cpu_percent: {oid: cpu.load}}",
+		"bad aggregate":    "name: x\nsystem: {cpu_percent: {oid: .1.3.6.1.4.1.1, aggregate: median}}",
+		"bad transform":    "name: x\nmetrics: [{name: m, oid: .1.3.6.1.4.1.1, transform: log}]",
+		"unnamed metric":   "name: x\nmetrics: [{oid: .1.3.6.1.4.1.1}]",
+		"bad label oid":    "name: x\nmetrics: [{name: m, oid: .1.3.6.1.4.1.1, label_oid: ifName}]",
+		"malformed yaml":   "name: [",
+		"bad match prefix": "name: x\nmatch: {sys_object_id: [enterprises.9]}",
+	}
+	for name, raw := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseProfile([]byte(raw)); err == nil {
+				t.Error("ParseProfile() expected error")
+			}
+		})
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"acme.yaml": "name: acme\nmatch: {sys_object_id: [\".1.3.6.1.4.1.9.1.99\"]}\n",
+		"cisco.yml": "name: cisco\nmatch: {sys_descr: [\"^IOS\"]}\n",
+		"notes.txt": "not a profile",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	profiles, err := LoadProfiles(dir)
+	if err != nil {
+		t.Fatalf("LoadProfiles() error = %v", err)
+	}
+
+	// Custom profiles are matched before the built-in ones
+	if profile := profiles.Match(".1.3.6.1.4.1.9.1.99.5", ""); profile == nil || profile.Name != "acme" {
+		t.Errorf("Match() = %v, want acme", profile)
+	}
+	// The custom cisco profile replaces the built-in one
+	if profile := profiles.Match(".1.3.6.1.4.1.9.1.2494", ""); profile != nil {
+		t.Errorf("Match() = %q, want none", profile.Name)
+	}
+	if profiles.Get("juniper") == nil {
+		t.Error("built-in profiles missing")
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("name: ["), 0o644)
+	if _, err := LoadProfiles(dir); err == nil {
+		t.Error("LoadProfiles() with invalid profile expected error")
+	}
+}
+
+func TestValue_Apply(t *testing.T) {
+	tests := []struct {
+		name  string
+		value Value
+		pdu   gosnmp.SnmpPDU
+		want  float64
+		ok    bool
+	}{
+		{"integer", Value{Scale: 1}, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 42}, 42, true},
+		{"idle to busy", Value{Scale: -1, Offset: 100}, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 85}, 15, true},
+		{"string", Value{Scale: 1}, gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte(" -3.5 ")}, -3.5, true},
+		{"microwatts", Value{Scale: 0.001, Transform: TransformMilliwattToDBm}, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 100}, -10, true},
+		{"no light", Value{Scale: 0.001, Transform: TransformMilliwattToDBm}, gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 0}, 0, false},
+		{"ignored zero", Value{Scale: 1, IgnoreZero: true}, gosnmp.SnmpPDU{Type: gosnmp.Gauge32, Value: uint(0)}, 0, false},
+		{"text", Value{Scale: 1}, gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("n/a")}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.value.apply(tt.pdu)
+			if ok != tt.ok || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("apply() = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestApplySystem(t *testing.T) {
+	system := models.SystemMetrics{CPUPercent: 1, MemoryPercent: 1}
+	applySystem(&system, map[string]float64{
+		"cpu_percent":        35,
+		"memory_total_bytes": 4000,
+		"memory_free_bytes":  1000,
+	})
+	if system.CPUPercent != 35 || system.MemoryUsedBytes != 3000 || system.MemoryPercent != 75 {
+		t.Errorf("system = %+v", system)
+	}
+
+	system = models.SystemMetrics{}
+	applySystem(&system, map[string]float64{"memory_used_bytes": 250, "memory_free_bytes": 750})
+	if system.MemoryTotalBytes != 1000 || system.MemoryPercent != 25 {
+		t.Errorf("used+free: system = %+v", system)
+	}
+}
+
+func TestCollect_Profile(t *testing.T) {
+	agent := newTestAgent(t, "public")
+	agent.populate(0)
+	agent.set(oidSysObjectID, gosnmp.ObjectIdentifier, ".1.3.6.1.4.1.2636.1.1.1.2.21")
+
+	// Routing engine and a FRU without CPU
+	agent.set(".1.3.6.1.4.1.2636.3.1.13.1.8.9.1.0.0", gosnmp.Gauge32, uint(12))
+	agent.set(".1.3.6.1.4.1.2636.3.1.13.1.8.7.1.0.0", gosnmp.Gauge32, uint(0))
+	agent.set(".1.3.6.1.4.1.2636.3.1.13.1.11.9.1.0.0", gosnmp.Gauge32, uint(48))
+	// Optics on ifIndex 1 (ge-0/0/1)
+	agent.set(".1.3.6.1.4.1.2636.3.60.1.1.1.1.5.1", gosnmp.Integer, -512)
+
+	router := testRouter(agent.port())
+	target, err := ParseTarget(router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newClient(router, target)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Conn.Close()
+
+	c := NewSNMPCollector()
+	data, err := c.collect(client, router.ID, target, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Profile != "juniper" || len(data.Errors) > 0 {
+		t.Fatalf("Profile = %q, errors = %v", data.Profile, data.Errors)
+	}
+	if data.System.CPUPercent != 12 || data.System.MemoryPercent != 48 {
+		t.Errorf("CPU/memory = %v/%v, want 12/48", data.System.CPUPercent, data.System.MemoryPercent)
+	}
+	if got := data.CustomMetrics[`optical_rx_power_dbm{interface="ge-0/0/1"}`]; got != -5.12 {
+		t.Errorf("optical_rx_power_dbm = %v, want -5.12 (metrics %v)", got, data.CustomMetrics)
+	}
+
+	// Explicit selection
+	target.Profile = ProfileNone
+	if data, _ := c.collect(client, router.ID, target, time.Now()); data.Profile != "" || data.System.CPUPercent != 20 {
+		t.Errorf("profile none: Profile = %q, CPU = %v", data.Profile, data.System.CPUPercent)
+	}
+	target.Profile = "missing"
+	if data, _ := c.collect(client, router.ID, target, time.Now()); len(data.Errors) != 1 {
+		t.Errorf("unknown profile: Errors = %v", data.Errors)
+	}
+}
@@ -0,0 +1,81 @@
+package snmp
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counter widths of ifTable and ifXTable counters.
+const (
+	wrap32 = math.MaxUint32
+	wrap64 = math.MaxUint64
+)
+
+// counterSample is the previous reading of an interface's counters.
+type counterSample struct {
+	rxBytes   uint64
+	txBytes   uint64
+	rxPackets uint64
+	txPackets uint64
+	wrap      uint64 // Maximum counter value, 32 or 64 bits
+	timestamp time.Time
+}
+
+// rateTracker converts interface counters to per-second rates between
+// polls.
+type rateTracker struct {
+	mu      sync.Mutex
+	samples map[string]counterSample // Router ID + ifIndex
+}
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{
+		samples: make(map[string]counterSample),
+	}
+}
+
+// update stores the sample and returns rates against the previous one. The
+// first sample, a changed counter width and a zero interval yield no rates.
+func (t *rateTracker) update(key string, sample counterSample) (rxBps, txBps, rxPps, txPps float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, exists := t.samples[key]
+	t.samples[key] = sample
+	if !exists || prev.wrap != sample.wrap {
+		return 0, 0, 0, 0, false
+	}
+	elapsed := sample.timestamp.Sub(prev.timestamp).Seconds()
+	if elapsed <= 0 {
+		return 0, 0, 0, 0, false
+	}
+
+	rxBps = float64(counterDelta(sample.rxBytes, prev.rxBytes, sample.wrap)) * 8 / elapsed
+	txBps = float64(counterDelta(sample.txBytes, prev.txBytes, sample.wrap)) * 8 / elapsed
+	rxPps = float64(counterDelta(sample.rxPackets, prev.rxPackets, sample.wrap)) / elapsed
+	txPps = float64(counterDelta(sample.txPackets, prev.txPackets, sample.wrap)) / elapsed
+	return rxBps, txBps, rxPps, txPps, true
+}
+
+// forget drops samples of interfaces not seen in the last poll of a router.
+func (t *rateTracker) forget(routerID string, seen map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prefix := routerID + "|"
+	for key := range t.samples {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(t.samples, key)
+		}
+	}
+}
+
+// counterDelta returns the increase of a counter that wraps after limit.
+func counterDelta(current, previous, limit uint64) uint64 {
+	if current >= previous {
+		return current - previous
+	}
+	return (limit - previous) + current + 1
+}
@@ -1,23 +1,39 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the agent configuration
 type Config struct {
-	Agent      AgentConfig      `yaml:"agent"`
-	Server     ServerConfig     `yaml:"server"`
-	License    LicenseConfig    `yaml:"license"`
-	Collection CollectionConfig `yaml:"collection"`
-	Routers    []models.RouterConfig `yaml:"routers"`
-	Privacy    PrivacyConfig    `yaml:"privacy"`
-	Logging    LoggingConfig    `yaml:"logging"`
+	Agent         AgentConfig            `yaml:"agent"`
+	Server        ServerConfig           `yaml:"server"`
+	License       LicenseConfig          `yaml:"license"`
+	Collection    CollectionConfig       `yaml:"collection"`
+	Routers       []models.RouterConfig  `yaml:"routers"`
+	Privacy       PrivacyConfig          `yaml:"privacy"`
+	NATLog        NATLogConfig           `yaml:"nat_log"`
+	ConfigBackup  ConfigBackupConfig     `yaml:"config_backup"`
+	MikroTik      map[string]interface{} `yaml:"mikrotik"`
+	SNMP          SNMPConfig             `yaml:"snmp"`
+	Prometheus    PrometheusConfig       `yaml:"prometheus"`
+	OpenTelemetry OpenTelemetryConfig    `yaml:"opentelemetry"`
+	InfluxDB      InfluxDBConfig         `yaml:"influxdb"`
+	MQTT          MQTTConfig             `yaml:"mqtt"`
+	Kafka         KafkaConfig            `yaml:"kafka"`
+	NATS          NATSConfig             `yaml:"nats"`
+	File          FileConfig             `yaml:"file"`
+	Outputs       []OutputConfig         `yaml:"outputs"`
+	Logging       LoggingConfig          `yaml:"logging"`
 }
 
 // AgentConfig contains agent identification
@@ -30,6 +46,8 @@ type AgentConfig struct {
 type ServerConfig struct {
 	Address string    `yaml:"address"`
 	TLS     TLSConfig `yaml:"tls"`
+	// Queue holds reports until the server acknowledges them
+	Queue QueueConfig `yaml:"queue"`
 }
 
 // TLSConfig contains TLS certificate configuration
@@ -40,6 +58,38 @@ type TLSConfig struct {
 	ClientKey  string `yaml:"client_key"`
 }
 
+// Load builds a client TLS configuration from the certificate files
+func (t *TLSConfig) Load() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	// Load CA certificate if provided
+	if t.CACert != "" {
+		caCert, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to append CA certificate")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	// Load client certificate if provided
+	if t.ClientCert != "" && t.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 // LicenseConfig contains license validation settings
 type LicenseConfig struct {
 	Key               string `yaml:"key"`
@@ -50,6 +100,7 @@ type LicenseConfig struct {
 // CollectionConfig contains data collection settings
 type CollectionConfig struct {
 	IntervalSeconds int `yaml:"interval_seconds"`
+	MaxConcurrent   int `yaml:"max_concurrent"` // 0 is unlimited
 }
 
 // PrivacyConfig contains privacy and audit settings
@@ -58,6 +109,168 @@ type PrivacyConfig struct {
 	AuditLogPath      string `yaml:"audit_log_path"`
 	RedactUsernames   bool   `yaml:"redact_usernames"`
 	RedactIPAddresses bool   `yaml:"redact_ip_addresses"`
+	// RedactIPv6PrefixLength is the number of leading bits of IPv6
+	// addresses kept when redacting; 0 redacts them entirely
+	RedactIPv6PrefixLength *int `yaml:"redact_ipv6_prefix_length"`
+}
+
+// NATLogConfig contains NAT translation logging settings
+type NATLogConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Directory     string `yaml:"directory"`
+	RetentionDays int    `yaml:"retention_days"`
+	ListenAddress string `yaml:"listen_address"`
+	// Token is the bearer token lookups must carry; required unless the
+	// API listens on loopback only
+	Token string `yaml:"token"`
+}
+
+// ConfigBackupConfig contains router configuration backup settings
+type ConfigBackupConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Directory       string `yaml:"directory"`
+	IntervalMinutes int    `yaml:"interval_minutes"`
+	Retain          int    `yaml:"retain"`
+	ShowSensitive   bool   `yaml:"show_sensitive"`
+}
+
+// SNMPConfig contains SNMP collector settings
+type SNMPConfig struct {
+	// ProfilesDir holds vendor profiles matched before the built-in ones
+	ProfilesDir string `yaml:"profiles_dir"`
+}
+
+// PrometheusConfig contains local Prometheus exporter settings
+type PrometheusConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+	// SubscriberMetrics exports per-subscriber series, such as PPPoE sessions
+	SubscriberMetrics bool `yaml:"subscriber_metrics"`
+	// MaxSubscriberSeries bounds the subscriber series per router
+	MaxSubscriberSeries int `yaml:"max_subscriber_series"`
+}
+
+// OpenTelemetryConfig contains OTLP export settings
+type OpenTelemetryConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of an OTLP/gRPC receiver, such as a collector
+	Endpoint string            `yaml:"endpoint"`
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	Metrics  bool              `yaml:"metrics"`
+	Traces   bool              `yaml:"traces"`
+	// ExportIntervalSeconds is the time between metric exports
+	ExportIntervalSeconds int `yaml:"export_interval_seconds"`
+	// SampleRatio is the fraction of collections traced; 0 traces none
+	SampleRatio *float64 `yaml:"sample_ratio"`
+}
+
+// InfluxDBConfig contains settings of the InfluxDB line protocol output,
+// which also writes to VictoriaMetrics
+type InfluxDBConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	URL     string `yaml:"url"`
+	// Organization, Bucket and Token select the InfluxDB 2 write API
+	Organization string `yaml:"organization"`
+	Bucket       string `yaml:"bucket"`
+	Token        string `yaml:"token"`
+	// Database, Username and Password select the InfluxDB 1 write API
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Gzip     bool   `yaml:"gzip"`
+	// BatchSize is the number of collections written per request
+	BatchSize            int         `yaml:"batch_size"`
+	FlushIntervalSeconds int         `yaml:"flush_interval_seconds"`
+	TimeoutSeconds       int         `yaml:"timeout_seconds"`
+	Queue                QueueConfig `yaml:"queue"`
+}
+
+// MQTTConfig contains MQTT output settings
+type MQTTConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Broker is the broker URL, e.g. tcp://broker:1883 or ssl://broker:8883
+	Broker   string    `yaml:"broker"`
+	ClientID string    `yaml:"client_id"`
+	Username string    `yaml:"username"`
+	Password string    `yaml:"password"`
+	TLS      TLSConfig `yaml:"tls"`
+	QoS      int       `yaml:"qos"`
+	// Retain marks state messages as retained
+	Retain bool `yaml:"retain"`
+	// TopicPrefix defaults to isp/<agent id>
+	TopicPrefix string `yaml:"topic_prefix"`
+	// SessionEvents publishes PPPoE sessions and DHCP leases coming and going
+	SessionEvents bool `yaml:"session_events"`
+}
+
+// KafkaConfig contains settings of publishing reports to Kafka
+type KafkaConfig struct {
+	Enabled  bool              `yaml:"enabled"`
+	Brokers  []string          `yaml:"brokers"`
+	Topics   KafkaTopicsConfig `yaml:"topics"`
+	ClientID string            `yaml:"client_id"`
+	// Username and Password authenticate with SASL/PLAIN if set
+	Username string    `yaml:"username"`
+	Password string    `yaml:"password"`
+	TLS      TLSConfig `yaml:"tls"`
+	// BatchSize is the number of reports published at once
+	BatchSize            int         `yaml:"batch_size"`
+	FlushIntervalSeconds int         `yaml:"flush_interval_seconds"`
+	TimeoutSeconds       int         `yaml:"timeout_seconds"`
+	Queue                QueueConfig `yaml:"queue"`
+}
+
+// KafkaTopicsConfig names the topic of each kind of report
+type KafkaTopicsConfig struct {
+	Metrics    string `yaml:"metrics"`
+	Sessions   string `yaml:"sessions"`
+	Heartbeats string `yaml:"heartbeats"`
+}
+
+// NATSConfig contains settings of publishing reports to NATS JetStream
+type NATSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// URL lists the servers, comma separated
+	URL string `yaml:"url"`
+	// SubjectPrefix is the first token of every subject
+	SubjectPrefix   string    `yaml:"subject_prefix"`
+	Username        string    `yaml:"username"`
+	Password        string    `yaml:"password"`
+	Token           string    `yaml:"token"`
+	CredentialsFile string    `yaml:"credentials_file"`
+	TLS             TLSConfig `yaml:"tls"`
+	// BatchSize is the number of reports published at once
+	BatchSize            int         `yaml:"batch_size"`
+	FlushIntervalSeconds int         `yaml:"flush_interval_seconds"`
+	TimeoutSeconds       int         `yaml:"timeout_seconds"`
+	Queue                QueueConfig `yaml:"queue"`
+}
+
+// FileConfig contains settings of writing collections to local files, for
+// sites whose data is carried out rather than sent
+type FileConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Directory string `yaml:"directory"`
+	// Prefix starts every file name
+	Prefix string `yaml:"prefix"`
+	// MaxSizeMB and RotateIntervalMinutes rotate the current file once it
+	// is that large or old
+	MaxSizeMB             int  `yaml:"max_size_mb"`
+	RotateIntervalMinutes int  `yaml:"rotate_interval_minutes"`
+	Compress              bool `yaml:"compress"`
+	// MaxFiles, MaxTotalSizeMB and RetentionDays limit the rotated files
+	// kept; zero means no limit
+	MaxFiles       int `yaml:"max_files"`
+	MaxTotalSizeMB int `yaml:"max_total_size_mb"`
+	RetentionDays  int `yaml:"retention_days"`
+}
+
+// QueueConfig contains settings of an output's outbound queue
+type QueueConfig struct {
+	Directory string `yaml:"directory"`
+	// MaxSizeMB bounds the queue on disk; the oldest data is dropped beyond it
+	MaxSizeMB int `yaml:"max_size_mb"`
 }
 
 // LoggingConfig contains logging settings
@@ -92,6 +305,47 @@ func Load(path string) (*Config, error) {
 	if cfg.License.OfflineGraceHours == 0 {
 		cfg.License.OfflineGraceHours = 72
 	}
+	if cfg.Privacy.RedactIPv6PrefixLength == nil {
+		bits := privacy.DefaultIPv6PrefixLength
+		cfg.Privacy.RedactIPv6PrefixLength = &bits
+	}
+	if cfg.NATLog.Directory == "" {
+		cfg.NATLog.Directory = "/var/lib/ispagent/natlog"
+	}
+	if cfg.NATLog.RetentionDays == 0 {
+		cfg.NATLog.RetentionDays = 180
+	}
+	if cfg.NATLog.ListenAddress == "" {
+		cfg.NATLog.ListenAddress = "127.0.0.1:9470"
+	}
+	if cfg.ConfigBackup.Directory == "" {
+		cfg.ConfigBackup.Directory = "/var/lib/ispagent/backups"
+	}
+	if cfg.ConfigBackup.IntervalMinutes == 0 {
+		cfg.ConfigBackup.IntervalMinutes = 60
+	}
+	if cfg.ConfigBackup.Retain == 0 {
+		cfg.ConfigBackup.Retain = 30
+	}
+	if cfg.OpenTelemetry.Endpoint == "" {
+		cfg.OpenTelemetry.Endpoint = "localhost:4317"
+	}
+	if cfg.OpenTelemetry.ExportIntervalSeconds == 0 {
+		cfg.OpenTelemetry.ExportIntervalSeconds = 60
+	}
+	if cfg.OpenTelemetry.SampleRatio == nil {
+		ratio := 1.0
+		cfg.OpenTelemetry.SampleRatio = &ratio
+	}
+	cfg.Server.setDefaults("server")
+	cfg.Prometheus.setDefaults()
+	cfg.InfluxDB.setDefaults("influxdb")
+	cfg.Kafka.setDefaults("kafka")
+	cfg.NATS.setDefaults("nats")
+	cfg.File.setDefaults("file")
+	for i := range cfg.Outputs {
+		cfg.Outputs[i].setDefaults()
+	}
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "info"
 	}
@@ -113,9 +367,6 @@ func generateAgentID() string {
 
 // Validate validates the configuration
 func (c *Config) Validate() error {
-	if c.Server.Address == "" {
-		return fmt.Errorf("server.address is required")
-	}
 	if c.License.Key == "" {
 		return fmt.Errorf("license.key is required")
 	}
@@ -133,5 +384,31 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("router[%d].address is required", i)
 		}
 	}
-	return nil
+	if bits := c.Privacy.RedactIPv6PrefixLength; bits != nil && (*bits < 0 || *bits > 128) {
+		return fmt.Errorf("privacy.redact_ipv6_prefix_length must be between 0 and 128")
+	}
+	if c.NATLog.Enabled && c.NATLog.Token == "" && !isLoopback(c.NATLog.ListenAddress) {
+		return fmt.Errorf("nat_log.token is required when nat_log.listen_address is not a loopback address")
+	}
+	if c.OpenTelemetry.Enabled && !c.OpenTelemetry.Metrics && !c.OpenTelemetry.Traces {
+		return fmt.Errorf("opentelemetry requires metrics or traces to be enabled")
+	}
+	if ratio := c.OpenTelemetry.SampleRatio; ratio != nil && (*ratio < 0 || *ratio > 1) {
+		return fmt.Errorf("opentelemetry.sample_ratio must be between 0 and 1")
+	}
+	return c.validateOutputs()
+}
+
+// isLoopback reports whether the listen address addr accepts loopback
+// connections only
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
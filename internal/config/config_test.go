@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
@@ -78,6 +79,12 @@ logging:
 	if len(cfg.Routers) != 1 {
 		t.Errorf("Expected 1 router, got %d", len(cfg.Routers))
 	}
+	if cfg.Privacy.RedactIPv6PrefixLength == nil || *cfg.Privacy.RedactIPv6PrefixLength != 48 {
+		t.Errorf("Expected default privacy.redact_ipv6_prefix_length 48, got %v", cfg.Privacy.RedactIPv6PrefixLength)
+	}
+	if cfg.ConfigBackup.IntervalMinutes != 60 || cfg.ConfigBackup.Retain != 30 {
+		t.Errorf("Expected default config_backup interval 60 and retain 30, got %d and %d", cfg.ConfigBackup.IntervalMinutes, cfg.ConfigBackup.Retain)
+	}
 }
 
 func TestConfigValidation(t *testing.T) {
@@ -125,6 +132,193 @@ func TestConfigValidation(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "opentelemetry without signals",
+			config: &Config{
+				Server:  ServerConfig{Address: "localhost:50051"},
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				OpenTelemetry: OpenTelemetryConfig{Enabled: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "influxdb instead of server",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				InfluxDB: InfluxDBConfig{Enabled: true, URL: "http://localhost:8086", Bucket: "routers"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "influxdb without bucket or database",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				InfluxDB: InfluxDBConfig{Enabled: true, URL: "http://localhost:8086"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "kafka instead of server",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Kafka: KafkaConfig{Enabled: true, Brokers: []string{"kafka-1:9092"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "nats without url",
+			config: &Config{
+				Server:  ServerConfig{Address: "localhost:50051"},
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				NATS: NATSConfig{Enabled: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "outputs instead of server",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Outputs: []OutputConfig{
+					{Type: OutputPrometheus},
+					{Name: "core", Type: OutputInfluxDB, Routers: []string{"bng-*"}, Data: []string{"metrics", "events"},
+						InfluxDB: InfluxDBConfig{URL: "http://localhost:8086", Bucket: "routers"}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "output without type",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Outputs: []OutputConfig{{Name: "metrics"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "output of unknown type",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Outputs: []OutputConfig{{Type: "carrier-pigeon"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "output of unknown data type",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Outputs: []OutputConfig{{Type: OutputPrometheus, Data: []string{"metrics", "flows"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "nat log API on loopback",
+			config: &Config{
+				Server:  ServerConfig{Address: "localhost:50051"},
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				NATLog: NATLogConfig{Enabled: true, ListenAddress: "127.0.0.1:9470"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "nat log API exposed without token",
+			config: &Config{
+				Server:  ServerConfig{Address: "localhost:50051"},
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				NATLog: NATLogConfig{Enabled: true, ListenAddress: ":9470"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "nat log API exposed with token",
+			config: &Config{
+				Server:  ServerConfig{Address: "localhost:50051"},
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				NATLog: NATLogConfig{Enabled: true, ListenAddress: "10.0.0.5:9470", Token: "s3cret"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "second server",
+			config: &Config{
+				Server:  ServerConfig{Address: "localhost:50051"},
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Outputs: []OutputConfig{{Type: OutputGRPC, Server: ServerConfig{Address: "backup:50051"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "file instead of server",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				File: FileConfig{Enabled: true, Directory: "/mnt/export", Compress: true, RetentionDays: 30},
+			},
+			wantErr: false,
+		},
+		{
+			name: "file with negative limit",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				File: FileConfig{Enabled: true, Directory: "/mnt/export", MaxFiles: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate output names",
+			config: &Config{
+				License: LicenseConfig{Key: "test-key"},
+				Routers: []models.RouterConfig{
+					{ID: "r1", Type: "mikrotik", Address: "192.168.1.1"},
+				},
+				Outputs:    []OutputConfig{{Type: OutputPrometheus}},
+				Prometheus: PrometheusConfig{Enabled: true},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -136,6 +330,155 @@ func TestConfigValidation(t *testing.T) {
 		})
 	}
 }
+func TestOutputList(t *testing.T) {
+	content := `
+server:
+  address: "localhost:50051"
+license:
+  key: "test-key"
+routers:
+  - id: "r1"
+    type: "mikrotik"
+    address: "192.168.1.1"
+prometheus:
+  enabled: true
+file:
+  enabled: true
+outputs:
+  - name: "backup"
+    type: "grpc"
+    routers: ["bng-*"]
+    server:
+      address: "backup:50051"
+  - type: "kafka"
+    data: ["sessions"]
+    buffer: 500
+    kafka:
+      brokers: ["kafka-1:9092"]
+`
+	tmpfile, err := os.CreateTemp("", "config-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+
+	cfg, err := Load(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	outputs := cfg.OutputList()
+	tests := []struct {
+		name   string
+		typ    string
+		buffer int
+		queue  string
+	}{
+		{"backup", OutputGRPC, 100, "/var/lib/ispagent/queue/backup"},
+		{"kafka", OutputKafka, 500, "/var/lib/ispagent/queue/kafka"},
+		{"server", OutputGRPC, 100, "/var/lib/ispagent/queue/server"},
+		{"prometheus", OutputPrometheus, 100, ""},
+		{"file", OutputFile, 100, "/var/lib/ispagent/export/file"},
+	}
+	if len(outputs) != len(tests) {
+		t.Fatalf("OutputList() returned %d outputs, want %d", len(outputs), len(tests))
+	}
+	for i, tt := range tests {
+		o := outputs[i]
+		var queue string
+		switch o.Type {
+		case OutputGRPC:
+			queue = o.Server.Queue.Directory
+		case OutputKafka:
+			queue = o.Kafka.Queue.Directory
+		case OutputFile:
+			queue = o.File.Directory
+		}
+		if o.Name != tt.name || o.Type != tt.typ || o.Buffer != tt.buffer || queue != tt.queue {
+			t.Errorf("output %d = %s (%s, buffer %d, queue %q), want %s (%s, buffer %d, queue %q)",
+				i, o.Name, o.Type, o.Buffer, queue, tt.name, tt.typ, tt.buffer, tt.queue)
+		}
+	}
+	if outputs[1].Kafka.Topics.Sessions != "ispagent.sessions" {
+		t.Errorf("kafka output topics = %+v, want defaults", outputs[1].Kafka.Topics)
+	}
+	if f := outputs[4].File; f.Prefix != "ispagent" || f.MaxSizeMB != 100 || f.RotateIntervalMinutes != 60 {
+		t.Errorf("file output = %+v, want defaults", f)
+	}
+}
+
+func TestRedactIPv6PrefixLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		privacy string
+		want    int
+		wantErr bool
+	}{
+		{"default", "", 48, false},
+		{"full redaction", "privacy:\n  redact_ipv6_prefix_length: 0\n", 0, false},
+		{"subscriber prefix", "privacy:\n  redact_ipv6_prefix_length: 56\n", 56, false},
+		{"out of range", "privacy:\n  redact_ipv6_prefix_length: 129\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "agent.yaml")
+			content := "license:\n  key: test-key\nserver:\n  address: localhost:50051\nrouters:\n  - id: r1\n    type: mikrotik\n    address: 192.168.1.1\n" + tt.privacy
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *cfg.Privacy.RedactIPv6PrefixLength != tt.want {
+				t.Errorf("redact_ipv6_prefix_length = %d, want %d", *cfg.Privacy.RedactIPv6PrefixLength, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenTelemetrySampleRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		otel    string
+		want    float64
+		wantErr bool
+	}{
+		{"default", "", 1, false},
+		{"traces off", "opentelemetry:\n  sample_ratio: 0\n", 0, false},
+		{"sampled", "opentelemetry:\n  sample_ratio: 0.25\n", 0.25, false},
+		{"out of range", "opentelemetry:\n  sample_ratio: 1.5\n", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "agent.yaml")
+			content := "license:\n  key: test-key\nserver:\n  address: localhost:50051\nrouters:\n  - id: r1\n    type: mikrotik\n    address: 192.168.1.1\n" + tt.otel
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *cfg.OpenTelemetry.SampleRatio != tt.want {
+				t.Errorf("sample_ratio = %v, want %v", *cfg.OpenTelemetry.SampleRatio, tt.want)
+			}
+		})
+	}
+}
 
 func TestEnvVarExpansion(t *testing.T) {
 	// Set test environment variable
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// Output types
+const (
+	OutputGRPC       = "grpc"
+	OutputPrometheus = "prometheus"
+	OutputInfluxDB   = "influxdb"
+	OutputMQTT       = "mqtt"
+	OutputKafka      = "kafka"
+	OutputNATS       = "nats"
+	OutputFile       = "file"
+)
+
+// outputDataTypes are the data types an output can be limited to
+var outputDataTypes = map[string]bool{
+	"metrics":   true,
+	"events":    true,
+	"sessions":  true,
+	"inventory": true,
+	"errors":    true,
+}
+
+// Default directories of the outputs, below which every output gets its
+// own
+const (
+	queueBaseDir  = "/var/lib/ispagent/queue"
+	exportBaseDir = "/var/lib/ispagent/export"
+)
+
+// OutputConfig declares one output of the output pipeline. Only the
+// section matching Type is used.
+type OutputConfig struct {
+	// Name identifies the output in logs; defaults to its type
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Routers limits the output to routers whose ID matches one of these
+	// patterns, e.g. "bng-*"; all routers if empty
+	Routers []string `yaml:"routers"`
+	// Data limits the output to these data types: metrics, events,
+	// sessions, inventory and errors; all if empty
+	Data []string `yaml:"data"`
+	// Buffer is the number of collections held while the output is busy;
+	// beyond it, collections are dropped for this output only
+	Buffer int `yaml:"buffer"`
+
+	Server     ServerConfig     `yaml:"server"`
+	Prometheus PrometheusConfig `yaml:"prometheus"`
+	InfluxDB   InfluxDBConfig   `yaml:"influxdb"`
+	MQTT       MQTTConfig       `yaml:"mqtt"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	NATS       NATSConfig       `yaml:"nats"`
+	File       FileConfig       `yaml:"file"`
+}
+
+// OutputList returns the outputs declared under outputs followed by those
+// enabled in the top-level sections, which are named after their type.
+// The server is an output of type grpc named server.
+func (c *Config) OutputList() []OutputConfig {
+	outputs := append([]OutputConfig(nil), c.Outputs...)
+	if c.Server.Address != "" {
+		outputs = append(outputs, OutputConfig{Name: "server", Type: OutputGRPC, Server: c.Server})
+	}
+	if c.Prometheus.Enabled {
+		outputs = append(outputs, OutputConfig{Name: OutputPrometheus, Type: OutputPrometheus, Prometheus: c.Prometheus})
+	}
+	if c.InfluxDB.Enabled {
+		outputs = append(outputs, OutputConfig{Name: OutputInfluxDB, Type: OutputInfluxDB, InfluxDB: c.InfluxDB})
+	}
+	if c.MQTT.Enabled {
+		outputs = append(outputs, OutputConfig{Name: OutputMQTT, Type: OutputMQTT, MQTT: c.MQTT})
+	}
+	if c.Kafka.Enabled {
+		outputs = append(outputs, OutputConfig{Name: OutputKafka, Type: OutputKafka, Kafka: c.Kafka})
+	}
+	if c.NATS.Enabled {
+		outputs = append(outputs, OutputConfig{Name: OutputNATS, Type: OutputNATS, NATS: c.NATS})
+	}
+	if c.File.Enabled {
+		outputs = append(outputs, OutputConfig{Name: OutputFile, Type: OutputFile, File: c.File})
+	}
+	for i := range outputs {
+		if outputs[i].Buffer == 0 {
+			outputs[i].Buffer = 100
+		}
+	}
+	return outputs
+}
+
+func (o *OutputConfig) setDefaults() {
+	if o.Name == "" {
+		o.Name = o.Type
+	}
+	switch o.Type {
+	case OutputGRPC:
+		o.Server.setDefaults(o.Name)
+	case OutputPrometheus:
+		o.Prometheus.setDefaults()
+	case OutputInfluxDB:
+		o.InfluxDB.setDefaults(o.Name)
+	case OutputKafka:
+		o.Kafka.setDefaults(o.Name)
+	case OutputNATS:
+		o.NATS.setDefaults(o.Name)
+	case OutputFile:
+		o.File.setDefaults(o.Name)
+	}
+}
+
+func (s *ServerConfig) setDefaults(name string) {
+	s.Queue.setDefaults(name)
+}
+
+func (p *PrometheusConfig) setDefaults() {
+	if p.ListenAddress == "" {
+		p.ListenAddress = "127.0.0.1:9471"
+	}
+	if p.MaxSubscriberSeries == 0 {
+		p.MaxSubscriberSeries = 1000
+	}
+}
+
+func (i *InfluxDBConfig) setDefaults(name string) {
+	if i.BatchSize == 0 {
+		i.BatchSize = 50
+	}
+	if i.FlushIntervalSeconds == 0 {
+		i.FlushIntervalSeconds = 10
+	}
+	if i.TimeoutSeconds == 0 {
+		i.TimeoutSeconds = 10
+	}
+	i.Queue.setDefaults(name)
+}
+
+func (k *KafkaConfig) setDefaults(name string) {
+	if k.Topics.Metrics == "" {
+		k.Topics.Metrics = "ispagent.metrics"
+	}
+	if k.Topics.Sessions == "" {
+		k.Topics.Sessions = "ispagent.sessions"
+	}
+	if k.Topics.Heartbeats == "" {
+		k.Topics.Heartbeats = "ispagent.heartbeats"
+	}
+	if k.BatchSize == 0 {
+		k.BatchSize = 100
+	}
+	if k.FlushIntervalSeconds == 0 {
+		k.FlushIntervalSeconds = 5
+	}
+	if k.TimeoutSeconds == 0 {
+		k.TimeoutSeconds = 10
+	}
+	k.Queue.setDefaults(name)
+}
+
+func (n *NATSConfig) setDefaults(name string) {
+	if n.SubjectPrefix == "" {
+		n.SubjectPrefix = "ispagent"
+	}
+	if n.BatchSize == 0 {
+		n.BatchSize = 100
+	}
+	if n.FlushIntervalSeconds == 0 {
+		n.FlushIntervalSeconds = 5
+	}
+	if n.TimeoutSeconds == 0 {
+		n.TimeoutSeconds = 10
+	}
+	n.Queue.setDefaults(name)
+}
+
+func (f *FileConfig) setDefaults(name string) {
+	if f.Directory == "" {
+		f.Directory = filepath.Join(exportBaseDir, name)
+	}
+	if f.Prefix == "" {
+		f.Prefix = "ispagent"
+	}
+	if f.MaxSizeMB == 0 {
+		f.MaxSizeMB = 100
+	}
+	if f.RotateIntervalMinutes == 0 {
+		f.RotateIntervalMinutes = 60
+	}
+	if f.MaxTotalSizeMB == 0 {
+		f.MaxTotalSizeMB = 10240
+	}
+}
+
+func (q *QueueConfig) setDefaults(name string) {
+	if q.Directory == "" {
+		q.Directory = filepath.Join(queueBaseDir, name)
+	}
+	if q.MaxSizeMB == 0 {
+		q.MaxSizeMB = 256
+	}
+}
+
+// validateOutputs checks every output and that there is at least one
+func (c *Config) validateOutputs() error {
+	outputs := c.OutputList()
+	if len(outputs) == 0 {
+		return fmt.Errorf("server.address or at least one output is required")
+	}
+
+	names := make(map[string]bool)
+	dirs := make(map[string]string) // Output by queue or export directory
+	for i, o := range outputs {
+		// Top-level sections report errors under their own name
+		field := o.Name
+		if i < len(c.Outputs) {
+			field = fmt.Sprintf("outputs[%d]", i)
+			if o.Type == "" {
+				return fmt.Errorf("%s.type is required", field)
+			}
+			if o.Name == "" {
+				o.Name = o.Type
+			}
+		}
+		if names[o.Name] {
+			return fmt.Errorf("duplicate output name %q", o.Name)
+		}
+		names[o.Name] = true
+
+		for _, pattern := range o.Routers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s.routers: invalid pattern %q", field, pattern)
+			}
+		}
+		for _, data := range o.Data {
+			if !outputDataTypes[data] {
+				return fmt.Errorf("%s.data: unknown data type %q", field, data)
+			}
+		}
+		if o.Buffer < 0 {
+			return fmt.Errorf("%s.buffer must not be negative", field)
+		}
+		if i < len(c.Outputs) {
+			if o.Type == OutputGRPC {
+				field += ".server"
+			} else {
+				field += "." + o.Type
+			}
+		}
+
+		var dir string
+		switch o.Type {
+		case OutputGRPC:
+			if o.Server.Address == "" {
+				return fmt.Errorf("%s.address is required", field)
+			}
+			dir = o.Server.Queue.Directory
+		case OutputPrometheus:
+		case OutputInfluxDB:
+			if o.InfluxDB.URL == "" {
+				return fmt.Errorf("%s.url is required", field)
+			}
+			if o.InfluxDB.Bucket == "" && o.InfluxDB.Database == "" {
+				return fmt.Errorf("%s.bucket or %s.database is required", field, field)
+			}
+			dir = o.InfluxDB.Queue.Directory
+		case OutputMQTT:
+			if o.MQTT.Broker == "" {
+				return fmt.Errorf("%s.broker is required", field)
+			}
+			if o.MQTT.QoS < 0 || o.MQTT.QoS > 2 {
+				return fmt.Errorf("%s.qos must be 0, 1 or 2", field)
+			}
+		case OutputKafka:
+			if len(o.Kafka.Brokers) == 0 {
+				return fmt.Errorf("%s.brokers is required", field)
+			}
+			dir = o.Kafka.Queue.Directory
+		case OutputNATS:
+			if o.NATS.URL == "" {
+				return fmt.Errorf("%s.url is required", field)
+			}
+			dir = o.NATS.Queue.Directory
+		case OutputFile:
+			if o.File.MaxSizeMB < 0 || o.File.RotateIntervalMinutes < 0 || o.File.MaxFiles < 0 || o.File.MaxTotalSizeMB < 0 || o.File.RetentionDays < 0 {
+				return fmt.Errorf("%s: sizes, intervals and limits must not be negative", field)
+			}
+			dir = o.File.Directory
+		default:
+			return fmt.Errorf("%s: unknown output type %q", field, o.Type)
+		}
+
+		if dir != "" {
+			if other, ok := dirs[dir]; ok {
+				return fmt.Errorf("outputs %s and %s share the directory %s", other, o.Name, dir)
+			}
+			dirs[dir] = o.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package natlog
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+)
+
+// LookupPath is the HTTP path served by Handler.
+const LookupPath = "/v1/nat/lookup"
+
+// Match is a lookup result as returned by the HTTP API.
+type Match struct {
+	RouterID       string    `json:"router_id"`
+	Source         string    `json:"source"`
+	Protocol       string    `json:"protocol,omitempty"`
+	PrivateAddress string    `json:"private_address"`
+	PrivatePort    int       `json:"private_port,omitempty"`
+	PublicAddress  string    `json:"public_address"`
+	PublicPortFrom int       `json:"public_port_from"`
+	PublicPortTo   int       `json:"public_port_to"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// LookupResponse is the body returned by the lookup endpoint.
+type LookupResponse struct {
+	Address  string    `json:"address"`
+	Port     int       `json:"port"`
+	Protocol string    `json:"protocol,omitempty"`
+	Time     time.Time `json:"time"`
+	Matches  []Match   `json:"matches"`
+}
+
+// Handler serves "who had address:port at time T" queries:
+//
+//	GET /v1/nat/lookup?address=203.0.113.5&port=40123&time=2024-01-01T12:00:00Z[&protocol=tcp]
+//
+// time defaults to now. If token is not empty, queries must carry it as a
+// bearer token ("Authorization: Bearer <token>"). Every query is written to
+// the audit log when one is given, since answering it discloses subscriber
+// identity; so are rejected tokens.
+func Handler(natLog *Log, token string, auditLogger *privacy.AuditLogger) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LookupPath, func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && !authorized(r, token) {
+			auditDenied(auditLogger, r)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="natlog"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+
+		addr, err := netip.ParseAddr(q.Get("address"))
+		if err != nil {
+			http.Error(w, "invalid or missing address", http.StatusBadRequest)
+			return
+		}
+
+		port, err := strconv.Atoi(q.Get("port"))
+		if err != nil || port < 0 || port > 65535 {
+			http.Error(w, "invalid or missing port", http.StatusBadRequest)
+			return
+		}
+
+		at := time.Now()
+		if ts := q.Get("time"); ts != "" {
+			if at, err = time.Parse(time.RFC3339, ts); err != nil {
+				http.Error(w, "invalid time, expected RFC 3339", http.StatusBadRequest)
+				return
+			}
+		}
+
+		protocol := q.Get("protocol")
+
+		records, err := natLog.Lookup(addr, port, protocol, at)
+		if err != nil {
+			log.Printf("NAT log lookup failed: %v", err)
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+
+		resp := LookupResponse{
+			Address:  addr.String(),
+			Port:     port,
+			Protocol: protocol,
+			Time:     at.UTC(),
+			Matches:  make([]Match, 0, len(records)),
+		}
+		for _, rec := range records {
+			resp.Matches = append(resp.Matches, Match{
+				RouterID:       rec.RouterID,
+				Source:         rec.Source,
+				Protocol:       rec.Protocol,
+				PrivateAddress: rec.PrivateAddr,
+				PrivatePort:    rec.PrivatePort,
+				PublicAddress:  rec.PublicAddr,
+				PublicPortFrom: rec.PortStart,
+				PublicPortTo:   rec.PortEnd,
+				FirstSeen:      time.Unix(rec.FirstSeen, 0).UTC(),
+				LastSeen:       time.Unix(rec.LastSeen, 0).UTC(),
+			})
+		}
+
+		if auditLogger != nil {
+			if err := auditLogger.Log(privacy.AuditEntry{
+				EventType:   "nat_lookup",
+				DataType:    "nat_translation",
+				RecordCount: len(resp.Matches),
+				Details: map[string]interface{}{
+					"query":  fmt.Sprintf("%s:%d", resp.Address, port),
+					"time":   resp.Time,
+					"remote": r.RemoteAddr,
+				},
+			}); err != nil {
+				log.Printf("Warning: Failed to log audit entry: %v", err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	return mux
+}
+
+// authorized reports whether r carries token as its bearer token.
+func authorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	scheme, given, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(given)), []byte(token)) == 1
+}
+
+// auditDenied records a query rejected for a missing or wrong token.
+func auditDenied(auditLogger *privacy.AuditLogger, r *http.Request) {
+	if auditLogger == nil {
+		return
+	}
+	if err := auditLogger.Log(privacy.AuditEntry{
+		EventType: "nat_lookup_denied",
+		DataType:  "nat_translation",
+		Details: map[string]interface{}{
+			"remote": r.RemoteAddr,
+		},
+	}); err != nil {
+		log.Printf("Warning: Failed to log audit entry: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package natlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+)
+
+func TestHandlerLookup(t *testing.T) {
+	l := openTestLog(t, Options{})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "100.64.0.10:51000", "203.0.113.5:40123")
+	snap.Commit()
+
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLogger, err := privacy.NewAuditLogger(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLogger.Close()
+
+	srv := httptest.NewServer(Handler(l, "", auditLogger))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + LookupPath + "?address=203.0.113.5&port=40123&time=2024-03-01T12:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var body LookupResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Matches) != 1 || body.Matches[0].PrivateAddress != "100.64.0.10" {
+		t.Errorf("unexpected matches %+v", body.Matches)
+	}
+
+	audit, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(audit), `"event_type":"nat_lookup"`) {
+		t.Errorf("expected lookup to be audited, got %q", audit)
+	}
+}
+
+func TestHandlerBadRequests(t *testing.T) {
+	l := openTestLog(t, Options{})
+	srv := httptest.NewServer(Handler(l, "", nil))
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing address", "?port=1"},
+		{"bad address", "?address=nope&port=1"},
+		{"missing port", "?address=203.0.113.5"},
+		{"port out of range", "?address=203.0.113.5&port=70000"},
+		{"bad time", "?address=203.0.113.5&port=1&time=yesterday"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + LookupPath + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandlerToken(t *testing.T) {
+	l := openTestLog(t, Options{})
+	srv := httptest.NewServer(Handler(l, "s3cret", nil))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "Basic s3cret", http.StatusUnauthorized},
+		{"token", "Bearer s3cret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+LookupPath+"?address=203.0.113.5&port=1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+// Package natlog keeps a local, queryable history of NAT translations so a
+// public address and port at a point in time can be mapped back to the
+// subscriber that was using it.
+package natlog
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record sources.
+const (
+	SourceConnection = "connection"
+	SourcePortBlock  = "port-block"
+)
+
+// Record is a single public-to-private mapping observed over a time span.
+type Record struct {
+	RouterID    string `json:"r"`
+	Source      string `json:"k"`
+	Protocol    string `json:"p,omitempty"`
+	PrivateAddr string `json:"sa"`
+	PrivatePort int    `json:"sp,omitempty"`
+	PublicAddr  string `json:"pa"`
+	PortStart   int    `json:"ps"`
+	PortEnd     int    `json:"pe"`
+	FirstSeen   int64  `json:"f"` // Unix seconds
+	LastSeen    int64  `json:"l"` // Unix seconds
+}
+
+// Covers reports whether the record maps the given public address and port
+// at time t, widening the observed span by tolerance on both sides.
+func (r *Record) Covers(addr netip.Addr, port int, protocol string, t time.Time, tolerance time.Duration) bool {
+	if r.PublicAddr != addr.String() {
+		return false
+	}
+	if port < r.PortStart || port > r.PortEnd {
+		return false
+	}
+	if protocol != "" && r.Protocol != "" && r.Protocol != protocol {
+		return false
+	}
+	ts := t.Unix()
+	tol := int64(tolerance / time.Second)
+	return ts >= r.FirstSeen-tol && ts <= r.LastSeen+tol
+}
+
+// Options configures a translation log.
+type Options struct {
+	// Directory holds the daily record files.
+	Directory string
+	// Retention is how long record files are kept.
+	Retention time.Duration
+	// MaxRecordSpan splits long-lived mappings into several records so they
+	// are persisted regularly instead of only when they end.
+	MaxRecordSpan time.Duration
+	// Tolerance widens observed spans when answering queries, to account
+	// for the time between two polls.
+	Tolerance time.Duration
+}
+
+// Log tracks active translations per router and persists them once they end.
+type Log struct {
+	opts  Options
+	store *store
+
+	mu      sync.Mutex
+	routers map[string]*routerState
+}
+
+// mappingKey identifies a mapping by its public side, which can belong to
+// only one subscriber at a time.
+type mappingKey struct {
+	source   string
+	protocol string
+	public   netip.AddrPort
+}
+
+type mapping struct {
+	private   netip.AddrPort
+	portEnd   uint16
+	firstSeen int64
+	lastSeen  int64
+	gen       uint64
+}
+
+type routerState struct {
+	mu     sync.Mutex
+	gen    uint64
+	active map[mappingKey]*mapping
+}
+
+// Open opens (or creates) a translation log in opts.Directory.
+func Open(opts Options) (*Log, error) {
+	if opts.Directory == "" {
+		return nil, fmt.Errorf("natlog directory is required")
+	}
+	if opts.MaxRecordSpan <= 0 {
+		opts.MaxRecordSpan = time.Hour
+	}
+
+	st, err := openStore(opts.Directory, opts.Retention)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{
+		opts:    opts,
+		store:   st,
+		routers: make(map[string]*routerState),
+	}, nil
+}
+
+// Snapshot collects the translations seen in one poll of a router. Mappings
+// are updated as they are added; mappings not seen again are only closed by
+// Commit, so an interrupted poll never ends mappings early. A snapshot is
+// ended with either Commit or Abort.
+type Snapshot struct {
+	log      *Log
+	routerID string
+	state    *routerState
+	gen      uint64
+	at       int64
+	closed   []Record
+}
+
+// Begin starts a snapshot for routerID taken at the given time.
+func (l *Log) Begin(routerID string, at time.Time) *Snapshot {
+	l.mu.Lock()
+	state, ok := l.routers[routerID]
+	if !ok {
+		state = &routerState{active: make(map[mappingKey]*mapping)}
+		l.routers[routerID] = state
+	}
+	l.mu.Unlock()
+
+	state.mu.Lock()
+	state.gen++
+	gen := state.gen
+	state.mu.Unlock()
+
+	return &Snapshot{
+		log:      l,
+		routerID: routerID,
+		state:    state,
+		gen:      gen,
+		at:       at.Unix(),
+	}
+}
+
+// AddConnection records a connection-tracking entry. private and public are
+// RouterOS "address:port" (or bare address) strings; entries that cannot be
+// parsed or were not translated are ignored.
+func (s *Snapshot) AddConnection(protocol, private, public string) {
+	priv, ok := parseAddrPort(private)
+	if !ok {
+		return
+	}
+	pub, ok := parseAddrPort(public)
+	if !ok || pub == priv {
+		return
+	}
+
+	s.add(mappingKey{source: SourceConnection, protocol: protocol, public: pub}, priv, pub.Port())
+}
+
+// AddPortBlock records a static allocation of a public port range to a
+// private address, as configured by a src-nat or netmap rule.
+func (s *Snapshot) AddPortBlock(private, public string, portStart, portEnd int) {
+	priv, err := netip.ParseAddr(private)
+	if err != nil {
+		return
+	}
+	pub, err := netip.ParseAddr(public)
+	if err != nil {
+		return
+	}
+	if portStart < 0 || portEnd > 65535 || portEnd < portStart {
+		return
+	}
+
+	key := mappingKey{source: SourcePortBlock, public: netip.AddrPortFrom(pub, uint16(portStart))}
+	s.add(key, netip.AddrPortFrom(priv, 0), uint16(portEnd))
+}
+
+func (s *Snapshot) add(key mappingKey, private netip.AddrPort, portEnd uint16) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+
+	m, ok := s.state.active[key]
+	if ok && (m.private != private || m.portEnd != portEnd) {
+		// The public side was reassigned to another subscriber.
+		s.closed = append(s.closed, *s.record(key, m))
+		ok = false
+	}
+	if ok {
+		m.lastSeen = s.at
+		m.gen = s.gen
+	} else {
+		s.state.active[key] = &mapping{
+			private:   private,
+			portEnd:   portEnd,
+			firstSeen: s.at,
+			lastSeen:  s.at,
+			gen:       s.gen,
+		}
+	}
+}
+
+// Commit ends mappings that were not seen in this snapshot and persists
+// them, along with segments of long-lived mappings.
+func (s *Snapshot) Commit() error {
+	maxSpan := int64(s.log.opts.MaxRecordSpan / time.Second)
+	records := s.closed
+	s.closed = nil
+
+	s.state.mu.Lock()
+	for key, m := range s.state.active {
+		switch {
+		case m.gen != s.gen:
+			records = append(records, *s.record(key, m))
+			delete(s.state.active, key)
+		case m.lastSeen-m.firstSeen >= maxSpan:
+			records = append(records, *s.record(key, m))
+			m.firstSeen = m.lastSeen
+		}
+	}
+	s.state.mu.Unlock()
+
+	return s.log.store.append(records...)
+}
+
+// Abort ends a snapshot whose poll failed. Mappings not seen stay active,
+// but the mappings already replaced by reassignments are persisted, as the
+// active state no longer holds them.
+func (s *Snapshot) Abort() error {
+	records := s.closed
+	s.closed = nil
+	return s.log.store.append(records...)
+}
+
+func (s *Snapshot) record(key mappingKey, m *mapping) *Record {
+	return newRecord(s.routerID, key, m)
+}
+
+func newRecord(routerID string, key mappingKey, m *mapping) *Record {
+	r := &Record{
+		RouterID:    routerID,
+		Source:      key.source,
+		Protocol:    key.protocol,
+		PrivateAddr: m.private.Addr().String(),
+		PrivatePort: int(m.private.Port()),
+		PublicAddr:  key.public.Addr().String(),
+		PortStart:   int(key.public.Port()),
+		PortEnd:     int(key.public.Port()),
+		FirstSeen:   m.firstSeen,
+		LastSeen:    m.lastSeen,
+	}
+	if key.source == SourcePortBlock {
+		r.PortEnd = int(m.portEnd)
+	}
+	return r
+}
+
+// Lookup returns every record that mapped the public address and port at
+// time t, from both active mappings and the files on disk. protocol may be
+// empty to match any protocol.
+func (l *Log) Lookup(addr netip.Addr, port int, protocol string, t time.Time) ([]Record, error) {
+	var matches []Record
+
+	l.mu.Lock()
+	states := make(map[string]*routerState, len(l.routers))
+	for id, st := range l.routers {
+		states[id] = st
+	}
+	l.mu.Unlock()
+
+	for routerID, st := range states {
+		st.mu.Lock()
+		for key, m := range st.active {
+			if key.public.Addr() != addr {
+				continue
+			}
+			r := newRecord(routerID, key, m)
+			if r.Covers(addr, port, protocol, t, l.opts.Tolerance) {
+				matches = append(matches, *r)
+			}
+		}
+		st.mu.Unlock()
+	}
+
+	from := t.Add(-l.opts.Tolerance)
+	to := t.Add(l.opts.Tolerance + l.opts.MaxRecordSpan)
+	stored, err := l.store.scan(from, to, func(r *Record) bool {
+		return r.Covers(addr, port, protocol, t, l.opts.Tolerance)
+	})
+	if err != nil {
+		return matches, err
+	}
+
+	return append(matches, stored...), nil
+}
+
+// Close persists all active mappings and closes the log.
+func (l *Log) Close() error {
+	var records []Record
+
+	l.mu.Lock()
+	for routerID, st := range l.routers {
+		st.mu.Lock()
+		for key, m := range st.active {
+			records = append(records, *newRecord(routerID, key, m))
+		}
+		st.active = make(map[mappingKey]*mapping)
+		st.mu.Unlock()
+	}
+	l.mu.Unlock()
+
+	if err := l.store.append(records...); err != nil {
+		l.store.close()
+		return err
+	}
+	return l.store.close()
+}
+
+// parseAddrPort parses RouterOS "address:port" strings, accepting a bare
+// address (port 0) for protocols without ports.
+func parseAddrPort(s string) (netip.AddrPort, bool) {
+	if s == "" {
+		return netip.AddrPort{}, false
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap, true
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.AddrPortFrom(addr, 0), true
+	}
+	return netip.AddrPort{}, false
+}
+
+// ParsePortRange parses a RouterOS port range such as "1024-2047" or "5000".
+func ParsePortRange(s string) (int, int, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, false
+	}
+
+	startStr, endStr, found := strings.Cut(s, "-")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	end := start
+	if found {
+		if end, err = strconv.Atoi(endStr); err != nil {
+			return 0, 0, false
+		}
+	}
+	if start < 0 || end > 65535 || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
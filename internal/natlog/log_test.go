@@ -0,0 +1,285 @@
+package natlog
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestLog(t *testing.T, opts Options) *Log {
+	t.Helper()
+
+	if opts.Directory == "" {
+		opts.Directory = t.TempDir()
+	}
+	l, err := Open(opts)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestOpenRequiresDirectory(t *testing.T) {
+	if _, err := Open(Options{}); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+func TestLookupActiveMapping(t *testing.T) {
+	l := openTestLog(t, Options{Tolerance: 30 * time.Second})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "100.64.0.10:51000", "203.0.113.5:40123")
+	if err := snap.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := l.Lookup(netip.MustParseAddr("203.0.113.5"), 40123, "tcp", t0.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	if matches[0].PrivateAddr != "100.64.0.10" || matches[0].PrivatePort != 51000 {
+		t.Errorf("unexpected subscriber %s:%d", matches[0].PrivateAddr, matches[0].PrivatePort)
+	}
+
+	// Outside the observed span plus tolerance
+	matches, _ = l.Lookup(netip.MustParseAddr("203.0.113.5"), 40123, "tcp", t0.Add(time.Hour))
+	if len(matches) != 0 {
+		t.Errorf("expected no match an hour later, got %d", len(matches))
+	}
+}
+
+func TestUntranslatedConnectionsIgnored(t *testing.T) {
+	l := openTestLog(t, Options{})
+	t0 := time.Now()
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "192.168.1.10:5000", "192.168.1.10:5000")
+	snap.AddConnection("tcp", "", "203.0.113.5:1000")
+	snap.AddConnection("tcp", "garbage", "203.0.113.5:1000")
+	snap.Commit()
+
+	if n := len(l.routers["r1"].active); n != 0 {
+		t.Errorf("expected no active mappings, got %d", n)
+	}
+}
+
+func TestEndedMappingIsPersisted(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, Options{Directory: dir})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("udp", "100.64.0.20:5353", "203.0.113.5:2000")
+	snap.Commit()
+
+	snap = l.Begin("r1", t0.Add(time.Minute))
+	snap.AddConnection("udp", "100.64.0.20:5353", "203.0.113.5:2000")
+	snap.Commit()
+
+	// Gone in the third poll
+	snap = l.Begin("r1", t0.Add(2*time.Minute))
+	snap.Commit()
+
+	if n := len(l.routers["r1"].active); n != 0 {
+		t.Fatalf("expected mapping to be closed, %d still active", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "natlog-20240301.jsonl")); err != nil {
+		t.Fatalf("expected record file: %v", err)
+	}
+
+	matches, err := l.Lookup(netip.MustParseAddr("203.0.113.5"), 2000, "", t0.Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 stored match, got %d", len(matches))
+	}
+	if matches[0].FirstSeen != t0.Unix() || matches[0].LastSeen != t0.Add(time.Minute).Unix() {
+		t.Errorf("unexpected span %d-%d", matches[0].FirstSeen, matches[0].LastSeen)
+	}
+}
+
+func TestInterruptedSnapshotKeepsMappings(t *testing.T) {
+	l := openTestLog(t, Options{})
+	t0 := time.Now()
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "100.64.0.10:1000", "203.0.113.5:1000")
+	snap.Commit()
+
+	// A poll that fails before Commit must not end the mapping
+	l.Begin("r1", t0.Add(time.Minute))
+
+	if n := len(l.routers["r1"].active); n != 1 {
+		t.Errorf("expected mapping to stay active, got %d", n)
+	}
+}
+
+func TestReassignedPublicPort(t *testing.T) {
+	l := openTestLog(t, Options{})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "100.64.0.10:1000", "203.0.113.5:40000")
+	snap.Commit()
+
+	snap = l.Begin("r1", t0.Add(5*time.Minute))
+	snap.AddConnection("tcp", "100.64.0.99:2000", "203.0.113.5:40000")
+	snap.Commit()
+
+	before, _ := l.Lookup(netip.MustParseAddr("203.0.113.5"), 40000, "tcp", t0)
+	after, _ := l.Lookup(netip.MustParseAddr("203.0.113.5"), 40000, "tcp", t0.Add(5*time.Minute))
+
+	if len(before) != 1 || before[0].PrivateAddr != "100.64.0.10" {
+		t.Errorf("expected first subscriber before reassignment, got %+v", before)
+	}
+	if len(after) != 1 || after[0].PrivateAddr != "100.64.0.99" {
+		t.Errorf("expected second subscriber after reassignment, got %+v", after)
+	}
+}
+
+func TestAbortedSnapshotPersistsReassignments(t *testing.T) {
+	l := openTestLog(t, Options{})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "100.64.0.10:1000", "203.0.113.5:40000")
+	snap.AddConnection("tcp", "100.64.0.11:1000", "203.0.113.5:40001")
+	snap.Commit()
+
+	// The poll fails after the first port was reassigned
+	snap = l.Begin("r1", t0.Add(5*time.Minute))
+	snap.AddConnection("tcp", "100.64.0.99:2000", "203.0.113.5:40000")
+	if err := snap.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := l.store.scan(t0, t0.Add(time.Hour), func(*Record) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].PrivateAddr != "100.64.0.10" {
+		t.Errorf("expected the replaced mapping to be persisted, got %+v", stored)
+	}
+	if n := len(l.routers["r1"].active); n != 2 {
+		t.Errorf("expected unseen mapping to stay active, got %d active", n)
+	}
+}
+
+func TestLongLivedMappingIsSegmented(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, Options{Directory: dir, MaxRecordSpan: 10 * time.Minute})
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i <= 10; i++ {
+		snap := l.Begin("r1", t0.Add(time.Duration(i)*time.Minute))
+		snap.AddConnection("tcp", "100.64.0.10:1000", "203.0.113.5:1000")
+		snap.Commit()
+	}
+
+	stored, err := l.store.scan(t0, t0.Add(time.Hour), func(*Record) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("expected a persisted segment, got %d records", len(stored))
+	}
+	if n := len(l.routers["r1"].active); n != 1 {
+		t.Errorf("mapping should remain active after segmenting, got %d", n)
+	}
+}
+
+func TestPortBlockLookup(t *testing.T) {
+	l := openTestLog(t, Options{})
+	t0 := time.Now()
+
+	snap := l.Begin("cgnat", t0)
+	snap.AddPortBlock("100.64.1.1", "203.0.113.9", 1024, 2047)
+	snap.AddPortBlock("100.64.1.2", "203.0.113.9", 2048, 3071)
+	snap.Commit()
+
+	matches, err := l.Lookup(netip.MustParseAddr("203.0.113.9"), 2500, "udp", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].PrivateAddr != "100.64.1.2" {
+		t.Fatalf("expected block owner 100.64.1.2, got %+v", matches)
+	}
+	if matches[0].Source != SourcePortBlock || matches[0].PortStart != 2048 || matches[0].PortEnd != 3071 {
+		t.Errorf("unexpected block record %+v", matches[0])
+	}
+}
+
+func TestCloseFlushesActiveMappings(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(Options{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := l.Begin("r1", t0)
+	snap.AddConnection("tcp", "100.64.0.10:1000", "203.0.113.5:1000")
+	snap.Commit()
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openTestLog(t, Options{Directory: dir})
+	matches, err := reopened.Lookup(netip.MustParseAddr("203.0.113.5"), 1000, "tcp", t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected mapping to survive restart, got %d matches", len(matches))
+	}
+}
+
+func TestRetentionPrunesOldFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "natlog-20000101.jsonl")
+	if err := os.WriteFile(old, []byte("{}\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	openTestLog(t, Options{Directory: dir, Retention: 24 * time.Hour})
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected expired file to be removed")
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		input      string
+		start, end int
+		ok         bool
+	}{
+		{"1024-2047", 1024, 2047, true},
+		{"5000", 5000, 5000, true},
+		{"", 0, 0, false},
+		{"2047-1024", 0, 0, false},
+		{"1-70000", 0, 0, false},
+		{"abc", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			start, end, ok := ParsePortRange(tt.input)
+			if ok != tt.ok || start != tt.start || end != tt.end {
+				t.Errorf("ParsePortRange(%q) = %d, %d, %v; want %d, %d, %v",
+					tt.input, start, end, ok, tt.start, tt.end, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package natlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	filePrefix = "natlog-"
+	fileSuffix = ".jsonl"
+	dayLayout  = "20060102"
+)
+
+// store appends records to one JSON-lines file per UTC day, named after the
+// day the record ended, and removes files older than the retention period.
+type store struct {
+	dir       string
+	retention time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	fileDay string
+}
+
+func openStore(dir string, retention time.Duration) (*store, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create natlog directory: %w", err)
+	}
+
+	s := &store{dir: dir, retention: retention}
+	if err := s.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *store) append(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range records {
+		day := time.Unix(records[i].LastSeen, 0).UTC().Format(dayLayout)
+		if err := s.openDay(day); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(&records[i])
+		if err != nil {
+			return fmt.Errorf("failed to marshal natlog record: %w", err)
+		}
+		if _, err := s.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write natlog record: %w", err)
+		}
+	}
+
+	// Records may be needed as evidence, so they are on disk before the
+	// mappings they close are forgotten.
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync natlog file: %w", err)
+	}
+	return nil
+}
+
+// openDay makes day's file the current one. Records are written roughly in
+// time order, so switching files is rare.
+func (s *store) openDay(day string) error {
+	if s.file != nil && s.fileDay == day {
+		return nil
+	}
+
+	if s.file != nil {
+		err := s.file.Sync()
+		if cerr := s.file.Close(); err == nil {
+			err = cerr
+		}
+		s.file = nil
+		if err != nil {
+			return fmt.Errorf("failed to close natlog file: %w", err)
+		}
+	}
+
+	path := filepath.Join(s.dir, filePrefix+day+fileSuffix)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open natlog file: %w", err)
+	}
+
+	if s.fileDay != "" && day > s.fileDay {
+		// New day: a good moment to drop expired files.
+		s.pruneLocked(time.Now())
+	}
+
+	s.file = file
+	s.fileDay = day
+	return nil
+}
+
+// scan returns records from the files covering [from, to] that match.
+func (s *store) scan(from, to time.Time, match func(*Record) bool) ([]Record, error) {
+	var matches []Record
+
+	first := from.UTC().Format(dayLayout)
+	last := to.UTC().Format(dayLayout)
+
+	days, err := s.days()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, day := range days {
+		if day < first || day > last {
+			continue
+		}
+		found, err := s.scanFile(filepath.Join(s.dir, filePrefix+day+fileSuffix), match)
+		if err != nil {
+			return matches, err
+		}
+		matches = append(matches, found...)
+	}
+
+	return matches, nil
+}
+
+func (s *store) scanFile(path string, match func(*Record) bool) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open natlog file: %w", err)
+	}
+	defer file.Close()
+
+	var matches []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A torn last line after a crash should not hide the rest.
+			continue
+		}
+		if match(&r) {
+			matches = append(matches, r)
+		}
+	}
+
+	return matches, scanner.Err()
+}
+
+// days lists the days that have a record file, oldest first.
+func (s *store) days() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list natlog directory: %w", err)
+	}
+
+	var days []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		days = append(days, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+	}
+	sort.Strings(days)
+
+	return days, nil
+}
+
+func (s *store) prune(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pruneLocked(now)
+}
+
+func (s *store) pruneLocked(now time.Time) error {
+	if s.retention <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-s.retention).UTC().Format(dayLayout)
+	days, err := s.days()
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		if day >= cutoff || day == s.fileDay {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, filePrefix+day+fileSuffix)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove expired natlog file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *store) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		err := s.file.Sync()
+		if cerr := s.file.Close(); err == nil {
+			err = cerr
+		}
+		s.file = nil
+		return err
+	}
+	return nil
+}
@@ -4,14 +4,22 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"net"
+	"net/netip"
 	"regexp"
 	"strings"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
 )
 
+// DefaultIPv6PrefixLength is the number of leading bits kept when redacting
+// IPv6 addresses
+const DefaultIPv6PrefixLength = 48
+
 // Redactor provides data redaction utilities
 type Redactor struct {
 	redactUsernames   bool
 	redactIPAddresses bool
+	ipv6PrefixLength  int
 }
 
 // NewRedactor creates a new redactor with the given settings
@@ -19,7 +27,21 @@ func NewRedactor(redactUsernames, redactIPAddresses bool) *Redactor {
 	return &Redactor{
 		redactUsernames:   redactUsernames,
 		redactIPAddresses: redactIPAddresses,
+		ipv6PrefixLength:  DefaultIPv6PrefixLength,
+	}
+}
+
+// WithIPv6PrefixLength sets how many leading bits of IPv6 addresses are kept
+// when redacting (0-128)
+func (r *Redactor) WithIPv6PrefixLength(bits int) *Redactor {
+	if bits < 0 {
+		bits = 0
+	}
+	if bits > 128 {
+		bits = 128
 	}
+	r.ipv6PrefixLength = bits
+	return r
 }
 
 // RedactUsername redacts a username if enabled
@@ -30,12 +52,17 @@ func (r *Redactor) RedactUsername(username string) string {
 	return r.hashString(username)
 }
 
-// RedactIPAddress redacts an IP address if enabled
+// RedactIPAddress redacts an IP address if enabled. Prefixes in CIDR
+// notation, such as delegated IPv6 prefixes, are redacted the same way.
 func (r *Redactor) RedactIPAddress(ip string) string {
 	if !r.redactIPAddresses || ip == "" {
 		return ip
 	}
 
+	if strings.Contains(ip, "/") {
+		return r.redactPrefix(ip)
+	}
+
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
 		return ip
@@ -46,8 +73,35 @@ func (r *Redactor) RedactIPAddress(ip string) string {
 		return fmt.Sprintf("%d.%d.xxx.xxx", ipv4[0], ipv4[1])
 	}
 
-	// For IPv6, keep prefix, redact interface ID
-	return r.hashString(ip)[:8] + "::xxxx"
+	// For IPv6, keep the configured prefix, e.g. 2001:db8:1234::/48
+	addr, _ := netip.AddrFromSlice(parsedIP)
+	return r.redactIPv6(addr, 128)
+}
+
+// redactPrefix redacts an address prefix, never making it more specific
+func (r *Redactor) redactPrefix(s string) string {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return s
+	}
+
+	if prefix.Addr().Is4() {
+		return r.RedactIPAddress(prefix.Addr().String())
+	}
+
+	return r.redactIPv6(prefix.Addr(), prefix.Bits())
+}
+
+func (r *Redactor) redactIPv6(addr netip.Addr, bits int) string {
+	if r.ipv6PrefixLength < bits {
+		bits = r.ipv6PrefixLength
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return r.hashString(addr.String())[:8] + "::xxxx"
+	}
+	return prefix.String()
 }
 
 // RedactMACAddress redacts a MAC address by keeping only the OUI (first 3 octets)
@@ -65,6 +119,66 @@ func (r *Redactor) RedactMACAddress(mac string) string {
 	return strings.Join(parts[:3], ":") + ":xx:xx:xx"
 }
 
+// Patterns of subscriber details in free text, such as router log lines
+var (
+	textIPv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?:/\d{1,2})?\b`)
+	textIPv6Pattern = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}(?:/\d{1,3})?`)
+	textMACPattern  = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[:-][0-9a-f]{2}){5}\b`)
+	// PPP interfaces such as <pppoe-alice>, "user alice" and PPP log
+	// lines such as "alice logged in, 100.64.0.10"
+	textPPPInterfacePattern = regexp.MustCompile(`<(pppoe|pptp|l2tp|sstp|ovpn|ppp)-([^>]+)>`)
+	textUserPattern         = regexp.MustCompile(`\buser (\S+)`)
+	textLoggedPattern       = regexp.MustCompile(`^([^\s,]+) (logged (?:in|out))`)
+)
+
+// RedactText redacts the usernames and addresses found in free text, such
+// as router log lines, as the other methods would redact them. Usernames
+// are only recognized in PPP interface names, after "user" and in PPP
+// login messages.
+func (r *Redactor) RedactText(s string) string {
+	if r.redactUsernames {
+		s = textPPPInterfacePattern.ReplaceAllStringFunc(s, func(m string) string {
+			sub := textPPPInterfacePattern.FindStringSubmatch(m)
+			return "<" + sub[1] + "-" + r.RedactUsername(sub[2]) + ">"
+		})
+		s = textUserPattern.ReplaceAllStringFunc(s, func(m string) string {
+			return "user " + r.RedactUsername(m[len("user "):])
+		})
+		if sub := textLoggedPattern.FindStringSubmatch(s); sub != nil && sub[1] != "user" {
+			s = r.RedactUsername(sub[1]) + " " + sub[2] + s[len(sub[0]):]
+		}
+	}
+	if r.redactIPAddresses {
+		s = textMACPattern.ReplaceAllStringFunc(s, r.RedactMACAddress)
+		s = textIPv6Pattern.ReplaceAllStringFunc(s, func(m string) string {
+			addr, _, _ := strings.Cut(m, "/")
+			if ip, err := netip.ParseAddr(addr); err != nil || !ip.Is6() {
+				return m
+			}
+			return r.RedactIPAddress(m)
+		})
+		s = textIPv4Pattern.ReplaceAllStringFunc(s, r.RedactIPAddress)
+	}
+	return s
+}
+
+// RedactEvent returns a copy of an event with its message and attribute
+// values redacted by RedactText
+func (r *Redactor) RedactEvent(e models.Event) models.Event {
+	if !r.redactUsernames && !r.redactIPAddresses {
+		return e
+	}
+	e.Message = r.RedactText(e.Message)
+	if e.Attributes != nil {
+		attrs := make(map[string]string, len(e.Attributes))
+		for k, v := range e.Attributes {
+			attrs[k] = r.RedactText(v)
+		}
+		e.Attributes = attrs
+	}
+	return e
+}
+
 // hashString creates a deterministic hash of a string
 func (r *Redactor) hashString(s string) string {
 	hash := sha256.Sum256([]byte(s))
@@ -80,3 +194,9 @@ func (r *Redactor) ShouldRedactUsernames() bool {
 func (r *Redactor) ShouldRedactIPAddresses() bool {
 	return r.redactIPAddresses
 }
+
+// IPv6PrefixLength returns the number of leading bits kept when redacting
+// IPv6 addresses
+func (r *Redactor) IPv6PrefixLength() int {
+	return r.ipv6PrefixLength
+}
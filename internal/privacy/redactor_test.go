@@ -71,6 +71,33 @@ func TestRedactor_RedactIPAddress(t *testing.T) {
 	}
 }
 
+func TestRedactor_RedactIPv6PrefixLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		bits     int
+		ip       string
+		expected string
+	}{
+		{"default", DefaultIPv6PrefixLength, "2001:db8:1234:5678::1", "2001:db8:1234::/48"},
+		{"site prefix", 56, "2001:db8:1234:5678::1", "2001:db8:1234:5600::/56"},
+		{"allocation", 32, "2001:db8:1234:5678::1", "2001:db8::/32"},
+		{"delegated prefix kept less specific", 56, "2001:db8:1200::/40", "2001:db8:1200::/40"},
+		{"delegated prefix truncated", 48, "2001:db8:1234:5600::/56", "2001:db8:1234::/48"},
+		{"ipv4 prefix", 48, "100.64.12.0/24", "100.64.xxx.xxx"},
+		{"clamped", 200, "2001:db8::1", "2001:db8::1/128"},
+		{"invalid prefix", 48, "2001:db8::/200", "2001:db8::/200"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRedactor(false, true).WithIPv6PrefixLength(tt.bits)
+			if result := r.RedactIPAddress(tt.ip); result != tt.expected {
+				t.Errorf("RedactIPAddress(%q) = %q, want %q", tt.ip, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestRedactor_RedactMACAddress(t *testing.T) {
 	r := NewRedactor(false, false)
 
@@ -93,3 +120,35 @@ func TestRedactor_RedactMACAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestRedactor_RedactText(t *testing.T) {
+	alice := NewRedactor(true, false).RedactUsername("alice")
+	admin := NewRedactor(true, false).RedactUsername("admin")
+	tests := []struct {
+		name      string
+		usernames bool
+		ips       bool
+		text      string
+		want      string
+	}{
+		{"disabled", false, false, "<pppoe-alice>: 100.64.0.10", "<pppoe-alice>: 100.64.0.10"},
+		{"ppp interface", true, false, "<pppoe-alice>: authenticated", "<pppoe-" + alice + ">: authenticated"},
+		{"ppp login", true, false, "alice logged in, 100.64.0.10", alice + " logged in, 100.64.0.10"},
+		{"user", true, false, "login failure for user admin from 10.0.0.5 via ssh", "login failure for user " + admin + " from 10.0.0.5 via ssh"},
+		{"admin login", true, false, "user admin logged in via winbox", "user " + admin + " logged in via winbox"},
+		{"ipv4", false, true, "alice logged in, 100.64.0.10", "alice logged in, 100.64.xxx.xxx"},
+		{"ipv4 prefix", false, true, "route 100.64.0.0/10 added", "route 100.64.xxx.xxx added"},
+		{"ipv6", false, true, "address 2001:db8:1234:5678::10 assigned", "address 2001:db8:1234::/48 assigned"},
+		{"mac", false, true, "device AA:BB:CC:00:00:01 moved", "device AA:BB:CC:xx:xx:xx moved"},
+		{"time left alone", false, true, "at 12:00:00 port 8080", "at 12:00:00 port 8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRedactor(tt.usernames, tt.ips)
+			if got := r.RedactText(tt.text); got != tt.want {
+				t.Errorf("RedactText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+// Package promexport serves the latest data collected from each router as
+// Prometheus metrics, along with metrics about the agent itself.
+package promexport
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/version"
+)
+
+// MetricsPath is the HTTP path served by Handler
+const MetricsPath = "/metrics"
+
+// DefaultMaxSubscriberSeries bounds per-subscriber series per router unless
+// Options.MaxSubscriberSeries is set
+const DefaultMaxSubscriberSeries = 1000
+
+// Options configures an Exporter
+type Options struct {
+	// Subscribers exports per-subscriber series: PPPoE sessions, their
+	// dynamic interfaces and NAT top sources. They are left out by default,
+	// as a large concentrator has thousands of them.
+	Subscribers bool
+	// MaxSubscriberSeries bounds the subscriber series exported per router;
+	// the rest are dropped and counted
+	MaxSubscriberSeries int
+	// Redactor, if set, redacts usernames and addresses in subscriber labels
+	Redactor *privacy.Redactor
+	// Stats returns the scheduler counters for the agent self-metrics
+	Stats func() scheduler.Stats
+}
+
+// Exporter keeps the latest data collected from each router and exposes it
+// in the Prometheus format. Routers keep their last data when a collection
+// fails; ispagent_router_up tells whether it is current.
+type Exporter struct {
+	opts     Options
+	registry *prometheus.Registry
+
+	collections *prometheus.CounterVec
+	duration    prometheus.Histogram
+
+	mu      sync.Mutex
+	routers map[string]*snapshot
+}
+
+// snapshot is the latest state of one router
+type snapshot struct {
+	router      *models.RouterConfig
+	metrics     *models.MetricsData
+	data        *mikrotik.CollectedData // Set for MikroTik routers
+	up          bool
+	duration    time.Duration
+	lastSuccess time.Time
+}
+
+// New creates an exporter
+func New(opts Options) *Exporter {
+	if opts.MaxSubscriberSeries <= 0 {
+		opts.MaxSubscriberSeries = DefaultMaxSubscriberSeries
+	}
+
+	e := &Exporter{
+		opts:     opts,
+		registry: prometheus.NewRegistry(),
+		collections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ispagent_collections_total",
+			Help: "Router collections by result.",
+		}, []string{"result"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ispagent_collection_duration_seconds",
+			Help:    "Time taken by router collections, including failed ones.",
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}),
+		routers: make(map[string]*snapshot),
+	}
+
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "ispagent_build_info",
+		Help:        "Agent version; always 1.",
+		ConstLabels: prometheus.Labels{"version": version.GetVersion()},
+	})
+	buildInfo.Set(1)
+
+	e.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo,
+		e.collections,
+		e.duration,
+		(*routerCollector)(e),
+	)
+	return e
+}
+
+// Observe records the outcome of a collection; it is meant to be called
+// from the scheduler's OnResult
+func (e *Exporter) Observe(result scheduler.Result) {
+	outcome := "success"
+	if result.Err != nil {
+		outcome = "error"
+	}
+	e.collections.WithLabelValues(outcome).Inc()
+	e.duration.Observe(result.Duration.Seconds())
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	snap := e.snapshot(result.Router.ID)
+	snap.router = result.Router
+	snap.up = result.Err == nil
+	snap.duration = result.Duration
+	if result.Err != nil {
+		return
+	}
+	snap.lastSuccess = result.Started.Add(result.Duration)
+	snap.metrics = result.Metrics
+	// Data handed to Update belongs to this collection only if it carries
+	// the same base model; otherwise it is left from an earlier one
+	if snap.data != nil && snap.data.MetricsData != result.Metrics {
+		snap.data = nil
+	}
+}
+
+// Update stores the full data of a MikroTik collection; it is meant to be
+// registered with the MikroTik collector's SetDataHandler
+func (e *Exporter) Update(data *mikrotik.CollectedData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.snapshot(data.RouterID).data = data
+}
+
+// Handler serves the metrics at MetricsPath
+func (e *Exporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+	return mux
+}
+
+// Registry returns the registry holding all exported metrics
+func (e *Exporter) Registry() *prometheus.Registry {
+	return e.registry
+}
+
+// snapshot returns the snapshot of a router, creating it if needed. Callers
+// must hold e.mu.
+func (e *Exporter) snapshot(routerID string) *snapshot {
+	snap, ok := e.routers[routerID]
+	if !ok {
+		snap = &snapshot{}
+		e.routers[routerID] = snap
+	}
+	return snap
+}
+
+// routerCollector builds the router metrics from the snapshots on every
+// scrape. It is unchecked, as the custom metrics of collectors are only
+// known once collected.
+type routerCollector Exporter
+
+func (c *routerCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *routerCollector) Collect(ch chan<- prometheus.Metric) {
+	e := (*Exporter)(c)
+
+	e.mu.Lock()
+	ids := make([]string, 0, len(e.routers))
+	snaps := make(map[string]snapshot, len(e.routers))
+	for id, snap := range e.routers {
+		if snap.router == nil {
+			continue // Update without a finished collection yet
+		}
+		ids = append(ids, id)
+		snaps[id] = *snap
+	}
+	e.mu.Unlock()
+	sort.Strings(ids)
+
+	if e.opts.Stats != nil {
+		stats := e.opts.Stats()
+		ch <- prometheus.MustNewConstMetric(schedulerMissedDesc, prometheus.CounterValue, float64(stats.Missed))
+		ch <- prometheus.MustNewConstMetric(schedulerInFlightDesc, prometheus.GaugeValue, float64(stats.InFlight))
+	}
+
+	w := &writer{ch: ch, opts: &e.opts, customLabels: make(map[string]string)}
+	for _, id := range ids {
+		snap := snaps[id]
+		w.router = id
+		w.subscriberSeries = 0
+		w.sent = make(map[seriesKey]struct{})
+		w.writeRouter(&snap)
+	}
+}
+
+// writer sends the metrics of one router after another
+type writer struct {
+	ch   chan<- prometheus.Metric
+	opts *Options
+
+	router           string
+	subscriberSeries int
+	// sent holds the series of the router, as redacted labels can collide
+	sent map[seriesKey]struct{}
+	// customLabels holds the label names first seen for each custom metric,
+	// as a metric family cannot mix label names
+	customLabels map[string]string
+}
+
+// seriesKey identifies a series of the router being written; name is set
+// for custom metrics, whose descriptions are created on the fly
+type seriesKey struct {
+	desc   *prometheus.Desc
+	name   string
+	labels string
+}
+
+func (w *writer) gauge(desc *prometheus.Desc, value float64, labels ...string) {
+	w.send(seriesKey{desc: desc}, desc, prometheus.GaugeValue, value, labels)
+}
+
+func (w *writer) counter(desc *prometheus.Desc, value float64, labels ...string) {
+	w.send(seriesKey{desc: desc}, desc, prometheus.CounterValue, value, labels)
+}
+
+// send sends a series of the router unless it was already sent
+func (w *writer) send(key seriesKey, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels []string) {
+	key.labels = strings.Join(labels, "\xff")
+	if _, ok := w.sent[key]; ok {
+		return
+	}
+	w.sent[key] = struct{}{}
+	w.ch <- prometheus.MustNewConstMetric(desc, valueType, value, append([]string{w.router}, labels...)...)
+}
+
+// subscriber reports whether another subscriber series may be sent and
+// counts it
+func (w *writer) subscriber() bool {
+	if !w.opts.Subscribers {
+		return false
+	}
+	w.subscriberSeries++
+	return w.subscriberSeries <= w.opts.MaxSubscriberSeries
+}
+
+func (w *writer) redactUsername(s string) string {
+	if w.opts.Redactor == nil {
+		return s
+	}
+	return w.opts.Redactor.RedactUsername(s)
+}
+
+func (w *writer) redactAddress(s string) string {
+	if w.opts.Redactor == nil {
+		return s
+	}
+	return w.opts.Redactor.RedactIPAddress(s)
+}
+
+func (w *writer) writeRouter(snap *snapshot) {
+	w.gauge(routerUpDesc, boolValue(snap.up))
+	w.gauge(routerDurationDesc, snap.duration.Seconds())
+	if snap.lastSuccess.IsZero() || snap.metrics == nil {
+		return
+	}
+	w.gauge(routerLastSuccessDesc, float64(snap.lastSuccess.UnixNano())/1e9)
+
+	sys := snap.metrics.System
+	w.gauge(routerInfoDesc, 1, snap.router.Name, snap.router.Type, sys.FirmwareVersion, sys.BoardName)
+	// System metrics are missing if the output pipeline filtered them out
+	if sys != (models.SystemMetrics{}) {
+		w.gauge(cpuDesc, sys.CPUPercent)
+		w.gauge(memoryPercentDesc, sys.MemoryPercent)
+		w.gauge(memoryTotalDesc, float64(sys.MemoryTotalBytes))
+		w.gauge(memoryUsedDesc, float64(sys.MemoryUsedBytes))
+		w.gauge(uptimeDesc, float64(sys.UptimeSeconds))
+	}
+	if sys.TemperatureCelsius != 0 {
+		w.gauge(temperatureDesc, sys.TemperatureCelsius)
+	}
+
+	if snap.data != nil {
+		w.writeInterfaces(snap.data.Interfaces)
+		w.writeMikroTik(snap.data)
+	} else {
+		ifaces := make([]mikrotik.InterfaceMetrics, len(snap.metrics.Interfaces))
+		for i, iface := range snap.metrics.Interfaces {
+			ifaces[i].InterfaceMetrics = iface
+		}
+		w.writeInterfaces(ifaces)
+	}
+	w.writeCustom(snap.metrics.CustomMetrics)
+
+	dropped := 0
+	if w.subscriberSeries > w.opts.MaxSubscriberSeries {
+		dropped = w.subscriberSeries - w.opts.MaxSubscriberSeries
+	}
+	w.gauge(droppedDesc, float64(dropped))
+}
+
+func (w *writer) writeInterfaces(ifaces []mikrotik.InterfaceMetrics) {
+	for i := range ifaces {
+		iface := &ifaces[i]
+		name := iface.Name
+		if iface.IsSubscriber() {
+			if !w.subscriber() {
+				continue
+			}
+			if user, ok := strings.CutPrefix(strings.TrimSuffix(name, ">"), "<pppoe-"); ok {
+				name = "<pppoe-" + w.redactUsername(user) + ">"
+			}
+		}
+
+		w.gauge(ifaceUpDesc, boolValue(iface.IsUp), name)
+		if iface.SpeedMbps > 0 {
+			w.gauge(ifaceSpeedDesc, float64(iface.SpeedMbps)*1e6, name)
+		}
+		w.counter(ifaceRxBytesDesc, float64(iface.RxBytes), name)
+		w.counter(ifaceTxBytesDesc, float64(iface.TxBytes), name)
+		w.counter(ifaceRxPacketsDesc, float64(iface.RxPackets), name)
+		w.counter(ifaceTxPacketsDesc, float64(iface.TxPackets), name)
+		w.counter(ifaceRxErrorsDesc, float64(iface.RxErrors), name)
+		w.counter(ifaceTxErrorsDesc, float64(iface.TxErrors), name)
+		w.counter(ifaceRxDropsDesc, float64(iface.RxDrops), name)
+		w.counter(ifaceTxDropsDesc, float64(iface.TxDrops), name)
+	}
+}
+
+func (w *writer) writeMikroTik(data *mikrotik.CollectedData) {
+	w.gauge(collectionErrorsDesc, float64(len(data.Errors)))
+
+	if data.System != nil && data.System.DiskTotalBytes > 0 {
+		w.gauge(diskTotalDesc, float64(data.System.DiskTotalBytes))
+		w.gauge(diskUsedDesc, float64(data.System.DiskUsedBytes))
+	}
+
+	if data.PPPoE != nil || data.PPPoEServers != nil {
+		w.gauge(pppoeSessionsDesc, float64(data.PPPoESessionCount()))
+	}
+	for _, server := range data.PPPoEServers {
+		w.gauge(pppoeServerSessionsDesc, float64(server.ActiveSessions), server.ServerName, server.Interface)
+	}
+	for _, session := range data.PPPoE {
+		if !w.subscriber() {
+			continue
+		}
+		user := w.redactUsername(session.Username)
+		w.counter(sessionRxBytesDesc, float64(session.RxBytes), user)
+		w.counter(sessionTxBytesDesc, float64(session.TxBytes), user)
+		w.gauge(sessionUptimeDesc, float64(session.Uptime), user)
+	}
+
+	for _, pool := range data.DHCPPools {
+		w.gauge(poolSizeDesc, float64(pool.TotalAddresses), pool.Name)
+		w.gauge(poolUsedDesc, float64(pool.UsedAddresses), pool.Name)
+		w.gauge(poolUtilizationDesc, pool.Utilization/100, pool.Name)
+	}
+	for _, server := range data.DHCPServers {
+		w.gauge(dhcpLeasesDesc, float64(server.TotalLeases), server.Name)
+		w.gauge(dhcpActiveLeasesDesc, float64(server.ActiveLeases), server.Name)
+	}
+
+	if stats := data.NATStats; stats != nil {
+		w.gauge(natConnectionsDesc, float64(stats.TotalConnections))
+		w.gauge(natProtocolDesc, float64(stats.TCPConnections), "tcp")
+		w.gauge(natProtocolDesc, float64(stats.UDPConnections), "udp")
+		w.gauge(natProtocolDesc, float64(stats.ICMPConnections), "icmp")
+		w.gauge(natProtocolDesc, float64(stats.OtherConnections), "other")
+		if stats.MaxEntries > 0 {
+			w.gauge(natMaxEntriesDesc, float64(stats.MaxEntries))
+		}
+	}
+	if data.NATAggregates != nil {
+		for _, t := range data.NATAggregates.Sources.All() {
+			if !w.subscriber() {
+				continue
+			}
+			address := w.redactAddress(t.Key)
+			w.gauge(natTopSourceBytesDesc, float64(t.Bytes), address)
+			w.gauge(natTopSourceConnectionsDesc, float64(t.Connections), address)
+		}
+	}
+}
+
+// writeCustom exports collector-specific values, such as
+// probe_rtt_avg_ms{target="1.1.1.1"}, as ispagent_ metrics
+func (w *writer) writeCustom(metrics map[string]float64) {
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name, labels, ok := collector.ParseMetricKey(key)
+		if !ok {
+			continue
+		}
+
+		names := []string{"router"}
+		var values []string
+		for _, l := range labels {
+			if l[0] == "router" {
+				ok = false
+			}
+			names = append(names, l[0])
+			values = append(values, l[1])
+		}
+		if !ok {
+			continue
+		}
+		if first, seen := w.customLabels[name]; !seen {
+			w.customLabels[name] = strings.Join(names, ",")
+		} else if first != strings.Join(names, ",") {
+			continue
+		}
+
+		desc := prometheus.NewDesc("ispagent_"+name, "Collector-specific value "+name+".", names, nil)
+		w.send(seriesKey{name: name}, desc, prometheus.GaugeValue, metrics[key], values)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
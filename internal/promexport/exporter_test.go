@@ -0,0 +1,208 @@
+package promexport
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func testData(routerID string) *mikrotik.CollectedData {
+	iface := func(name, typ string, rx int64) mikrotik.InterfaceMetrics {
+		return mikrotik.InterfaceMetrics{
+			InterfaceMetrics: models.InterfaceMetrics{Name: name, IsUp: true, SpeedMbps: 1000, RxBytes: rx},
+			Type:             typ,
+		}
+	}
+	data := &mikrotik.CollectedData{
+		MetricsData: &models.MetricsData{
+			RouterID: routerID,
+			System:   models.SystemMetrics{CPUPercent: 12, MemoryTotalBytes: 1024, FirmwareVersion: "7.14.3", BoardName: "CCR2004"},
+			CustomMetrics: map[string]float64{
+				`probe_rtt_avg_ms{target="1.1.1.1"}`: 4.5,
+				`posture_findings{severity="high"}`:  1,
+				`broken{label=unquoted}`:             1,
+			},
+		},
+		Interfaces: []mikrotik.InterfaceMetrics{
+			iface("ether1", "ether", 1000),
+			iface("<pppoe-alice>", "pppoe-in", 10),
+			iface("<pppoe-bob>", "pppoe-in", 20),
+		},
+		PPPoE: []mikrotik.PPPoESession{
+			{Username: "alice", RxBytes: 10, Uptime: 60},
+			{Username: "bob", RxBytes: 20, Uptime: 120},
+		},
+		PPPoEServers: []mikrotik.PPPoEServerStats{{ServerName: "pppoe1", Interface: "ether2", ActiveSessions: 2}},
+		DHCPPools:    []mikrotik.DHCPPoolStats{{Name: "dhcp_pool1", TotalAddresses: 200, UsedAddresses: 50, Utilization: 25}},
+		DHCPServers:  []mikrotik.DHCPServerStats{{Name: "dhcp1", TotalLeases: 60, ActiveLeases: 50}},
+		NATStats:     &mikrotik.NATStats{TotalConnections: 30, TCPConnections: 20, UDPConnections: 10, MaxEntries: 1000},
+		NATAggregates: &mikrotik.NATAggregates{Sources: mikrotik.NATTopList{
+			ByBytes:       []mikrotik.NATTalker{{Key: "100.64.0.10", Connections: 5, Bytes: 2000}, {Key: "100.64.0.11", Connections: 9, Bytes: 1000}},
+			ByConnections: []mikrotik.NATTalker{{Key: "100.64.0.11", Connections: 9, Bytes: 1000}, {Key: "100.64.0.10", Connections: 5, Bytes: 2000}},
+		}},
+		Errors: []string{"ipv6: no such command prefix"},
+	}
+	return data
+}
+
+func collect(e *Exporter, router *models.RouterConfig, data *mikrotik.CollectedData) {
+	e.Update(data)
+	e.Observe(scheduler.Result{
+		Router:   router,
+		Metrics:  data.MetricsData,
+		Started:  time.Now(),
+		Duration: 250 * time.Millisecond,
+	})
+}
+
+func scrape(t *testing.T, e *Exporter) string {
+	t.Helper()
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + MetricsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func checkLines(t *testing.T, body string, want, notWant []string) {
+	t.Helper()
+	for _, line := range want {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %s", line)
+		}
+	}
+	for _, s := range notWant {
+		if strings.Contains(body, s) {
+			t.Errorf("unexpected %s", s)
+		}
+	}
+}
+
+func TestExporter_Metrics(t *testing.T) {
+	e := New(Options{Stats: func() scheduler.Stats { return scheduler.Stats{Missed: 3, InFlight: 1} }})
+	router := &models.RouterConfig{ID: "r1", Name: "core", Type: "mikrotik"}
+	collect(e, router, testData("r1"))
+
+	// A generic collector without full data
+	e.Observe(scheduler.Result{
+		Router: &models.RouterConfig{ID: "switch", Type: "snmp"},
+		Metrics: &models.MetricsData{
+			RouterID:      "switch",
+			Interfaces:    []models.InterfaceMetrics{{Name: "pon1", IsUp: true, TxBytes: 5}},
+			CustomMetrics: map[string]float64{`probe_rtt_avg_ms{check="icmp"}`: 1},
+		},
+		Started: time.Now(),
+	})
+
+	body := scrape(t, e)
+	checkLines(t, body, []string{
+		`ispagent_router_up{router="r1"} 1`,
+		`ispagent_router_collection_duration_seconds{router="r1"} 0.25`,
+		`ispagent_router_info{board="CCR2004",name="core",router="r1",type="mikrotik",version="7.14.3"} 1`,
+		`ispagent_router_cpu_percent{router="r1"} 12`,
+		`ispagent_router_memory_total_bytes{router="r1"} 1024`,
+		`ispagent_router_collection_errors{router="r1"} 1`,
+		`ispagent_interface_up{interface="ether1",router="r1"} 1`,
+		`ispagent_interface_speed_bits_per_second{interface="ether1",router="r1"} 1e+09`,
+		`ispagent_interface_receive_bytes_total{interface="ether1",router="r1"} 1000`,
+		`ispagent_interface_transmit_bytes_total{interface="pon1",router="switch"} 5`,
+		`ispagent_pppoe_sessions{router="r1"} 2`,
+		`ispagent_pppoe_server_sessions{interface="ether2",router="r1",server="pppoe1"} 2`,
+		`ispagent_dhcp_pool_utilization_ratio{pool="dhcp_pool1",router="r1"} 0.25`,
+		`ispagent_dhcp_server_active_leases{router="r1",server="dhcp1"} 50`,
+		`ispagent_nat_connections{router="r1"} 30`,
+		`ispagent_nat_protocol_connections{protocol="udp",router="r1"} 10`,
+		`ispagent_nat_max_entries{router="r1"} 1000`,
+		`ispagent_probe_rtt_avg_ms{router="r1",target="1.1.1.1"} 4.5`,
+		`ispagent_posture_findings{router="r1",severity="high"} 1`,
+		`ispagent_exporter_subscriber_series_dropped{router="r1"} 0`,
+		`ispagent_scheduler_missed_intervals_total 3`,
+		`ispagent_scheduler_collections_in_flight 1`,
+		`ispagent_collections_total{result="success"} 2`,
+	}, []string{
+		// Subscriber series are off by default
+		"pppoe-alice",
+		"ispagent_pppoe_session_",
+		"ispagent_nat_top_source",
+		// Custom metrics must keep the label names first seen
+		"ispagent_probe_rtt_avg_ms{check=",
+		"ispagent_broken",
+	})
+	if !strings.Contains(body, "go_goroutines ") || !strings.Contains(body, "ispagent_build_info{") {
+		t.Error("missing agent self-metrics")
+	}
+
+	// A failed collection keeps the last data
+	e.Observe(scheduler.Result{Router: router, Err: errors.New("timeout"), Duration: time.Second})
+	checkLines(t, scrape(t, e), []string{
+		`ispagent_router_up{router="r1"} 0`,
+		`ispagent_router_cpu_percent{router="r1"} 12`,
+		`ispagent_collections_total{result="error"} 1`,
+	}, nil)
+}
+
+func TestExporter_Subscribers(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "all",
+			opts: Options{Subscribers: true},
+			want: []string{
+				`ispagent_interface_receive_bytes_total{interface="<pppoe-alice>",router="r1"} 10`,
+				`ispagent_pppoe_session_receive_bytes_total{router="r1",user="bob"} 20`,
+				`ispagent_pppoe_session_uptime_seconds{router="r1",user="alice"} 60`,
+				`ispagent_nat_top_source_bytes{address="100.64.0.10",router="r1"} 2000`,
+				`ispagent_exporter_subscriber_series_dropped{router="r1"} 0`,
+			},
+		},
+		{
+			name: "limited",
+			opts: Options{Subscribers: true, MaxSubscriberSeries: 3},
+			want: []string{
+				`ispagent_interface_up{interface="<pppoe-bob>",router="r1"} 1`,
+				`ispagent_pppoe_session_receive_bytes_total{router="r1",user="alice"} 10`,
+				`ispagent_exporter_subscriber_series_dropped{router="r1"} 3`,
+			},
+			notWant: []string{`user="bob"`, "ispagent_nat_top_source"},
+		},
+		{
+			name: "redacted",
+			opts: Options{Subscribers: true, Redactor: privacy.NewRedactor(true, true)},
+			want: []string{
+				`ispagent_nat_top_source_bytes{address="100.64.xxx.xxx",router="r1"} 2000`,
+			},
+			notWant: []string{"alice", "bob", "100.64.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := New(tt.opts)
+			collect(e, &models.RouterConfig{ID: "r1", Type: "mikrotik"}, testData("r1"))
+			checkLines(t, scrape(t, e), tt.want, tt.notWant)
+		})
+	}
+}
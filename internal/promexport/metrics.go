@@ -0,0 +1,68 @@
+package promexport
+
+import "github.com/prometheus/client_golang/prometheus"
+
+func routerDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, append([]string{"router"}, labels...), nil)
+}
+
+// Agent self-metrics built on scrape
+var (
+	schedulerMissedDesc   = prometheus.NewDesc("ispagent_scheduler_missed_intervals_total", "Polls skipped because the previous collection of the router had not finished.", nil, nil)
+	schedulerInFlightDesc = prometheus.NewDesc("ispagent_scheduler_collections_in_flight", "Collections running or waiting for a slot.", nil, nil)
+
+	routerUpDesc          = routerDesc("ispagent_router_up", "Whether the last collection from the router succeeded.")
+	routerDurationDesc    = routerDesc("ispagent_router_collection_duration_seconds", "Time taken by the last collection from the router.")
+	routerLastSuccessDesc = routerDesc("ispagent_router_last_success_timestamp_seconds", "Time the last successful collection from the router finished.")
+	collectionErrorsDesc  = routerDesc("ispagent_router_collection_errors", "Parts of the last collection that failed, such as a menu the router refused.")
+	droppedDesc           = routerDesc("ispagent_exporter_subscriber_series_dropped", "Subscriber series of the router left out by the series limit.")
+)
+
+// Router system metrics
+var (
+	routerInfoDesc    = routerDesc("ispagent_router_info", "Router details; always 1.", "name", "type", "version", "board")
+	cpuDesc           = routerDesc("ispagent_router_cpu_percent", "CPU load in percent.")
+	memoryPercentDesc = routerDesc("ispagent_router_memory_percent", "Memory in use in percent.")
+	memoryTotalDesc   = routerDesc("ispagent_router_memory_total_bytes", "Total memory.")
+	memoryUsedDesc    = routerDesc("ispagent_router_memory_used_bytes", "Memory in use.")
+	uptimeDesc        = routerDesc("ispagent_router_uptime_seconds", "Time since the router booted.")
+	temperatureDesc   = routerDesc("ispagent_router_temperature_celsius", "Board temperature.")
+	diskTotalDesc     = routerDesc("ispagent_router_disk_total_bytes", "Total storage.")
+	diskUsedDesc      = routerDesc("ispagent_router_disk_used_bytes", "Storage in use.")
+)
+
+// Interface metrics
+var (
+	ifaceUpDesc        = routerDesc("ispagent_interface_up", "Whether the interface is running.", "interface")
+	ifaceSpeedDesc     = routerDesc("ispagent_interface_speed_bits_per_second", "Negotiated interface speed.", "interface")
+	ifaceRxBytesDesc   = routerDesc("ispagent_interface_receive_bytes_total", "Bytes received.", "interface")
+	ifaceTxBytesDesc   = routerDesc("ispagent_interface_transmit_bytes_total", "Bytes transmitted.", "interface")
+	ifaceRxPacketsDesc = routerDesc("ispagent_interface_receive_packets_total", "Packets received.", "interface")
+	ifaceTxPacketsDesc = routerDesc("ispagent_interface_transmit_packets_total", "Packets transmitted.", "interface")
+	ifaceRxErrorsDesc  = routerDesc("ispagent_interface_receive_errors_total", "Receive errors.", "interface")
+	ifaceTxErrorsDesc  = routerDesc("ispagent_interface_transmit_errors_total", "Transmit errors.", "interface")
+	ifaceRxDropsDesc   = routerDesc("ispagent_interface_receive_drops_total", "Received packets dropped.", "interface")
+	ifaceTxDropsDesc   = routerDesc("ispagent_interface_transmit_drops_total", "Transmitted packets dropped.", "interface")
+)
+
+// PPPoE, DHCP and NAT metrics
+var (
+	pppoeSessionsDesc       = routerDesc("ispagent_pppoe_sessions", "Active PPP sessions.")
+	pppoeServerSessionsDesc = routerDesc("ispagent_pppoe_server_sessions", "Active sessions per PPPoE server.", "server", "interface")
+	sessionRxBytesDesc      = routerDesc("ispagent_pppoe_session_receive_bytes_total", "Bytes received from the subscriber in the session.", "user")
+	sessionTxBytesDesc      = routerDesc("ispagent_pppoe_session_transmit_bytes_total", "Bytes sent to the subscriber in the session.", "user")
+	sessionUptimeDesc       = routerDesc("ispagent_pppoe_session_uptime_seconds", "Time since the session was established.", "user")
+
+	poolSizeDesc         = routerDesc("ispagent_dhcp_pool_addresses", "Addresses in the pool.", "pool")
+	poolUsedDesc         = routerDesc("ispagent_dhcp_pool_used_addresses", "Addresses of the pool in use.", "pool")
+	poolUtilizationDesc  = routerDesc("ispagent_dhcp_pool_utilization_ratio", "Fraction of the pool in use.", "pool")
+	dhcpLeasesDesc       = routerDesc("ispagent_dhcp_server_leases", "Leases of the DHCP server.", "server")
+	dhcpActiveLeasesDesc = routerDesc("ispagent_dhcp_server_active_leases", "Bound leases of the DHCP server.", "server")
+
+	natConnectionsDesc = routerDesc("ispagent_nat_connections", "Tracked connections.")
+	natProtocolDesc    = routerDesc("ispagent_nat_protocol_connections", "Tracked connections per protocol.", "protocol")
+	natMaxEntriesDesc  = routerDesc("ispagent_nat_max_entries", "Connection tracking table size.")
+
+	natTopSourceBytesDesc       = routerDesc("ispagent_nat_top_source_bytes", "Bytes of a top NAT source during the collection interval.", "address")
+	natTopSourceConnectionsDesc = routerDesc("ispagent_nat_top_source_connections", "Tracked connections of a top NAT source.", "address")
+)
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DeliverOptions configures Deliver.
+type DeliverOptions struct {
+	// BatchSize is the most records sent at once.
+	BatchSize int
+	// FlushInterval is the longest a record waits for a batch to fill.
+	FlushInterval time.Duration
+	// MinBackoff and MaxBackoff bound the wait between failed attempts,
+	// which doubles after every failure.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// OnError is called with every failed attempt and the number of
+	// records dropped because of it, which is zero unless the error is
+	// permanent.
+	OnError func(err error, dropped int)
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error returned by a send function to report that the
+// batch was rejected and retrying would fail again, such as on malformed
+// data. Deliver drops the batch instead of retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped by Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Deliver sends the queued records to send in batches until ctx is done. A
+// full batch is sent right away, a partial one after FlushInterval. A batch
+// is removed from the queue once send succeeds; on failure it is retried
+// with backoff, so send must tolerate receiving records twice.
+func (q *Queue) Deliver(ctx context.Context, opts DeliverOptions, send func(ctx context.Context, records [][]byte) error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(time.Minute, opts.MinBackoff)
+	}
+
+	flush := time.NewTicker(opts.FlushInterval)
+	defer flush.Stop()
+
+	backoff := opts.MinBackoff
+	full := true // Send what is left from before a restart right away
+	for {
+		for {
+			if stats := q.Stats(); stats.Records == 0 || (!full && stats.Records < opts.BatchSize) {
+				break
+			}
+			batch, err := q.Read(opts.BatchSize)
+			if err == nil {
+				err = send(ctx, batch.Records)
+				if IsPermanent(err) && opts.OnError != nil {
+					opts.OnError(err, len(batch.Records))
+				}
+				if err == nil || IsPermanent(err) {
+					err = q.Commit(batch)
+				}
+			}
+			if errors.Is(err, ErrClosed) || ctx.Err() != nil {
+				return
+			}
+			if err != nil && !IsPermanent(err) {
+				if opts.OnError != nil {
+					opts.OnError(err, 0)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, opts.MaxBackoff)
+				continue
+			}
+			backoff = opts.MinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.Notify():
+			full = false
+		case <-flush.C:
+			full = true
+		}
+	}
+}
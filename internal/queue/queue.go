@@ -0,0 +1,508 @@
+// Package queue implements the agent's outbound queue: a durable FIFO of
+// encoded records that outputs deliver at least once, surviving restarts of
+// the agent and outages of the receiving end.
+package queue
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".q"
+	cursorFile    = "cursor"
+
+	// headerSize is the length and CRC-32 preceding every record.
+	headerSize = 8
+	// maxSegmentSize bounds segment files; smaller queues use smaller
+	// segments so that dropping the oldest one frees a fair share.
+	maxSegmentSize = 4 << 20
+	// DefaultMaxBytes bounds queues whose options set no limit.
+	DefaultMaxBytes = 256 << 20
+)
+
+// ErrClosed is returned by operations on a closed queue.
+var ErrClosed = errors.New("queue closed")
+
+// Options configures a queue.
+type Options struct {
+	// Directory holds the queue's segment files. Each queue needs its own.
+	Directory string
+	// MaxBytes bounds the size of the queue on disk. When it is reached
+	// the oldest records are dropped to make room.
+	MaxBytes int64
+}
+
+// Stats describes the contents of a queue.
+type Stats struct {
+	Records int   // Records waiting for delivery
+	Bytes   int64 // Size of the segment files
+	Dropped int64 // Records dropped since opening to respect MaxBytes
+}
+
+// Queue keeps records in append-only segment files and the position of the
+// first undelivered record in a cursor file. Records are removed only by
+// Commit, so a record read but not committed before a crash is read again
+// after a restart. Segment files are synced to disk when a new one is started
+// and on every Commit, along with the cursor, so a power failure loses at
+// most the records pushed since the last of them.
+type Queue struct {
+	dir         string
+	maxBytes    int64
+	segmentSize int64
+
+	mu       sync.Mutex
+	segments []*segment // Oldest first; records are appended to the last
+	head     position   // First record not committed
+	file     *os.File   // Last segment, open for appending
+	size     int64
+	dropped  int64
+	closed   bool
+	notify   chan struct{}
+}
+
+// segment is one file of records.
+type segment struct {
+	seq     uint64
+	size    int64 // Bytes of complete records
+	records int
+}
+
+// position locates a record: the segment, the byte offset within it and
+// the number of records before it in the segment.
+type position struct {
+	seq    uint64
+	offset int64
+	index  int
+}
+
+func (p position) before(o position) bool {
+	return p.seq < o.seq || (p.seq == o.seq && p.offset < o.offset)
+}
+
+// Batch holds records read from the head of a queue.
+type Batch struct {
+	Records [][]byte
+	end     position
+}
+
+// Open opens (or creates) a queue in opts.Directory. A record left
+// incomplete by a crash is discarded.
+func Open(opts Options) (*Queue, error) {
+	if opts.Directory == "" {
+		return nil, fmt.Errorf("queue directory is required")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if err := os.MkdirAll(opts.Directory, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &Queue{
+		dir:         opts.Directory,
+		maxBytes:    opts.MaxBytes,
+		segmentSize: min(opts.MaxBytes/4, maxSegmentSize),
+		notify:      make(chan struct{}, 1),
+	}
+
+	seqs, err := q.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		seg, err := q.scanSegment(seq)
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, seg)
+		q.size += seg.size
+	}
+	if len(q.segments) == 0 {
+		q.segments = append(q.segments, &segment{seq: 1})
+	}
+
+	last := q.segments[len(q.segments)-1]
+	q.file, err = os.OpenFile(q.segmentPath(last.seq), os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue segment: %w", err)
+	}
+	// Drop a partial record at the end of the last segment
+	if err := q.file.Truncate(last.size); err != nil {
+		q.file.Close()
+		return nil, fmt.Errorf("failed to repair queue segment: %w", err)
+	}
+	if _, err := q.file.Seek(last.size, io.SeekStart); err != nil {
+		q.file.Close()
+		return nil, fmt.Errorf("failed to open queue segment: %w", err)
+	}
+
+	q.head = q.readCursor()
+	q.advanceHead()
+	return q, nil
+}
+
+// Push appends a record to the queue, dropping the oldest records if the
+// queue would grow beyond its limit.
+func (q *Queue) Push(record []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	n := int64(headerSize + len(record))
+	last := q.segments[len(q.segments)-1]
+	if last.size > 0 && last.size+n > q.segmentSize {
+		if err := q.roll(); err != nil {
+			return err
+		}
+		last = q.segments[len(q.segments)-1]
+	}
+	for q.size+n > q.maxBytes && len(q.segments) > 1 {
+		q.dropOldest()
+	}
+
+	buf := make([]byte, n)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(record))
+	copy(buf[headerSize:], record)
+	if _, err := q.file.Write(buf); err != nil {
+		// Cut off whatever part was written so the segment stays readable
+		q.file.Truncate(last.size)
+		q.file.Seek(last.size, io.SeekStart)
+		return fmt.Errorf("failed to write queue record: %w", err)
+	}
+	last.size += n
+	last.records++
+	q.size += n
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Read returns up to n records from the head of the queue without removing
+// them. The batch is empty if the queue is.
+func (q *Queue) Read(n int) (*Batch, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	b := &Batch{end: q.head}
+	for i, seg := range q.segments {
+		if len(b.Records) >= n {
+			break
+		}
+		if seg.seq < b.end.seq {
+			continue
+		}
+		if b.end.offset >= seg.size {
+			continue
+		}
+		if err := q.readSegment(seg, b, n); err != nil {
+			return nil, err
+		}
+		// Move past a finished segment unless it is still written to
+		if b.end.offset >= seg.size && i < len(q.segments)-1 {
+			b.end = position{seq: q.segments[i+1].seq}
+		}
+	}
+	return b, nil
+}
+
+// readSegment appends records of seg from b.end to b until it holds n.
+func (q *Queue) readSegment(seg *segment, b *Batch, n int) error {
+	f, err := os.Open(q.segmentPath(seg.seq))
+	if err != nil {
+		return fmt.Errorf("failed to open queue segment: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, b.end.offset, seg.size-b.end.offset))
+	for len(b.Records) < n && b.end.offset < seg.size {
+		record, err := readRecord(r, seg.size-b.end.offset)
+		if err != nil {
+			return fmt.Errorf("failed to read queue segment %d: %w", seg.seq, err)
+		}
+		b.Records = append(b.Records, record)
+		b.end.offset += int64(headerSize + len(record))
+		b.end.index++
+	}
+	return nil
+}
+
+// Commit removes the records of b, which must be the last batch read, from
+// the queue. Records dropped meanwhile to respect the size limit are not
+// counted twice.
+func (q *Queue) Commit(b *Batch) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if !q.head.before(b.end) {
+		return nil
+	}
+
+	q.head = b.end
+	q.advanceHead()
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync queue segment: %w", err)
+	}
+	return q.writeCursor()
+}
+
+// Notify returns a channel that receives a value after records are pushed.
+func (q *Queue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// Stats returns the current size of the queue.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	records := -q.head.index
+	for _, seg := range q.segments {
+		records += seg.records
+	}
+	return Stats{Records: records, Bytes: q.size, Dropped: q.dropped}
+}
+
+// Close closes the queue. Queued records are kept for the next Open.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	if err := q.file.Sync(); err != nil {
+		q.file.Close()
+		return fmt.Errorf("failed to sync queue segment: %w", err)
+	}
+	return q.file.Close()
+}
+
+// roll starts a new segment.
+func (q *Queue) roll() error {
+	seq := q.segments[len(q.segments)-1].seq + 1
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync queue segment: %w", err)
+	}
+	file, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create queue segment: %w", err)
+	}
+	q.file.Close()
+	q.file = file
+	q.segments = append(q.segments, &segment{seq: seq})
+	return nil
+}
+
+// dropOldest removes the oldest segment with its records, committed or not.
+func (q *Queue) dropOldest() {
+	seg := q.segments[0]
+	if seg.seq >= q.head.seq {
+		if seg.seq == q.head.seq {
+			q.dropped += int64(seg.records - q.head.index)
+		} else {
+			q.dropped += int64(seg.records)
+		}
+		q.head = position{seq: q.segments[1].seq}
+	}
+	q.removeSegment()
+	q.writeCursor()
+}
+
+// advanceHead moves the head to the start of the next segment when it is at
+// the end of one, and removes the segments before the head.
+func (q *Queue) advanceHead() {
+	for len(q.segments) > 1 {
+		seg := q.segments[0]
+		if seg.seq == q.head.seq && q.head.offset >= seg.size {
+			q.head = position{seq: q.segments[1].seq}
+		} else if seg.seq >= q.head.seq {
+			break
+		}
+		q.removeSegment()
+	}
+	if seg := q.segments[0]; seg.seq > q.head.seq {
+		q.head = position{seq: seg.seq}
+	}
+}
+
+// removeSegment deletes the oldest segment file.
+func (q *Queue) removeSegment() {
+	seg := q.segments[0]
+	os.Remove(q.segmentPath(seg.seq))
+	q.size -= seg.size
+	q.segments = q.segments[1:]
+}
+
+// scanSegment counts the complete records of a segment file, stopping at
+// the first damaged one.
+func (q *Queue) scanSegment(seq uint64) (*segment, error) {
+	f, err := os.Open(q.segmentPath(seq))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue segment: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue segment: %w", err)
+	}
+
+	seg := &segment{seq: seq}
+	r := bufio.NewReader(f)
+	for {
+		record, err := readRecord(r, info.Size()-seg.size)
+		if err != nil {
+			return seg, nil
+		}
+		seg.size += int64(headerSize + len(record))
+		seg.records++
+	}
+}
+
+// readRecord reads one record of at most remaining bytes, header included,
+// and checks its CRC. A damaged length is rejected before anything is
+// allocated for it.
+func readRecord(r io.Reader, remaining int64) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if length > remaining-headerSize {
+		return nil, fmt.Errorf("record length %d exceeds the %d bytes left in the segment", length, remaining-headerSize)
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("record checksum mismatch")
+	}
+	return record, nil
+}
+
+// listSegments returns the sequence numbers of the segment files in order.
+func (q *Queue) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func (q *Queue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%s%020d%s", segmentPrefix, seq, segmentSuffix))
+}
+
+// readCursor returns the committed head position, or the start of the
+// queue if none was saved or it no longer matches a segment.
+func (q *Queue) readCursor() position {
+	start := position{seq: q.segments[0].seq}
+	data, err := os.ReadFile(filepath.Join(q.dir, cursorFile))
+	if err != nil || len(data) != 20 {
+		return start
+	}
+	p := position{
+		seq:    binary.BigEndian.Uint64(data[0:8]),
+		offset: int64(binary.BigEndian.Uint64(data[8:16])),
+		index:  int(binary.BigEndian.Uint32(data[16:20])),
+	}
+	for _, seg := range q.segments {
+		if seg.seq == p.seq {
+			if p.offset > seg.size || p.index > seg.records {
+				return position{seq: p.seq}
+			}
+			return p
+		}
+	}
+	if p.seq > q.segments[len(q.segments)-1].seq {
+		return start
+	}
+	return p // Before the first segment; advanceHead moves it there
+}
+
+// writeCursor saves the head position, replacing the cursor file
+// atomically.
+func (q *Queue) writeCursor() error {
+	var data [20]byte
+	binary.BigEndian.PutUint64(data[0:8], q.head.seq)
+	binary.BigEndian.PutUint64(data[8:16], uint64(q.head.offset))
+	binary.BigEndian.PutUint32(data[16:20], uint32(q.head.index))
+
+	path := filepath.Join(q.dir, cursorFile)
+	if err := writeFileSync(path+".tmp", data[:]); err != nil {
+		return fmt.Errorf("failed to save queue cursor: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save queue cursor: %w", err)
+	}
+	// Make the rename itself durable
+	if err := syncDir(q.dir); err != nil {
+		return fmt.Errorf("failed to save queue cursor: %w", err)
+	}
+	return nil
+}
+
+// writeFileSync writes data to a file and syncs it to disk.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs a directory, persisting the files created and renamed in it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
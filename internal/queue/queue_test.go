@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func records(b *Batch) []string {
+	var out []string
+	for _, r := range b.Records {
+		out = append(out, string(r))
+	}
+	return out
+}
+
+func TestQueue_ReadCommitReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := Open(Options{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := q.Push([]byte(fmt.Sprintf("r%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := q.Read(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := records(b); fmt.Sprint(got) != "[r0 r1]" {
+		t.Fatalf("Read() = %v, want [r0 r1]", got)
+	}
+	if err := q.Commit(b); err != nil {
+		t.Fatal(err)
+	}
+	// Read but not committed: delivered again after a restart
+	if _, err := q.Read(2); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	// A record cut short by a crash is discarded
+	last := filepath.Join(dir, "segment-00000000000000000001.q")
+	f, err := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	q, err = Open(Options{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if got := q.Stats().Records; got != 3 {
+		t.Errorf("Stats().Records = %d, want 3", got)
+	}
+	q.Push([]byte("r5"))
+	b, err = q.Read(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := records(b); fmt.Sprint(got) != "[r2 r3 r4 r5]" {
+		t.Errorf("Read() after reopen = %v, want [r2 r3 r4 r5]", got)
+	}
+}
+
+func TestReadRecord_Length(t *testing.T) {
+	record := []byte{0, 0, 0, 2, 0, 0, 0, 0, 'o', 'k'}
+	tests := []struct {
+		name      string
+		header    []byte
+		remaining int64
+	}{
+		{"beyond the segment", []byte{0, 0, 0, 3}, int64(len(record))},
+		{"corrupt length", []byte{0xff, 0xff, 0xff, 0xff}, 4 << 20},
+		{"segment shorter than the record", []byte{0, 0, 0, 2}, int64(len(record)) - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append([]byte{}, tt.header...), record[4:]...)
+			if _, err := readRecord(bytes.NewReader(data), tt.remaining); err == nil {
+				t.Error("readRecord() error = nil")
+			}
+		})
+	}
+}
+
+func TestQueue_MaxBytes(t *testing.T) {
+	q, err := Open(Options{Directory: t.TempDir(), MaxBytes: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	record := make([]byte, 92) // 100 bytes with the header
+	for i := 0; i < 100; i++ {
+		record[0] = byte(i)
+		if err := q.Push(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := q.Stats()
+	if stats.Bytes > 4096 {
+		t.Errorf("Stats().Bytes = %d, want at most 4096", stats.Bytes)
+	}
+	if stats.Records+int(stats.Dropped) != 100 {
+		t.Errorf("Records %d + Dropped %d, want 100", stats.Records, stats.Dropped)
+	}
+	b, err := q.Read(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Records) != stats.Records || b.Records[len(b.Records)-1][0] != 99 {
+		t.Errorf("Read() returned %d records, want the newest %d", len(b.Records), stats.Records)
+	}
+	if b.Records[0][0] != byte(stats.Dropped) {
+		t.Errorf("oldest record = %d, want %d", b.Records[0][0], stats.Dropped)
+	}
+
+	// Committing after everything was read empties the queue
+	if err := q.Commit(b); err != nil {
+		t.Fatal(err)
+	}
+	if stats := q.Stats(); stats.Records != 0 {
+		t.Errorf("Stats().Records after commit = %d, want 0", stats.Records)
+	}
+}
+
+func TestQueue_Deliver(t *testing.T) {
+	tests := []struct {
+		name    string
+		fail    error // Returned by the first attempt
+		want    string
+		dropped int
+	}{
+		{name: "success", want: "[a b c]"},
+		{name: "retry", fail: errors.New("unavailable"), want: "[a b c]"},
+		{name: "permanent", fail: Permanent(errors.New("bad request")), want: "[c]", dropped: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Open(Options{Directory: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer q.Close()
+			for _, r := range []string{"a", "b", "c"} {
+				q.Push([]byte(r))
+			}
+
+			var (
+				mu        sync.Mutex
+				delivered []string
+				attempts  int
+				dropped   int
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			q.Deliver(ctx, DeliverOptions{
+				BatchSize:  2,
+				MinBackoff: time.Millisecond,
+				OnError:    func(err error, n int) { dropped += n },
+			}, func(ctx context.Context, records [][]byte) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts++
+				if attempts == 1 && tt.fail != nil {
+					return tt.fail
+				}
+				for _, r := range records {
+					delivered = append(delivered, string(r))
+				}
+				if len(delivered) == 3 || (tt.dropped > 0 && len(delivered) == 1) {
+					cancel()
+				}
+				return nil
+			})
+
+			if got := fmt.Sprint(delivered); got != tt.want {
+				t.Errorf("delivered %s, want %s", got, tt.want)
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped %d, want %d", dropped, tt.dropped)
+			}
+			if got := q.Stats().Records; got != 0 {
+				t.Errorf("%d records left in the queue", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Package scheduler polls routers with their collectors on a fixed
+// interval.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer of collections, whose spans go to the global
+// tracer provider; it does nothing unless tracing is set up
+const tracerName = "github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+
+// Options configures a Scheduler
+type Options struct {
+	// Interval between polls of a router
+	Interval time.Duration
+	// Timeout bounds each collection; defaults to Interval
+	Timeout time.Duration
+	// MaxConcurrent limits the collections running at once; 0 is unlimited
+	MaxConcurrent int
+	// OnResult is called after each collection from the collecting goroutine
+	OnResult func(Result)
+}
+
+// Result is the outcome of one collection
+type Result struct {
+	Router   *models.RouterConfig
+	Metrics  *models.MetricsData
+	Err      error
+	Started  time.Time
+	Duration time.Duration
+}
+
+// Stats counts collections since the scheduler started
+type Stats struct {
+	Collections int64 // Finished collections, including failed ones
+	Failures    int64 // Collections that returned an error
+	Missed      int64 // Polls skipped because the previous one had not finished
+	InFlight    int   // Collections running or waiting for a slot
+}
+
+// Scheduler polls each router every interval. Polls are spread evenly over
+// the first interval so that routers are not all contacted at once, and a
+// router is never polled again before its previous collection finishes.
+type Scheduler struct {
+	registry *collector.Registry
+	routers  []models.RouterConfig
+	opts     Options
+	slots    chan struct{}
+
+	mu      sync.Mutex
+	running map[string]bool
+	stats   Stats
+	wg      sync.WaitGroup
+}
+
+// New creates a scheduler for routers
+func New(registry *collector.Registry, routers []models.RouterConfig, opts Options) *Scheduler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = opts.Interval
+	}
+	s := &Scheduler{
+		registry: registry,
+		routers:  routers,
+		opts:     opts,
+		running:  make(map[string]bool),
+	}
+	if opts.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, opts.MaxConcurrent)
+	}
+	return s
+}
+
+// Run polls the routers until ctx is cancelled, then waits for running
+// collections, which are cancelled too, and returns ctx.Err()
+func (s *Scheduler) Run(ctx context.Context) error {
+	var loops sync.WaitGroup
+	for i := range s.routers {
+		offset := s.opts.Interval * time.Duration(i) / time.Duration(len(s.routers))
+		loops.Add(1)
+		go func(router *models.RouterConfig) {
+			defer loops.Done()
+			s.loop(ctx, router, offset)
+		}(&s.routers[i])
+	}
+
+	loops.Wait()
+	s.wg.Wait()
+	return ctx.Err()
+}
+
+// Stats returns the counters so far
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// loop polls one router every interval, starting after offset
+func (s *Scheduler) loop(ctx context.Context, router *models.RouterConfig, offset time.Duration) {
+	if offset > 0 {
+		timer := time.NewTimer(offset)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		s.poll(ctx, router)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll starts a collection from router unless one is still running
+func (s *Scheduler) poll(ctx context.Context, router *models.RouterConfig) {
+	s.mu.Lock()
+	if s.running[router.ID] {
+		s.stats.Missed++
+		s.mu.Unlock()
+		return
+	}
+	s.running[router.ID] = true
+	s.stats.InFlight++
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		result := s.collect(ctx, router)
+
+		s.mu.Lock()
+		delete(s.running, router.ID)
+		s.stats.InFlight--
+		if result != nil {
+			s.stats.Collections++
+			if result.Err != nil {
+				s.stats.Failures++
+			}
+		}
+		s.mu.Unlock()
+
+		if result != nil && s.opts.OnResult != nil {
+			s.opts.OnResult(*result)
+		}
+	}()
+}
+
+// collect runs one collection, or returns nil if ctx was cancelled before
+// it finished; collections cut short by shutdown are not failures
+func (s *Scheduler) collect(ctx context.Context, router *models.RouterConfig) *Result {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	result := &Result{Router: router, Started: time.Now()}
+	spanCtx, span := otel.Tracer(tracerName).Start(ctx, "collect", trace.WithAttributes(
+		attribute.String("router.id", router.ID),
+		attribute.String("router.name", router.Name),
+		attribute.String("router.type", router.Type),
+	))
+	defer func() {
+		if result.Err != nil {
+			span.RecordError(result.Err)
+			span.SetStatus(codes.Error, result.Err.Error())
+		}
+		span.End()
+	}()
+
+	coll, err := s.registry.Get(router.Type)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	collectCtx, cancel := context.WithTimeout(spanCtx, s.opts.Timeout)
+	defer cancel()
+	result.Metrics, result.Err = coll.Collect(collectCtx, router)
+	result.Duration = time.Since(result.Started)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// fakeCollector takes delay per collection and fails routers named "bad"
+type fakeCollector struct {
+	delay   time.Duration
+	active  atomic.Int32
+	maxSeen atomic.Int32
+}
+
+func (f *fakeCollector) Name() string { return "fake" }
+func (f *fakeCollector) Type() string { return "fake" }
+
+func (f *fakeCollector) Collect(ctx context.Context, router *models.RouterConfig) (*models.MetricsData, error) {
+	n := f.active.Add(1)
+	defer f.active.Add(-1)
+	for {
+		seen := f.maxSeen.Load()
+		if n <= seen || f.maxSeen.CompareAndSwap(seen, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if router.Name == "bad" {
+		return nil, errors.New("unreachable")
+	}
+	return &models.MetricsData{RouterID: router.ID}, nil
+}
+
+func (f *fakeCollector) HealthCheck(ctx context.Context, router *models.RouterConfig) error {
+	return nil
+}
+
+func newRegistry(t *testing.T, coll collector.Collector) *collector.Registry {
+	t.Helper()
+	registry := collector.NewRegistry()
+	if err := registry.Register(coll); err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestScheduler_Run(t *testing.T) {
+	coll := &fakeCollector{delay: 5 * time.Millisecond}
+	routers := []models.RouterConfig{
+		{ID: "r1", Type: "fake"},
+		{ID: "r2", Type: "fake", Name: "bad"},
+		{ID: "r3", Type: "other"},
+	}
+
+	var mu sync.Mutex
+	results := make(map[string][]Result)
+	s := New(newRegistry(t, coll), routers, Options{
+		Interval: 50 * time.Millisecond,
+		OnResult: func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[r.Router.ID] = append(results[r.Router.ID], r)
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if n := len(results["r1"]); n < 2 || n > 3 {
+		t.Errorf("r1 polled %d times, want 2-3", n)
+	}
+	if r := results["r1"][0]; r.Err != nil || r.Metrics.RouterID != "r1" || r.Duration < coll.delay {
+		t.Errorf("r1 result = %+v", r)
+	}
+	if len(results["r2"]) == 0 || results["r2"][0].Err == nil {
+		t.Errorf("r2 results = %+v, want errors", results["r2"])
+	}
+	if len(results["r3"]) == 0 || results["r3"][0].Err == nil {
+		t.Errorf("r3 results = %+v, want missing collector errors", results["r3"])
+	}
+
+	stats := s.Stats()
+	if stats.InFlight != 0 || stats.Missed != 0 || stats.Failures == 0 || stats.Collections < stats.Failures {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestScheduler_Missed(t *testing.T) {
+	coll := &fakeCollector{delay: 70 * time.Millisecond}
+	s := New(newRegistry(t, coll), []models.RouterConfig{{ID: "slow", Type: "fake"}}, Options{
+		Interval: 20 * time.Millisecond,
+		Timeout:  time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	stats := s.Stats()
+	if stats.Collections != 1 || stats.Failures != 0 || stats.Missed < 2 {
+		t.Errorf("stats = %+v, want one collection and missed polls", stats)
+	}
+	if coll.maxSeen.Load() != 1 {
+		t.Errorf("router collected %d times at once", coll.maxSeen.Load())
+	}
+}
+
+func TestScheduler_MaxConcurrent(t *testing.T) {
+	coll := &fakeCollector{delay: 20 * time.Millisecond}
+	var routers []models.RouterConfig
+	for _, id := range []string{"r1", "r2", "r3", "r4", "r5", "r6"} {
+		routers = append(routers, models.RouterConfig{ID: id, Type: "fake"})
+	}
+	s := New(newRegistry(t, coll), routers, Options{
+		Interval:      5 * time.Millisecond,
+		Timeout:       time.Second,
+		MaxConcurrent: 2,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.Run(ctx)
+
+	if max := coll.maxSeen.Load(); max != 2 {
+		t.Errorf("%d collections ran at once, want 2", max)
+	}
+	if s.Stats().Missed == 0 {
+		t.Error("expected missed polls while waiting for a slot")
+	}
+}
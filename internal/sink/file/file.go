@@ -0,0 +1,262 @@
+// Package file writes collections to newline-delimited JSON files in a
+// directory, for sites without a network path to a server: the files are
+// carried out of the site and imported later. Files are rotated by size and
+// age, compressed once rotated and removed beyond the retention limits.
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// Record types
+const (
+	// RecordCollection carries the data of one collection: the full data of
+	// MikroTik collections, the base model of others, or the error of a
+	// failed one
+	RecordCollection = "collection"
+	// RecordSessions carries the sessions of a MikroTik collection as the
+	// JSON form of the SessionReport protobuf message
+	RecordSessions = "sessions"
+)
+
+// Record is one line of a file
+type Record struct {
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	AgentID         string          `json:"agent_id"`
+	RouterID        string          `json:"router_id"`
+	RouterType      string          `json:"router_type,omitempty"`
+	DurationSeconds float64         `json:"duration_seconds,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// Options configures the file sink
+type Options struct {
+	// Directory holds the files; it is created if missing
+	Directory string
+	// Prefix starts every file name; defaults to ispagent
+	Prefix string
+	// MaxSize is the size in bytes beyond which a file is rotated;
+	// 100 MB if zero
+	MaxSize int64
+	// RotateInterval is the age at which a file is rotated; never if zero
+	RotateInterval time.Duration
+	// Compress compresses rotated files with gzip
+	Compress bool
+	// MaxFiles, MaxTotalSize and MaxAge limit the rotated files kept; the
+	// oldest are removed beyond any of them. Zero means no limit.
+	MaxFiles     int
+	MaxTotalSize int64
+	MaxAge       time.Duration
+	// AgentID is set in every record
+	AgentID string
+	// Redactor redacts subscriber details in session records and events
+	Redactor *privacy.Redactor
+	// OnError is called when a record cannot be written
+	OnError func(err error)
+}
+
+// Sink writes a record per collection, and one with its sessions, to the
+// current file
+type Sink struct {
+	opts Options
+
+	mu      sync.Mutex
+	pending map[string]*mikrotik.CollectedData // By router ID, until Observe
+	writer  *writer
+}
+
+// New creates a sink writing to opts.Directory. Files left uncompressed by
+// an earlier run are compressed first, if compression is enabled.
+func New(opts Options) (*Sink, error) {
+	if opts.Directory == "" {
+		return nil, fmt.Errorf("export directory is required")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "ispagent"
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 100 << 20
+	}
+
+	w, err := openWriter(opts.Directory, opts.Prefix, rotation{
+		maxSize:  opts.MaxSize,
+		interval: opts.RotateInterval,
+		compress: opts.Compress,
+		maxFiles: opts.MaxFiles,
+		maxTotal: opts.MaxTotalSize,
+		maxAge:   opts.MaxAge,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{
+		opts:    opts,
+		pending: make(map[string]*mikrotik.CollectedData),
+		writer:  w,
+	}, nil
+}
+
+// Update keeps the full data of a MikroTik collection until the matching
+// result reaches Observe; it is meant to be registered with the MikroTik
+// collector's SetDataHandler
+func (s *Sink) Update(data *mikrotik.CollectedData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[data.RouterID] = data
+}
+
+// Observe writes the records of a collection; it is meant to be called
+// from the scheduler's OnResult
+func (s *Sink) Observe(result scheduler.Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := s.pending[result.Router.ID]
+	delete(s.pending, result.Router.ID)
+	// Data handed to Update belongs to this collection only if it carries
+	// the same base model
+	if data != nil && (result.Metrics == nil || data.MetricsData != result.Metrics) {
+		data = nil
+	}
+
+	records, err := s.records(result, data)
+	if err != nil {
+		s.onError(err)
+		return
+	}
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			s.onError(fmt.Errorf("failed to encode %s record: %w", record.Type, err))
+			continue
+		}
+		if err := s.writer.write(append(line, '\n')); err != nil {
+			s.onError(err)
+			return
+		}
+	}
+}
+
+// Close completes the current file, compressing it if enabled
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writer.close()
+}
+
+// records returns the records of a collection. data, if not nil, is the
+// full data of a MikroTik collection.
+func (s *Sink) records(result scheduler.Result, data *mikrotik.CollectedData) ([]Record, error) {
+	record := Record{
+		Type:            RecordCollection,
+		Time:            result.Started.UTC(),
+		AgentID:         s.opts.AgentID,
+		RouterID:        result.Router.ID,
+		RouterType:      result.Router.Type,
+		DurationSeconds: result.Duration.Seconds(),
+	}
+	if result.Err != nil {
+		record.Error = result.Err.Error()
+		return []Record{record}, nil
+	}
+	if result.Metrics == nil {
+		return []Record{record}, nil
+	}
+	if !result.Metrics.Timestamp.IsZero() {
+		record.Time = result.Metrics.Timestamp.UTC()
+	}
+
+	var err error
+	if data == nil {
+		record.Data, err = json.Marshal(s.redactEvents(result.Metrics))
+	} else {
+		record.Data, err = json.Marshal(s.withoutSessions(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode collection of %s: %w", result.Router.ID, err)
+	}
+	records := []Record{record}
+
+	if data == nil {
+		return records, nil
+	}
+	report := transport.NewSessionReport(s.opts.AgentID, data, s.opts.Redactor)
+	if report == nil {
+		return records, nil
+	}
+	sessions := record
+	sessions.Type = RecordSessions
+	sessions.DurationSeconds = 0
+	sessions.Data, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sessions of %s: %w", result.Router.ID, err)
+	}
+	return append(records, sessions), nil
+}
+
+// withoutSessions returns a copy of data without the subscriber records and
+// NAT top sources, which go to the sessions record redacted, and with
+// redacted events and DHCPv6 bindings
+func (s *Sink) withoutSessions(data *mikrotik.CollectedData) *mikrotik.CollectedData {
+	c := *data
+	c.MetricsData = s.redactEvents(data.MetricsData)
+	c.PPPoE = nil
+	c.NAT = nil
+	c.DHCPLeases = nil
+	if data.NATAggregates != nil {
+		agg := *data.NATAggregates
+		agg.Sources = mikrotik.NATTopList{}
+		c.NATAggregates = &agg
+	}
+
+	r := s.opts.Redactor
+	if r == nil || data.IPv6 == nil || len(data.IPv6.Bindings) == 0 {
+		return &c
+	}
+	ipv6 := *data.IPv6
+	ipv6.Bindings = make([]mikrotik.DHCPv6Binding, len(data.IPv6.Bindings))
+	for i, b := range data.IPv6.Bindings {
+		b.Subscriber = r.RedactUsername(b.Subscriber)
+		b.Prefix = r.RedactIPAddress(b.Prefix)
+		b.ClientAddress = r.RedactIPAddress(b.ClientAddress)
+		if r.ShouldRedactIPAddresses() {
+			b.DUID = ""
+		}
+		ipv6.Bindings[i] = b
+	}
+	c.IPv6 = &ipv6
+	return &c
+}
+
+// redactEvents returns m, or a copy of it with redacted events
+func (s *Sink) redactEvents(m *models.MetricsData) *models.MetricsData {
+	r := s.opts.Redactor
+	if r == nil || m == nil || len(m.Events) == 0 {
+		return m
+	}
+	c := *m
+	c.Events = make([]models.Event, len(m.Events))
+	for i, e := range m.Events {
+		c.Events[i] = r.RedactEvent(e)
+	}
+	return &c
+}
+
+func (s *Sink) onError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
@@ -0,0 +1,260 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// readRecords returns the records of every file in dir, oldest first
+func readRecords(t *testing.T, dir string) []Record {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []Record
+	for _, e := range entries {
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(e.Name(), compressedSuffix) {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatalf("%s: %v", e.Name(), err)
+			}
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("%s: %v", e.Name(), err)
+			}
+			records = append(records, record)
+		}
+		f.Close()
+	}
+	return records
+}
+
+func TestSink_Observe(t *testing.T) {
+	dir := t.TempDir()
+	var errs []error
+	s, err := New(Options{
+		Directory: dir,
+		Compress:  true,
+		AgentID:   "agent-1",
+		Redactor:  privacy.NewRedactor(true, true),
+		OnError:   func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	bng := &models.RouterConfig{ID: "bng-1", Type: "mikrotik"}
+	metrics := &models.MetricsData{
+		RouterID:  "bng-1",
+		Timestamp: started,
+		System:    models.SystemMetrics{CPUPercent: 12},
+		Events:    []models.Event{{Type: "router_log", Message: "alice logged in, 10.1.2.3"}},
+	}
+	s.Update(&mikrotik.CollectedData{
+		MetricsData: metrics,
+		System:      &mikrotik.SystemMetrics{},
+		PPPoE:       []mikrotik.PPPoESession{{SessionID: "1", Username: "alice", Address: "10.1.2.3"}},
+		IPv6:        &mikrotik.IPv6Data{Bindings: []mikrotik.DHCPv6Binding{{Subscriber: "alice", Prefix: "2001:db8:1:100::/56", DUID: "0003000102"}}},
+	})
+	s.Observe(scheduler.Result{Router: bng, Metrics: metrics, Started: started, Duration: time.Second})
+	s.Observe(scheduler.Result{Router: &models.RouterConfig{ID: "olt-1", Type: "snmp"}, Metrics: &models.MetricsData{RouterID: "olt-1"}, Started: started})
+	s.Observe(scheduler.Result{Router: bng, Err: errors.New("connection refused"), Started: started})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("errors: %v", errs)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], compressedSuffix) {
+		t.Fatalf("files = %v, want one compressed file", files)
+	}
+	records := readRecords(t, dir)
+	tests := []struct {
+		typ    string
+		router string
+		check  func(t *testing.T, r Record)
+	}{
+		{RecordCollection, "bng-1", func(t *testing.T, r Record) {
+			data := string(r.Data)
+			if !strings.Contains(data, `"system"`) || r.DurationSeconds != 1 || !r.Time.Equal(started) {
+				t.Errorf("record = %+v", r)
+			}
+			// Subscribers are only in the sessions record, redacted, and
+			// events are redacted
+			if !strings.Contains(data, "router_log") {
+				t.Errorf("collection record lacks events: %s", data)
+			}
+			if strings.Contains(data, "alice") || strings.Contains(data, "10.1.2.3") || strings.Contains(data, "pppoe_sessions") || strings.Contains(data, "0003000102") {
+				t.Errorf("collection record leaks subscribers: %s", data)
+			}
+		}},
+		{RecordSessions, "bng-1", func(t *testing.T, r Record) {
+			data := string(r.Data)
+			if !strings.Contains(data, `"agent_id":"agent-1"`) || !strings.Contains(data, `"pppoe_sessions"`) {
+				t.Errorf("sessions record = %s", data)
+			}
+			if strings.Contains(data, "alice") || strings.Contains(data, "10.1.2.3") {
+				t.Errorf("sessions record not redacted: %s", data)
+			}
+		}},
+		{RecordCollection, "olt-1", func(t *testing.T, r Record) {
+			if r.RouterType != "snmp" || !strings.Contains(string(r.Data), `"router_id":"olt-1"`) {
+				t.Errorf("record = %+v", r)
+			}
+		}},
+		{RecordCollection, "bng-1", func(t *testing.T, r Record) {
+			if r.Error != "connection refused" || r.Data != nil {
+				t.Errorf("record = %+v", r)
+			}
+		}},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("got %d records, want %d", len(records), len(tests))
+	}
+	for i, tt := range tests {
+		r := records[i]
+		if r.Type != tt.typ || r.RouterID != tt.router || r.AgentID != "agent-1" {
+			t.Errorf("record %d = %s from %s, want %s from %s", i, r.Type, r.RouterID, tt.typ, tt.router)
+			continue
+		}
+		tt.check(t, r)
+	}
+}
+
+func TestWriter_Rotate(t *testing.T) {
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	tests := []struct {
+		name      string
+		rotation  rotation
+		writes    int
+		step      time.Duration // Clock advance per write
+		wantFiles int
+		wantLines int
+	}{
+		{"size", rotation{maxSize: 250}, 6, 0, 3, 6},
+		{"interval", rotation{maxSize: 1 << 20, interval: time.Hour}, 6, 30 * time.Minute, 3, 6},
+		{"compressed", rotation{maxSize: 250, compress: true}, 6, 0, 3, 6},
+		{"max files", rotation{maxSize: 250, maxFiles: 1}, 6, 0, 1, 2},
+		{"max total size", rotation{maxSize: 250, maxTotal: 450}, 6, 0, 2, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := openWriter(dir, "test", tt.rotation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+			w.now = func() time.Time { return now }
+			for i := 0; i < tt.writes; i++ {
+				if err := w.write(line); err != nil {
+					t.Fatal(err)
+				}
+				now = now.Add(tt.step)
+			}
+			if err := w.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			names, err := w.files()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != tt.wantFiles {
+				t.Errorf("files = %v, want %d", names, tt.wantFiles)
+			}
+			for _, name := range names {
+				if strings.HasSuffix(name, compressedSuffix) != tt.rotation.compress {
+					t.Errorf("file %s, compress %t", name, tt.rotation.compress)
+				}
+			}
+			if records := len(readLines(t, dir)); records != tt.wantLines {
+				t.Errorf("got %d lines, want %d", records, tt.wantLines)
+			}
+		})
+	}
+}
+
+// readLines returns the lines of every file in dir
+func readLines(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(e.Name(), compressedSuffix) {
+			zr, err := gzip.NewReader(strings.NewReader(string(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, err = io.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")...)
+	}
+	return lines
+}
+
+func TestWriter_Retention(t *testing.T) {
+	dir := t.TempDir()
+	// Files of an earlier run: one expired, one left uncompressed by a crash
+	old := filepath.Join(dir, "test-20260101T000000Z"+compressedSuffix)
+	crashed := filepath.Join(dir, "test-20261017T000000Z"+fileSuffix)
+	other := filepath.Join(dir, "notes.txt")
+	for _, path := range []string{old, crashed, other} {
+		if err := os.WriteFile(path, []byte("{}\n"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aged := time.Now().Add(-30 * 24 * time.Hour)
+	os.Chtimes(old, aged, aged)
+
+	w, err := openWriter(dir, "test", rotation{maxSize: 1 << 20, compress: true, maxAge: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.close()
+
+	names, err := w.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "test-20261017T000000Z"+compressedSuffix {
+		t.Errorf("files = %v, want the crashed file compressed and the expired one removed", names)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package file
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	fileSuffix       = ".ndjson"
+	compressedSuffix = ".ndjson.gz"
+	timeLayout       = "20060102T150405Z"
+)
+
+// rotation configures when files are rotated and how long they are kept
+type rotation struct {
+	maxSize  int64
+	interval time.Duration
+	compress bool
+	maxFiles int
+	maxTotal int64
+	maxAge   time.Duration
+}
+
+// writer appends lines to the current file of a directory. Files are named
+// after the time they were opened, so they sort oldest first. Rotated files
+// are compressed if enabled and removed beyond the retention limits.
+type writer struct {
+	dir    string
+	prefix string
+	rotation
+	now func() time.Time
+
+	file   *os.File
+	name   string
+	size   int64
+	opened time.Time
+}
+
+// openWriter prepares dir for writing. Files left uncompressed by an
+// earlier run are compressed now.
+func openWriter(dir, prefix string, r rotation) (*writer, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	w := &writer{dir: dir, prefix: prefix, rotation: r, now: time.Now}
+
+	names, err := w.files()
+	if err != nil {
+		return nil, err
+	}
+	if w.compress {
+		for _, name := range names {
+			if strings.HasSuffix(name, fileSuffix) {
+				if err := compressFile(filepath.Join(dir, name)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := w.prune(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// write appends line to the current file, first rotating it if it is
+// full or old enough
+func (w *writer) write(line []byte) error {
+	now := w.now()
+	if w.due(now, len(line)) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	if w.file == nil {
+		if err := w.open(now); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return nil
+}
+
+// due reports whether the current file must be rotated before n more
+// bytes are written to it
+func (w *writer) due(now time.Time, n int) bool {
+	if w.file == nil || w.size == 0 {
+		return false
+	}
+	full := w.maxSize > 0 && w.size+int64(n) > w.maxSize
+	old := w.interval > 0 && now.Sub(w.opened) >= w.interval
+	return full || old
+}
+
+// open creates a file named after now, or a later second if that name is
+// taken
+func (w *writer) open(now time.Time) error {
+	at := now.UTC().Truncate(time.Second)
+	for {
+		name := w.prefix + "-" + at.Format(timeLayout)
+		_, errPlain := os.Stat(filepath.Join(w.dir, name+fileSuffix))
+		_, errCompressed := os.Stat(filepath.Join(w.dir, name+compressedSuffix))
+		if os.IsNotExist(errPlain) && os.IsNotExist(errCompressed) {
+			break
+		}
+		at = at.Add(time.Second)
+	}
+
+	name := w.prefix + "-" + at.Format(timeLayout) + fileSuffix
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	w.file = file
+	w.name = name
+	w.size = 0
+	w.opened = now
+	return nil
+}
+
+// rotate closes the current file, compresses it if enabled and applies
+// the retention limits
+func (w *writer) rotate() error {
+	if w.file == nil {
+		return nil
+	}
+	file, path := w.file, filepath.Join(w.dir, w.name)
+	w.file = nil
+	w.name = ""
+
+	err := file.Sync()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close export file: %w", err)
+	}
+	if w.compress {
+		if err := compressFile(path); err != nil {
+			return err
+		}
+	}
+	return w.prune()
+}
+
+// close rotates the current file, so that every file is complete
+func (w *writer) close() error {
+	return w.rotate()
+}
+
+// files lists the files of the writer, oldest first
+func (w *writer) files() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list export directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, w.prefix+"-") {
+			continue
+		}
+		if strings.HasSuffix(name, fileSuffix) || strings.HasSuffix(name, compressedSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// prune removes the oldest rotated files beyond the retention limits
+func (w *writer) prune() error {
+	names, err := w.files()
+	if err != nil {
+		return err
+	}
+	type rotated struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []rotated
+	var total int64
+	for _, name := range names {
+		if name == w.name {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(w.dir, name))
+		if err != nil {
+			continue
+		}
+		files = append(files, rotated{name, info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	now := w.now()
+	var errs []error
+	for i, f := range files {
+		keep := (w.maxFiles <= 0 || len(files)-i <= w.maxFiles) &&
+			(w.maxTotal <= 0 || total <= w.maxTotal) &&
+			(w.maxAge <= 0 || now.Sub(f.modTime) < w.maxAge)
+		if keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.dir, f.name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to remove expired export file: %w", err))
+			continue
+		}
+		total -= f.size
+	}
+	return errors.Join(errs...)
+}
+
+// compressFile replaces path with a gzip-compressed copy
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to compress export file: %w", err)
+	}
+	defer src.Close()
+
+	gzPath := strings.TrimSuffix(path, fileSuffix) + compressedSuffix
+	dst, err := os.OpenFile(gzPath+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to compress export file: %w", err)
+	}
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if serr := dst.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(gzPath+".tmp", gzPath)
+	}
+	if err != nil {
+		os.Remove(gzPath + ".tmp")
+		return fmt.Errorf("failed to compress export file: %w", err)
+	}
+	return os.Remove(path)
+}
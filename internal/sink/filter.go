@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"path"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// DataType selects part of the collected data
+type DataType string
+
+// Data types
+const (
+	// DataMetrics is system, interface and custom metrics, and aggregates
+	// such as session counts, pool usage and probe results
+	DataMetrics DataType = "metrics"
+	// DataEvents is the events detected since the previous collection
+	DataEvents DataType = "events"
+	// DataSessions is per-subscriber records: PPPoE sessions, DHCP leases,
+	// NAT connections and top sources, and DHCPv6 bindings
+	DataSessions DataType = "sessions"
+	// DataInventory is neighbor tables, IPv6 addresses and security posture
+	DataInventory DataType = "inventory"
+	// DataErrors is failed collections and the errors of partial ones
+	DataErrors DataType = "errors"
+)
+
+// Filter selects the collections and the data an output receives
+type Filter struct {
+	// Routers are patterns, as for path.Match, of the IDs of the routers
+	// whose collections pass; all pass if empty
+	Routers []string
+	// Data are the data types that pass; all pass if empty. Data of other
+	// types is removed from copies of the collections.
+	Data []DataType
+}
+
+// matchRouter reports whether the collections of router id pass
+func (f *Filter) matchRouter(id string) bool {
+	if len(f.Routers) == 0 {
+		return true
+	}
+	for _, pattern := range f.Routers {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// all reports whether every data type passes
+func (f *Filter) all() bool {
+	return len(f.Data) == 0
+}
+
+func (f *Filter) has(t DataType) bool {
+	if f.all() {
+		return true
+	}
+	for _, d := range f.Data {
+		if d == t {
+			return true
+		}
+	}
+	return false
+}
+
+// metrics returns a copy of m without the data that does not pass
+func (f *Filter) metrics(m *models.MetricsData) *models.MetricsData {
+	c := *m
+	if !f.has(DataMetrics) {
+		c.System = models.SystemMetrics{}
+		c.Interfaces = nil
+		c.CustomMetrics = nil
+	}
+	if !f.has(DataEvents) {
+		c.Events = nil
+	}
+	return &c
+}
+
+// data returns a copy of d carrying m, filtered by metrics, without the
+// data that does not pass
+func (f *Filter) data(d *mikrotik.CollectedData, m *models.MetricsData) *mikrotik.CollectedData {
+	c := *d
+	c.MetricsData = m
+	if !f.has(DataMetrics) {
+		c.System = nil
+		c.Interfaces = nil
+		c.PPPoEServers = nil
+		c.NATStats = nil
+		c.DHCPPools = nil
+		c.DHCPServers = nil
+		c.Probes = nil
+	}
+	if !f.has(DataSessions) {
+		c.PPPoE = nil
+		c.NAT = nil
+		c.DHCPLeases = nil
+	}
+	if !f.has(DataInventory) {
+		c.Neighbors = nil
+		c.Posture = nil
+	}
+	if !f.has(DataErrors) {
+		c.Errors = nil
+	}
+	// NAT top sources are subscriber addresses, the other aggregates metrics
+	if d.NATAggregates != nil {
+		var agg mikrotik.NATAggregates
+		if f.has(DataMetrics) {
+			agg = *d.NATAggregates
+			agg.Sources = mikrotik.NATTopList{}
+		}
+		if f.has(DataSessions) {
+			agg.Sources = d.NATAggregates.Sources
+		}
+		c.NATAggregates = &agg
+		if !f.has(DataMetrics) && !f.has(DataSessions) {
+			c.NATAggregates = nil
+		}
+	}
+	if d.IPv6 != nil {
+		ipv6 := *d.IPv6
+		if !f.has(DataMetrics) {
+			ipv6.Pools = nil
+		}
+		if !f.has(DataSessions) {
+			ipv6.Bindings = nil
+		}
+		if !f.has(DataInventory) {
+			ipv6.Addresses = nil
+		}
+		c.IPv6 = &ipv6
+		if ipv6.Pools == nil && ipv6.Bindings == nil && ipv6.Addresses == nil {
+			c.IPv6 = nil
+		}
+	}
+	return &c
+}
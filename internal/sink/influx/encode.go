@@ -0,0 +1,152 @@
+package influx
+
+import (
+	"sort"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// encode returns the points of one collection. data is the full MikroTik
+// data of the collection, if any. Interfaces created per subscriber are
+// left out to bound the number of series. Event messages are redacted by r.
+func encode(result scheduler.Result, data *mikrotik.CollectedData, agentID string, r *privacy.Redactor) []byte {
+	e := &encoder{
+		common:    []tag{{"agent", agentID}, {"router", result.Router.ID}},
+		timestamp: result.Started.UnixNano(),
+	}
+
+	metrics := result.Metrics
+	if result.Err != nil || metrics == nil {
+		e.point("router", nil, field{"up", int64(0)}, field{"collection_seconds", result.Duration.Seconds()})
+		return e.buf.Bytes()
+	}
+	if !metrics.Timestamp.IsZero() {
+		e.timestamp = metrics.Timestamp.UnixNano()
+	}
+	e.point("router", nil, field{"up", int64(1)}, field{"collection_seconds", result.Duration.Seconds()})
+
+	// System metrics are missing if the output pipeline filtered them out
+	if sys := metrics.System; sys != (models.SystemMetrics{}) {
+		fields := []field{
+			{"cpu_percent", sys.CPUPercent},
+			{"memory_percent", sys.MemoryPercent},
+			{"memory_used_bytes", sys.MemoryUsedBytes},
+			{"memory_total_bytes", sys.MemoryTotalBytes},
+			{"uptime_seconds", sys.UptimeSeconds},
+		}
+		if sys.TemperatureCelsius != 0 {
+			fields = append(fields, field{"temperature_celsius", sys.TemperatureCelsius})
+		}
+		if data != nil && data.System != nil && data.System.DiskTotalBytes > 0 {
+			fields = append(fields, field{"disk_used_bytes", data.System.DiskUsedBytes}, field{"disk_total_bytes", data.System.DiskTotalBytes})
+		}
+		e.point("system", nil, fields...)
+	}
+
+	var ifaces []mikrotik.InterfaceMetrics
+	if data != nil {
+		ifaces = data.Interfaces
+	} else {
+		ifaces = make([]mikrotik.InterfaceMetrics, len(metrics.Interfaces))
+		for i, iface := range metrics.Interfaces {
+			ifaces[i].InterfaceMetrics = iface
+		}
+	}
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.IsSubscriber() {
+			continue
+		}
+		e.point("interface", []tag{{"interface", iface.Name}},
+			field{"up", iface.IsUp},
+			field{"speed_mbps", iface.SpeedMbps},
+			field{"rx_bytes", iface.RxBytes},
+			field{"tx_bytes", iface.TxBytes},
+			field{"rx_packets", iface.RxPackets},
+			field{"tx_packets", iface.TxPackets},
+			field{"rx_errors", iface.RxErrors},
+			field{"tx_errors", iface.TxErrors},
+			field{"rx_drops", iface.RxDrops},
+			field{"tx_drops", iface.TxDrops},
+		)
+	}
+
+	if data != nil {
+		encodeMikroTik(e, data)
+	}
+
+	keys := make([]string, 0, len(metrics.CustomMetrics))
+	for key := range metrics.CustomMetrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name, labels, ok := collector.ParseMetricKey(key)
+		if !ok {
+			continue
+		}
+		tags := make([]tag, 0, len(labels))
+		conflict := false
+		for _, l := range labels {
+			conflict = conflict || l[0] == "agent" || l[0] == "router"
+			tags = append(tags, tag{l[0], l[1]})
+		}
+		if conflict {
+			continue // A label would replace a common tag
+		}
+		e.point(name, tags, field{"value", metrics.CustomMetrics[key]})
+	}
+
+	for _, event := range metrics.Events {
+		ts := event.Timestamp.UnixNano()
+		if event.Timestamp.IsZero() {
+			ts = e.timestamp
+		}
+		e.pointAt("event", ts, []tag{{"type", event.Type}, {"severity", event.Severity}}, field{"message", r.RedactText(event.Message)})
+	}
+
+	return e.buf.Bytes()
+}
+
+// encodeMikroTik adds the sessions, pools and connection tracking figures
+// collected from MikroTik routers
+func encodeMikroTik(e *encoder, data *mikrotik.CollectedData) {
+	if data.PPPoE != nil || data.PPPoEServers != nil {
+		e.point("pppoe", nil, field{"sessions", data.PPPoESessionCount()})
+	}
+	for _, server := range data.PPPoEServers {
+		e.point("pppoe_server", []tag{{"server", server.ServerName}, {"interface", server.Interface}},
+			field{"sessions", server.ActiveSessions})
+	}
+	for _, pool := range data.DHCPPools {
+		e.point("dhcp_pool", []tag{{"pool", pool.Name}},
+			field{"total", pool.TotalAddresses},
+			field{"used", pool.UsedAddresses},
+			field{"free", pool.FreeAddresses},
+			field{"utilization_percent", pool.Utilization},
+		)
+	}
+	for _, server := range data.DHCPServers {
+		e.point("dhcp_server", []tag{{"server", server.Name}, {"interface", server.Interface}},
+			field{"active_leases", server.ActiveLeases},
+			field{"total_leases", server.TotalLeases},
+		)
+	}
+	if stats := data.NATStats; stats != nil {
+		fields := []field{
+			{"connections", stats.TotalConnections},
+			{"tcp", stats.TCPConnections},
+			{"udp", stats.UDPConnections},
+			{"icmp", stats.ICMPConnections},
+			{"other", stats.OtherConnections},
+		}
+		if stats.MaxEntries > 0 {
+			fields = append(fields, field{"max_entries", stats.MaxEntries})
+		}
+		e.point("nat", nil, fields...)
+	}
+}
@@ -0,0 +1,210 @@
+// Package influx writes collected data to InfluxDB and compatible
+// time-series databases, such as VictoriaMetrics, in line protocol over
+// HTTP. Collections are queued on disk first, so data collected while the
+// database is unreachable is written once it is back.
+package influx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+)
+
+// Options configures the InfluxDB sink
+type Options struct {
+	// URL is the base URL of the database, e.g. http://localhost:8086
+	URL string
+	// Organization, Bucket and Token select the InfluxDB 2 write API
+	Organization string
+	Bucket       string
+	Token        string
+	// Database, Username and Password select the InfluxDB 1 write API,
+	// which VictoriaMetrics also serves
+	Database string
+	Username string
+	Password string
+	// Gzip compresses request bodies
+	Gzip bool
+	// Timeout bounds each write request
+	Timeout time.Duration
+	// BatchSize is the number of collections written per request
+	BatchSize int
+	// FlushInterval is the longest a collection waits for a batch to fill
+	FlushInterval time.Duration
+	// AgentID is added to every point as the agent tag
+	AgentID string
+	// Redactor, if set, redacts usernames and addresses in event messages
+	Redactor *privacy.Redactor
+	// OnError is called when collections cannot be queued or written
+	OnError func(err error)
+}
+
+// Sink encodes collections as line protocol into a queue and writes the
+// queue to the database
+type Sink struct {
+	opts     Options
+	writeURL string
+	queue    *queue.Queue
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending map[string]*mikrotik.CollectedData // By router ID, until Observe
+}
+
+// New creates a sink writing through q, which it does not close
+func New(q *queue.Queue, opts Options) (*Sink, error) {
+	base, err := url.Parse(opts.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid InfluxDB URL %q", opts.URL)
+	}
+
+	var write *url.URL
+	params := url.Values{}
+	switch {
+	case opts.Bucket != "":
+		write = base.JoinPath("api/v2/write")
+		params.Set("bucket", opts.Bucket)
+		if opts.Organization != "" {
+			params.Set("org", opts.Organization)
+		}
+	case opts.Database != "":
+		write = base.JoinPath("write")
+		params.Set("db", opts.Database)
+	default:
+		return nil, fmt.Errorf("InfluxDB bucket or database is required")
+	}
+	write.RawQuery = params.Encode()
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Redactor == nil {
+		opts.Redactor = privacy.NewRedactor(false, false)
+	}
+
+	return &Sink{
+		opts:     opts,
+		writeURL: write.String(),
+		queue:    q,
+		client:   &http.Client{},
+		pending:  make(map[string]*mikrotik.CollectedData),
+	}, nil
+}
+
+// Update keeps the full data of a MikroTik collection until the matching
+// result reaches Observe; it is meant to be registered with the MikroTik
+// collector's SetDataHandler
+func (s *Sink) Update(data *mikrotik.CollectedData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[data.RouterID] = data
+}
+
+// Observe queues the points of a collection; it is meant to be called from
+// the scheduler's OnResult
+func (s *Sink) Observe(result scheduler.Result) {
+	s.mu.Lock()
+	data := s.pending[result.Router.ID]
+	delete(s.pending, result.Router.ID)
+	s.mu.Unlock()
+
+	// Data handed to Update belongs to this collection only if it carries
+	// the same base model
+	if data != nil && (result.Metrics == nil || data.MetricsData != result.Metrics) {
+		data = nil
+	}
+
+	record := encode(result, data, s.opts.AgentID, s.opts.Redactor)
+	if len(record) == 0 {
+		return
+	}
+	if err := s.queue.Push(record); err != nil {
+		s.onError(fmt.Errorf("failed to queue InfluxDB points: %w", err))
+	}
+}
+
+// Run writes queued collections until ctx is done, retrying with backoff
+// while the database is unreachable or overloaded
+func (s *Sink) Run(ctx context.Context) {
+	s.queue.Deliver(ctx, queue.DeliverOptions{
+		BatchSize:     s.opts.BatchSize,
+		FlushInterval: s.opts.FlushInterval,
+		OnError: func(err error, dropped int) {
+			if dropped > 0 {
+				err = fmt.Errorf("%w (dropped %d collections)", err, dropped)
+			}
+			s.onError(err)
+		},
+	}, s.write)
+}
+
+// write sends records in one request. Requests the database rejects as
+// malformed or too large fail permanently; anything else is retried.
+func (s *Sink) write(ctx context.Context, records [][]byte) error {
+	var body bytes.Buffer
+	if s.opts.Gzip {
+		zw := gzip.NewWriter(&body)
+		for _, r := range records {
+			zw.Write(r)
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range records {
+			body.Write(r)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, &body)
+	if err != nil {
+		return queue.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.opts.Token)
+	} else if s.opts.Username != "" {
+		req.SetBasicAuth(s.opts.Username, s.opts.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("InfluxDB write failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+func (s *Sink) onError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
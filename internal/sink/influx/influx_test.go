@@ -0,0 +1,240 @@
+package influx
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func TestEncode(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	metrics := &models.MetricsData{
+		RouterID:  "bng-1",
+		Timestamp: at,
+		System:    models.SystemMetrics{CPUPercent: 12.5, MemoryUsedBytes: 100, MemoryTotalBytes: 400, UptimeSeconds: 60},
+		Interfaces: []models.InterfaceMetrics{
+			{Name: "ether 1", IsUp: true, RxBytes: 10, TxBytes: 20},
+			{Name: "<pppoe-alice>", IsUp: true},
+		},
+		CustomMetrics: map[string]float64{
+			`probe_rtt_avg_ms{target="8.8.8.8"}`: 4.5,
+			`bad{router="x"}`:                    1,
+		},
+		Events: []models.Event{{Type: "link_down", Severity: models.SeverityWarning, Message: `ether2 "uplink" down`}},
+	}
+	data := &mikrotik.CollectedData{
+		MetricsData:  metrics,
+		Interfaces:   []mikrotik.InterfaceMetrics{{InterfaceMetrics: metrics.Interfaces[0]}, {InterfaceMetrics: metrics.Interfaces[1]}},
+		PPPoE:        []mikrotik.PPPoESession{{}, {}},
+		PPPoEServers: []mikrotik.PPPoEServerStats{{ServerName: "pppoe", Interface: "ether2", ActiveSessions: 2}},
+		DHCPPools:    []mikrotik.DHCPPoolStats{{Name: "pool1", TotalAddresses: 10, UsedAddresses: 4, FreeAddresses: 6, Utilization: 40}},
+		NATStats:     &mikrotik.NATStats{TotalConnections: 5, TCPConnections: 3, UDPConnections: 2},
+	}
+
+	logs := &models.MetricsData{
+		RouterID: "bng-1",
+		Events:   []models.Event{{Type: "router_log", Severity: models.SeverityInfo, Message: "<pppoe-alice>: authenticated, 100.64.0.10"}},
+	}
+
+	tests := []struct {
+		name     string
+		result   scheduler.Result
+		data     *mikrotik.CollectedData
+		redactor *privacy.Redactor
+		want     []string
+		absent   []string
+	}{
+		{
+			name: "mikrotik",
+			result: scheduler.Result{
+				Router:   &models.RouterConfig{ID: "bng-1"},
+				Metrics:  metrics,
+				Duration: 1500 * time.Millisecond,
+			},
+			data: data,
+			want: []string{
+				"router,agent=agent-1,router=bng-1 up=1i,collection_seconds=1.5 1700000000000000000",
+				"system,agent=agent-1,router=bng-1 cpu_percent=12.5,memory_percent=0,memory_used_bytes=100i,memory_total_bytes=400i,uptime_seconds=60i 1700000000000000000",
+				`interface,agent=agent-1,interface=ether\ 1,router=bng-1 up=true,speed_mbps=0i,rx_bytes=10i,tx_bytes=20i,`,
+				"pppoe,agent=agent-1,router=bng-1 sessions=2i",
+				"pppoe_server,agent=agent-1,interface=ether2,router=bng-1,server=pppoe sessions=2i",
+				"dhcp_pool,agent=agent-1,pool=pool1,router=bng-1 total=10i,used=4i,free=6i,utilization_percent=40",
+				"nat,agent=agent-1,router=bng-1 connections=5i,tcp=3i,udp=2i,icmp=0i,other=0i",
+				"probe_rtt_avg_ms,agent=agent-1,router=bng-1,target=8.8.8.8 value=4.5",
+				`event,agent=agent-1,router=bng-1,severity=warning,type=link_down message="ether2 \"uplink\" down"`,
+			},
+			absent: []string{"pppoe-alice", "bad,"},
+		},
+		{
+			name: "without full data",
+			result: scheduler.Result{
+				Router:  &models.RouterConfig{ID: "bng-1"},
+				Metrics: metrics,
+			},
+			want:   []string{"interface,agent=agent-1,interface=ether\\ 1,router=bng-1 "},
+			absent: []string{"pppoe", "nat,"},
+		},
+		{
+			name:     "redacted",
+			result:   scheduler.Result{Router: &models.RouterConfig{ID: "bng-1"}, Metrics: logs},
+			redactor: privacy.NewRedactor(true, true),
+			want:     []string{`message="<pppoe-` + privacy.NewRedactor(true, false).RedactUsername("alice") + `>: authenticated, 100.64.xxx.xxx"`},
+			absent:   []string{"alice", "100.64.0.10"},
+		},
+		{
+			name: "failed",
+			result: scheduler.Result{
+				Router:   &models.RouterConfig{ID: "bng-1"},
+				Err:      errors.New("timeout"),
+				Started:  at,
+				Duration: 2 * time.Second,
+			},
+			want:   []string{"router,agent=agent-1,router=bng-1 up=0i,collection_seconds=2 1700000000000000000\n"},
+			absent: []string{"system"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.redactor
+			if r == nil {
+				r = privacy.NewRedactor(false, false)
+			}
+			got := string(encode(tt.result, tt.data, "agent-1", r))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("missing %q in\n%s", want, got)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(got, absent) {
+					t.Errorf("unexpected %q in\n%s", absent, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSink_Write(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		bodies   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "routers" || r.URL.Query().Get("org") != "isp" {
+			t.Errorf("request to %s", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Error("request is not compressed")
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		body, _ := io.ReadAll(zr)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	q, err := queue.Open(queue.Options{Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	sink, err := New(q, Options{
+		URL:          srv.URL,
+		Organization: "isp",
+		Bucket:       "routers",
+		Token:        "secret",
+		Gzip:         true,
+		BatchSize:    2,
+		AgentID:      "agent-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both collections are queued while the database is failing and
+	// written together once it recovers
+	for _, id := range []string{"r1", "r2"} {
+		metrics := &models.MetricsData{RouterID: id, Timestamp: time.Now()}
+		sink.Update(&mikrotik.CollectedData{MetricsData: metrics, NATStats: &mikrotik.NATStats{TotalConnections: 7}})
+		sink.Observe(scheduler.Result{Router: &models.RouterConfig{ID: id}, Metrics: metrics})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go func() {
+		for q.Stats().Records > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	sink.Run(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("got %d writes, want 1", len(bodies))
+	}
+	for _, want := range []string{"nat,agent=agent-1,router=r1 connections=7i", "nat,agent=agent-1,router=r2 connections=7i"} {
+		if !strings.Contains(bodies[0], want) {
+			t.Errorf("missing %q in\n%s", want, bodies[0])
+		}
+	}
+	if got := q.Stats().Records; got != 0 {
+		t.Errorf("%d collections left in the queue", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    string
+		wantErr bool
+	}{
+		{name: "v2", opts: Options{URL: "http://db:8086", Organization: "isp", Bucket: "routers"}, want: "http://db:8086/api/v2/write?bucket=routers&org=isp"},
+		{name: "v1 behind prefix", opts: Options{URL: "https://vm.example.com/insert/", Database: "isp"}, want: "https://vm.example.com/insert/write?db=isp"},
+		{name: "no target", opts: Options{URL: "http://db:8086"}, wantErr: true},
+		{name: "bad url", opts: Options{URL: "db:8086", Bucket: "routers"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := New(nil, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && sink.writeURL != tt.want {
+				t.Errorf("write URL = %s, want %s", sink.writeURL, tt.want)
+			}
+		})
+	}
+}
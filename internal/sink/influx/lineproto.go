@@ -0,0 +1,102 @@
+package influx
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", " ")
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", " ")
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", " ")
+)
+
+// tag is a line protocol tag; tags with empty values are left out
+type tag struct {
+	key, value string
+}
+
+// field is a line protocol field; value is an int64, float64, bool or
+// string
+type field struct {
+	key   string
+	value any
+}
+
+// encoder writes points of one collection in line protocol. Every point
+// carries the common tags and the timestamp of the collection.
+type encoder struct {
+	buf       bytes.Buffer
+	common    []tag
+	timestamp int64 // Nanoseconds
+}
+
+// point writes one line. Points without a field are skipped, as line
+// protocol requires at least one.
+func (e *encoder) point(measurement string, tags []tag, fields ...field) {
+	e.pointAt(measurement, e.timestamp, tags, fields...)
+}
+
+func (e *encoder) pointAt(measurement string, timestamp int64, tags []tag, fields ...field) {
+	var line bytes.Buffer
+	line.WriteString(measurementEscaper.Replace(measurement))
+
+	all := append(append([]tag(nil), e.common...), tags...)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].key < all[j].key })
+	for _, t := range all {
+		if t.value == "" {
+			continue
+		}
+		line.WriteByte(',')
+		line.WriteString(keyEscaper.Replace(t.key))
+		line.WriteByte('=')
+		line.WriteString(keyEscaper.Replace(t.value))
+	}
+
+	sep := byte(' ')
+	written := 0
+	for _, f := range fields {
+		value, ok := formatValue(f.value)
+		if !ok {
+			continue
+		}
+		line.WriteByte(sep)
+		line.WriteString(keyEscaper.Replace(f.key))
+		line.WriteByte('=')
+		line.WriteString(value)
+		sep = ','
+		written++
+	}
+	if written == 0 {
+		return
+	}
+
+	line.WriteByte(' ')
+	line.WriteString(strconv.FormatInt(timestamp, 10))
+	line.WriteByte('\n')
+	e.buf.Write(line.Bytes())
+}
+
+// formatValue formats a field value, reporting false for values line
+// protocol cannot carry, such as NaN
+func formatValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case int:
+		return strconv.Itoa(v) + "i", true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	}
+	return "", false
+}
@@ -0,0 +1,180 @@
+package mqtt
+
+import (
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// message is one message to publish below the router's topic
+type message struct {
+	topic   string
+	payload any
+	state   bool // Retained if the sink retains state
+}
+
+type statusPayload struct {
+	Up              bool      `json:"up"`
+	Timestamp       time.Time `json:"timestamp"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+type systemPayload struct {
+	CPUPercent         float64   `json:"cpu_percent"`
+	MemoryPercent      float64   `json:"memory_percent"`
+	MemoryUsedBytes    int64     `json:"memory_used_bytes"`
+	MemoryTotalBytes   int64     `json:"memory_total_bytes"`
+	UptimeSeconds      int64     `json:"uptime_seconds"`
+	TemperatureCelsius float64   `json:"temperature_celsius,omitempty"`
+	FirmwareVersion    string    `json:"firmware_version,omitempty"`
+	BoardName          string    `json:"board_name,omitempty"`
+	Timestamp          time.Time `json:"timestamp"`
+}
+
+type interfacePayload struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	Up          bool      `json:"up"`
+	SpeedMbps   int64     `json:"speed_mbps,omitempty"`
+	RxBytes     int64     `json:"rx_bytes"`
+	TxBytes     int64     `json:"tx_bytes"`
+	RxPackets   int64     `json:"rx_packets"`
+	TxPackets   int64     `json:"tx_packets"`
+	RxErrors    int64     `json:"rx_errors"`
+	TxErrors    int64     `json:"tx_errors"`
+	RxDrops     int64     `json:"rx_drops"`
+	TxDrops     int64     `json:"tx_drops"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type pppoePayload struct {
+	Sessions  int                         `json:"sessions"`
+	Servers   []mikrotik.PPPoEServerStats `json:"servers,omitempty"`
+	Timestamp time.Time                   `json:"timestamp"`
+}
+
+type dhcpPayload struct {
+	Pools     []mikrotik.DHCPPoolStats   `json:"pools,omitempty"`
+	Servers   []mikrotik.DHCPServerStats `json:"servers,omitempty"`
+	Timestamp time.Time                  `json:"timestamp"`
+}
+
+type eventPayload struct {
+	Type       string            `json:"type"`
+	Severity   string            `json:"severity"`
+	Message    string            `json:"message"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// messages returns the messages of one collection. data is the full
+// MikroTik data of the collection, if any. Interfaces created per
+// subscriber are left out, as each would add a retained topic. Events are
+// redacted by r.
+func messages(result scheduler.Result, data *mikrotik.CollectedData, events []sessionEvent, r *privacy.Redactor) []message {
+	status := statusPayload{
+		Up:              result.Err == nil,
+		Timestamp:       result.Started.UTC(),
+		DurationSeconds: result.Duration.Seconds(),
+	}
+	if result.Err != nil || result.Metrics == nil {
+		if result.Err != nil {
+			status.Error = result.Err.Error()
+		}
+		return []message{{topic: "status", payload: status, state: true}}
+	}
+
+	metrics := result.Metrics
+	at := metrics.Timestamp.UTC()
+	if metrics.Timestamp.IsZero() {
+		at = status.Timestamp
+	}
+	msgs := []message{{topic: "status", payload: status, state: true}}
+	// System metrics are missing if the output pipeline filtered them out
+	if sys := metrics.System; sys != (models.SystemMetrics{}) {
+		msgs = append(msgs, message{topic: "system", state: true, payload: systemPayload{
+			CPUPercent:         sys.CPUPercent,
+			MemoryPercent:      sys.MemoryPercent,
+			MemoryUsedBytes:    sys.MemoryUsedBytes,
+			MemoryTotalBytes:   sys.MemoryTotalBytes,
+			UptimeSeconds:      sys.UptimeSeconds,
+			TemperatureCelsius: sys.TemperatureCelsius,
+			FirmwareVersion:    sys.FirmwareVersion,
+			BoardName:          sys.BoardName,
+			Timestamp:          at,
+		}})
+	}
+
+	var ifaces []mikrotik.InterfaceMetrics
+	if data != nil {
+		ifaces = data.Interfaces
+	} else {
+		ifaces = make([]mikrotik.InterfaceMetrics, len(metrics.Interfaces))
+		for i, iface := range metrics.Interfaces {
+			ifaces[i].InterfaceMetrics = iface
+		}
+	}
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.IsSubscriber() {
+			continue
+		}
+		msgs = append(msgs, message{topic: "interfaces/" + topicLevel(iface.Name), state: true, payload: interfacePayload{
+			Name:        iface.Name,
+			Description: iface.Description,
+			Type:        iface.Type,
+			Up:          iface.IsUp,
+			SpeedMbps:   iface.SpeedMbps,
+			RxBytes:     iface.RxBytes,
+			TxBytes:     iface.TxBytes,
+			RxPackets:   iface.RxPackets,
+			TxPackets:   iface.TxPackets,
+			RxErrors:    iface.RxErrors,
+			TxErrors:    iface.TxErrors,
+			RxDrops:     iface.RxDrops,
+			TxDrops:     iface.TxDrops,
+			Timestamp:   at,
+		}})
+	}
+
+	if data != nil {
+		if data.PPPoE != nil || data.PPPoEServers != nil {
+			msgs = append(msgs, message{topic: "pppoe", state: true, payload: pppoePayload{
+				Sessions:  data.PPPoESessionCount(),
+				Servers:   data.PPPoEServers,
+				Timestamp: at,
+			}})
+		}
+		if data.DHCPPools != nil || data.DHCPServers != nil {
+			msgs = append(msgs, message{topic: "dhcp", state: true, payload: dhcpPayload{
+				Pools:     data.DHCPPools,
+				Servers:   data.DHCPServers,
+				Timestamp: at,
+			}})
+		}
+	}
+
+	for _, event := range events {
+		msgs = append(msgs, message{topic: "events/" + event.kind, payload: event})
+	}
+	for _, event := range metrics.Events {
+		event = r.RedactEvent(event)
+		ts := event.Timestamp.UTC()
+		if event.Timestamp.IsZero() {
+			ts = at
+		}
+		msgs = append(msgs, message{topic: "events/" + topicLevel(event.Type), payload: eventPayload{
+			Type:       event.Type,
+			Severity:   event.Severity,
+			Message:    event.Message,
+			Timestamp:  ts,
+			Attributes: event.Attributes,
+		}})
+	}
+	return msgs
+}
@@ -0,0 +1,224 @@
+// Package mqtt publishes the state of routers and events detected on them
+// to an MQTT broker, for dashboards and automation that subscribe to a
+// topic hierarchy rather than query a database.
+//
+// Topics are laid out under a prefix, isp/<agent> by default:
+//
+//	<prefix>/status                      online or offline (retained, last will)
+//	<prefix>/<router>/status             outcome of the last collection
+//	<prefix>/<router>/system             CPU, memory, uptime
+//	<prefix>/<router>/interfaces/<name>  interface state and counters
+//	<prefix>/<router>/pppoe              PPPoE sessions per server
+//	<prefix>/<router>/dhcp               DHCP pools and servers
+//	<prefix>/<router>/events/<type>      events, such as pppoe or dhcp
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+)
+
+const (
+	online  = "online"
+	offline = "offline"
+
+	// publishTimeout bounds the wait for the broker to acknowledge the
+	// messages of one collection
+	publishTimeout = 30 * time.Second
+)
+
+// Options configures the MQTT sink
+type Options struct {
+	// Broker is the broker URL, e.g. tcp://broker:1883 or ssl://broker:8883
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// TLS, if set, is used for ssl://, tls:// and wss:// brokers
+	TLS *tls.Config
+	// QoS is the MQTT quality of service of every message (0, 1 or 2)
+	QoS byte
+	// Retain marks state messages as retained, so new subscribers get the
+	// last state right away. Events are never retained.
+	Retain bool
+	// TopicPrefix is prepended to every topic; isp/<AgentID> if empty
+	TopicPrefix string
+	// SessionEvents publishes PPPoE sessions and DHCP leases coming and
+	// going, detected by comparing consecutive collections
+	SessionEvents bool
+	// Redactor, if set, redacts usernames and addresses in events, including
+	// router logs and other collected events
+	Redactor *privacy.Redactor
+	AgentID  string
+	// OnError is called when messages cannot be published
+	OnError func(err error)
+}
+
+// Sink publishes collections to an MQTT broker
+type Sink struct {
+	opts   Options
+	prefix string
+	client paho.Client
+
+	mu       sync.Mutex
+	pending  map[string]*mikrotik.CollectedData // By router ID, until Observe
+	sessions map[string]*sessionTracker         // By router ID
+}
+
+// New creates a sink; Connect must be called before publishing
+func New(opts Options) (*Sink, error) {
+	if opts.Broker == "" {
+		return nil, fmt.Errorf("MQTT broker is required")
+	}
+	if opts.QoS > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d", opts.QoS)
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = "ispagent-" + opts.AgentID
+	}
+	if opts.Redactor == nil {
+		opts.Redactor = privacy.NewRedactor(false, false)
+	}
+
+	s := &Sink{
+		opts:     opts,
+		prefix:   strings.TrimSuffix(opts.TopicPrefix, "/"),
+		pending:  make(map[string]*mikrotik.CollectedData),
+		sessions: make(map[string]*sessionTracker),
+	}
+	if s.prefix == "" {
+		s.prefix = "isp/" + topicLevel(opts.AgentID)
+	}
+
+	clientOpts := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetCleanSession(true).
+		SetOrderMatters(false).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10*time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetWill(s.prefix+"/status", offline, opts.QoS, true).
+		SetOnConnectHandler(func(c paho.Client) {
+			c.Publish(s.prefix+"/status", opts.QoS, true, online)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			s.onError(fmt.Errorf("connection to MQTT broker lost: %w", err))
+		})
+	if opts.TLS != nil {
+		clientOpts.SetTLSConfig(opts.TLS)
+	}
+	s.client = paho.NewClient(clientOpts)
+	return s, nil
+}
+
+// Connect connects to the broker, waiting until ctx is done. The client
+// keeps retrying in the background if the broker cannot be reached, so an
+// error leaves the sink usable.
+func (s *Sink) Connect(ctx context.Context) error {
+	token := s.client.Connect()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return fmt.Errorf("MQTT broker %s not reachable yet: %w", s.opts.Broker, ctx.Err())
+	}
+}
+
+// Update keeps the full data of a MikroTik collection until the matching
+// result reaches Observe; it is meant to be registered with the MikroTik
+// collector's SetDataHandler
+func (s *Sink) Update(data *mikrotik.CollectedData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[data.RouterID] = data
+}
+
+// Observe publishes the state of a router and its events; it is meant to
+// be called from the scheduler's OnResult. It does not wait for the broker.
+func (s *Sink) Observe(result scheduler.Result) {
+	s.mu.Lock()
+	data := s.pending[result.Router.ID]
+	delete(s.pending, result.Router.ID)
+	// Data handed to Update belongs to this collection only if it carries
+	// the same base model
+	if data != nil && (result.Metrics == nil || data.MetricsData != result.Metrics) {
+		data = nil
+	}
+	var events []sessionEvent
+	if s.opts.SessionEvents && data != nil {
+		tracker := s.sessions[result.Router.ID]
+		if tracker == nil {
+			tracker = &sessionTracker{}
+			s.sessions[result.Router.ID] = tracker
+		}
+		events = tracker.update(data, s.opts.Redactor)
+	}
+	s.mu.Unlock()
+
+	var tokens []paho.Token
+	for _, m := range messages(result, data, events, s.opts.Redactor) {
+		topic := s.prefix + "/" + topicLevel(result.Router.ID) + "/" + m.topic
+		payload, err := json.Marshal(m.payload)
+		if err != nil {
+			s.onError(fmt.Errorf("failed to encode MQTT message for %s: %w", topic, err))
+			continue
+		}
+		tokens = append(tokens, s.client.Publish(topic, s.opts.QoS, s.opts.Retain && m.state, payload))
+	}
+	go s.wait(tokens)
+}
+
+// Close publishes that the agent is going offline and disconnects
+func (s *Sink) Close() error {
+	if s.client.IsConnectionOpen() {
+		s.client.Publish(s.prefix+"/status", s.opts.QoS, true, offline).WaitTimeout(5 * time.Second)
+	}
+	s.client.Disconnect(250)
+	return nil
+}
+
+// wait reports the first message of a collection the broker did not
+// accept
+func (s *Sink) wait(tokens []paho.Token) {
+	deadline := time.Now().Add(publishTimeout)
+	for _, token := range tokens {
+		if !token.WaitTimeout(time.Until(deadline)) {
+			s.onError(fmt.Errorf("MQTT broker did not acknowledge messages within %v", publishTimeout))
+			return
+		}
+		if err := token.Error(); err != nil {
+			s.onError(fmt.Errorf("failed to publish to MQTT broker: %w", err))
+			return
+		}
+	}
+}
+
+func (s *Sink) onError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+// topicLevel makes s usable as one topic level, replacing the separator
+// and wildcards
+func topicLevel(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
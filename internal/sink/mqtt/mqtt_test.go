@@ -0,0 +1,241 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// broker accepts MQTT connections and keeps what it is sent
+type broker struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	connect   *packets.ConnectPacket
+	published []*packets.PublishPacket
+}
+
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return b
+}
+
+func (b *broker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.connect = p
+			b.mu.Unlock()
+			packets.NewControlPacket(packets.Connack).Write(conn)
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			b.published = append(b.published, p)
+			b.mu.Unlock()
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				ack.Write(conn)
+			}
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// messages returns the messages published to a topic
+func (b *broker) messages(topic string) []*packets.PublishPacket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var msgs []*packets.PublishPacket
+	for _, p := range b.published {
+		if p.TopicName == topic {
+			msgs = append(msgs, p)
+		}
+	}
+	return msgs
+}
+
+// waitFor waits until a message is published to topic
+func (b *broker) waitFor(t *testing.T, topic string) []*packets.PublishPacket {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if msgs := b.messages(topic); len(msgs) > 0 {
+			return msgs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("nothing published to %s", topic)
+	return nil
+}
+
+func collection(sink *Sink, id string, sessions []string, leases []string) {
+	metrics := &models.MetricsData{
+		RouterID:  id,
+		Timestamp: time.Now(),
+		System:    models.SystemMetrics{CPUPercent: 7},
+		Events:    []models.Event{{Type: "router_log", Message: "<pppoe-alice>: authenticated"}},
+	}
+	data := &mikrotik.CollectedData{
+		MetricsData: metrics,
+		Interfaces: []mikrotik.InterfaceMetrics{
+			{InterfaceMetrics: models.InterfaceMetrics{Name: "ether1", IsUp: true, RxBytes: 100}, Type: "ether"},
+			{InterfaceMetrics: models.InterfaceMetrics{Name: "<pppoe-alice>", IsUp: true}, Type: "pppoe-in"},
+		},
+		PPPoEServers: []mikrotik.PPPoEServerStats{{ServerName: "pppoe", Interface: "ether2", ActiveSessions: len(sessions)}},
+		DHCPServers:  []mikrotik.DHCPServerStats{{Name: "dhcp1"}},
+		CollectedAt:  metrics.Timestamp,
+	}
+	for _, user := range sessions {
+		data.PPPoE = append(data.PPPoE, mikrotik.PPPoESession{ID: "*" + user, Username: user, Address: "100.64.0.1"})
+	}
+	for _, mac := range leases {
+		data.DHCPLeases = append(data.DHCPLeases, mikrotik.DHCPLease{MACAddress: mac, Address: "192.168.88.10", Status: "bound", ServerName: "dhcp1"})
+	}
+	sink.Update(data)
+	sink.Observe(scheduler.Result{Router: &models.RouterConfig{ID: id}, Metrics: metrics, Started: metrics.Timestamp})
+}
+
+func TestSink_Publish(t *testing.T) {
+	b := newBroker(t)
+	sink, err := New(Options{
+		Broker:        "tcp://" + b.ln.Addr().String(),
+		QoS:           1,
+		Retain:        true,
+		SessionEvents: true,
+		Redactor:      privacy.NewRedactor(true, false),
+		AgentID:       "agent-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := sink.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	// The first collection is the baseline; the second reports changes
+	collection(sink, "bng/1", []string{"alice", "bob"}, []string{"AA:BB:CC:00:00:01"})
+	b.waitFor(t, "isp/agent-1/bng_1/status")
+	collection(sink, "bng/1", []string{"bob", "carol"}, nil)
+	b.waitFor(t, "isp/agent-1/bng_1/events/dhcp")
+	sink.Observe(scheduler.Result{Router: &models.RouterConfig{ID: "olt-1"}, Err: context.DeadlineExceeded})
+	b.waitFor(t, "isp/agent-1/olt-1/status")
+	sink.Close()
+
+	b.mu.Lock()
+	will := b.connect
+	b.mu.Unlock()
+	if will.WillTopic != "isp/agent-1/status" || string(will.WillMessage) != "offline" || !will.WillRetain {
+		t.Errorf("last will = %s %q retained %t", will.WillTopic, will.WillMessage, will.WillRetain)
+	}
+
+	status := b.messages("isp/agent-1/status")
+	if len(status) != 2 || string(status[0].Payload) != "online" || string(status[1].Payload) != "offline" || !status[1].Retain {
+		t.Errorf("agent status messages = %v", status)
+	}
+
+	tests := []struct {
+		topic    string
+		retained bool
+		contains []string
+	}{
+		{"isp/agent-1/bng_1/status", true, []string{`"up":true`}},
+		{"isp/agent-1/bng_1/system", true, []string{`"cpu_percent":7`}},
+		{"isp/agent-1/bng_1/interfaces/ether1", true, []string{`"name":"ether1"`, `"rx_bytes":100`}},
+		{"isp/agent-1/bng_1/pppoe", true, []string{`"server_name":"pppoe"`}},
+		{"isp/agent-1/bng_1/dhcp", true, []string{`"name":"dhcp1"`}},
+		{"isp/agent-1/bng_1/events/dhcp", false, []string{`"event":"released"`, `"mac_address":"AA:BB:CC:00:00:01"`}},
+		{"isp/agent-1/olt-1/status", true, []string{`"up":false`, `"error":"context deadline exceeded"`}},
+	}
+	for _, tt := range tests {
+		msgs := b.messages(tt.topic)
+		if len(msgs) == 0 {
+			t.Errorf("nothing published to %s", tt.topic)
+			continue
+		}
+		last := msgs[len(msgs)-1]
+		if last.Retain != tt.retained {
+			t.Errorf("%s retained = %t, want %t", tt.topic, last.Retain, tt.retained)
+		}
+		for _, want := range tt.contains {
+			if !strings.Contains(string(last.Payload), want) {
+				t.Errorf("%s payload %s does not contain %s", tt.topic, last.Payload, want)
+			}
+		}
+	}
+
+	if msgs := b.messages("isp/agent-1/bng_1/interfaces/<pppoe-alice>"); len(msgs) > 0 {
+		t.Error("subscriber interface published")
+	}
+
+	redactor := privacy.NewRedactor(true, false)
+	logs := b.messages("isp/agent-1/bng_1/events/router_log")
+	if len(logs) == 0 {
+		t.Error("nothing published to isp/agent-1/bng_1/events/router_log")
+	}
+	for _, m := range logs {
+		var event eventPayload
+		if err := json.Unmarshal(m.Payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		if want := "<pppoe-" + redactor.RedactUsername("alice") + ">: authenticated"; event.Message != want {
+			t.Errorf("router log message = %q, want %q", event.Message, want)
+		}
+	}
+
+	events := make(map[string]string)
+	for _, m := range b.messages("isp/agent-1/bng_1/events/pppoe") {
+		var event sessionEvent
+		if err := json.Unmarshal(m.Payload, &event); err != nil {
+			t.Fatal(err)
+		}
+		events[event.Username] = event.Event
+	}
+	want := map[string]string{
+		redactor.RedactUsername("carol"): "connected",
+		redactor.RedactUsername("alice"): "disconnected",
+	}
+	if len(events) != len(want) {
+		t.Errorf("PPPoE events = %v, want %v", events, want)
+	}
+	for user, event := range want {
+		if events[user] != event {
+			t.Errorf("PPPoE event of %s = %q, want %q", user, events[user], event)
+		}
+	}
+}
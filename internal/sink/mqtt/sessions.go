@@ -0,0 +1,132 @@
+package mqtt
+
+import (
+	"sort"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+)
+
+// Session event kinds, the last level of their topic
+const (
+	kindPPPoE = "pppoe"
+	kindDHCP  = "dhcp"
+)
+
+// sessionEvent reports a PPPoE session or bound DHCP lease appearing or
+// going away between two collections
+type sessionEvent struct {
+	kind          string
+	Event         string    `json:"event"` // connected, disconnected, bound or released
+	Username      string    `json:"username,omitempty"`
+	Address       string    `json:"address,omitempty"`
+	MACAddress    string    `json:"mac_address,omitempty"`
+	Hostname      string    `json:"hostname,omitempty"`
+	Server        string    `json:"server,omitempty"`
+	UptimeSeconds int64     `json:"uptime_seconds,omitempty"` // Last seen, for disconnections
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// sessionTracker remembers the sessions and leases of one router. The first
+// collection only sets the baseline, so restarting the agent does not
+// report every subscriber as new.
+type sessionTracker struct {
+	pppoe  map[string]mikrotik.PPPoESession // By session ID
+	leases map[string]mikrotik.DHCPLease    // Bound leases by MAC and address
+}
+
+// update returns the events between the previous collection and data
+func (t *sessionTracker) update(data *mikrotik.CollectedData, r *privacy.Redactor) []sessionEvent {
+	at := data.CollectedAt.UTC()
+	if data.CollectedAt.IsZero() {
+		at = time.Now().UTC()
+	}
+	var events []sessionEvent
+
+	if data.PPPoE != nil || data.PPPoEServers != nil {
+		current := make(map[string]mikrotik.PPPoESession, len(data.PPPoE))
+		for _, session := range data.PPPoE {
+			key := session.ID
+			if key == "" {
+				key = session.Name + "/" + session.SessionID
+			}
+			current[key] = session
+			if _, ok := t.pppoe[key]; !ok && t.pppoe != nil {
+				events = append(events, pppoeEvent("connected", session, r, at))
+			}
+		}
+		for _, key := range sortedKeys(t.pppoe) {
+			if _, ok := current[key]; !ok {
+				event := pppoeEvent("disconnected", t.pppoe[key], r, at)
+				event.UptimeSeconds = t.pppoe[key].Uptime
+				events = append(events, event)
+			}
+		}
+		t.pppoe = current
+	}
+
+	if data.DHCPLeases != nil || data.DHCPServers != nil {
+		current := make(map[string]mikrotik.DHCPLease)
+		for _, lease := range data.DHCPLeases {
+			if lease.Status != "bound" {
+				continue
+			}
+			key := lease.MACAddress + "/" + lease.Address
+			current[key] = lease
+			if _, ok := t.leases[key]; !ok && t.leases != nil {
+				events = append(events, dhcpEvent("bound", lease, r, at))
+			}
+		}
+		for _, key := range sortedKeys(t.leases) {
+			if _, ok := current[key]; !ok {
+				events = append(events, dhcpEvent("released", t.leases[key], r, at))
+			}
+		}
+		t.leases = current
+	}
+
+	return events
+}
+
+func pppoeEvent(event string, s mikrotik.PPPoESession, r *privacy.Redactor, at time.Time) sessionEvent {
+	return sessionEvent{
+		kind:       kindPPPoE,
+		Event:      event,
+		Username:   r.RedactUsername(s.Username),
+		Address:    r.RedactIPAddress(s.Address),
+		MACAddress: redactMAC(s.CallerID, r),
+		Server:     s.Service,
+		Timestamp:  at,
+	}
+}
+
+func dhcpEvent(event string, l mikrotik.DHCPLease, r *privacy.Redactor, at time.Time) sessionEvent {
+	return sessionEvent{
+		kind:       kindDHCP,
+		Event:      event,
+		Address:    r.RedactIPAddress(l.Address),
+		MACAddress: redactMAC(l.MACAddress, r),
+		Hostname:   r.RedactUsername(l.Hostname),
+		Server:     l.ServerName,
+		Timestamp:  at,
+	}
+}
+
+// redactMAC redacts a MAC address along with IP addresses, as both
+// identify a subscriber's device
+func redactMAC(mac string, r *privacy.Redactor) string {
+	if r.ShouldRedactIPAddresses() {
+		return r.RedactMACAddress(mac)
+	}
+	return mac
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,255 @@
+// Package sink fans collections out to outputs, such as the server,
+// Prometheus, InfluxDB, MQTT or an event bus. Every output gets its own
+// buffer and goroutine, so a slow or failing output cannot hold up
+// collection or the other outputs, and its own filter of routers and data
+// types.
+package sink
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// dropReportInterval bounds how often dropped collections are reported per
+// output
+const dropReportInterval = time.Minute
+
+// Sink is an output fed with collections
+type Sink interface {
+	// Update receives the full data of a MikroTik collection, before its
+	// result reaches Observe
+	Update(data *mikrotik.CollectedData)
+	// Observe receives the result of every collection
+	Observe(result scheduler.Result)
+}
+
+// OutputOptions configures how an output is fed
+type OutputOptions struct {
+	Filter Filter
+	// Buffer is the number of collections held while the output is busy;
+	// beyond it, collections are dropped for this output only. 100 if zero.
+	Buffer int
+}
+
+// OutputStats reports what an output received
+type OutputStats struct {
+	Name      string
+	Delivered int64
+	Dropped   int64
+	Pending   int
+}
+
+// Pipeline feeds collections to outputs
+type Pipeline struct {
+	onError func(output string, err error)
+
+	mu      sync.RWMutex
+	outputs []*output
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewPipeline creates a pipeline without outputs. onError, if set, is
+// called when an output drops collections or panics.
+func NewPipeline(onError func(output string, err error)) *Pipeline {
+	return &Pipeline{onError: onError}
+}
+
+// Add starts feeding s with the collections that pass opts.Filter
+func (p *Pipeline) Add(name string, s Sink, opts OutputOptions) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+	o := &output{
+		name:     name,
+		sink:     s,
+		filter:   opts.Filter,
+		events:   make(chan event, opts.Buffer),
+		filtered: make(map[string]filteredMetrics),
+		onError:  p.onError,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.outputs = append(p.outputs, o)
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		o.run()
+	}()
+}
+
+// Update hands the full data of a MikroTik collection to the outputs; it is
+// meant to be registered with the MikroTik collector's SetDataHandler. It
+// does not wait for the outputs.
+func (p *Pipeline) Update(data *mikrotik.CollectedData) {
+	if data.MetricsData == nil {
+		return
+	}
+	p.send(data.RouterID, event{data: data})
+}
+
+// Observe hands a collection result to the outputs; it is meant to be
+// called from the scheduler's OnResult. It does not wait for the outputs.
+func (p *Pipeline) Observe(result scheduler.Result) {
+	p.send(result.Router.ID, event{result: &result})
+}
+
+func (p *Pipeline) send(routerID string, ev event) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	for _, o := range p.outputs {
+		if o.filter.matchRouter(routerID) {
+			o.send(ev)
+		}
+	}
+}
+
+// Close stops accepting collections and waits until the outputs have
+// received those already handed to them
+func (p *Pipeline) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, o := range p.outputs {
+			close(o.events)
+		}
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// Stats returns what each output received, in the order they were added
+func (p *Pipeline) Stats() []OutputStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	stats := make([]OutputStats, len(p.outputs))
+	for i, o := range p.outputs {
+		o.mu.Lock()
+		stats[i] = OutputStats{
+			Name:      o.name,
+			Delivered: o.delivered,
+			Dropped:   o.dropped,
+			Pending:   len(o.events),
+		}
+		o.mu.Unlock()
+	}
+	return stats
+}
+
+// event is a collection on its way to an output: the full data of a
+// MikroTik collection or a result
+type event struct {
+	data   *mikrotik.CollectedData
+	result *scheduler.Result
+}
+
+// filteredMetrics is the filtered copy of the base model of a collection,
+// kept so that the data and the result of the collection still carry the
+// same base model after filtering
+type filteredMetrics struct {
+	original *models.MetricsData
+	copy     *models.MetricsData
+}
+
+// output feeds one sink from its own goroutine
+type output struct {
+	name     string
+	sink     Sink
+	filter   Filter
+	events   chan event
+	filtered map[string]filteredMetrics // By router ID; used by run only
+	onError  func(output string, err error)
+
+	mu         sync.Mutex
+	delivered  int64
+	dropped    int64
+	reported   int64 // Dropped count last reported
+	reportedAt time.Time
+}
+
+// send queues ev, or drops it if the output is too far behind
+func (o *output) send(ev event) {
+	select {
+	case o.events <- ev:
+		return
+	default:
+	}
+
+	o.mu.Lock()
+	o.dropped++
+	var err error
+	if time.Since(o.reportedAt) >= dropReportInterval {
+		err = fmt.Errorf("output too slow, dropped %d collections", o.dropped-o.reported)
+		o.reported = o.dropped
+		o.reportedAt = time.Now()
+	}
+	o.mu.Unlock()
+	if err != nil {
+		o.report(err)
+	}
+}
+
+func (o *output) run() {
+	for ev := range o.events {
+		o.deliver(ev)
+		o.mu.Lock()
+		o.delivered++
+		o.mu.Unlock()
+	}
+}
+
+// deliver hands one event to the sink, filtered. A panicking sink is
+// reported and keeps receiving collections.
+func (o *output) deliver(ev event) {
+	defer func() {
+		if r := recover(); r != nil {
+			o.report(fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	if ev.data != nil {
+		data := ev.data
+		if !o.filter.all() {
+			metrics := o.filter.metrics(data.MetricsData)
+			o.filtered[data.RouterID] = filteredMetrics{original: data.MetricsData, copy: metrics}
+			data = o.filter.data(data, metrics)
+		}
+		o.sink.Update(data)
+		return
+	}
+
+	result := *ev.result
+	if !o.filter.all() {
+		if result.Err != nil && !o.filter.has(DataErrors) {
+			return
+		}
+		if result.Metrics != nil {
+			f, ok := o.filtered[result.Router.ID]
+			if ok && f.original == result.Metrics {
+				result.Metrics = f.copy
+			} else {
+				result.Metrics = o.filter.metrics(result.Metrics)
+			}
+		}
+		delete(o.filtered, result.Router.ID)
+	}
+	o.sink.Observe(result)
+}
+
+func (o *output) report(err error) {
+	if o.onError != nil {
+		o.onError(o.name, err)
+	}
+}
@@ -0,0 +1,304 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// recorder is a sink recording what it receives
+type recorder struct {
+	mu      sync.Mutex
+	updates []*mikrotik.CollectedData
+	results []scheduler.Result
+	block   chan struct{} // If set, Observe waits for it to close
+}
+
+func (r *recorder) Update(data *mikrotik.CollectedData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, data)
+}
+
+func (r *recorder) Observe(result scheduler.Result) {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.results = append(r.results, result)
+}
+
+// panicker is a sink that panics on every collection
+type panicker struct{}
+
+func (panicker) Update(*mikrotik.CollectedData) { panic("update") }
+func (panicker) Observe(scheduler.Result)       { panic("observe") }
+
+// fakeTransport is a transport recording the metrics reports it is sent
+type fakeTransport struct {
+	metrics []*agentpb.MetricsReport
+}
+
+func (f *fakeTransport) Connect(context.Context) error { return nil }
+func (f *fakeTransport) SendMetrics(_ context.Context, report *agentpb.MetricsReport) error {
+	f.metrics = append(f.metrics, report)
+	return nil
+}
+func (f *fakeTransport) SendSessions(context.Context, *agentpb.SessionReport) error { return nil }
+func (f *fakeTransport) SendHeartbeat(context.Context) error                        { return nil }
+func (f *fakeTransport) Close() error                                               { return nil }
+
+// collection returns the data and the result of a collection from router
+func collection(router string) (*mikrotik.CollectedData, scheduler.Result) {
+	metrics := &models.MetricsData{
+		RouterID:   router,
+		System:     models.SystemMetrics{CPUPercent: 10},
+		Interfaces: []models.InterfaceMetrics{{Name: "ether1"}},
+		Events:     []models.Event{{Type: "link_down"}},
+	}
+	data := &mikrotik.CollectedData{
+		MetricsData:  metrics,
+		System:       &mikrotik.SystemMetrics{},
+		PPPoE:        []mikrotik.PPPoESession{{Username: "alice"}},
+		PPPoEServers: []mikrotik.PPPoEServerStats{{ServerName: "pppoe1", ActiveSessions: 1}},
+		Neighbors:    &mikrotik.NeighborTables{},
+		IPv6:         &mikrotik.IPv6Data{Bindings: []mikrotik.DHCPv6Binding{{}}},
+		Errors:       []string{"nat: timeout"},
+	}
+	return data, scheduler.Result{Router: &models.RouterConfig{ID: router}, Metrics: metrics}
+}
+
+func TestPipeline_Filter(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      Filter
+		routers     []string
+		wantRouters []string
+		check       func(t *testing.T, data *mikrotik.CollectedData, result scheduler.Result)
+	}{
+		{
+			name:        "everything",
+			routers:     []string{"bng-1", "olt-1"},
+			wantRouters: []string{"bng-1", "olt-1"},
+			check: func(t *testing.T, data *mikrotik.CollectedData, result scheduler.Result) {
+				if data.PPPoE == nil || data.Neighbors == nil || data.Errors == nil || len(result.Metrics.Events) != 1 {
+					t.Errorf("data = %+v, want all of it", data)
+				}
+			},
+		},
+		{
+			name:        "routers",
+			filter:      Filter{Routers: []string{"bng-*", "core"}},
+			routers:     []string{"bng-1", "olt-1", "core", "bng-2"},
+			wantRouters: []string{"bng-1", "core", "bng-2"},
+		},
+		{
+			name:        "metrics only",
+			filter:      Filter{Data: []DataType{DataMetrics}},
+			routers:     []string{"bng-1"},
+			wantRouters: []string{"bng-1"},
+			check: func(t *testing.T, data *mikrotik.CollectedData, result scheduler.Result) {
+				if data.PPPoE != nil || data.Neighbors != nil || data.IPv6 != nil || data.Errors != nil || result.Metrics.Events != nil {
+					t.Errorf("data = %+v, want metrics only", data)
+				}
+				if data.System == nil || data.PPPoEServers == nil || result.Metrics.System.CPUPercent != 10 {
+					t.Errorf("data = %+v, want metrics", data)
+				}
+				if data.PPPoESessionCount() != 1 {
+					t.Errorf("PPPoESessionCount() = %d, want 1", data.PPPoESessionCount())
+				}
+			},
+		},
+		{
+			name:        "sessions and events",
+			filter:      Filter{Data: []DataType{DataSessions, DataEvents}},
+			routers:     []string{"bng-1"},
+			wantRouters: []string{"bng-1"},
+			check: func(t *testing.T, data *mikrotik.CollectedData, result scheduler.Result) {
+				if data.PPPoE == nil || data.IPv6 == nil || len(data.IPv6.Bindings) != 1 || len(result.Metrics.Events) != 1 {
+					t.Errorf("data = %+v, want sessions and events", data)
+				}
+				if data.System != nil || data.PPPoEServers != nil || result.Metrics.System != (models.SystemMetrics{}) || result.Metrics.Interfaces != nil {
+					t.Errorf("data = %+v, want no metrics", data)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPipeline(nil)
+			r := &recorder{}
+			p.Add("test", r, OutputOptions{Filter: tt.filter})
+			var originals []*models.MetricsData
+			for _, router := range tt.routers {
+				data, result := collection(router)
+				originals = append(originals, data.MetricsData)
+				p.Update(data)
+				p.Observe(result)
+			}
+			p.Close()
+
+			if len(r.results) != len(tt.wantRouters) || len(r.updates) != len(tt.wantRouters) {
+				t.Fatalf("got %d results and %d updates, want %d", len(r.results), len(r.updates), len(tt.wantRouters))
+			}
+			for i, want := range tt.wantRouters {
+				data, result := r.updates[i], r.results[i]
+				if result.Router.ID != want || data.RouterID != want {
+					t.Errorf("collection %d from %s, want %s", i, result.Router.ID, want)
+				}
+				// Sinks pair the data and the result of a collection by
+				// their base model
+				if data.MetricsData != result.Metrics {
+					t.Errorf("collection %d: data and result carry different metrics", i)
+				}
+				if tt.check != nil {
+					tt.check(t, data, result)
+				}
+			}
+			// Filtering works on copies
+			for _, m := range originals {
+				if m.System.CPUPercent != 10 || len(m.Events) != 1 {
+					t.Errorf("original metrics modified: %+v", m)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportSink_Observe(t *testing.T) {
+	tests := []struct {
+		name   string
+		result scheduler.Result
+		want   int
+	}{
+		{"metrics", scheduler.Result{Metrics: &models.MetricsData{System: models.SystemMetrics{CPUPercent: 10}}}, 1},
+		{"events only", scheduler.Result{Metrics: &models.MetricsData{Events: []models.Event{{Type: "router_log"}}}}, 1},
+		{"empty", scheduler.Result{Metrics: &models.MetricsData{}}, 0},
+		{"failed", scheduler.Result{Err: errors.New("timeout")}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &fakeTransport{}
+			NewTransportSink(tr, "agent-1", nil, nil).Observe(tt.result)
+			if len(tr.metrics) != tt.want {
+				t.Errorf("sent %d reports, want %d", len(tr.metrics), tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all data", Filter{}, 1},
+		{"errors", Filter{Data: []DataType{DataErrors}}, 1},
+		{"metrics", Filter{Data: []DataType{DataMetrics}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPipeline(nil)
+			r := &recorder{}
+			p.Add("test", r, OutputOptions{Filter: tt.filter})
+			p.Observe(scheduler.Result{Router: &models.RouterConfig{ID: "bng-1"}, Err: errors.New("timeout")})
+			p.Close()
+			if len(r.results) != tt.want {
+				t.Errorf("got %d failed results, want %d", len(r.results), tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_SlowOutput(t *testing.T) {
+	var mu sync.Mutex
+	var reported []string
+	p := NewPipeline(func(output string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, output+": "+err.Error())
+	})
+	slow := &recorder{block: make(chan struct{})}
+	fast := &recorder{}
+	p.Add("slow", slow, OutputOptions{Buffer: 2})
+	p.Add("fast", fast, OutputOptions{Buffer: 20})
+
+	// The slow output takes the first result and blocks on it
+	_, result := collection("bng-1")
+	p.Observe(result)
+	for p.Stats()[0].Pending > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Observing must not wait for the slow output
+	observed := make(chan struct{})
+	go func() {
+		defer close(observed)
+		for i := 1; i < 10; i++ {
+			_, result := collection("bng-1")
+			p.Observe(result)
+		}
+	}()
+	select {
+	case <-observed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Observe blocked on a slow output")
+	}
+	close(slow.block)
+	p.Close()
+
+	if len(fast.results) != 10 {
+		t.Errorf("fast output got %d results, want 10", len(fast.results))
+	}
+	// One result was taken by the blocked output and two buffered
+	if len(slow.results) != 3 {
+		t.Errorf("slow output got %d results, want 3", len(slow.results))
+	}
+	stats := p.Stats()
+	if stats[0].Name != "slow" || stats[0].Dropped != 7 || stats[0].Delivered != 3 || stats[1].Dropped != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	// Drops are reported once per interval
+	if len(reported) != 1 || !strings.HasPrefix(reported[0], "slow: ") {
+		t.Errorf("reported %v, want one report for slow", reported)
+	}
+}
+
+func TestPipeline_Panic(t *testing.T) {
+	var reported []string
+	p := NewPipeline(func(output string, err error) {
+		reported = append(reported, output+": "+err.Error())
+	})
+	r := &recorder{}
+	p.Add("broken", panicker{}, OutputOptions{})
+	p.Add("test", r, OutputOptions{})
+	for i := 0; i < 2; i++ {
+		data, result := collection("bng-1")
+		p.Update(data)
+		p.Observe(result)
+	}
+	p.Close()
+
+	if len(r.results) != 2 {
+		t.Errorf("got %d results, want 2", len(r.results))
+	}
+	want := []string{"broken: panic: update", "broken: panic: observe", "broken: panic: update", "broken: panic: observe"}
+	if strings.Join(reported, "\n") != strings.Join(want, "\n") {
+		t.Errorf("reported %q, want %q", reported, want)
+	}
+
+	// Collections after Close are ignored
+	_, result := collection("bng-1")
+	p.Observe(result)
+}
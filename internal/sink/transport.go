@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// sendTimeout bounds handing one report to a transport
+const sendTimeout = 30 * time.Second
+
+// TransportSink feeds a transport with the metrics and events of every
+// successful collection and the sessions of MikroTik collections
+type TransportSink struct {
+	transport transport.Transport
+	agentID   string
+	redactor  *privacy.Redactor
+	onError   func(err error)
+}
+
+// NewTransportSink creates a sink sending to t. Session reports and events
+// are redacted by r; onError, if set, is called when a report cannot be sent.
+func NewTransportSink(t transport.Transport, agentID string, r *privacy.Redactor, onError func(err error)) *TransportSink {
+	return &TransportSink{transport: t, agentID: agentID, redactor: r, onError: onError}
+}
+
+// Update sends the sessions of a MikroTik collection, if any were collected
+func (s *TransportSink) Update(data *mikrotik.CollectedData) {
+	report := transport.NewSessionReport(s.agentID, data, s.redactor)
+	if report == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	if err := s.transport.SendSessions(ctx, report); err != nil {
+		s.fail(err)
+	}
+}
+
+// Observe sends the metrics and events of a successful collection
+func (s *TransportSink) Observe(result scheduler.Result) {
+	if result.Err != nil || result.Metrics == nil || !hasMetrics(result.Metrics) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	report := transport.NewMetricsReport(s.agentID, result.Metrics, s.redactor)
+	if err := s.transport.SendMetrics(ctx, report); err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *TransportSink) fail(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// hasMetrics reports whether m carries metrics or events, which a filter
+// may have removed
+func hasMetrics(m *models.MetricsData) bool {
+	return m.System != (models.SystemMetrics{}) || len(m.Interfaces) > 0 || len(m.CustomMetrics) > 0 || len(m.Events) > 0
+}
@@ -0,0 +1,236 @@
+// Package sshclient runs commands on remote hosts over SSH with key or
+// password authentication and known_hosts host key verification.
+package sshclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Options configures a connection.
+type Options struct {
+	// Address is host:port.
+	Address  string
+	Username string
+	// Password is used for password authentication and, when the key is
+	// encrypted, as its passphrase.
+	Password string
+	// Key is a private key file path or the PEM key itself.
+	Key string
+	// KnownHosts is the known_hosts file verifying the host key; it defaults
+	// to ~/.ssh/known_hosts.
+	KnownHosts string
+	// InsecureIgnoreHostKey disables host key verification.
+	InsecureIgnoreHostKey bool
+	// Timeout limits connection setup; it defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// Client is an SSH connection. Every command runs in its own session, so a
+// client may be used from several goroutines.
+type Client struct {
+	conn *ssh.Client
+}
+
+// ExitError is returned when a command exits with a non-zero status.
+type ExitError struct {
+	Command string
+	Status  int
+	Stderr  string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("%q exited with status %d: %s", e.Command, e.Status, e.Stderr)
+	}
+	return fmt.Sprintf("%q exited with status %d", e.Command, e.Status)
+}
+
+// AuthError is returned by Dial when the server rejects the credentials.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("ssh authentication failed: %v", e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// IsAuthError reports whether err is, or wraps, an AuthError.
+func IsAuthError(err error) bool {
+	var authErr *AuthError
+	return errors.As(err, &authErr)
+}
+
+// Dial connects and authenticates.
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	var authenticating bool
+	config, err := clientConfig(opts, &authenticating)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the handshake as well as the TCP connect
+	deadline := time.Now().Add(config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, opts.Address, config)
+	if err != nil {
+		conn.Close()
+		// Once credentials were offered, a handshake that fails without
+		// losing the connection was refused by the server
+		var netErr net.Error
+		if authenticating && !errors.Is(err, io.EOF) && !errors.As(err, &netErr) {
+			return nil, &AuthError{Err: err}
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &Client{conn: ssh.NewClient(sshConn, chans, reqs)}, nil
+}
+
+// clientConfig builds the handshake settings. authenticating is set once the
+// handshake offers the credentials.
+func clientConfig(opts Options, authenticating *bool) (*ssh.ClientConfig, error) {
+	if opts.Username == "" {
+		return nil, fmt.Errorf("ssh username is required")
+	}
+
+	var auth []ssh.AuthMethod
+	if opts.Key != "" {
+		signer, err := loadKey(opts.Key, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			*authenticating = true
+			return []ssh.Signer{signer}, nil
+		}))
+	}
+	if opts.Password != "" {
+		auth = append(auth, ssh.PasswordCallback(func() (string, error) {
+			*authenticating = true
+			return opts.Password, nil
+		}))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("ssh key or password is required")
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !opts.InsecureIgnoreHostKey {
+		path := opts.KnownHosts
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("no known_hosts file: %w", err)
+			}
+			path = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts: %w", err)
+		}
+		hostKeyCallback = callback
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &ssh.ClientConfig{
+		User:            opts.Username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}, nil
+}
+
+// loadKey parses a private key given inline or as a file path.
+func loadKey(key, passphrase string) (ssh.Signer, error) {
+	pem := []byte(key)
+	if !strings.Contains(key, "PRIVATE KEY") {
+		var err error
+		if pem, err = os.ReadFile(key); err != nil {
+			return nil, fmt.Errorf("failed to read ssh key: %w", err)
+		}
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh key: %w", err)
+	}
+	return signer, nil
+}
+
+// Run runs a command and returns its standard output. A non-zero exit
+// status is returned as *ExitError. Cancelling ctx closes the session.
+func (c *Client) Run(ctx context.Context, command string) ([]byte, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(command)
+	}()
+
+	select {
+	case <-ctx.Done():
+		session.Close()
+		return nil, ctx.Err()
+	case err := <-done:
+		var exit *ssh.ExitError
+		if errors.As(err, &exit) {
+			return stdout.Bytes(), &ExitError{
+				Command: command,
+				Status:  exit.ExitStatus(),
+				Stderr:  strings.TrimSpace(stderr.String()),
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return stdout.Bytes(), nil
+	}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
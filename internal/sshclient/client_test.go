@@ -0,0 +1,266 @@
+package sshclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an SSH server answering exec requests from a fixed table.
+type testServer struct {
+	addr    string
+	hostKey ssh.Signer
+}
+
+type testCommand struct {
+	stdout string
+	stderr string
+	status uint32
+}
+
+func newTestServer(t *testing.T, password string, authorized ssh.PublicKey, commands map[string]testCommand) *testServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if password != "" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if authorized != nil && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("denied")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config, commands)
+		}
+	}()
+
+	return &testServer{addr: ln.Addr().String(), hostKey: hostKey}
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig, commands map[string]testCommand) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+
+				cmd, ok := commands[payload.Command]
+				if !ok {
+					cmd = testCommand{stderr: "command not found", status: 127}
+				}
+				channel.Write([]byte(cmd.stdout))
+				channel.Stderr().Write([]byte(cmd.stderr))
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{cmd.status}))
+				return
+			}
+		}()
+	}
+}
+
+// knownHosts writes a known_hosts file trusting key for the server address.
+func knownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key) + "\n"
+	if err := os.WriteFile(path, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	srv := newTestServer(t, "secret", nil, map[string]testCommand{
+		"cat /proc/uptime": {stdout: "12345.67 4000.00\n"},
+		"false":            {stderr: "failed\n", status: 1},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, Options{
+		Address:    srv.addr,
+		Username:   "monitor",
+		Password:   "secret",
+		KnownHosts: knownHosts(t, srv.addr, srv.hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	out, err := client.Run(ctx, "cat /proc/uptime")
+	if err != nil || string(out) != "12345.67 4000.00\n" {
+		t.Errorf("Run() = %q, %v", out, err)
+	}
+
+	_, err = client.Run(ctx, "false")
+	var exit *ExitError
+	if !errors.As(err, &exit) || exit.Status != 1 || exit.Stderr != "failed" {
+		t.Errorf("Run(false) error = %v", err)
+	}
+}
+
+func TestDial_PublicKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newTestServer(t, "", sshPub, map[string]testCommand{"true": {}})
+	ctx := context.Background()
+
+	for name, key := range map[string]string{
+		"file":   keyFile,
+		"inline": string(pem.EncodeToMemory(block)),
+	} {
+		client, err := Dial(ctx, Options{
+			Address:               srv.addr,
+			Username:              "monitor",
+			Key:                   key,
+			InsecureIgnoreHostKey: true,
+		})
+		if err != nil {
+			t.Errorf("%s: Dial() error = %v", name, err)
+			continue
+		}
+		if _, err := client.Run(ctx, "true"); err != nil {
+			t.Errorf("%s: Run() error = %v", name, err)
+		}
+		client.Close()
+	}
+}
+
+func TestDial_HostKeyMismatch(t *testing.T) {
+	srv := newTestServer(t, "secret", nil, nil)
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, err := ssh.NewSignerFromKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Dial(context.Background(), Options{
+		Address:    srv.addr,
+		Username:   "monitor",
+		Password:   "secret",
+		KnownHosts: knownHosts(t, srv.addr, otherKey.PublicKey()),
+	})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) || IsAuthError(err) {
+		t.Errorf("Dial() error = %v, want host key mismatch", err)
+	}
+}
+
+func TestDial_AuthError(t *testing.T) {
+	srv := newTestServer(t, "secret", nil, nil)
+
+	_, err := Dial(context.Background(), Options{
+		Address:               srv.addr,
+		Username:              "monitor",
+		Password:              "wrong",
+		InsecureIgnoreHostKey: true,
+	})
+	if !IsAuthError(err) {
+		t.Errorf("Dial() error = %v, want AuthError", err)
+	}
+
+	// A server that is not there is no authentication failure
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if _, err := Dial(context.Background(), Options{Address: addr, Username: "monitor", Password: "secret", InsecureIgnoreHostKey: true}); err == nil || IsAuthError(err) {
+		t.Errorf("Dial() error = %v, want connection error", err)
+	}
+}
+
+func TestDial_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"no username", Options{Address: "127.0.0.1:22", Password: "x", InsecureIgnoreHostKey: true}},
+		{"no credentials", Options{Address: "127.0.0.1:22", Username: "u", InsecureIgnoreHostKey: true}},
+		{"missing key file", Options{Address: "127.0.0.1:22", Username: "u", Key: "/nonexistent/key", InsecureIgnoreHostKey: true}},
+		{"missing known_hosts", Options{Address: "127.0.0.1:22", Username: "u", Password: "x", KnownHosts: "/nonexistent/known_hosts"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Dial(context.Background(), tt.opts); err == nil {
+				t.Error("Dial() expected error")
+			}
+		})
+	}
+}
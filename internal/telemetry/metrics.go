@@ -0,0 +1,236 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+)
+
+// instruments are the router metrics reported from the snapshots
+type instruments struct {
+	up          metric.Int64ObservableGauge
+	cpu         metric.Float64ObservableGauge
+	memoryUsage metric.Int64ObservableGauge
+	memoryLimit metric.Int64ObservableGauge
+	uptime      metric.Int64ObservableGauge
+	temperature metric.Float64ObservableGauge
+
+	ifaceStatus  metric.Int64ObservableGauge
+	ifaceIO      metric.Int64ObservableCounter
+	ifacePackets metric.Int64ObservableCounter
+	ifaceErrors  metric.Int64ObservableCounter
+	ifaceDropped metric.Int64ObservableCounter
+
+	pppSessions    metric.Int64ObservableGauge
+	pppoeSessions  metric.Int64ObservableGauge
+	poolUsage      metric.Int64ObservableGauge
+	poolUtil       metric.Float64ObservableGauge
+	dhcpLeases     metric.Int64ObservableGauge
+	natConnections metric.Int64ObservableGauge
+	natLimit       metric.Int64ObservableGauge
+}
+
+// registerMetrics creates the agent and router metrics
+func (t *Telemetry) registerMetrics() error {
+	m := t.meter
+	var err error
+	if t.collections, err = m.Int64Counter("ispagent.collections",
+		metric.WithDescription("Router collections by result."), metric.WithUnit("{collection}")); err != nil {
+		return err
+	}
+	if t.duration, err = m.Float64Histogram("ispagent.collection.duration",
+		metric.WithDescription("Time taken by router collections, including failed ones."), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60)); err != nil {
+		return err
+	}
+
+	var in instruments
+	gauges := []struct {
+		gauge *metric.Int64ObservableGauge
+		name  string
+		desc  string
+		unit  string
+	}{
+		{&in.up, "ispagent.router.up", "Whether the last collection from the router succeeded.", "1"},
+		{&in.memoryUsage, "ispagent.router.memory.usage", "Memory in use.", "By"},
+		{&in.memoryLimit, "ispagent.router.memory.limit", "Total memory.", "By"},
+		{&in.uptime, "ispagent.router.uptime", "Time since the router booted.", "s"},
+		{&in.ifaceStatus, "ispagent.router.interface.status", "Whether the interface is running.", "1"},
+		{&in.pppSessions, "ispagent.router.ppp.sessions", "Active PPP sessions.", "{session}"},
+		{&in.pppoeSessions, "ispagent.router.pppoe.server.sessions", "Active sessions per PPPoE server.", "{session}"},
+		{&in.poolUsage, "ispagent.router.dhcp.pool.usage", "Addresses of DHCP pools by state.", "{address}"},
+		{&in.dhcpLeases, "ispagent.router.dhcp.leases", "Leases of DHCP servers by state.", "{lease}"},
+		{&in.natConnections, "ispagent.router.nat.connections", "Tracked connections by protocol.", "{connection}"},
+		{&in.natLimit, "ispagent.router.nat.limit", "Connection tracking table size.", "{connection}"},
+	}
+	for _, g := range gauges {
+		if *g.gauge, err = m.Int64ObservableGauge(g.name, metric.WithDescription(g.desc), metric.WithUnit(g.unit)); err != nil {
+			return err
+		}
+	}
+
+	floatGauges := []struct {
+		gauge *metric.Float64ObservableGauge
+		name  string
+		desc  string
+		unit  string
+	}{
+		{&in.cpu, "ispagent.router.cpu.load", "CPU load in percent.", "%"},
+		{&in.temperature, "ispagent.router.temperature", "Board temperature.", "Cel"},
+		{&in.poolUtil, "ispagent.router.dhcp.pool.utilization", "Fraction of DHCP pools in use.", "1"},
+	}
+	for _, g := range floatGauges {
+		if *g.gauge, err = m.Float64ObservableGauge(g.name, metric.WithDescription(g.desc), metric.WithUnit(g.unit)); err != nil {
+			return err
+		}
+	}
+
+	counters := []struct {
+		counter *metric.Int64ObservableCounter
+		name    string
+		desc    string
+		unit    string
+	}{
+		{&in.ifaceIO, "ispagent.router.interface.io", "Bytes through the interface by direction.", "By"},
+		{&in.ifacePackets, "ispagent.router.interface.packets", "Packets through the interface by direction.", "{packet}"},
+		{&in.ifaceErrors, "ispagent.router.interface.errors", "Interface errors by direction.", "{error}"},
+		{&in.ifaceDropped, "ispagent.router.interface.dropped", "Packets dropped by the interface by direction.", "{packet}"},
+	}
+	for _, c := range counters {
+		if *c.counter, err = m.Int64ObservableCounter(c.name, metric.WithDescription(c.desc), metric.WithUnit(c.unit)); err != nil {
+			return err
+		}
+	}
+
+	_, err = m.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for id, snap := range t.routers {
+			observeRouter(o, &in, id, snap)
+		}
+		return nil
+	},
+		in.up, in.cpu, in.memoryUsage, in.memoryLimit, in.uptime, in.temperature,
+		in.ifaceStatus, in.ifaceIO, in.ifacePackets, in.ifaceErrors, in.ifaceDropped,
+		in.pppSessions, in.pppoeSessions, in.poolUsage, in.poolUtil, in.dhcpLeases,
+		in.natConnections, in.natLimit,
+	)
+	return err
+}
+
+// registerCustom creates a gauge for a custom metric name, such as
+// probe_rtt_avg_ms, reported as ispagent.probe_rtt_avg_ms
+func (t *Telemetry) registerCustom(name string) error {
+	gauge, err := t.meter.Float64ObservableGauge("ispagent."+name,
+		metric.WithDescription("Collector-specific value "+name+"."))
+	if err != nil {
+		return err
+	}
+	_, err = t.meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for _, snap := range t.routers {
+			for _, p := range snap.custom[name] {
+				o.ObserveFloat64(gauge, p.value, p.attrs)
+			}
+		}
+		return nil
+	}, gauge)
+	return err
+}
+
+// observeRouter reports the latest data of one router. Interfaces created
+// per subscriber are left out to bound the number of series.
+func observeRouter(o metric.Observer, in *instruments, id string, snap *snapshot) {
+	router := attribute.String("router.id", id)
+	with := func(attrs ...attribute.KeyValue) metric.ObserveOption {
+		return metric.WithAttributes(append([]attribute.KeyValue{router}, attrs...)...)
+	}
+
+	up := int64(0)
+	if snap.up {
+		up = 1
+	}
+	o.ObserveInt64(in.up, up, with())
+	if snap.metrics == nil {
+		return
+	}
+
+	sys := snap.metrics.System
+	o.ObserveFloat64(in.cpu, sys.CPUPercent, with())
+	o.ObserveInt64(in.memoryUsage, sys.MemoryUsedBytes, with())
+	o.ObserveInt64(in.memoryLimit, sys.MemoryTotalBytes, with())
+	o.ObserveInt64(in.uptime, sys.UptimeSeconds, with())
+	if sys.TemperatureCelsius != 0 {
+		o.ObserveFloat64(in.temperature, sys.TemperatureCelsius, with())
+	}
+
+	var ifaces []mikrotik.InterfaceMetrics
+	if snap.data != nil {
+		ifaces = snap.data.Interfaces
+	} else {
+		ifaces = make([]mikrotik.InterfaceMetrics, len(snap.metrics.Interfaces))
+		for i, iface := range snap.metrics.Interfaces {
+			ifaces[i].InterfaceMetrics = iface
+		}
+	}
+	receive := attribute.String("direction", "receive")
+	transmit := attribute.String("direction", "transmit")
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.IsSubscriber() {
+			continue
+		}
+		name := attribute.String("interface", iface.Name)
+		status := int64(0)
+		if iface.IsUp {
+			status = 1
+		}
+		o.ObserveInt64(in.ifaceStatus, status, with(name))
+		o.ObserveInt64(in.ifaceIO, iface.RxBytes, with(name, receive))
+		o.ObserveInt64(in.ifaceIO, iface.TxBytes, with(name, transmit))
+		o.ObserveInt64(in.ifacePackets, iface.RxPackets, with(name, receive))
+		o.ObserveInt64(in.ifacePackets, iface.TxPackets, with(name, transmit))
+		o.ObserveInt64(in.ifaceErrors, iface.RxErrors, with(name, receive))
+		o.ObserveInt64(in.ifaceErrors, iface.TxErrors, with(name, transmit))
+		o.ObserveInt64(in.ifaceDropped, iface.RxDrops, with(name, receive))
+		o.ObserveInt64(in.ifaceDropped, iface.TxDrops, with(name, transmit))
+	}
+
+	data := snap.data
+	if data == nil {
+		return
+	}
+	if data.PPPoE != nil || data.PPPoEServers != nil {
+		o.ObserveInt64(in.pppSessions, int64(len(data.PPPoE)), with())
+	}
+	for _, server := range data.PPPoEServers {
+		o.ObserveInt64(in.pppoeSessions, int64(server.ActiveSessions),
+			with(attribute.String("server", server.ServerName), attribute.String("interface", server.Interface)))
+	}
+	for _, pool := range data.DHCPPools {
+		name := attribute.String("pool", pool.Name)
+		o.ObserveInt64(in.poolUsage, pool.UsedAddresses, with(name, attribute.String("state", "used")))
+		o.ObserveInt64(in.poolUsage, pool.FreeAddresses, with(name, attribute.String("state", "free")))
+		o.ObserveFloat64(in.poolUtil, pool.Utilization/100, with(name))
+	}
+	for _, server := range data.DHCPServers {
+		name := attribute.String("server", server.Name)
+		o.ObserveInt64(in.dhcpLeases, int64(server.ActiveLeases), with(name, attribute.String("state", "bound")))
+		o.ObserveInt64(in.dhcpLeases, int64(server.TotalLeases-server.ActiveLeases), with(name, attribute.String("state", "other")))
+	}
+	if stats := data.NATStats; stats != nil {
+		for _, p := range []struct {
+			protocol string
+			n        int
+		}{{"tcp", stats.TCPConnections}, {"udp", stats.UDPConnections}, {"icmp", stats.ICMPConnections}, {"other", stats.OtherConnections}} {
+			o.ObserveInt64(in.natConnections, int64(p.n), with(attribute.String("protocol", p.protocol)))
+		}
+		if stats.MaxEntries > 0 {
+			o.ObserveInt64(in.natLimit, stats.MaxEntries, with())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	collmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	colltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// Receiver is a minimal OTLP/gRPC receiver that keeps what it is sent. It
+// stands in for a collector in tests and when checking an agent's telemetry
+// without a tracing backend.
+type Receiver struct {
+	server   *grpc.Server
+	listener net.Listener
+
+	mu      sync.Mutex
+	spans   []*tracepb.Span
+	metrics []*metricspb.Metric
+}
+
+// NewReceiver starts a receiver on addr, such as "127.0.0.1:0" for a free
+// port
+func NewReceiver(addr string) (*Receiver, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Receiver{server: grpc.NewServer(), listener: ln}
+	colltracepb.RegisterTraceServiceServer(r.server, &traceService{r: r})
+	collmetricspb.RegisterMetricsServiceServer(r.server, &metricsService{r: r})
+	go r.server.Serve(ln)
+	return r, nil
+}
+
+// Addr returns the address the receiver listens on
+func (r *Receiver) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Spans returns the spans received so far
+func (r *Receiver) Spans() []*tracepb.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*tracepb.Span(nil), r.spans...)
+}
+
+// Metrics returns the metrics received so far, one entry per metric and
+// export
+func (r *Receiver) Metrics() []*metricspb.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*metricspb.Metric(nil), r.metrics...)
+}
+
+// Close stops the receiver
+func (r *Receiver) Close() {
+	r.server.Stop()
+}
+
+type traceService struct {
+	colltracepb.UnimplementedTraceServiceServer
+	r *Receiver
+}
+
+func (s *traceService) Export(ctx context.Context, req *colltracepb.ExportTraceServiceRequest) (*colltracepb.ExportTraceServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			s.r.spans = append(s.r.spans, ss.Spans...)
+		}
+	}
+	return &colltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsService struct {
+	collmetricspb.UnimplementedMetricsServiceServer
+	r *Receiver
+}
+
+func (s *metricsService) Export(ctx context.Context, req *collmetricspb.ExportMetricsServiceRequest) (*collmetricspb.ExportMetricsServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			s.r.metrics = append(s.r.metrics, sm.Metrics...)
+		}
+	}
+	return &collmetricspb.ExportMetricsServiceResponse{}, nil
+}
@@ -0,0 +1,260 @@
+// Package telemetry exports collected router metrics and traces of the
+// agent's work over OTLP. Collections, RouterOS commands and calls to the
+// server are traced by their own packages through the global tracer
+// provider, which Setup installs.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/version"
+)
+
+// Options configures OTLP export
+type Options struct {
+	// Endpoint is the host:port of an OTLP/gRPC receiver
+	Endpoint string
+	// Insecure disables TLS to the receiver
+	Insecure bool
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string
+	// Metrics and Traces select the signals exported
+	Metrics bool
+	Traces  bool
+	// ExportInterval is the time between metric exports
+	ExportInterval time.Duration
+	// SampleRatio is the fraction of collections traced; nil traces all of
+	// them and 0 none
+	SampleRatio *float64
+	// AgentID identifies the agent as the service instance
+	AgentID string
+}
+
+// Telemetry holds the providers installed by Setup and the latest data of
+// each router, which is reported on every metric export
+type Telemetry struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+	meter          metric.Meter
+
+	collections metric.Int64Counter
+	duration    metric.Float64Histogram
+
+	mu      sync.Mutex
+	routers map[string]*snapshot
+
+	// customMu guards custom, which tells whether a gauge was created for
+	// each custom metric name. It is never held with mu, as the SDK calls
+	// the callbacks that take mu while holding its own locks.
+	customMu sync.Mutex
+	custom   map[string]bool
+}
+
+// snapshot is the latest state of one router
+type snapshot struct {
+	up      bool
+	metrics *models.MetricsData
+	data    *mikrotik.CollectedData // Set for MikroTik routers
+	custom  map[string][]point      // Parsed custom metrics by name
+}
+
+// point is one value of a custom metric
+type point struct {
+	attrs metric.MeasurementOption
+	value float64
+}
+
+// Setup creates the OTLP exporters and installs the global tracer provider
+// and trace context propagation. Shutdown must be called to flush them.
+func Setup(ctx context.Context, opts Options) (*Telemetry, error) {
+	if opts.ExportInterval <= 0 {
+		opts.ExportInterval = time.Minute
+	}
+	sampleRatio := 1.0
+	if opts.SampleRatio != nil {
+		sampleRatio = *opts.SampleRatio
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "ispagent"),
+		attribute.String("service.version", version.GetVersion()),
+		attribute.String("service.instance.id", opts.AgentID),
+	)
+
+	t := &Telemetry{
+		routers: make(map[string]*snapshot),
+		custom:  make(map[string]bool),
+	}
+
+	if opts.Traces {
+		traceOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(opts.Endpoint), otlptracegrpc.WithHeaders(opts.Headers)}
+		if opts.Insecure {
+			traceOpts = append(traceOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err := otlptracegrpc.New(ctx, traceOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		}
+		t.tracerProvider = sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		)
+		otel.SetTracerProvider(t.tracerProvider)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	}
+
+	if opts.Metrics {
+		metricOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(opts.Endpoint), otlpmetricgrpc.WithHeaders(opts.Headers)}
+		if opts.Insecure {
+			metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
+		}
+		exporter, err := otlpmetricgrpc.New(ctx, metricOpts...)
+		if err != nil {
+			t.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+		t.meterProvider = sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(opts.ExportInterval))),
+			sdkmetric.WithResource(res),
+		)
+		t.meter = t.meterProvider.Meter("github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/telemetry")
+		if err := t.registerMetrics(); err != nil {
+			t.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create metrics: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// Observe records the outcome of a collection; it is meant to be called
+// from the scheduler's OnResult
+func (t *Telemetry) Observe(result scheduler.Result) {
+	if t.meter == nil {
+		return
+	}
+
+	ctx := context.Background()
+	outcome := "success"
+	if result.Err != nil {
+		outcome = "error"
+	}
+	t.collections.Add(ctx, 1, metric.WithAttributes(attribute.String("result", outcome)))
+	t.duration.Record(ctx, result.Duration.Seconds(), metric.WithAttributes(attribute.String("router.id", result.Router.ID)))
+
+	var custom map[string][]point
+	if result.Err == nil {
+		custom = t.parseCustom(result.Router.ID, result.Metrics.CustomMetrics)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	snap := t.snapshot(result.Router.ID)
+	snap.up = result.Err == nil
+	if result.Err != nil {
+		return
+	}
+	snap.metrics = result.Metrics
+	snap.custom = custom
+	// Data handed to Update belongs to this collection only if it carries
+	// the same base model; otherwise it is left from an earlier one
+	if snap.data != nil && snap.data.MetricsData != result.Metrics {
+		snap.data = nil
+	}
+}
+
+// Update stores the full data of a MikroTik collection; it is meant to be
+// registered with the MikroTik collector's SetDataHandler
+func (t *Telemetry) Update(data *mikrotik.CollectedData) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.snapshot(data.RouterID).data = data
+}
+
+// ForceFlush exports pending spans and the current metrics
+func (t *Telemetry) ForceFlush(ctx context.Context) error {
+	var errs []error
+	if t.tracerProvider != nil {
+		errs = append(errs, t.tracerProvider.ForceFlush(ctx))
+	}
+	if t.meterProvider != nil {
+		errs = append(errs, t.meterProvider.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown flushes and stops the exporters
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	if t.tracerProvider != nil {
+		errs = append(errs, t.tracerProvider.Shutdown(ctx))
+	}
+	if t.meterProvider != nil {
+		errs = append(errs, t.meterProvider.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// snapshot returns the snapshot of a router, creating it if needed. Callers
+// must hold t.mu.
+func (t *Telemetry) snapshot(routerID string) *snapshot {
+	snap, ok := t.routers[routerID]
+	if !ok {
+		snap = &snapshot{}
+		t.routers[routerID] = snap
+	}
+	return snap
+}
+
+// parseCustom groups custom metrics by name and creates a gauge for names
+// not seen before
+func (t *Telemetry) parseCustom(routerID string, metrics map[string]float64) map[string][]point {
+	custom := make(map[string][]point)
+	for key, value := range metrics {
+		name, labels, ok := collector.ParseMetricKey(key)
+		if !ok {
+			continue
+		}
+		attrs := []attribute.KeyValue{attribute.String("router.id", routerID)}
+		for _, l := range labels {
+			attrs = append(attrs, attribute.String(l[0], l[1]))
+		}
+		custom[name] = append(custom[name], point{attrs: metric.WithAttributes(attrs...), value: value})
+	}
+
+	t.customMu.Lock()
+	defer t.customMu.Unlock()
+	for name := range custom {
+		registered, seen := t.custom[name]
+		if !seen {
+			err := t.registerCustom(name)
+			if err != nil {
+				otel.Handle(err)
+			}
+			registered = err == nil
+			t.custom[name] = registered
+		}
+		if !registered {
+			delete(custom, name)
+		}
+	}
+	return custom
+}
@@ -0,0 +1,171 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik/apisim"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/scheduler"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// points returns the number data points of a metric by their attributes,
+// formatted as "k=v,k=v"
+func points(m *metricspb.Metric) map[string]float64 {
+	var dps []*metricspb.NumberDataPoint
+	switch data := m.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		dps = data.Gauge.DataPoints
+	case *metricspb.Metric_Sum:
+		dps = data.Sum.DataPoints
+	}
+
+	result := make(map[string]float64)
+	for _, dp := range dps {
+		key := ""
+		for i, kv := range dp.Attributes {
+			if i > 0 {
+				key += ","
+			}
+			key += kv.Key + "=" + kv.Value.GetStringValue()
+		}
+		switch v := dp.Value.(type) {
+		case *metricspb.NumberDataPoint_AsInt:
+			result[key] = float64(v.AsInt)
+		case *metricspb.NumberDataPoint_AsDouble:
+			result[key] = v.AsDouble
+		}
+	}
+	return result
+}
+
+func TestTelemetry_Receiver(t *testing.T) {
+	receiver, err := NewReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+
+	tel, err := Setup(context.Background(), Options{
+		Endpoint:       receiver.Addr(),
+		Insecure:       true,
+		Metrics:        true,
+		Traces:         true,
+		ExportInterval: time.Hour,
+		AgentID:        "agent-test",
+	})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	// Collect once from a simulated router through the scheduler
+	sim := apisim.NewRouter("bng-1", "monitor", "secret")
+	sim.Populate(apisim.Profile{Interfaces: 2, Sessions: 3, Leases: 4, Connections: 5})
+	srv, err := apisim.Listen("127.0.0.1:0", sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	cfg := mikrotik.DefaultConfig()
+	cfg.Collect.NAT = true
+	coll := mikrotik.NewCollectorWithConfig(cfg)
+	coll.SetDataHandler(tel.Update)
+	registry := collector.NewRegistry()
+	if err := registry.Register(coll); err != nil {
+		t.Fatal(err)
+	}
+
+	router := models.RouterConfig{
+		ID:          "bng-1",
+		Type:        "mikrotik",
+		Address:     "127.0.0.1",
+		Credentials: models.RouterCredentials{Username: "monitor", Password: "secret"},
+		Metadata:    map[string]interface{}{"api_port": srv.Port()},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var result scheduler.Result
+	sched := scheduler.New(registry, []models.RouterConfig{router}, scheduler.Options{
+		Interval: time.Hour,
+		OnResult: func(r scheduler.Result) {
+			result = r
+			tel.Observe(r)
+			cancel()
+		},
+	})
+	sched.Run(ctx)
+	if result.Err != nil {
+		t.Fatalf("collection error = %v", result.Err)
+	}
+
+	tel.Observe(scheduler.Result{
+		Router:  &models.RouterConfig{ID: "probe-1"},
+		Metrics: &models.MetricsData{CustomMetrics: map[string]float64{`probe_success{check="icmp"}`: 1}},
+	})
+
+	if err := tel.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	// Commands are traced as children of the collection
+	spans := make(map[string][]byte)
+	parents := make(map[string][]byte)
+	for _, span := range receiver.Spans() {
+		spans[span.Name] = span.SpanId
+		parents[span.Name] = span.ParentSpanId
+	}
+	for _, name := range []string{"routeros.connect", "/system/resource/print", "/ppp/active/print", "/ip/firewall/connection/print"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("missing span %s", name)
+		} else if string(parents[name]) != string(spans["collect"]) {
+			t.Errorf("span %s is not a child of the collection", name)
+		}
+	}
+	if _, ok := spans["collect"]; !ok {
+		t.Error("missing collect span")
+	}
+
+	metrics := make(map[string]map[string]float64)
+	for _, m := range receiver.Metrics() {
+		metrics[m.Name] = points(m)
+	}
+	tests := []struct {
+		metric string
+		attrs  string
+		want   float64
+	}{
+		{"ispagent.router.up", "router.id=bng-1", 1},
+		{"ispagent.router.cpu.load", "router.id=bng-1", 12},
+		{"ispagent.router.memory.limit", "router.id=bng-1", 1073741824},
+		{"ispagent.router.interface.status", "interface=ether1,router.id=bng-1", 1},
+		{"ispagent.router.ppp.sessions", "router.id=bng-1", 3},
+		{"ispagent.router.pppoe.server.sessions", "interface=ether2,router.id=bng-1,server=pppoe", 3},
+		{"ispagent.router.dhcp.pool.usage", "pool=dhcp_pool1,router.id=bng-1,state=used", 4},
+		{"ispagent.router.dhcp.leases", "router.id=bng-1,server=dhcp1,state=bound", 4},
+		{"ispagent.router.nat.connections", "protocol=udp,router.id=bng-1", 2},
+		{"ispagent.probe_success", "check=icmp,router.id=probe-1", 1},
+		{"ispagent.collections", "result=success", 2},
+	}
+	for _, tt := range tests {
+		if got, ok := metrics[tt.metric][tt.attrs]; !ok || got != tt.want {
+			t.Errorf("%s{%s} = %v, want %v (points %v)", tt.metric, tt.attrs, got, tt.want, metrics[tt.metric])
+		}
+	}
+	for attrs := range metrics["ispagent.router.interface.status"] {
+		if attrs != "interface=ether1,router.id=bng-1" && attrs != "interface=ether2,router.id=bng-1" {
+			t.Errorf("unexpected interface series %s", attrs)
+		}
+	}
+	if _, ok := metrics["ispagent.collection.duration"]; !ok {
+		t.Error("missing collection duration")
+	}
+}
@@ -2,43 +2,64 @@ package grpc
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"sync"
 
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
 	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/config"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// Client represents a gRPC client connection to the monitoring server
+// Client represents a gRPC client connection to the monitoring server.
+// Metrics and session reports are queued on disk and sent at least once,
+// so reports collected while the server is unreachable are sent once it is
+// back.
 type Client struct {
-	config     *config.ServerConfig
-	conn       *grpc.ClientConn
+	*transport.Outbox
+	config      *config.ServerConfig
+	agentID     string
+	conn        *grpc.ClientConn
 	agentClient agentpb.AgentServiceClient
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
-// NewClient creates a new gRPC client
-func NewClient(cfg *config.ServerConfig) (*Client, error) {
+var _ transport.Transport = (*Client)(nil)
+
+// NewClient creates a new gRPC client sending reports through q, which it
+// does not close
+func NewClient(cfg *config.ServerConfig, q *queue.Queue, opts transport.OutboxOptions) (*Client, error) {
 	if cfg.Address == "" {
 		return nil, fmt.Errorf("server address is required")
 	}
 
 	return &Client{
-		config: cfg,
+		Outbox:  transport.NewOutbox(q, opts),
+		config:  cfg,
+		agentID: opts.AgentID,
 	}, nil
 }
 
-// Connect establishes a connection to the server
+// Connect establishes a connection to the server and starts sending
+// queued reports
 func (c *Client) Connect(ctx context.Context) error {
 	var opts []grpc.DialOption
 
 	// Configure TLS if enabled
 	if c.config.TLS.Enabled {
-		tlsConfig, err := c.loadTLSConfig()
+		tlsConfig, err := c.config.TLS.Load()
 		if err != nil {
 			return fmt.Errorf("failed to load TLS config: %w", err)
 		}
@@ -47,17 +68,29 @@ func (c *Client) Connect(ctx context.Context) error {
 		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	}
 
-	// Add interceptors for authentication and logging
-	opts = append(opts, grpc.WithUnaryInterceptor(authUnaryInterceptor()))
-	opts = append(opts, grpc.WithStreamInterceptor(authStreamInterceptor()))
+	// Add interceptors for authentication and logging, then tracing, which
+	// must see the metadata set by authentication
+	opts = append(opts, grpc.WithChainUnaryInterceptor(authUnaryInterceptor(), tracingUnaryInterceptor()))
+	opts = append(opts, grpc.WithChainStreamInterceptor(authStreamInterceptor(), tracingStreamInterceptor()))
 
 	conn, err := grpc.DialContext(ctx, c.config.Address, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to connect to server: %w", err)
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.conn = conn
 	c.agentClient = agentpb.NewAgentServiceClient(conn)
+	if c.cancel == nil {
+		runCtx, cancel := context.WithCancel(context.Background())
+		c.cancel = cancel
+		c.done = make(chan struct{})
+		go func() {
+			defer close(c.done)
+			c.Run(runCtx, c.send)
+		}()
+	}
 
 	return nil
 }
@@ -67,42 +100,124 @@ func (c *Client) GetAgentClient() agentpb.AgentServiceClient {
 	return c.agentClient
 }
 
-// Close closes the connection
+// SendHeartbeat sends a heartbeat right away; heartbeats are not queued, as
+// a late one would be misleading
+func (c *Client) SendHeartbeat(ctx context.Context) error {
+	if c.agentClient == nil {
+		return fmt.Errorf("not connected to server")
+	}
+	_, err := c.agentClient.Heartbeat(ctx, &agentpb.HeartbeatRequest{
+		AgentId:   c.agentID,
+		Timestamp: timestamppb.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Close stops sending and closes the connection. Reports not sent yet stay
+// queued.
 func (c *Client) Close() error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel = nil
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
 	if c.conn != nil {
 		return c.conn.Close()
 	}
 	return nil
 }
 
-// loadTLSConfig loads TLS configuration from files
-func (c *Client) loadTLSConfig() (*tls.Config, error) {
-	tlsConfig := &tls.Config{
-		MinVersion: tls.VersionTLS12,
+// send hands queued reports to the server: metrics over one metrics
+// stream, sessions one report at a time. Reports the server rejects as
+// invalid fail permanently; anything else is retried.
+func (c *Client) send(ctx context.Context, msgs []transport.Message) error {
+	var metrics []*agentpb.MetricsReport
+	var sessions []*agentpb.SessionReport
+	for _, m := range msgs {
+		switch m.Kind {
+		case transport.KindMetrics:
+			report := new(agentpb.MetricsReport)
+			if err := proto.Unmarshal(m.Payload, report); err != nil {
+				return queue.Permanent(fmt.Errorf("invalid queued metrics report: %w", err))
+			}
+			metrics = append(metrics, report)
+		case transport.KindSessions:
+			report := new(agentpb.SessionReport)
+			if err := proto.Unmarshal(m.Payload, report); err != nil {
+				return queue.Permanent(fmt.Errorf("invalid queued session report: %w", err))
+			}
+			sessions = append(sessions, report)
+		default:
+			return queue.Permanent(fmt.Errorf("unknown message kind %q", m.Kind))
+		}
 	}
 
-	// Load CA certificate if provided
-	if c.config.TLS.CACert != "" {
-		caCert, err := os.ReadFile(c.config.TLS.CACert)
+	if len(metrics) > 0 {
+		if err := c.streamMetrics(ctx, metrics); err != nil {
+			return sendError("metrics", err)
+		}
+	}
+	for _, report := range sessions {
+		resp, err := c.agentClient.ReportSessions(ctx, report)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+			return sendError("sessions", err)
 		}
-
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(caCert) {
-			return nil, fmt.Errorf("failed to append CA certificate")
+		if !resp.Success {
+			return fmt.Errorf("server did not accept sessions of %s", report.RouterId)
 		}
-		tlsConfig.RootCAs = caCertPool
 	}
+	return nil
+}
 
-	// Load client certificate if provided
-	if c.config.TLS.ClientCert != "" && c.config.TLS.ClientKey != "" {
-		cert, err := tls.LoadX509KeyPair(c.config.TLS.ClientCert, c.config.TLS.ClientKey)
+// streamMetrics sends reports over one metrics stream and waits until the
+// server has acknowledged them
+func (c *Client) streamMetrics(ctx context.Context, reports []*agentpb.MetricsReport) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.agentClient.StreamMetrics(ctx)
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		if err := stream.Send(report); err != nil {
+			// The reason is returned by Recv
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		ack, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			return err
+		}
+		if !ack.Received {
+			return fmt.Errorf("server did not accept metrics batch %s", ack.BatchId)
 		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
+}
 
-	return tlsConfig, nil
+// sendError describes a failed send, marking it permanent if retrying
+// cannot succeed
+func sendError(kind string, err error) error {
+	err = fmt.Errorf("failed to send %s to server: %w", kind, err)
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) && s.GRPCStatus().Code() == codes.InvalidArgument {
+		return queue.Permanent(err)
+	}
+	return err
 }
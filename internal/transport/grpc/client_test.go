@@ -0,0 +1,159 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/config"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// server records what the agent sends
+type server struct {
+	agentpb.UnimplementedAgentServiceServer
+
+	mu         sync.Mutex
+	metrics    []*agentpb.MetricsReport
+	sessions   []*agentpb.SessionReport
+	heartbeats int
+}
+
+func (s *server) StreamMetrics(stream agentpb.AgentService_StreamMetricsServer) error {
+	for {
+		report, err := stream.Recv()
+		if err == io.EOF {
+			return stream.Send(&agentpb.MetricsAck{Received: true, BatchId: "1"})
+		}
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.metrics = append(s.metrics, report)
+		s.mu.Unlock()
+	}
+}
+
+func (s *server) ReportSessions(ctx context.Context, report *agentpb.SessionReport) (*agentpb.SessionReportResponse, error) {
+	if report.RouterId == "" {
+		return nil, status.Error(codes.InvalidArgument, "router_id is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = append(s.sessions, report)
+	return &agentpb.SessionReportResponse{Success: true}, nil
+}
+
+func (s *server) Heartbeat(ctx context.Context, req *agentpb.HeartbeatRequest) (*agentpb.HeartbeatResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heartbeats++
+	return &agentpb.HeartbeatResponse{Acknowledged: true}, nil
+}
+
+func TestClient_Send(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &server{}
+	grpcServer := grpc.NewServer()
+	agentpb.RegisterAgentServiceServer(grpcServer, srv)
+	go grpcServer.Serve(ln)
+	defer grpcServer.Stop()
+
+	q, err := queue.Open(queue.Options{Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	var mu sync.Mutex
+	var errs []error
+	client, err := NewClient(&config.ServerConfig{Address: ln.Addr().String()}, q, transport.OutboxOptions{
+		AgentID:       "agent-1",
+		FlushInterval: 10 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	waitQueued := func() {
+		t.Helper()
+		for q.Stats().Records > 0 {
+			if ctx.Err() != nil {
+				t.Fatalf("%d reports not sent", q.Stats().Records)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if err := client.SendMetrics(ctx, transport.NewMetricsReport("", &models.MetricsData{RouterID: "r1", System: models.SystemMetrics{CPUPercent: 42}}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	// An event-only report, as a configuration change between polls
+	change := models.Event{
+		Type:       "config_change",
+		Severity:   models.SeverityWarning,
+		Message:    "Configuration changed by admin (+1 -0 lines)",
+		Timestamp:  time.Now(),
+		Attributes: map[string]string{"diff": "+/ip address add address=10.0.0.1/24", "users": "admin"},
+	}
+	if err := client.SendMetrics(ctx, transport.NewMetricsReport("", &models.MetricsData{RouterID: "r2", Events: []models.Event{change}}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendSessions(ctx, &agentpb.SessionReport{RouterId: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendHeartbeat(ctx); err != nil {
+		t.Fatalf("SendHeartbeat() error = %v", err)
+	}
+	waitQueued()
+
+	srv.mu.Lock()
+	if len(srv.metrics) != 2 || srv.metrics[0].AgentId != "agent-1" || srv.metrics[1].RouterId != "r2" {
+		t.Errorf("server got metrics %v", srv.metrics)
+	} else if events := srv.metrics[1].Events; len(events) != 1 || events[0].Type != "config_change" || events[0].Attributes["diff"] != change.Attributes["diff"] || events[0].Attributes["users"] != "admin" {
+		t.Errorf("server got events %v, want the config_change", events)
+	}
+	if len(srv.sessions) != 1 || srv.sessions[0].AgentId != "agent-1" {
+		t.Errorf("server got sessions %v", srv.sessions)
+	}
+	if srv.heartbeats != 1 {
+		t.Errorf("server got %d heartbeats, want 1", srv.heartbeats)
+	}
+	srv.mu.Unlock()
+
+	// A report the server rejects as invalid is dropped rather than retried
+	if err := client.SendSessions(ctx, &agentpb.SessionReport{}); err != nil {
+		t.Fatal(err)
+	}
+	waitQueued()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "dropped 1") {
+		t.Errorf("errors = %v, want the invalid report dropped", errs)
+	}
+}
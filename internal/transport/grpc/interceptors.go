@@ -5,10 +5,18 @@ import (
 	"log"
 	"os"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
+// tracerName names the tracer of calls to the server, whose spans go to the
+// global tracer provider; it does nothing unless tracing is set up
+const tracerName = "github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport/grpc"
+
 // authUnaryInterceptor adds authentication to unary RPC calls
 func authUnaryInterceptor() grpc.UnaryClientInterceptor {
 	return func(
@@ -49,6 +57,84 @@ func authStreamInterceptor() grpc.StreamClientInterceptor {
 	}
 }
 
+// tracingUnaryInterceptor wraps unary RPC calls in spans and passes the
+// trace context to the server
+func tracingUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		ctx, span := startSpan(ctx, method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// tracingStreamInterceptor wraps opening a stream in a span and passes the
+// trace context to the server
+func tracingStreamInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		ctx, span := startSpan(ctx, method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		endSpan(span, err)
+		return stream, err
+	}
+}
+
+// startSpan starts a client span for method and adds the trace context to
+// the outgoing metadata
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc"), attribute.String("rpc.method", method)))
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// metadataCarrier adapts gRPC metadata for trace context propagation
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 // addAuthMetadata adds authentication metadata to the context
 func addAuthMetadata(ctx context.Context) context.Context {
 	// Get API key from environment or config
@@ -0,0 +1,252 @@
+// Package kafka publishes reports to Kafka topics, for deployments where
+// agents feed an event bus rather than one server. Metrics and session
+// reports are queued on disk and published at least once, keyed by router
+// ID so the reports of a router land on one partition in order.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+)
+
+// Header names set on every message
+const (
+	HeaderAgentID     = "agent_id"
+	HeaderMessageID   = "message_id"
+	HeaderMessageType = "message_type"
+	HeaderContentType = "content-type"
+
+	contentType = "application/x-protobuf"
+)
+
+// messageTypes are the protobuf message names of each kind, for consumers
+// subscribed to several topics
+var messageTypes = map[string]string{
+	transport.KindMetrics:   "ispmonitor.agent.v1.MetricsReport",
+	transport.KindSessions:  "ispmonitor.agent.v1.SessionReport",
+	transport.KindHeartbeat: "ispmonitor.agent.v1.HeartbeatRequest",
+}
+
+// Topics names the topic of each kind of message
+type Topics struct {
+	Metrics    string
+	Sessions   string
+	Heartbeats string
+}
+
+// Options configures the Kafka transport
+type Options struct {
+	// Brokers are the bootstrap brokers, as host:port
+	Brokers  []string
+	Topics   Topics
+	ClientID string
+	// Username and Password authenticate with SASL/PLAIN if set
+	Username string
+	Password string
+	TLS      *tls.Config
+	// Timeout bounds connecting to and writing to a broker
+	Timeout time.Duration
+	// BatchSize is the most messages published at once
+	BatchSize int
+	// FlushInterval is the longest a report waits for a batch to fill
+	FlushInterval time.Duration
+	AgentID       string
+	// OnError is called when reports cannot be queued or published
+	OnError func(err error)
+}
+
+// Transport publishes reports to Kafka
+type Transport struct {
+	*transport.Outbox
+	opts    Options
+	dialer  *kafka.Dialer
+	writers map[string]*kafka.Writer // By kind
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ transport.Transport = (*Transport)(nil)
+
+// New creates a transport publishing through q, which it does not close
+func New(q *queue.Queue, opts Options) (*Transport, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, fmt.Errorf("at least one Kafka broker is required")
+	}
+	if opts.Topics.Metrics == "" || opts.Topics.Sessions == "" || opts.Topics.Heartbeats == "" {
+		return nil, fmt.Errorf("Kafka topics for metrics, sessions and heartbeats are required")
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = "ispagent-" + opts.AgentID
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	dialer := &kafka.Dialer{
+		ClientID:  opts.ClientID,
+		Timeout:   opts.Timeout,
+		DualStack: true,
+		TLS:       opts.TLS,
+	}
+	writerTransport := &kafka.Transport{
+		ClientID:    opts.ClientID,
+		DialTimeout: opts.Timeout,
+		TLS:         opts.TLS,
+	}
+	if opts.Username != "" {
+		mechanism := plain.Mechanism{Username: opts.Username, Password: opts.Password}
+		dialer.SASLMechanism = mechanism
+		writerTransport.SASL = mechanism
+	}
+
+	t := &Transport{
+		Outbox: transport.NewOutbox(q, transport.OutboxOptions{
+			AgentID:       opts.AgentID,
+			BatchSize:     opts.BatchSize,
+			FlushInterval: opts.FlushInterval,
+			OnError:       opts.OnError,
+		}),
+		opts:    opts,
+		dialer:  dialer,
+		writers: make(map[string]*kafka.Writer),
+	}
+	for kind, topic := range map[string]string{
+		transport.KindMetrics:   opts.Topics.Metrics,
+		transport.KindSessions:  opts.Topics.Sessions,
+		transport.KindHeartbeat: opts.Topics.Heartbeats,
+	} {
+		t.writers[kind] = &kafka.Writer{
+			Addr:      kafka.TCP(opts.Brokers...),
+			Topic:     topic,
+			Transport: writerTransport,
+			// Murmur2 places keys on the same partitions as the Java
+			// client does
+			Balancer:     &kafka.Murmur2Balancer{},
+			MaxAttempts:  3,
+			BatchSize:    opts.BatchSize,
+			BatchTimeout: 10 * time.Millisecond,
+			WriteTimeout: opts.Timeout,
+			RequiredAcks: kafka.RequireAll,
+		}
+	}
+	return t, nil
+}
+
+// Connect starts publishing queued reports and checks that a broker can
+// be reached. Publishing goes on if it cannot, so an error leaves the
+// transport usable.
+func (t *Transport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	if t.cancel == nil {
+		runCtx, cancel := context.WithCancel(context.Background())
+		t.cancel = cancel
+		t.done = make(chan struct{})
+		go func() {
+			defer close(t.done)
+			t.Run(runCtx, t.publish)
+		}()
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, broker := range t.opts.Brokers {
+		conn, err := t.dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no Kafka broker reachable: %w", errors.Join(errs...))
+}
+
+// SendHeartbeat publishes a heartbeat right away; heartbeats are not
+// queued, as a late one would be misleading
+func (t *Transport) SendHeartbeat(ctx context.Context) error {
+	msg, err := transport.NewHeartbeatMessage(t.opts.AgentID)
+	if err != nil {
+		return err
+	}
+	return t.publish(ctx, []transport.Message{msg})
+}
+
+// Close stops publishing and closes the connections to the brokers.
+// Reports not published yet stay queued.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	if t.cancel != nil {
+		t.cancel()
+		<-t.done
+		t.cancel = nil
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for _, w := range t.writers {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publish writes msgs to their topics. Messages a broker rejects as too
+// large or malformed fail permanently; anything else is retried.
+func (t *Transport) publish(ctx context.Context, msgs []transport.Message) error {
+	byKind := make(map[string][]kafka.Message)
+	for _, m := range msgs {
+		byKind[m.Kind] = append(byKind[m.Kind], kafka.Message{
+			Key:   []byte(m.Key),
+			Value: m.Payload,
+			Time:  m.Time,
+			Headers: []kafka.Header{
+				{Key: HeaderAgentID, Value: []byte(t.opts.AgentID)},
+				{Key: HeaderMessageID, Value: []byte(m.ID)},
+				{Key: HeaderMessageType, Value: []byte(messageTypes[m.Kind])},
+				{Key: HeaderContentType, Value: []byte(contentType)},
+			},
+		})
+	}
+
+	for kind, batch := range byKind {
+		w, ok := t.writers[kind]
+		if !ok {
+			return queue.Permanent(fmt.Errorf("unknown message kind %q", kind))
+		}
+		if err := w.WriteMessages(ctx, batch...); err != nil {
+			return writeError(kind, err)
+		}
+	}
+	return nil
+}
+
+// writeError describes a failed write, marking it permanent if retrying
+// cannot succeed
+func writeError(kind string, err error) error {
+	err = fmt.Errorf("failed to publish %s to Kafka: %w", kind, err)
+
+	var tooLarge kafka.MessageTooLargeError
+	var kerr kafka.Error
+	switch {
+	case errors.As(err, &tooLarge):
+		return queue.Permanent(err)
+	case errors.As(err, &kerr) && (kerr == kafka.MessageSizeTooLarge || kerr == kafka.InvalidMessage):
+		return queue.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	kafka "github.com/segmentio/kafka-go"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+)
+
+func TestNew(t *testing.T) {
+	topics := Topics{Metrics: "m", Sessions: "s", Heartbeats: "h"}
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"valid", Options{Brokers: []string{"localhost:9092"}, Topics: topics}, false},
+		{"no brokers", Options{Topics: topics}, true},
+		{"missing topic", Options{Brokers: []string{"localhost:9092"}, Topics: Topics{Metrics: "m"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := New(nil, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tr != nil {
+				tr.Close()
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{"message too large", kafka.MessageTooLargeError{}, true},
+		{"rejected as too large", fmt.Errorf("write: %w", kafka.MessageSizeTooLarge), true},
+		{"invalid message", kafka.InvalidMessage, true},
+		{"leader moved", kafka.NotLeaderForPartition, false},
+		{"unreachable", errors.New("dial tcp: connection refused"), false},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := writeError("metrics", tt.err)
+			if !strings.Contains(err.Error(), tt.err.Error()) {
+				t.Errorf("writeError() = %v, does not describe %v", err, tt.err)
+			}
+			if got := queue.IsPermanent(err); got != tt.permanent {
+				t.Errorf("IsPermanent(writeError()) = %t, want %t", got, tt.permanent)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Package nats publishes reports to NATS JetStream, for deployments where
+// agents feed an event bus rather than one server. Metrics and session
+// reports are queued on disk and published at least once to subjects
+// ending in the router ID:
+//
+//	<prefix>.metrics.<router>    MetricsReport
+//	<prefix>.sessions.<router>   SessionReport
+//	<prefix>.heartbeat.<agent>   HeartbeatRequest
+//
+// Every message carries a Nats-Msg-Id header, so a stream drops the
+// duplicates of messages published again after a failure.
+package nats
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+)
+
+// Header names set on every message besides Nats-Msg-Id
+const (
+	HeaderAgentID     = "Agent-Id"
+	HeaderRouterID    = "Router-Id"
+	HeaderContentType = "Content-Type"
+
+	contentType = "application/x-protobuf"
+)
+
+// Options configures the NATS transport
+type Options struct {
+	// URL lists the servers, comma separated, e.g. nats://nats:4222
+	URL string
+	// SubjectPrefix is the first subject token; ispagent if empty
+	SubjectPrefix string
+	// Username and Password, Token, or CredentialsFile authenticate the
+	// connection
+	Username        string
+	Password        string
+	Token           string
+	CredentialsFile string
+	TLS             *tls.Config
+	// Timeout bounds connecting and waiting for acknowledgements
+	Timeout time.Duration
+	// BatchSize is the most messages published at once
+	BatchSize int
+	// FlushInterval is the longest a report waits for a batch to fill
+	FlushInterval time.Duration
+	AgentID       string
+	// OnError is called when reports cannot be queued or published
+	OnError func(err error)
+}
+
+// Transport publishes reports to NATS JetStream
+type Transport struct {
+	*transport.Outbox
+	opts Options
+
+	mu     sync.Mutex
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ transport.Transport = (*Transport)(nil)
+
+// New creates a transport publishing through q, which it does not close
+func New(q *queue.Queue, opts Options) (*Transport, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("NATS URL is required")
+	}
+	if opts.SubjectPrefix == "" {
+		opts.SubjectPrefix = "ispagent"
+	}
+	opts.SubjectPrefix = strings.TrimSuffix(opts.SubjectPrefix, ".")
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Transport{
+		Outbox: transport.NewOutbox(q, transport.OutboxOptions{
+			AgentID:       opts.AgentID,
+			BatchSize:     opts.BatchSize,
+			FlushInterval: opts.FlushInterval,
+			OnError:       opts.OnError,
+		}),
+		opts: opts,
+	}, nil
+}
+
+// Connect connects to NATS and starts publishing queued reports. The
+// client keeps reconnecting in the background if the servers cannot be
+// reached, so an error leaves the transport usable.
+func (t *Transport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		return nil
+	}
+
+	natsOpts := []nats.Option{
+		nats.Name("ispagent-" + t.opts.AgentID),
+		nats.Timeout(t.opts.Timeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(5 * time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				t.onError(fmt.Errorf("connection to NATS lost: %w", err))
+			}
+		}),
+	}
+	switch {
+	case t.opts.CredentialsFile != "":
+		natsOpts = append(natsOpts, nats.UserCredentials(t.opts.CredentialsFile))
+	case t.opts.Token != "":
+		natsOpts = append(natsOpts, nats.Token(t.opts.Token))
+	case t.opts.Username != "":
+		natsOpts = append(natsOpts, nats.UserInfo(t.opts.Username, t.opts.Password))
+	}
+	if t.opts.TLS != nil {
+		natsOpts = append(natsOpts, nats.Secure(t.opts.TLS))
+	}
+
+	conn, err := nats.Connect(t.opts.URL, natsOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn, jetstream.WithPublishAsyncTimeout(t.opts.Timeout))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	t.conn = conn
+	t.js = js
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		t.Run(runCtx, t.publish)
+	}()
+
+	if !conn.IsConnected() {
+		return fmt.Errorf("NATS server %s not reachable yet", t.opts.URL)
+	}
+	return nil
+}
+
+// SendHeartbeat publishes a heartbeat right away; heartbeats are not
+// queued, as a late one would be misleading
+func (t *Transport) SendHeartbeat(ctx context.Context) error {
+	msg, err := transport.NewHeartbeatMessage(t.opts.AgentID)
+	if err != nil {
+		return err
+	}
+	return t.publish(ctx, []transport.Message{msg})
+}
+
+// Close stops publishing and closes the connection. Reports not published
+// yet stay queued.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	conn, cancel, done := t.conn, t.cancel, t.done
+	t.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	cancel()
+	<-done
+
+	t.mu.Lock()
+	t.conn = nil
+	t.js = nil
+	t.mu.Unlock()
+	conn.Close()
+	return nil
+}
+
+// publish sends msgs without waiting for each acknowledgement, then waits
+// until the stream has stored all of them
+func (t *Transport) publish(ctx context.Context, msgs []transport.Message) error {
+	t.mu.Lock()
+	js := t.js
+	t.mu.Unlock()
+	if js == nil {
+		return fmt.Errorf("not connected to NATS")
+	}
+
+	futures := make([]jetstream.PubAckFuture, 0, len(msgs))
+	for _, m := range msgs {
+		msg := nats.NewMsg(t.subject(m))
+		msg.Data = m.Payload
+		msg.Header.Set(HeaderAgentID, t.opts.AgentID)
+		if m.Kind != transport.KindHeartbeat {
+			msg.Header.Set(HeaderRouterID, m.Key)
+		}
+		msg.Header.Set(HeaderContentType, contentType)
+		future, err := js.PublishMsgAsync(msg, jetstream.WithMsgID(m.ID))
+		if errors.Is(err, nats.ErrMaxPayload) {
+			return queue.Permanent(fmt.Errorf("failed to publish to NATS: %w", err))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to publish to NATS: %w", err)
+		}
+		futures = append(futures, future)
+	}
+
+	var errs []error
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			errs = append(errs, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("NATS did not store %d of %d messages: %w", len(errs), len(msgs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// subject returns the subject of a message: the prefix, its kind, and the
+// router or agent it is about
+func (t *Transport) subject(m transport.Message) string {
+	return t.opts.SubjectPrefix + "." + m.Kind + "." + subjectToken(m.Key)
+}
+
+func (t *Transport) onError(err error) {
+	if t.opts.OnError != nil {
+		t.opts.OnError(err)
+	}
+}
+
+// subjectToken makes s usable as one subject token, replacing the
+// separator, wildcards and whitespace
+func subjectToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,201 @@
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/transport"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// published is a message received by the fake server
+type published struct {
+	subject string
+	header  textproto.MIMEHeader
+	data    []byte
+}
+
+// server speaks enough of the NATS protocol to acknowledge JetStream
+// publishes the way a stream does
+type server struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	msgs []published
+}
+
+func newServer(t *testing.T) *server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *server) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+
+	subs := make(map[string]string) // Subject prefix by subscription ID
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "SUB":
+			subs[fields[len(fields)-1]] = strings.TrimSuffix(fields[1], "*")
+		case "HPUB":
+			// HPUB <subject> <reply> <header bytes> <total bytes>
+			hdrLen, _ := strconv.Atoi(fields[3])
+			total, _ := strconv.Atoi(fields[4])
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			hr := textproto.NewReader(bufio.NewReader(bytes.NewReader(buf[:hdrLen])))
+			hr.ReadLine() // NATS/1.0
+			header, _ := hr.ReadMIMEHeader()
+
+			s.mu.Lock()
+			s.msgs = append(s.msgs, published{subject: fields[1], header: header, data: buf[hdrLen:total]})
+			seq := len(s.msgs)
+			s.mu.Unlock()
+
+			ack := fmt.Sprintf(`{"stream":"ISPAGENT","seq":%d}`, seq)
+			for sid, prefix := range subs {
+				if strings.HasPrefix(fields[2], prefix) {
+					fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", fields[2], sid, len(ack), ack)
+				}
+			}
+		}
+	}
+}
+
+func (s *server) published() []published {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]published(nil), s.msgs...)
+}
+
+func TestTransport_Publish(t *testing.T) {
+	srv := newServer(t)
+	q, err := queue.Open(queue.Options{Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	tr, err := New(q, Options{
+		URL:           "nats://" + srv.ln.Addr().String(),
+		SubjectPrefix: "isp.",
+		FlushInterval: 10 * time.Millisecond,
+		AgentID:       "agent-1",
+		OnError:       func(err error) { t.Log(err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer tr.Close()
+
+	change := models.Event{
+		Type:       "config_change",
+		Severity:   models.SeverityWarning,
+		Timestamp:  time.Now(),
+		Attributes: map[string]string{"diff": "-/ip firewall filter add chain=input action=drop", "users": "noc"},
+	}
+	if err := tr.SendMetrics(ctx, transport.NewMetricsReport("", &models.MetricsData{RouterID: "bng.1", System: models.SystemMetrics{CPUPercent: 42}, Events: []models.Event{change}}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.SendSessions(ctx, &agentpb.SessionReport{RouterId: "olt-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.SendHeartbeat(ctx); err != nil {
+		t.Fatalf("SendHeartbeat() error = %v", err)
+	}
+
+	// Queued reports are committed once the stream acknowledges them
+	for q.Stats().Records > 0 {
+		if ctx.Err() != nil {
+			t.Fatalf("%d reports not acknowledged", q.Stats().Records)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	msgs := make(map[string]published)
+	for _, m := range srv.published() {
+		msgs[m.subject] = m
+	}
+	tests := []struct {
+		subject string
+		router  string
+		report  proto.Message
+	}{
+		{"isp.metrics.bng_1", "bng.1", &agentpb.MetricsReport{}},
+		{"isp.sessions.olt-1", "olt-1", &agentpb.SessionReport{}},
+		{"isp.heartbeat.agent-1", "", &agentpb.HeartbeatRequest{}},
+	}
+	for _, tt := range tests {
+		m, ok := msgs[tt.subject]
+		if !ok {
+			t.Errorf("nothing published to %s", tt.subject)
+			continue
+		}
+		if m.header.Get("Nats-Msg-Id") == "" {
+			t.Errorf("%s has no Nats-Msg-Id", tt.subject)
+		}
+		if m.header.Get(HeaderAgentID) != "agent-1" || m.header.Get(HeaderRouterID) != tt.router {
+			t.Errorf("%s headers = %v", tt.subject, m.header)
+		}
+		if err := proto.Unmarshal(m.data, tt.report); err != nil {
+			t.Errorf("%s payload: %v", tt.subject, err)
+		}
+	}
+	if report := msgs["isp.metrics.bng_1"]; report.data != nil {
+		var metrics agentpb.MetricsReport
+		proto.Unmarshal(report.data, &metrics)
+		if metrics.AgentId != "agent-1" || metrics.System.GetCpuPercent() != 42 {
+			t.Errorf("metrics report = %v", &metrics)
+		}
+		if len(metrics.Events) != 1 || metrics.Events[0].Type != "config_change" || metrics.Events[0].Attributes["diff"] != change.Attributes["diff"] || metrics.Events[0].Attributes["users"] != "noc" {
+			t.Errorf("metrics report events = %v, want the config_change", metrics.Events)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+)
+
+// Message kinds, which select the topic or subject of a message
+const (
+	KindMetrics   = "metrics"
+	KindSessions  = "sessions"
+	KindHeartbeat = "heartbeat"
+)
+
+// messageVersion is the first byte of an encoded message
+const messageVersion = 1
+
+var errInvalidMessage = errors.New("invalid queued message")
+
+// Message is a report on its way to a message broker
+type Message struct {
+	Kind string
+	// Key is the router ID, or the agent ID for heartbeats. Brokers
+	// partition messages by it, so the reports of a router stay in order.
+	Key string
+	// ID is unique per report, so brokers and consumers can drop the
+	// duplicates at-least-once delivery produces
+	ID   string
+	Time time.Time
+	// Payload is the protobuf-encoded report
+	Payload []byte
+}
+
+// NewMessage encodes a report as a message of kind, keyed by key
+func NewMessage(kind, key string, report proto.Message) (Message, error) {
+	payload, err := proto.Marshal(report)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode %s report: %w", kind, err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Message{
+		Kind:    kind,
+		Key:     key,
+		ID:      hex.EncodeToString(id),
+		Time:    time.Now(),
+		Payload: payload,
+	}, nil
+}
+
+// NewHeartbeatMessage returns a heartbeat of the agent
+func NewHeartbeatMessage(agentID string) (Message, error) {
+	return NewMessage(KindHeartbeat, agentID, &agentpb.HeartbeatRequest{
+		AgentId:   agentID,
+		Timestamp: timestamppb.Now(),
+	})
+}
+
+// MarshalBinary encodes the message as a queue record
+func (m Message) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 64+len(m.Payload))
+	b = append(b, messageVersion)
+	for _, s := range []string{m.Kind, m.Key, m.ID} {
+		b = binary.AppendUvarint(b, uint64(len(s)))
+		b = append(b, s...)
+	}
+	b = binary.AppendVarint(b, m.Time.UnixNano())
+	b = binary.AppendUvarint(b, uint64(len(m.Payload)))
+	return append(b, m.Payload...), nil
+}
+
+// UnmarshalBinary decodes a queue record written by MarshalBinary
+func (m *Message) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || b[0] != messageVersion {
+		return errInvalidMessage
+	}
+	b = b[1:]
+	next := func() ([]byte, bool) {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || n > uint64(len(b)-size) {
+			return nil, false
+		}
+		field := b[size : size+int(n)]
+		b = b[size+int(n):]
+		return field, true
+	}
+
+	var fields [3][]byte
+	for i := range fields {
+		field, ok := next()
+		if !ok {
+			return errInvalidMessage
+		}
+		fields[i] = field
+	}
+	nanos, size := binary.Varint(b)
+	if size <= 0 {
+		return errInvalidMessage
+	}
+	b = b[size:]
+	payload, ok := next()
+	if !ok || len(b) != 0 {
+		return errInvalidMessage
+	}
+
+	*m = Message{
+		Kind:    string(fields[0]),
+		Key:     string(fields[1]),
+		ID:      string(fields[2]),
+		Time:    time.Unix(0, nanos),
+		Payload: payload,
+	}
+	return nil
+}
+
+// OutboxOptions configures an Outbox
+type OutboxOptions struct {
+	// AgentID is set in every report
+	AgentID string
+	// BatchSize is the most messages published at once
+	BatchSize int
+	// FlushInterval is the longest a message waits for a batch to fill
+	FlushInterval time.Duration
+	// OnError is called when messages cannot be queued or published
+	OnError func(err error)
+}
+
+// Outbox queues reports on disk until a broker accepts them, so reports
+// collected while the broker is unreachable are published once it is
+// back. Delivery is at least once: a batch is published again until the
+// broker accepts all of it.
+type Outbox struct {
+	queue *queue.Queue
+	opts  OutboxOptions
+}
+
+// NewOutbox creates an outbox queueing to q, which it does not close
+func NewOutbox(q *queue.Queue, opts OutboxOptions) *Outbox {
+	return &Outbox{queue: q, opts: opts}
+}
+
+// SendMetrics queues a metrics report
+func (o *Outbox) SendMetrics(ctx context.Context, report *agentpb.MetricsReport) error {
+	if report.AgentId == "" {
+		report.AgentId = o.opts.AgentID
+	}
+	return o.push(KindMetrics, report.RouterId, report)
+}
+
+// SendSessions queues a session report
+func (o *Outbox) SendSessions(ctx context.Context, report *agentpb.SessionReport) error {
+	if report.AgentId == "" {
+		report.AgentId = o.opts.AgentID
+	}
+	return o.push(KindSessions, report.RouterId, report)
+}
+
+func (o *Outbox) push(kind, key string, report proto.Message) error {
+	msg, err := NewMessage(kind, key, report)
+	if err != nil {
+		return err
+	}
+	record, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := o.queue.Push(record); err != nil {
+		return fmt.Errorf("failed to queue %s report: %w", kind, err)
+	}
+	return nil
+}
+
+// Run hands queued messages to publish in batches until ctx is done,
+// retrying with backoff while publish fails. Batches publish rejects with
+// an error wrapped by queue.Permanent are dropped.
+func (o *Outbox) Run(ctx context.Context, publish func(ctx context.Context, msgs []Message) error) {
+	o.queue.Deliver(ctx, queue.DeliverOptions{
+		BatchSize:     o.opts.BatchSize,
+		FlushInterval: o.opts.FlushInterval,
+		OnError: func(err error, dropped int) {
+			if dropped > 0 {
+				err = fmt.Errorf("%w (dropped %d messages)", err, dropped)
+			}
+			o.onError(err)
+		},
+	}, func(ctx context.Context, records [][]byte) error {
+		msgs := make([]Message, 0, len(records))
+		for _, record := range records {
+			var msg Message
+			if err := msg.UnmarshalBinary(record); err != nil {
+				o.onError(err)
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		return publish(ctx, msgs)
+	})
+}
+
+func (o *Outbox) onError(err error) {
+	if o.opts.OnError != nil {
+		o.opts.OnError(err)
+	}
+}
@@ -0,0 +1,155 @@
+package transport
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+// NewMetricsReport converts collected metrics to the report sent to the
+// server, redacting subscriber details in event messages and attributes
+func NewMetricsReport(agentID string, data *models.MetricsData, r *privacy.Redactor) *agentpb.MetricsReport {
+	if r == nil {
+		r = privacy.NewRedactor(false, false)
+	}
+	report := &agentpb.MetricsReport{
+		AgentId:   agentID,
+		RouterId:  data.RouterID,
+		Timestamp: timestamppb.New(data.Timestamp),
+		System: &agentpb.SystemMetrics{
+			CpuPercent:         data.System.CPUPercent,
+			MemoryPercent:      data.System.MemoryPercent,
+			MemoryTotalBytes:   data.System.MemoryTotalBytes,
+			MemoryUsedBytes:    data.System.MemoryUsedBytes,
+			UptimeSeconds:      data.System.UptimeSeconds,
+			TemperatureCelsius: data.System.TemperatureCelsius,
+			FirmwareVersion:    data.System.FirmwareVersion,
+			BoardName:          data.System.BoardName,
+		},
+		CustomMetrics: data.CustomMetrics,
+	}
+	for _, iface := range data.Interfaces {
+		report.Interfaces = append(report.Interfaces, &agentpb.InterfaceMetrics{
+			Name:        iface.Name,
+			Description: iface.Description,
+			IsUp:        iface.IsUp,
+			SpeedMbps:   iface.SpeedMbps,
+			RxBytes:     iface.RxBytes,
+			TxBytes:     iface.TxBytes,
+			RxPackets:   iface.RxPackets,
+			TxPackets:   iface.TxPackets,
+			RxErrors:    iface.RxErrors,
+			TxErrors:    iface.TxErrors,
+			RxDrops:     iface.RxDrops,
+			TxDrops:     iface.TxDrops,
+		})
+	}
+	for _, e := range data.Events {
+		e = r.RedactEvent(e)
+		report.Events = append(report.Events, &agentpb.Event{
+			Type:       e.Type,
+			Severity:   e.Severity,
+			Message:    e.Message,
+			Timestamp:  timestamppb.New(e.Timestamp),
+			Attributes: e.Attributes,
+		})
+	}
+	return report
+}
+
+// NewSessionReport converts the PPPoE sessions, NAT connections, DHCP
+// leases and NAT top sources of a MikroTik collection to the report sent to
+// the server, redacting subscriber details. It returns nil if none were
+// collected.
+func NewSessionReport(agentID string, data *mikrotik.CollectedData, r *privacy.Redactor) *agentpb.SessionReport {
+	var topSources []mikrotik.NATTalker
+	if data.NATAggregates != nil {
+		topSources = data.NATAggregates.Sources.All()
+	}
+	if data.PPPoE == nil && data.NAT == nil && data.DHCPLeases == nil && len(topSources) == 0 {
+		return nil
+	}
+	if r == nil {
+		r = privacy.NewRedactor(false, false)
+	}
+	at := data.CollectedAt
+	if at.IsZero() {
+		at = data.Timestamp
+	}
+
+	report := &agentpb.SessionReport{
+		AgentId:   agentID,
+		RouterId:  data.RouterID,
+		Timestamp: timestamppb.New(at),
+	}
+	for _, s := range data.PPPoE {
+		id := s.SessionID
+		if id == "" {
+			id = s.ID
+		}
+		report.PppoeSessions = append(report.PppoeSessions, &agentpb.PPPoESession{
+			SessionId:          id,
+			Username:           r.RedactUsername(s.Username),
+			CallingStationId:   redactMAC(s.CallerID, r),
+			FramedIp:           r.RedactIPAddress(s.Address),
+			SessionTimeSeconds: s.Uptime,
+			BytesIn:            s.RxBytes,
+			BytesOut:           s.TxBytes,
+			Status:             "active",
+			ConnectTime:        timestamppb.New(at.Add(-time.Duration(s.Uptime) * time.Second)),
+		})
+	}
+	for _, c := range data.NAT {
+		report.NatSessions = append(report.NatSessions, &agentpb.NATSession{
+			Protocol:          c.Protocol,
+			SrcAddress:        r.RedactIPAddress(c.SrcAddress),
+			SrcPort:           int32(c.SrcPort),
+			DstAddress:        r.RedactIPAddress(c.DstAddress),
+			DstPort:           int32(c.DstPort),
+			TranslatedAddress: r.RedactIPAddress(c.ReplyDstAddr),
+			TranslatedPort:    int32(c.ReplyDstPort),
+			Bytes:             c.RxBytes + c.TxBytes,
+			Packets:           c.RxPackets + c.TxPackets,
+		})
+	}
+	for _, l := range data.DHCPLeases {
+		lease := &agentpb.DHCPLease{
+			MacAddress: redactMAC(l.MACAddress, r),
+			IpAddress:  r.RedactIPAddress(l.Address),
+			Hostname:   r.RedactUsername(l.Hostname),
+			Status:     l.Status,
+		}
+		if !l.ExpiresAt.IsZero() {
+			lease.LeaseEnd = timestamppb.New(l.ExpiresAt)
+		}
+		report.DhcpLeases = append(report.DhcpLeases, lease)
+	}
+	// Sources redacted alike are reported once, with their totals
+	bySource := make(map[string]*agentpb.NATTopSource)
+	for _, t := range topSources {
+		address := r.RedactIPAddress(t.Key)
+		if s, ok := bySource[address]; ok {
+			s.Bytes += t.Bytes
+			s.Connections += int32(t.Connections)
+			continue
+		}
+		s := &agentpb.NATTopSource{Address: address, Bytes: t.Bytes, Connections: int32(t.Connections)}
+		bySource[address] = s
+		report.NatTopSources = append(report.NatTopSources, s)
+	}
+	return report
+}
+
+// redactMAC redacts a MAC address along with IP addresses, as both
+// identify a subscriber's device
+func redactMAC(mac string, r *privacy.Redactor) string {
+	if r.ShouldRedactIPAddresses() {
+		return r.RedactMACAddress(mac)
+	}
+	return mac
+}
@@ -3,7 +3,7 @@ package transport
 import (
 	"context"
 
-	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
 )
 
 // Transport defines the interface for sending data to the server
@@ -11,8 +11,11 @@ type Transport interface {
 	// Connect establishes a connection to the server
 	Connect(ctx context.Context) error
 
-	// SendMetrics sends metrics data to the server
-	SendMetrics(ctx context.Context, data *models.MetricsData) error
+	// SendMetrics sends the metrics of a router to the server
+	SendMetrics(ctx context.Context, report *agentpb.MetricsReport) error
+
+	// SendSessions sends the sessions of a router to the server
+	SendSessions(ctx context.Context, report *agentpb.SessionReport) error
 
 	// SendHeartbeat sends a heartbeat to the server
 	SendHeartbeat(ctx context.Context) error
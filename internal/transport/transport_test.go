@@ -0,0 +1,257 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/api/proto/agentpb"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/collector/mikrotik"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/privacy"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/internal/queue"
+	"github.com/MohamadKhaledAbbas/ISPVisualMonitor-Agent/pkg/models"
+)
+
+func TestMessage_MarshalBinary(t *testing.T) {
+	msg, err := NewMessage(KindMetrics, "router-1", &agentpb.MetricsReport{RouterId: "router-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Message
+	if err := got.UnmarshalBinary(record); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if got.Kind != msg.Kind || got.Key != msg.Key || got.ID != msg.ID || !got.Time.Equal(msg.Time) || string(got.Payload) != string(msg.Payload) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", got, msg)
+	}
+
+	tests := []struct {
+		name   string
+		record []byte
+	}{
+		{"empty", nil},
+		{"unknown version", append([]byte{9}, record[1:]...)},
+		{"truncated", record[:len(record)-1]},
+		{"trailing data", append(append([]byte{}, record...), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Message
+			if err := m.UnmarshalBinary(tt.record); err == nil {
+				t.Error("UnmarshalBinary() error = nil")
+			}
+		})
+	}
+}
+
+func TestNewMetricsReport_Events(t *testing.T) {
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := &models.MetricsData{
+		RouterID: "bng-1",
+		Events: []models.Event{{
+			Type:       "router_log",
+			Severity:   "warning",
+			Message:    "login failure for user admin",
+			Timestamp:  at,
+			Attributes: map[string]string{"topics": "system,error,critical"},
+		}},
+	}
+
+	report := NewMetricsReport("agent-1", data, nil)
+	if len(report.Events) != 1 {
+		t.Fatalf("Events = %d, want 1", len(report.Events))
+	}
+	e := report.Events[0]
+	if e.Type != "router_log" || e.Severity != "warning" || e.Message != "login failure for user admin" || !e.Timestamp.AsTime().Equal(at) || e.Attributes["topics"] != "system,error,critical" {
+		t.Errorf("Events[0] = %+v", e)
+	}
+
+	payload, err := proto.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got agentpb.MetricsReport
+	if err := proto.Unmarshal(payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&got, report) {
+		t.Errorf("round trip = %+v, want %+v", &got, report)
+	}
+}
+
+func TestNewMetricsReport_RedactsEvents(t *testing.T) {
+	data := &models.MetricsData{
+		RouterID: "bng-1",
+		Events: []models.Event{
+			{Type: "router_log", Message: "<pppoe-alice>: authenticated, 100.64.0.10"},
+			{Type: "router_log", Message: "alice logged in, 100.64.0.10 from AA:BB:CC:00:00:01"},
+			{Type: "mac_move", Message: "Host 100.64.0.10 moved", Attributes: map[string]string{"mac_address": "AA:BB:CC:00:00:01", "address": "2001:db8:1234:5678::10"}},
+		},
+	}
+
+	r := privacy.NewRedactor(true, true)
+	payload, err := proto.Marshal(NewMetricsReport("agent-1", data, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"alice", "100.64.0.10", "AA:BB:CC:00:00:01", "2001:db8:1234:5678::10"} {
+		if bytes.Contains(payload, []byte(raw)) {
+			t.Errorf("report contains %s", raw)
+		}
+	}
+	if data.Events[2].Attributes["address"] != "2001:db8:1234:5678::10" {
+		t.Error("collected event attributes were modified")
+	}
+}
+
+func TestNewSessionReport(t *testing.T) {
+	collected := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := &mikrotik.CollectedData{
+		MetricsData: &models.MetricsData{RouterID: "bng-1"},
+		PPPoE: []mikrotik.PPPoESession{
+			{ID: "*1", Username: "alice", CallerID: "AA:BB:CC:00:00:01", Address: "100.64.0.10", Uptime: 3600, RxBytes: 10, TxBytes: 20},
+		},
+		NAT: []mikrotik.NATConnection{
+			{Protocol: "tcp", SrcAddress: "100.64.0.10", SrcPort: 50000, DstAddress: "1.1.1.1", DstPort: 443, ReplyDstAddr: "203.0.113.1", ReplyDstPort: 40000, RxBytes: 5, TxBytes: 6},
+		},
+		DHCPLeases: []mikrotik.DHCPLease{
+			{MACAddress: "AA:BB:CC:00:00:02", Address: "192.168.88.10", Hostname: "laptop", Status: "bound"},
+		},
+		CollectedAt: collected,
+	}
+
+	if report := NewSessionReport("agent-1", &mikrotik.CollectedData{MetricsData: &models.MetricsData{}}, nil); report != nil {
+		t.Errorf("NewSessionReport() without sessions = %v, want nil", report)
+	}
+
+	r := privacy.NewRedactor(true, true)
+	report := NewSessionReport("agent-1", data, r)
+	if report.AgentId != "agent-1" || report.RouterId != "bng-1" || !report.Timestamp.AsTime().Equal(collected) {
+		t.Errorf("report header = %s %s %v", report.AgentId, report.RouterId, report.Timestamp.AsTime())
+	}
+
+	session := report.PppoeSessions[0]
+	if session.Username != r.RedactUsername("alice") || session.FramedIp != r.RedactIPAddress("100.64.0.10") ||
+		session.CallingStationId != r.RedactMACAddress("AA:BB:CC:00:00:01") {
+		t.Errorf("PPPoE session not redacted: %v", session)
+	}
+	if !session.ConnectTime.AsTime().Equal(collected.Add(-time.Hour)) || session.BytesIn != 10 || session.BytesOut != 20 {
+		t.Errorf("PPPoE session = %v", session)
+	}
+
+	nat := report.NatSessions[0]
+	// The public address and the destination identify the subscriber too
+	if nat.SrcAddress != r.RedactIPAddress("100.64.0.10") || nat.DstAddress != r.RedactIPAddress("1.1.1.1") ||
+		nat.TranslatedAddress != r.RedactIPAddress("203.0.113.1") || nat.TranslatedPort != 40000 || nat.Bytes != 11 {
+		t.Errorf("NAT session = %v", nat)
+	}
+
+	lease := report.DhcpLeases[0]
+	if lease.Hostname != r.RedactUsername("laptop") || lease.IpAddress != r.RedactIPAddress("192.168.88.10") || lease.Status != "bound" {
+		t.Errorf("DHCP lease = %v", lease)
+	}
+}
+
+func TestNATTopSourcesRedacted(t *testing.T) {
+	agg := &mikrotik.NATAggregates{
+		Sources: mikrotik.NATTopList{
+			ByBytes:       []mikrotik.NATTalker{{Key: "100.64.0.10", Connections: 5, Bytes: 2000}, {Key: "100.64.0.11", Connections: 9, Bytes: 1000}},
+			ByConnections: []mikrotik.NATTalker{{Key: "100.64.0.11", Connections: 9, Bytes: 1000}, {Key: "100.64.0.10", Connections: 5, Bytes: 2000}},
+		},
+		DestinationPorts: mikrotik.NATTopList{ByBytes: []mikrotik.NATTalker{{Key: "tcp/443", Connections: 14, Bytes: 3000}}},
+	}
+	data := &mikrotik.CollectedData{
+		MetricsData:   &models.MetricsData{RouterID: "bng-1", CustomMetrics: agg.Metrics()},
+		NATAggregates: agg,
+	}
+
+	r := privacy.NewRedactor(false, true)
+	metrics, err := proto.Marshal(NewMetricsReport("agent-1", data.MetricsData, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewSessionReport("agent-1", data, r)
+	sessions, err := proto.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"100.64.0.10", "100.64.0.11"} {
+		if bytes.Contains(metrics, []byte(raw)) || bytes.Contains(sessions, []byte(raw)) {
+			t.Errorf("report contains %s", raw)
+		}
+	}
+
+	// Both sources redact to the same address and are summed
+	if len(report.NatTopSources) != 1 {
+		t.Fatalf("NatTopSources = %v, want one", report.NatTopSources)
+	}
+	if s := report.NatTopSources[0]; s.Address != "100.64.xxx.xxx" || s.Bytes != 3000 || s.Connections != 14 {
+		t.Errorf("NatTopSources[0] = %v", s)
+	}
+}
+
+func TestOutbox_Run(t *testing.T) {
+	q, err := queue.Open(queue.Options{Directory: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	outbox := NewOutbox(q, OutboxOptions{AgentID: "agent-1", BatchSize: 10, FlushInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+	if err := outbox.SendMetrics(ctx, NewMetricsReport("", &models.MetricsData{RouterID: "r1", System: models.SystemMetrics{CPUPercent: 12}}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.SendSessions(ctx, &agentpb.SessionReport{RouterId: "r2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		attempts int
+		got      []Message
+	)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	go func() {
+		for q.Stats().Records > 0 && ctx.Err() == nil {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	outbox.Run(ctx, func(_ context.Context, msgs []Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// The first attempt fails, so the batch is published again
+		if attempts++; attempts == 1 {
+			return errors.New("broker unavailable")
+		}
+		got = append(got, msgs...)
+		return nil
+	})
+
+	if attempts != 2 || len(got) != 2 {
+		t.Fatalf("published %d messages in %d attempts, want 2 in 2", len(got), attempts)
+	}
+
+	var metrics agentpb.MetricsReport
+	if got[0].Kind != KindMetrics || got[0].Key != "r1" || proto.Unmarshal(got[0].Payload, &metrics) != nil ||
+		metrics.AgentId != "agent-1" || metrics.System.CpuPercent != 12 {
+		t.Errorf("metrics message = %+v (%v)", got[0], &metrics)
+	}
+	var sessions agentpb.SessionReport
+	if got[1].Kind != KindSessions || got[1].Key != "r2" || proto.Unmarshal(got[1].Payload, &sessions) != nil ||
+		sessions.AgentId != "agent-1" {
+		t.Errorf("sessions message = %+v (%v)", got[1], &sessions)
+	}
+}
@@ -31,36 +31,58 @@ type CollectorFlags struct {
 
 // MetricsData represents collected metrics from a router
 type MetricsData struct {
-	RouterID  string
-	Timestamp time.Time
-	System    SystemMetrics
-	Interfaces []InterfaceMetrics
+	RouterID   string             `json:"router_id"`
+	Timestamp  time.Time          `json:"timestamp"`
+	System     SystemMetrics      `json:"system"`
+	Interfaces []InterfaceMetrics `json:"interfaces,omitempty"`
+	// CustomMetrics holds collector-specific values keyed by metric name,
+	// carried in MetricsReport.custom_metrics
+	CustomMetrics map[string]float64 `json:"custom_metrics,omitempty"`
+	// Events holds changes detected since the previous collection
+	Events []Event `json:"events,omitempty"`
+}
+
+// Event severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event represents a discrete occurrence detected during collection, such as
+// a MAC address moving between ports
+type Event struct {
+	Type       string            `json:"type"`
+	Severity   string            `json:"severity"`
+	Message    string            `json:"message"`
+	Timestamp  time.Time         `json:"timestamp"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // SystemMetrics represents router system metrics
 type SystemMetrics struct {
-	CPUPercent        float64
-	MemoryPercent     float64
-	MemoryTotalBytes  int64
-	MemoryUsedBytes   int64
-	UptimeSeconds     int64
-	TemperatureCelsius float64
-	FirmwareVersion   string
-	BoardName         string
+	CPUPercent         float64 `json:"cpu_percent"`
+	MemoryPercent      float64 `json:"memory_percent"`
+	MemoryTotalBytes   int64   `json:"memory_total_bytes"`
+	MemoryUsedBytes    int64   `json:"memory_used_bytes"`
+	UptimeSeconds      int64   `json:"uptime_seconds"`
+	TemperatureCelsius float64 `json:"temperature_celsius,omitempty"`
+	FirmwareVersion    string  `json:"firmware_version,omitempty"`
+	BoardName          string  `json:"board_name,omitempty"`
 }
 
 // InterfaceMetrics represents network interface metrics
 type InterfaceMetrics struct {
-	Name        string
-	Description string
-	IsUp        bool
-	SpeedMbps   int64
-	RxBytes     int64
-	TxBytes     int64
-	RxPackets   int64
-	TxPackets   int64
-	RxErrors    int64
-	TxErrors    int64
-	RxDrops     int64
-	TxDrops     int64
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	IsUp        bool   `json:"is_up"`
+	SpeedMbps   int64  `json:"speed_mbps,omitempty"`
+	RxBytes     int64  `json:"rx_bytes"`
+	TxBytes     int64  `json:"tx_bytes"`
+	RxPackets   int64  `json:"rx_packets"`
+	TxPackets   int64  `json:"tx_packets"`
+	RxErrors    int64  `json:"rx_errors"`
+	TxErrors    int64  `json:"tx_errors"`
+	RxDrops     int64  `json:"rx_drops"`
+	TxDrops     int64  `json:"tx_drops"`
 }